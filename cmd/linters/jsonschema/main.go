@@ -6,7 +6,7 @@ import (
 	"os"
 	"path/filepath"
 
-	linter "github.com/grafana/mcp-grafana/internal/linter/jsonschema"
+	linter "mcp-grafana-local/internal/linter/jsonschema"
 )
 
 func main() {
@@ -54,4 +54,4 @@ func main() {
 	if len(jsonLinter.Errors) > 0 {
 		os.Exit(1)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	mcpgrafana "mcp-grafana-local"
+	"mcp-grafana-local/tools"
+)
+
+// dashboardCommands are the subcommands exporting and importing dashboards
+// without running the server. They read the Grafana URL and API key from the
+// same environment variables as the stdio transport.
+var dashboardCommands = map[string]func(ctx context.Context, args []string) (any, error){
+	"export-dashboards": exportDashboardsCommand,
+	"import-dashboards": importDashboardsCommand,
+}
+
+// splitList splits a comma separated flag value.
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+func exportDashboardsCommand(ctx context.Context, args []string) (any, error) {
+	fs := flag.NewFlagSet("export-dashboards", flag.ExitOnError)
+	dir := fs.String("dir", "dashboards", "The directory to write the dashboards to")
+	folders := fs.String("folder", "", "A comma separated list of folder UIDs to export the dashboards of")
+	tags := fs.String("tag", "", "A comma separated list of tags the exported dashboards must have")
+	prune := fs.Bool("prune", false, "Delete the files of dashboards which weren't exported, e.g. because they were deleted or moved")
+	_ = fs.Parse(args)
+
+	return tools.ExportDashboardsTool(ctx, tools.ExportDashboardsParams{
+		Directory:  *dir,
+		FolderUIDs: splitList(*folders),
+		Tags:       splitList(*tags),
+		Prune:      *prune,
+	})
+}
+
+func importDashboardsCommand(ctx context.Context, args []string) (any, error) {
+	fs := flag.NewFlagSet("import-dashboards", flag.ExitOnError)
+	dir := fs.String("dir", "dashboards", "The directory to read the dashboards from")
+	apply := fs.Bool("apply", false, "Save the changed dashboards. Otherwise only print the changes")
+	message := fs.String("message", "", "The version history message of the saved dashboards")
+	_ = fs.Parse(args)
+
+	return tools.ImportDashboardsTool(ctx, tools.ImportDashboardsParams{
+		Directory: *dir,
+		Apply:     *apply,
+		Message:   *message,
+	})
+}
+
+// runDashboardCommand runs a dashboard subcommand and prints its result as
+// JSON.
+func runDashboardCommand(name string, args []string) error {
+	command := dashboardCommands[name]
+	ctx := mcpgrafana.ComposedStdioContextFunc(false)(context.Background())
+	result, err := command(ctx, args)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(result)
+}
@@ -5,6 +5,7 @@ import (
 	"flag"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
 	"slices"
 	"strings"
@@ -39,7 +40,7 @@ type disabledTools struct {
 
 	search, datasource, incident,
 	prometheus, loki, alerting,
-	dashboard, oncall, asserts, sift, admin, file bool
+	dashboard, folder, annotation, oncall, asserts, sift, admin, file bool
 }
 
 // Configuration for the Grafana client.
@@ -49,7 +50,7 @@ type grafanaConfig struct {
 }
 
 func (dt *disabledTools) addFlags() {
-	flag.StringVar(&dt.enabledTools, "enabled-tools", "search,datasource,incident,prometheus,loki,alerting,dashboard,oncall,asserts,sift,admin,file", "A comma separated list of tools enabled for this server. Can be overwritten entirely or by disabling specific components, e.g. --disable-search.")
+	flag.StringVar(&dt.enabledTools, "enabled-tools", "search,datasource,incident,prometheus,loki,alerting,dashboard,folder,annotation,oncall,asserts,sift,admin,file", "A comma separated list of tools enabled for this server. Can be overwritten entirely or by disabling specific components, e.g. --disable-search.")
 
 	flag.BoolVar(&dt.search, "disable-search", false, "Disable search tools")
 	flag.BoolVar(&dt.datasource, "disable-datasource", false, "Disable datasource tools")
@@ -58,6 +59,8 @@ func (dt *disabledTools) addFlags() {
 	flag.BoolVar(&dt.loki, "disable-loki", false, "Disable loki tools")
 	flag.BoolVar(&dt.alerting, "disable-alerting", false, "Disable alerting tools")
 	flag.BoolVar(&dt.dashboard, "disable-dashboard", false, "Disable dashboard tools")
+	flag.BoolVar(&dt.folder, "disable-folder", false, "Disable folder tools")
+	flag.BoolVar(&dt.annotation, "disable-annotation", false, "Disable annotation tools")
 	flag.BoolVar(&dt.oncall, "disable-oncall", false, "Disable oncall tools")
 	flag.BoolVar(&dt.asserts, "disable-asserts", false, "Disable asserts tools")
 	flag.BoolVar(&dt.sift, "disable-sift", false, "Disable sift tools")
@@ -69,6 +72,30 @@ func (gc *grafanaConfig) addFlags() {
 	flag.BoolVar(&gc.debug, "debug", false, "Enable debug mode for the Grafana transport")
 }
 
+// prometheusConfig holds the guardrails for the Prometheus queries run by
+// tools.
+type prometheusConfig struct {
+	guardrails mcpgrafana.PrometheusGuardrails
+}
+
+func (pc *prometheusConfig) addFlags() {
+	pc.guardrails = mcpgrafana.DefaultPrometheusGuardrails
+	flag.IntVar(&pc.guardrails.MaxPointsPerSeries, "prometheus-max-points", pc.guardrails.MaxPointsPerSeries, "Maximum number of points per series of Prometheus range queries, or 0 for no limit")
+	flag.DurationVar(&pc.guardrails.MaxRange, "prometheus-max-range", pc.guardrails.MaxRange, "Maximum time range of Prometheus range queries and of range selectors, or 0 for no limit")
+	flag.IntVar(&pc.guardrails.MaxSeries, "prometheus-max-series", pc.guardrails.MaxSeries, "If set, count the series selected by Prometheus queries with the series API first, and reject queries selecting more")
+	flag.BoolVar(&pc.guardrails.AllowUnboundedSelectors, "prometheus-allow-unbounded-selectors", pc.guardrails.AllowUnboundedSelectors, "Allow Prometheus selectors without a metric name")
+}
+
+// stdioContextFunc adds the guardrails to the context of stdio requests.
+func (pc prometheusConfig) stdioContextFunc(ctx context.Context) context.Context {
+	return mcpgrafana.WithPrometheusGuardrails(ctx, pc.guardrails)
+}
+
+// httpContextFunc adds the guardrails to the context of HTTP requests.
+func (pc prometheusConfig) httpContextFunc(ctx context.Context, _ *http.Request) context.Context {
+	return mcpgrafana.WithPrometheusGuardrails(ctx, pc.guardrails)
+}
+
 func (dt *disabledTools) addTools(s *server.MCPServer) {
 	enabledTools := strings.Split(dt.enabledTools, ",")
 	maybeAddTools(s, tools.AddSearchTools, enabledTools, dt.search, "search")
@@ -78,6 +105,8 @@ func (dt *disabledTools) addTools(s *server.MCPServer) {
 	maybeAddTools(s, tools.AddLokiTools, enabledTools, dt.loki, "loki")
 	maybeAddTools(s, tools.AddAlertingTools, enabledTools, dt.alerting, "alerting")
 	maybeAddTools(s, tools.AddDashboardTools, enabledTools, dt.dashboard, "dashboard")
+	maybeAddTools(s, tools.AddFolderTools, enabledTools, dt.folder, "folder")
+	maybeAddTools(s, tools.AddAnnotationTools, enabledTools, dt.annotation, "annotation")
 	maybeAddTools(s, tools.AddOnCallTools, enabledTools, dt.oncall, "oncall")
 	maybeAddTools(s, tools.AddAssertsTools, enabledTools, dt.asserts, "asserts")
 	maybeAddTools(s, tools.AddSiftTools, enabledTools, dt.sift, "sift")
@@ -149,20 +178,26 @@ func HandleReadResource(
     }, nil
 }
 
-func run(transport, addr, basePath string, logLevel slog.Level, dt disabledTools, gc grafanaConfig) error {
+func run(transport, addr, basePath string, logLevel slog.Level, dt disabledTools, gc grafanaConfig, pc prometheusConfig) error {
 	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel})))
 	s := newServer(dt)
 
 	switch transport {
 	case "stdio":
 		srv := server.NewStdioServer(s)
-		srv.SetContextFunc(mcpgrafana.ComposedStdioContextFunc(gc.debug))
+		srv.SetContextFunc(mcpgrafana.ComposeStdioContextFuncs(
+			mcpgrafana.ComposedStdioContextFunc(gc.debug),
+			pc.stdioContextFunc,
+		))
 		slog.Info("Starting Grafana MCP server using stdio transport")
 		return srv.Listen(context.Background(), os.Stdin, os.Stdout)
 	
 	case "sse":
 		srv := server.NewSSEServer(s,
-			server.WithHTTPContextFunc(mcpgrafana.ComposedHTTPContextFunc(gc.debug)),
+			server.WithHTTPContextFunc(mcpgrafana.ComposeHTTPContextFuncs(
+				mcpgrafana.ComposedHTTPContextFunc(gc.debug),
+				pc.httpContextFunc,
+			)),
 		)
 		slog.Info("Starting Grafana MCP server using SSE transport", "address", addr)
 		if err := srv.Start(addr); err != nil {
@@ -179,6 +214,16 @@ func run(transport, addr, basePath string, logLevel slog.Level, dt disabledTools
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		if _, ok := dashboardCommands[os.Args[1]]; ok {
+			if err := runDashboardCommand(os.Args[1], os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	var transport string
 	flag.StringVar(&transport, "t", "sse", "Transport type (stdio or sse)")
 	flag.StringVar(
@@ -195,9 +240,11 @@ func main() {
 	dt.addFlags()
 	var gc grafanaConfig
 	gc.addFlags()
+	var pc prometheusConfig
+	pc.addFlags()
 	flag.Parse()
 
-	if err := run(transport, *addr, *basePath, parseLevel(*logLevel), dt, gc); err != nil {
+	if err := run(transport, *addr, *basePath, parseLevel(*logLevel), dt, gc, pc); err != nil {
 		panic(err)
 	}
 }
@@ -0,0 +1,517 @@
+// Package interpolate replaces Grafana template variables in queries,
+// following the syntax and formatting rules Grafana applies in dashboards.
+//
+// It supports the `$var`, `${var}`, `${var:format}` and `[[var]]` forms,
+// multi-value variables, the special `$__all` value, and the built-in
+// variables `$__from`, `$__to`, `$__range`, `$__range_s`, `$__range_ms`,
+// `$__interval`, `$__interval_ms` and `$__rate_interval`.
+package interpolate
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formats that can be applied to variable values with `${var:format}`.
+// See https://grafana.com/docs/grafana/latest/dashboards/variables/variable-syntax/.
+const (
+	FormatCSV           = "csv"
+	FormatDistributed   = "distributed"
+	FormatDoubleQuote   = "doublequote"
+	FormatGlob          = "glob"
+	FormatJSON          = "json"
+	FormatLucene        = "lucene"
+	FormatPercentEncode = "percentencode"
+	FormatPipe          = "pipe"
+	FormatQueryParam    = "queryparam"
+	FormatRaw           = "raw"
+	FormatRegex         = "regex"
+	FormatSingleQuote   = "singlequote"
+	FormatSQLString     = "sqlstring"
+	FormatText          = "text"
+
+	// FormatPrometheus is the default format of the Prometheus and Loki
+	// datasources: single values are used as-is, while multi-value and
+	// include-all variables are regex escaped and joined as `(a|b)`.
+	FormatPrometheus = "prometheus"
+)
+
+// AllValue is the value Grafana uses for the "All" option of a variable.
+const AllValue = "$__all"
+
+const (
+	// DefaultMaxDataPoints is used to compute `$__interval` when neither an
+	// interval nor a number of data points is given. It matches the width
+	// of a typical Grafana panel.
+	DefaultMaxDataPoints = 1000
+
+	// DefaultScrapeInterval is the default minimum interval, and the scrape
+	// interval used for `$__rate_interval`, as in Grafana's Prometheus
+	// datasource.
+	DefaultScrapeInterval = 15 * time.Second
+)
+
+// variablePattern matches the variable syntaxes supported by Grafana. It is
+// the same expression as Grafana's templateSrv uses:
+//
+//   - $var                   (group 1)
+//   - [[var]] or [[var:fmt]] (groups 2 and 3)
+//   - ${var}, ${var.field} or ${var:fmt} (groups 4, 5 and 6)
+var variablePattern = regexp.MustCompile(`\$(\w+)|\[\[(\w+?)(?::(\w+))?\]\]|\$\{(\w+)(?:\.([^:^\}]+))?(?::([^\}]+))?\}`)
+
+// Variable is a template variable and its selected values.
+type Variable struct {
+	Name   string
+	Values []string
+	// Multi and IncludeAll mirror the variable settings of the same name
+	// and change how FormatPrometheus escapes values.
+	Multi      bool
+	IncludeAll bool
+	// AllValue is the custom value used when "All" is selected. It is
+	// inserted verbatim, without any formatting.
+	AllValue string
+	// Options are all values of the variable, used when "All" is selected
+	// and there is no AllValue.
+	Options []string
+}
+
+// Options configures an interpolation.
+type Options struct {
+	Variables map[string]Variable
+
+	// From and To are the query time range. Built-in time variables are only
+	// available if both are set.
+	From, To time.Time
+	// Interval is the value of `$__interval`. If zero, it is computed from
+	// the time range and MaxDataPoints, the same way Grafana does.
+	Interval time.Duration
+	// MaxDataPoints is used to compute the interval. Defaults to
+	// DefaultMaxDataPoints.
+	MaxDataPoints int
+	// MinInterval is the lower bound of the computed interval. Defaults to
+	// DefaultScrapeInterval.
+	MinInterval time.Duration
+	// ScrapeInterval is used to compute `$__rate_interval`. Defaults to
+	// DefaultScrapeInterval.
+	ScrapeInterval time.Duration
+
+	// DefaultFormat is used for references without an explicit format. If
+	// empty, single values are inserted as-is and multiple values use the
+	// glob format, as Grafana does for datasources without a formatter.
+	DefaultFormat string
+}
+
+// Interpolate replaces the variables in query. It returns the interpolated
+// query and the names of the referenced variables that have no value, which
+// are left in place. Unknown built-in variables (names starting with `__`,
+// such as the SQL `$__timeFilter` macro) and capture group references such as
+// `$1` are left to the datasource and not reported.
+func Interpolate(query string, opts Options) (string, []string, error) {
+	builtins := opts.builtins()
+
+	var (
+		unresolved []string
+		seen       = map[string]bool{}
+		firstErr   error
+	)
+	markUnresolved := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			unresolved = append(unresolved, name)
+		}
+	}
+	result := variablePattern.ReplaceAllStringFunc(query, func(match string) string {
+		name, _, format := parseReference(match)
+		if isCaptureReference(name) {
+			return match
+		}
+
+		if b, ok := builtins[name]; ok {
+			value, err := b.format(format)
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			return value
+		}
+
+		v, ok := opts.Variables[name]
+		if !ok || len(v.Values) == 0 {
+			if !strings.HasPrefix(name, "__") {
+				markUnresolved(name)
+			}
+			return match
+		}
+
+		values := v.Values
+		if slices.Contains(values, AllValue) {
+			switch {
+			case v.AllValue != "":
+				return v.AllValue
+			case len(v.Options) > 0:
+				values = v.Options
+			default:
+				markUnresolved(name)
+				return match
+			}
+		}
+
+		if format == "" {
+			format = opts.DefaultFormat
+		}
+		value, err := formatValues(v, values, format)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		return value
+	})
+	if firstErr != nil {
+		return "", nil, firstErr
+	}
+	return result, unresolved, nil
+}
+
+// Variables returns the unique names of the variables referenced in query,
+// in order of first appearance. Built-in variables are not included.
+func Variables(query string) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, match := range variablePattern.FindAllString(query, -1) {
+		name, _, _ := parseReference(match)
+		if strings.HasPrefix(name, "__") || isCaptureReference(name) || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+// Reference is a reference to a variable in a query.
+type Reference struct {
+	Name string
+	// Start and End are the byte offsets of the reference in the query.
+	Start, End int
+}
+
+// References returns the references to variables in query, including
+// built-in variables, in order of appearance.
+func References(query string) []Reference {
+	var refs []Reference
+	for _, loc := range variablePattern.FindAllStringIndex(query, -1) {
+		name, _, _ := parseReference(query[loc[0]:loc[1]])
+		if isCaptureReference(name) {
+			continue
+		}
+		refs = append(refs, Reference{Name: name, Start: loc[0], End: loc[1]})
+	}
+	return refs
+}
+
+// isCaptureReference reports whether a variable name is only made of
+// digits, as in the `$1` capture group references of label_replace and
+// regex replacements. These are never variables.
+func isCaptureReference(name string) bool {
+	for _, r := range name {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// ParseValues splits a variable value given as a string into its values.
+// A value of the form `{a,b,c}`, as produced by Grafana's glob format, is
+// treated as a multi-value selection.
+func ParseValues(value string) []string {
+	if len(value) > 2 && strings.HasPrefix(value, "{") && strings.HasSuffix(value, "}") && strings.Contains(value, ",") {
+		return strings.Split(value[1:len(value)-1], ",")
+	}
+	return []string{value}
+}
+
+// FromMap builds variables from a map of names to values. Values are split
+// with ParseValues, and variables with several values are marked as multi.
+func FromMap(m map[string]string) map[string]Variable {
+	vars := make(map[string]Variable, len(m))
+	for name, value := range m {
+		name = strings.TrimPrefix(name, "$")
+		values := ParseValues(value)
+		vars[name] = Variable{
+			Name:   name,
+			Values: values,
+			Multi:  len(values) > 1,
+		}
+	}
+	return vars
+}
+
+// parseReference returns the variable name, field path and format of a
+// match of variablePattern.
+func parseReference(match string) (name, field, format string) {
+	groups := variablePattern.FindStringSubmatch(match)
+	switch {
+	case groups[1] != "":
+		return groups[1], "", ""
+	case groups[2] != "":
+		return groups[2], "", groups[3]
+	default:
+		return groups[4], groups[5], groups[6]
+	}
+}
+
+// builtin is the value of a built-in variable. Time variables hold a time
+// and accept the `date` formats; the others are plain strings.
+type builtin struct {
+	value string
+	time  time.Time
+}
+
+func (b builtin) format(format string) (string, error) {
+	if b.time.IsZero() {
+		return b.value, nil
+	}
+	switch {
+	case format == "", format == FormatRaw, format == FormatText:
+		return b.value, nil
+	case format == "date", strings.HasPrefix(format, "date:iso"):
+		return b.time.UTC().Format("2006-01-02T15:04:05.000Z"), nil
+	case format == "date:seconds":
+		return strconv.FormatInt(b.time.Unix(), 10), nil
+	case strings.HasPrefix(format, "date:"):
+		return "", fmt.Errorf("unsupported date format %q: use 'date:iso' or 'date:seconds'", strings.TrimPrefix(format, "date:"))
+	}
+	return b.value, nil
+}
+
+// builtins returns the built-in variables available for the options.
+func (opts Options) builtins() map[string]builtin {
+	if opts.From.IsZero() || opts.To.IsZero() {
+		return nil
+	}
+
+	rangeMs := opts.To.Sub(opts.From).Milliseconds()
+	rangeS := int64(math.Round(float64(rangeMs) / 1000))
+
+	interval := opts.Interval
+	if interval == 0 {
+		interval = CalculateInterval(opts.To.Sub(opts.From), opts.MaxDataPoints, opts.MinInterval)
+	}
+	scrape := opts.ScrapeInterval
+	if scrape == 0 {
+		scrape = DefaultScrapeInterval
+	}
+	rateInterval := max(interval+scrape, 4*scrape)
+
+	return map[string]builtin{
+		"__from":          {value: strconv.FormatInt(opts.From.UnixMilli(), 10), time: opts.From},
+		"__to":            {value: strconv.FormatInt(opts.To.UnixMilli(), 10), time: opts.To},
+		"__range":         {value: strconv.FormatInt(rangeS, 10) + "s"},
+		"__range_s":       {value: strconv.FormatInt(rangeS, 10)},
+		"__range_ms":      {value: strconv.FormatInt(rangeMs, 10)},
+		"__interval":      {value: FormatInterval(interval)},
+		"__interval_ms":   {value: strconv.FormatInt(interval.Milliseconds(), 10)},
+		"__rate_interval": {value: FormatInterval(rateInterval)},
+	}
+}
+
+// intervalSteps are the boundaries used by Grafana's roundInterval: a raw
+// interval below the first value is rounded to the second.
+var intervalSteps = []struct {
+	below, rounded time.Duration
+}{
+	{15 * time.Millisecond, 10 * time.Millisecond},
+	{35 * time.Millisecond, 20 * time.Millisecond},
+	{75 * time.Millisecond, 50 * time.Millisecond},
+	{150 * time.Millisecond, 100 * time.Millisecond},
+	{350 * time.Millisecond, 200 * time.Millisecond},
+	{750 * time.Millisecond, 500 * time.Millisecond},
+	{1500 * time.Millisecond, time.Second},
+	{3500 * time.Millisecond, 2 * time.Second},
+	{7500 * time.Millisecond, 5 * time.Second},
+	{12500 * time.Millisecond, 10 * time.Second},
+	{17500 * time.Millisecond, 15 * time.Second},
+	{25 * time.Second, 20 * time.Second},
+	{45 * time.Second, 30 * time.Second},
+	{90 * time.Second, time.Minute},
+	{210 * time.Second, 2 * time.Minute},
+	{450 * time.Second, 5 * time.Minute},
+	{750 * time.Second, 10 * time.Minute},
+	{1050 * time.Second, 15 * time.Minute},
+	{1500 * time.Second, 20 * time.Minute},
+	{2700 * time.Second, 30 * time.Minute},
+	{5400 * time.Second, time.Hour},
+	{9000 * time.Second, 2 * time.Hour},
+	{16200 * time.Second, 3 * time.Hour},
+	{27000 * time.Second, 6 * time.Hour},
+	{86400 * time.Second, 12 * time.Hour},
+	{604800 * time.Second, 24 * time.Hour},
+	{1814400 * time.Second, 7 * 24 * time.Hour},
+	{3628800 * time.Second, 30 * 24 * time.Hour},
+}
+
+// CalculateInterval returns the interval Grafana would use for a query over
+// queryRange with the given number of data points, rounded to a friendly
+// value and no smaller than minInterval.
+func CalculateInterval(queryRange time.Duration, maxDataPoints int, minInterval time.Duration) time.Duration {
+	if maxDataPoints <= 0 {
+		maxDataPoints = DefaultMaxDataPoints
+	}
+	if minInterval <= 0 {
+		minInterval = DefaultScrapeInterval
+	}
+	interval := roundInterval(queryRange / time.Duration(maxDataPoints))
+	if interval < minInterval {
+		return minInterval
+	}
+	return interval
+}
+
+func roundInterval(interval time.Duration) time.Duration {
+	for _, step := range intervalSteps {
+		if interval < step.below {
+			return step.rounded
+		}
+	}
+	return 365 * 24 * time.Hour
+}
+
+// FormatInterval formats d the way Grafana formats intervals, using the
+// largest unit that divides it evenly, e.g. "30s", "5m" or "1d".
+func FormatInterval(d time.Duration) string {
+	if d%time.Second != 0 {
+		return strconv.FormatInt(d.Milliseconds(), 10) + "ms"
+	}
+	units := []struct {
+		suffix string
+		size   time.Duration
+	}{
+		{"y", 365 * 24 * time.Hour},
+		{"w", 7 * 24 * time.Hour},
+		{"d", 24 * time.Hour},
+		{"h", time.Hour},
+		{"m", time.Minute},
+	}
+	for _, u := range units {
+		if d >= u.size && d%u.size == 0 {
+			return strconv.FormatInt(int64(d/u.size), 10) + u.suffix
+		}
+	}
+	return strconv.FormatInt(int64(d/time.Second), 10) + "s"
+}
+
+var (
+	regexSpecialChars      = regexp.MustCompile(`[\\^$*+?.()|\[\]{}/]`)
+	prometheusSpecialChars = regexp.MustCompile(`[$^*{}\[\]'+?.()|]`)
+	luceneSpecialChars     = regexp.MustCompile(`[+\-=&|><!(){}\[\]^"~*?:\\/]`)
+)
+
+// formatValues applies format to the values of v.
+func formatValues(v Variable, values []string, format string) (string, error) {
+	switch format {
+	case "":
+		if len(values) == 1 {
+			return values[0], nil
+		}
+		return "{" + strings.Join(values, ",") + "}", nil
+	case FormatPrometheus:
+		if !v.Multi && !v.IncludeAll && len(values) == 1 {
+			return prometheusRegularEscape(values[0]), nil
+		}
+		escaped := mapValues(values, prometheusSpecialRegexEscape)
+		if len(escaped) == 1 {
+			return escaped[0], nil
+		}
+		return "(" + strings.Join(escaped, "|") + ")", nil
+	case FormatCSV, FormatRaw:
+		return strings.Join(values, ","), nil
+	case FormatDistributed:
+		parts := []string{values[0]}
+		for _, value := range values[1:] {
+			parts = append(parts, v.Name+"="+value)
+		}
+		return strings.Join(parts, ","), nil
+	case FormatDoubleQuote:
+		return strings.Join(mapValues(values, func(s string) string {
+			return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+		}), ","), nil
+	case FormatSingleQuote:
+		return strings.Join(mapValues(values, func(s string) string {
+			return `'` + strings.ReplaceAll(s, `'`, `\'`) + `'`
+		}), ","), nil
+	case FormatSQLString:
+		return strings.Join(mapValues(values, func(s string) string {
+			return `'` + strings.ReplaceAll(s, `'`, `''`) + `'`
+		}), ","), nil
+	case FormatGlob:
+		if len(values) == 1 {
+			return values[0], nil
+		}
+		return "{" + strings.Join(values, ",") + "}", nil
+	case FormatJSON:
+		var b []byte
+		if len(values) == 1 && !v.Multi {
+			b, _ = json.Marshal(values[0])
+		} else {
+			b, _ = json.Marshal(values)
+		}
+		return string(b), nil
+	case FormatLucene:
+		escaped := mapValues(values, func(s string) string {
+			return luceneSpecialChars.ReplaceAllString(s, `\$0`)
+		})
+		if len(escaped) == 1 {
+			return escaped[0], nil
+		}
+		return `("` + strings.Join(escaped, `" OR "`) + `")`, nil
+	case FormatPercentEncode:
+		return strings.Join(mapValues(values, percentEncode), ","), nil
+	case FormatPipe:
+		return strings.Join(values, "|"), nil
+	case FormatQueryParam:
+		return strings.Join(mapValues(values, func(s string) string {
+			return "var-" + percentEncode(v.Name) + "=" + percentEncode(s)
+		}), "&"), nil
+	case FormatRegex:
+		escaped := mapValues(values, func(s string) string {
+			return regexSpecialChars.ReplaceAllString(s, `\$0`)
+		})
+		if len(escaped) == 1 {
+			return escaped[0], nil
+		}
+		return "(" + strings.Join(escaped, "|") + ")", nil
+	case FormatText:
+		return strings.Join(values, " + "), nil
+	}
+	return "", fmt.Errorf("unsupported format %q for variable %s", format, v.Name)
+}
+
+func mapValues(values []string, f func(string) string) []string {
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = f(v)
+	}
+	return out
+}
+
+func percentEncode(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// prometheusRegularEscape escapes a value used inside a quoted PromQL string.
+func prometheusRegularEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s)
+}
+
+// prometheusSpecialRegexEscape escapes a value used inside a quoted PromQL
+// regex matcher, where both the regex and the string need escaping.
+func prometheusSpecialRegexEscape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\\\`)
+	return prometheusSpecialChars.ReplaceAllString(s, `\\$0`)
+}
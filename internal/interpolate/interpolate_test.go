@@ -0,0 +1,213 @@
+//go:build unit
+// +build unit
+
+package interpolate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterpolate(t *testing.T) {
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+
+	vars := map[string]Variable{
+		"job":      {Name: "job", Values: []string{"api"}},
+		"instance": {Name: "instance", Values: []string{"a:9090", "b:9090"}, Multi: true},
+		"env":      {Name: "env", Values: []string{AllValue}, IncludeAll: true, Options: []string{"prod", "dev"}},
+		"cluster":  {Name: "cluster", Values: []string{AllValue}, IncludeAll: true, AllValue: ".*"},
+		"quoted":   {Name: "quoted", Values: []string{"it's"}},
+	}
+
+	testCases := []struct {
+		name       string
+		query      string
+		opts       Options
+		expected   string
+		unresolved []string
+		expectErr  bool
+	}{
+		{
+			name:     "simple syntax",
+			query:    `up{job="$job"}`,
+			expected: `up{job="api"}`,
+		},
+		{
+			name:     "braces syntax",
+			query:    `up{job="${job}"}`,
+			expected: `up{job="api"}`,
+		},
+		{
+			name:     "brackets syntax",
+			query:    `up{job="[[job]]"}`,
+			expected: `up{job="api"}`,
+		},
+		{
+			name:     "name prefix is not replaced",
+			query:    `$job_name`,
+			expected: `$job_name`,
+			unresolved: []string{
+				"job_name",
+			},
+		},
+		{
+			name:     "multi value defaults to glob",
+			query:    `$instance`,
+			expected: `{a:9090,b:9090}`,
+		},
+		{
+			name:     "multi value prometheus format",
+			query:    `up{instance=~"$instance"}`,
+			opts:     Options{DefaultFormat: FormatPrometheus},
+			expected: `up{instance=~"(a:9090|b:9090)"}`,
+		},
+		{
+			name:     "prometheus format escapes regex characters",
+			query:    `up{env=~"$env"}`,
+			opts:     Options{DefaultFormat: FormatPrometheus, Variables: map[string]Variable{"env": {Values: []string{"a.b", "c"}, Multi: true}}},
+			expected: `up{env=~"(a\\.b|c)"}`,
+		},
+		{
+			name:     "prometheus format escapes quotes in single values",
+			query:    `up{name="$quoted"}`,
+			opts:     Options{DefaultFormat: FormatPrometheus},
+			expected: `up{name="it\'s"}`,
+		},
+		{
+			name:     "all expands to options",
+			query:    `${env:csv}`,
+			expected: `prod,dev`,
+		},
+		{
+			name:     "all uses custom all value verbatim",
+			query:    `up{cluster=~"$cluster"}`,
+			opts:     Options{DefaultFormat: FormatPrometheus},
+			expected: `up{cluster=~".*"}`,
+		},
+		{
+			name:     "explicit formats",
+			query:    `${instance:pipe} ${instance:regex} ${instance:singlequote} ${instance:doublequote} ${instance:json}`,
+			expected: `a:9090|b:9090 (a:9090|b:9090) 'a:9090','b:9090' "a:9090","b:9090" ["a:9090","b:9090"]`,
+		},
+		{
+			name:     "sqlstring and lucene",
+			query:    `${quoted:sqlstring} ${instance:lucene}`,
+			expected: `'it''s' ("a\:9090" OR "b\:9090")`,
+		},
+		{
+			name:     "queryparam and distributed",
+			query:    `${instance:queryparam} ${instance:distributed}`,
+			expected: `var-instance=a%3A9090&var-instance=b%3A9090 a:9090,instance=b:9090`,
+		},
+		{
+			name:     "brackets with format",
+			query:    `[[instance:csv]]`,
+			expected: `a:9090,b:9090`,
+		},
+		{
+			name:      "unknown format",
+			query:     `${job:nope}`,
+			expectErr: true,
+		},
+		{
+			name:       "unresolved variables are reported once",
+			query:      `$missing + $missing + $job`,
+			expected:   `$missing + $missing + api`,
+			unresolved: []string{"missing"},
+		},
+		{
+			name:     "capture group references are not variables",
+			query:    `label_replace(up{job="$job"}, "x", "$1", "instance", "(.*):.*")`,
+			expected: `label_replace(up{job="api"}, "x", "$1", "instance", "(.*):.*")`,
+		},
+		{
+			name:     "built-in range variables",
+			query:    `rate(x[$__rate_interval]) $__interval $__interval_ms $__range $__range_s $__range_ms`,
+			opts:     Options{From: from, To: to},
+			expected: `rate(x[1m]) 15s 15000 3600s 3600 3600000`,
+		},
+		{
+			name:     "explicit interval",
+			query:    `rate(x[$__rate_interval]) [$__interval]`,
+			opts:     Options{From: from, To: to, Interval: 5 * time.Minute},
+			expected: `rate(x[315s]) [5m]`,
+		},
+		{
+			name:     "built-in time variables",
+			query:    `$__from ${__to} ${__from:date:iso} ${__to:date:seconds}`,
+			opts:     Options{From: from, To: to},
+			expected: `1735689600000 1735693200000 2025-01-01T00:00:00.000Z 1735693200`,
+		},
+		{
+			name:     "built-ins are left alone without a time range",
+			query:    `rate(x[$__rate_interval])`,
+			expected: `rate(x[$__rate_interval])`,
+		},
+		{
+			name:     "unknown macros are left to the datasource",
+			query:    `SELECT * FROM t WHERE $__timeFilter(time)`,
+			opts:     Options{From: from, To: to},
+			expected: `SELECT * FROM t WHERE $__timeFilter(time)`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := tc.opts
+			if opts.Variables == nil {
+				opts.Variables = vars
+			}
+			result, unresolved, err := Interpolate(tc.query, opts)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, result)
+			assert.Equal(t, tc.unresolved, unresolved)
+		})
+	}
+}
+
+func TestVariables(t *testing.T) {
+	names := Variables(`sum(rate(x{job="$job", env=~"${env:regex}", i="[[instance]]"}[$__rate_interval])) by ($job)`)
+	assert.Equal(t, []string{"job", "env", "instance"}, names)
+	assert.Empty(t, Variables(`label_replace(up, "x", "$1", "instance", "(.*):.*")`))
+}
+
+func TestReferences(t *testing.T) {
+	query := `x{job="$job"}[${__range}] > [[threshold:raw]]`
+	refs := References(query)
+	assert.Equal(t, []Reference{
+		{Name: "job", Start: 7, End: 11},
+		{Name: "__range", Start: 14, End: 24},
+		{Name: "threshold", Start: 28, End: 45},
+	}, refs)
+	assert.Equal(t, "[[threshold:raw]]", query[refs[2].Start:refs[2].End])
+}
+
+func TestFromMap(t *testing.T) {
+	vars := FromMap(map[string]string{"$job": "api", "instance": "{a,b}"})
+	assert.Equal(t, Variable{Name: "job", Values: []string{"api"}}, vars["job"])
+	assert.Equal(t, Variable{Name: "instance", Values: []string{"a", "b"}, Multi: true}, vars["instance"])
+}
+
+func TestCalculateInterval(t *testing.T) {
+	assert.Equal(t, 15*time.Second, CalculateInterval(time.Hour, 0, 0))
+	assert.Equal(t, 10*time.Minute, CalculateInterval(7*24*time.Hour, 0, 0))
+	assert.Equal(t, time.Minute, CalculateInterval(time.Hour, 60, 0))
+	assert.Equal(t, time.Minute, CalculateInterval(time.Hour, 1000, time.Minute))
+}
+
+func TestFormatInterval(t *testing.T) {
+	assert.Equal(t, "500ms", FormatInterval(500*time.Millisecond))
+	assert.Equal(t, "15s", FormatInterval(15*time.Second))
+	assert.Equal(t, "90s", FormatInterval(90*time.Second))
+	assert.Equal(t, "5m", FormatInterval(5*time.Minute))
+	assert.Equal(t, "1d", FormatInterval(24*time.Hour))
+	assert.Equal(t, "1w", FormatInterval(7*24*time.Hour))
+}
@@ -0,0 +1,288 @@
+// Package jsonpatch applies JSON Patch (RFC 6902) operations to decoded JSON
+// documents, i.e. values made of map[string]any, []any and scalars as
+// produced by encoding/json.
+package jsonpatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// The operations defined by RFC 6902.
+const (
+	OpAdd     = "add"
+	OpRemove  = "remove"
+	OpReplace = "replace"
+	OpMove    = "move"
+	OpCopy    = "copy"
+	OpTest    = "test"
+)
+
+// Operation is a single JSON Patch operation. Paths are JSON Pointers
+// (RFC 6901); From is only used by move and copy.
+type Operation struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	From  string `json:"from,omitempty"`
+	Value any    `json:"value,omitempty"`
+}
+
+func (o Operation) String() string {
+	if o.From != "" {
+		return fmt.Sprintf("%s %s to %s", o.Op, o.From, o.Path)
+	}
+	return fmt.Sprintf("%s %s", o.Op, o.Path)
+}
+
+// Apply applies the operations to a copy of doc, in order, and returns the
+// patched document. If any operation fails, an error is returned and doc is
+// left unchanged.
+func Apply(doc any, ops []Operation) (any, error) {
+	doc = deepCopy(doc)
+	for i, op := range ops {
+		var err error
+		if doc, err = apply(doc, op); err != nil {
+			return nil, fmt.Errorf("operation %d (%s): %w", i, op, err)
+		}
+	}
+	return doc, nil
+}
+
+func apply(doc any, op Operation) (any, error) {
+	path, err := ParsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case OpAdd:
+		return add(doc, path, deepCopy(op.Value))
+	case OpRemove:
+		doc, _, err := remove(doc, path)
+		return doc, err
+	case OpReplace:
+		if _, err := get(doc, path); err != nil {
+			return nil, err
+		}
+		return set(doc, path, deepCopy(op.Value))
+	case OpMove, OpCopy:
+		from, err := ParsePointer(op.From)
+		if err != nil {
+			return nil, fmt.Errorf("invalid from: %w", err)
+		}
+		if op.Op == OpCopy {
+			value, err := get(doc, from)
+			if err != nil {
+				return nil, err
+			}
+			return add(doc, path, deepCopy(value))
+		}
+		if len(path) > len(from) && slices.Equal(path[:len(from)], from) {
+			return nil, fmt.Errorf("cannot move a value into one of its children")
+		}
+		doc, value, err := remove(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+	case OpTest:
+		value, err := get(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !Equal(value, op.Value) {
+			return nil, fmt.Errorf("test failed: value is %s", mustMarshal(value))
+		}
+		return doc, nil
+	default:
+		return nil, fmt.Errorf("unknown operation %q, must be one of add, remove, replace, move, copy or test", op.Op)
+	}
+}
+
+// ParsePointer parses a JSON Pointer into its reference tokens. The empty
+// pointer refers to the whole document.
+func ParsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q: must be empty or start with '/'", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// Pointer formats reference tokens as a JSON Pointer, escaping them as
+// needed.
+func Pointer(tokens ...string) string {
+	var b strings.Builder
+	for _, t := range tokens {
+		b.WriteByte('/')
+		b.WriteString(strings.ReplaceAll(strings.ReplaceAll(t, "~", "~0"), "/", "~1"))
+	}
+	return b.String()
+}
+
+// Get returns the value at pointer in doc.
+func Get(doc any, pointer string) (any, error) {
+	path, err := ParsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	return get(doc, path)
+}
+
+// Equal reports whether two decoded JSON values are equal.
+func Equal(a, b any) bool {
+	return string(mustMarshal(a)) == string(mustMarshal(b))
+}
+
+func get(doc any, path []string) (any, error) {
+	current := doc
+	for i, token := range path {
+		switch c := current.(type) {
+		case map[string]any:
+			value, ok := c[token]
+			if !ok {
+				return nil, fmt.Errorf("path %s does not exist", Pointer(path[:i+1]...))
+			}
+			current = value
+		case []any:
+			idx, err := arrayIndex(token, len(c)-1)
+			if err != nil {
+				return nil, fmt.Errorf("path %s: %w", Pointer(path[:i+1]...), err)
+			}
+			current = c[idx]
+		default:
+			return nil, fmt.Errorf("path %s does not exist: %s is not an object or array", Pointer(path[:i+1]...), Pointer(path[:i]...))
+		}
+	}
+	return current, nil
+}
+
+// set replaces the value at path, which must be a valid location, and
+// returns the updated document.
+func set(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	key := path[len(path)-1]
+	switch p := parent.(type) {
+	case map[string]any:
+		p[key] = value
+	case []any:
+		idx, err := arrayIndex(key, len(p)-1)
+		if err != nil {
+			return nil, fmt.Errorf("path %s: %w", Pointer(path...), err)
+		}
+		p[idx] = value
+	default:
+		return nil, fmt.Errorf("path %s does not exist: parent is not an object or array", Pointer(path...))
+	}
+	return doc, nil
+}
+
+func add(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parentPath, key := path[:len(path)-1], path[len(path)-1]
+	parent, err := get(doc, parentPath)
+	if err != nil {
+		return nil, err
+	}
+	switch p := parent.(type) {
+	case map[string]any:
+		p[key] = value
+		return doc, nil
+	case []any:
+		idx := len(p)
+		if key != "-" {
+			if idx, err = arrayIndex(key, len(p)); err != nil {
+				return nil, fmt.Errorf("path %s: %w", Pointer(path...), err)
+			}
+		}
+		return set(doc, parentPath, slices.Insert(slices.Clone(p), idx, value))
+	default:
+		return nil, fmt.Errorf("path %s does not exist: parent is not an object or array", Pointer(path...))
+	}
+}
+
+func remove(doc any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("cannot remove the whole document")
+	}
+	parentPath, key := path[:len(path)-1], path[len(path)-1]
+	parent, err := get(doc, parentPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch p := parent.(type) {
+	case map[string]any:
+		value, ok := p[key]
+		if !ok {
+			return nil, nil, fmt.Errorf("path %s does not exist", Pointer(path...))
+		}
+		delete(p, key)
+		return doc, value, nil
+	case []any:
+		idx, err := arrayIndex(key, len(p)-1)
+		if err != nil {
+			return nil, nil, fmt.Errorf("path %s: %w", Pointer(path...), err)
+		}
+		value := p[idx]
+		doc, err = set(doc, parentPath, slices.Delete(slices.Clone(p), idx, idx+1))
+		return doc, value, err
+	default:
+		return nil, nil, fmt.Errorf("path %s does not exist: parent is not an object or array", Pointer(path...))
+	}
+}
+
+// arrayIndex parses an array index token, which must be between 0 and max.
+func arrayIndex(token string, max int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') || strings.TrimLeft(token, "0123456789") != "" {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	idx, err := strconv.Atoi(token)
+	if err != nil || idx > max {
+		return 0, fmt.Errorf("array index %s out of range", token)
+	}
+	return idx, nil
+}
+
+func deepCopy(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		c := make(map[string]any, len(v))
+		for k, e := range v {
+			c[k] = deepCopy(e)
+		}
+		return c
+	case []any:
+		c := make([]any, len(v))
+		for i, e := range v {
+			c[i] = deepCopy(e)
+		}
+		return c
+	default:
+		return v
+	}
+}
+
+func mustMarshal(value any) []byte {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return []byte(fmt.Sprint(value))
+	}
+	return b
+}
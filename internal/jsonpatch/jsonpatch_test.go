@@ -0,0 +1,189 @@
+//go:build unit
+// +build unit
+
+package jsonpatch
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decode(t *testing.T, s string) any {
+	t.Helper()
+	var v any
+	require.NoError(t, json.Unmarshal([]byte(s), &v))
+	return v
+}
+
+func TestApply(t *testing.T) {
+	// Most cases are taken from the examples in RFC 6902, appendix A.
+	testCases := []struct {
+		name     string
+		doc      string
+		ops      string
+		expected string
+		err      string
+	}{
+		{
+			name:     "add an object member",
+			doc:      `{"foo": "bar"}`,
+			ops:      `[{"op": "add", "path": "/baz", "value": "qux"}]`,
+			expected: `{"baz": "qux", "foo": "bar"}`,
+		},
+		{
+			name:     "add an array element",
+			doc:      `{"foo": ["bar", "baz"]}`,
+			ops:      `[{"op": "add", "path": "/foo/1", "value": "qux"}]`,
+			expected: `{"foo": ["bar", "qux", "baz"]}`,
+		},
+		{
+			name:     "append to an array",
+			doc:      `{"foo": ["bar"]}`,
+			ops:      `[{"op": "add", "path": "/foo/-", "value": ["abc", "def"]}]`,
+			expected: `{"foo": ["bar", ["abc", "def"]]}`,
+		},
+		{
+			name:     "remove an object member",
+			doc:      `{"baz": "qux", "foo": "bar"}`,
+			ops:      `[{"op": "remove", "path": "/baz"}]`,
+			expected: `{"foo": "bar"}`,
+		},
+		{
+			name:     "remove an array element",
+			doc:      `{"foo": ["bar", "qux", "baz"]}`,
+			ops:      `[{"op": "remove", "path": "/foo/1"}]`,
+			expected: `{"foo": ["bar", "baz"]}`,
+		},
+		{
+			name:     "replace a value",
+			doc:      `{"baz": "qux", "foo": "bar"}`,
+			ops:      `[{"op": "replace", "path": "/baz", "value": "boo"}]`,
+			expected: `{"baz": "boo", "foo": "bar"}`,
+		},
+		{
+			name:     "move a value",
+			doc:      `{"foo": {"bar": "baz", "waldo": "fred"}, "qux": {"corge": "grault"}}`,
+			ops:      `[{"op": "move", "from": "/foo/waldo", "path": "/qux/thud"}]`,
+			expected: `{"foo": {"bar": "baz"}, "qux": {"corge": "grault", "thud": "fred"}}`,
+		},
+		{
+			name:     "move an array element",
+			doc:      `{"foo": ["all", "grass", "cows", "eat"]}`,
+			ops:      `[{"op": "move", "from": "/foo/1", "path": "/foo/3"}]`,
+			expected: `{"foo": ["all", "cows", "eat", "grass"]}`,
+		},
+		{
+			name:     "copy a value",
+			doc:      `{"a": {"b": 1}}`,
+			ops:      `[{"op": "copy", "from": "/a", "path": "/c"}, {"op": "replace", "path": "/c/b", "value": 2}]`,
+			expected: `{"a": {"b": 1}, "c": {"b": 2}}`,
+		},
+		{
+			name:     "test a value",
+			doc:      `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+			ops:      `[{"op": "test", "path": "/baz", "value": "qux"}, {"op": "test", "path": "/foo/1", "value": 2}]`,
+			expected: `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+		},
+		{
+			name:     "escaped pointer",
+			doc:      `{"/": 9, "~1": 10}`,
+			ops:      `[{"op": "replace", "path": "/~01", "value": 11}, {"op": "remove", "path": "/~1"}]`,
+			expected: `{"~1": 11}`,
+		},
+		{
+			name:     "replace the whole document",
+			doc:      `{"foo": "bar"}`,
+			ops:      `[{"op": "replace", "path": "", "value": [1]}]`,
+			expected: `[1]`,
+		},
+		{
+			name: "test failure",
+			doc:  `{"baz": "qux"}`,
+			ops:  `[{"op": "test", "path": "/baz", "value": "bar"}]`,
+			err:  "test failed",
+		},
+		{
+			name: "add to a nonexistent target",
+			doc:  `{"foo": "bar"}`,
+			ops:  `[{"op": "add", "path": "/baz/bat", "value": "qux"}]`,
+			err:  "does not exist",
+		},
+		{
+			name: "replace a nonexistent member",
+			doc:  `{"foo": "bar"}`,
+			ops:  `[{"op": "replace", "path": "/baz", "value": "qux"}]`,
+			err:  "does not exist",
+		},
+		{
+			name: "array index out of range",
+			doc:  `{"foo": ["bar"]}`,
+			ops:  `[{"op": "add", "path": "/foo/2", "value": "qux"}]`,
+			err:  "out of range",
+		},
+		{
+			name: "invalid array index",
+			doc:  `{"foo": ["bar"]}`,
+			ops:  `[{"op": "remove", "path": "/foo/01"}]`,
+			err:  "invalid array index",
+		},
+		{
+			name: "move into a child",
+			doc:  `{"a": {"b": {}}}`,
+			ops:  `[{"op": "move", "from": "/a", "path": "/a/b/c"}]`,
+			err:  "into one of its children",
+		},
+		{
+			name: "invalid pointer",
+			doc:  `{}`,
+			ops:  `[{"op": "add", "path": "foo", "value": 1}]`,
+			err:  "invalid JSON pointer",
+		},
+		{
+			name: "unknown operation",
+			doc:  `{}`,
+			ops:  `[{"op": "merge", "path": "/foo"}]`,
+			err:  "unknown operation",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc := decode(t, tc.doc)
+			var ops []Operation
+			require.NoError(t, json.Unmarshal([]byte(tc.ops), &ops))
+
+			result, err := Apply(doc, ops)
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, decode(t, tc.expected), result)
+		})
+	}
+}
+
+func TestApplyLeavesDocumentUnchanged(t *testing.T) {
+	doc := decode(t, `{"foo": ["bar"], "baz": {"qux": 1}}`)
+	_, err := Apply(doc, []Operation{
+		{Op: OpRemove, Path: "/foo/0"},
+		{Op: OpReplace, Path: "/baz/qux", Value: 2},
+		{Op: OpTest, Path: "/baz/qux", Value: 3},
+	})
+	require.Error(t, err)
+	assert.Equal(t, decode(t, `{"foo": ["bar"], "baz": {"qux": 1}}`), doc)
+}
+
+func TestPointer(t *testing.T) {
+	assert.Equal(t, "/panels/0/a~1b~0c", Pointer("panels", "0", "a/b~c"))
+	tokens, err := ParsePointer("/panels/0/a~1b~0c")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"panels", "0", "a/b~c"}, tokens)
+
+	value, err := Get(decode(t, `{"panels": [{"title": "A"}]}`), "/panels/0/title")
+	require.NoError(t, err)
+	assert.Equal(t, "A", value)
+}
@@ -8,6 +8,7 @@ import (
 	"net/url"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/go-openapi/strfmt"
 	"github.com/grafana/grafana-openapi-client-go/client"
@@ -62,6 +63,48 @@ func GrafanaDebugFromContext(ctx context.Context) bool {
 	return false
 }
 
+// PrometheusGuardrails limits the cost of the Prometheus queries run by
+// tools. Zero values disable a limit.
+type PrometheusGuardrails struct {
+	// MaxPointsPerSeries is the maximum number of points per series of a
+	// range query.
+	MaxPointsPerSeries int
+	// MaxRange is the maximum time range of a range query, and of the range
+	// selectors and subqueries in any query.
+	MaxRange time.Duration
+	// MaxSeries is the maximum number of series a query may select. It is
+	// checked with the series API before the query runs.
+	MaxSeries int
+	// AllowUnboundedSelectors allows selectors without a metric name, such
+	// as {__name__=~".+"}, which select every series of the instance.
+	AllowUnboundedSelectors bool
+}
+
+// DefaultPrometheusGuardrails are the guardrails used unless others are
+// added to the context.
+var DefaultPrometheusGuardrails = PrometheusGuardrails{
+	MaxPointsPerSeries: 11000,
+	MaxRange:           30 * 24 * time.Hour,
+}
+
+// prometheusGuardrailsKey is the context key for the Prometheus guardrails.
+type prometheusGuardrailsKey struct{}
+
+// WithPrometheusGuardrails adds the Prometheus query guardrails to the
+// context.
+func WithPrometheusGuardrails(ctx context.Context, guardrails PrometheusGuardrails) context.Context {
+	return context.WithValue(ctx, prometheusGuardrailsKey{}, guardrails)
+}
+
+// PrometheusGuardrailsFromContext extracts the Prometheus query guardrails
+// from the context. If none are set, it returns DefaultPrometheusGuardrails.
+func PrometheusGuardrailsFromContext(ctx context.Context) PrometheusGuardrails {
+	if guardrails, ok := ctx.Value(prometheusGuardrailsKey{}).(PrometheusGuardrails); ok {
+		return guardrails
+	}
+	return DefaultPrometheusGuardrails
+}
+
 // ExtractGrafanaInfoFromEnv is a StdioContextFunc that extracts Grafana configuration
 // from environment variables and injects a configured client into the context.
 var ExtractGrafanaInfoFromEnv server.StdioContextFunc = func(ctx context.Context) context.Context {
@@ -7,6 +7,7 @@ import (
 	"context"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/go-openapi/runtime/client"
 	grafana_client "github.com/grafana/grafana-openapi-client-go/client"
@@ -69,6 +70,15 @@ func TestExtractIncidentClientFromHeaders(t *testing.T) {
 	})
 }
 
+func TestPrometheusGuardrailsFromContext(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, DefaultPrometheusGuardrails, PrometheusGuardrailsFromContext(ctx))
+
+	guardrails := PrometheusGuardrails{MaxRange: time.Hour, MaxSeries: 100}
+	ctx = WithPrometheusGuardrails(ctx, guardrails)
+	assert.Equal(t, guardrails, PrometheusGuardrailsFromContext(ctx))
+}
+
 func TestExtractGrafanaInfoFromHeaders(t *testing.T) {
 	t.Run("no headers, no env", func(t *testing.T) {
 		req, err := http.NewRequest("GET", "http://example.com", nil)
@@ -66,20 +66,21 @@ func handleExtractQuery(ctx context.Context, req mcp.GetPromptRequest) (*mcp.Get
 		Query Execution  
 		- Once all variables are resolved and the time range is defined, execute the query against the Prometheus datasource and retrieve the time series data as (timestamp, throttle percentage) pairs.
 
-		Spike Detection Algorithm  
-		- Analyze the data for spikes using the following method:  
-		For each pair of adjacent throttle percentage values:  
-		- Calculate the relative increase using the formula:  
-			(current - previous) / max(previous, 1e-6)  
-		- If the relative increase is greater than or equal to 0.5 (i.e., 50%) and the absolute increase is greater than or equal to 10 percentage points, mark it as a spike.
+		Spike Detection  
+		- Do not compute spikes by hand. Call the detect_metric_anomalies tool with the same expression, datasource, variables and time range, using:  
+		- detectors: ["spike"]  
+		- direction: "up"  
+		- spikeRelativeThreshold: 0.5 (a relative increase of at least 50%, computed as (current - previous) / max(previous, 1e-6))  
+		- spikeAbsoluteThreshold: 10 (an absolute increase of at least 10 percentage points)  
+		- Use the findings it returns as the detected spikes.
 
 		Output Requirements:  
 		- Return the final substituted Prometheus query.  
 		- Display the time series data in tabular format.  
 		- If a spike is detected:  
-		- Show the timestamps where the spike started and peaked.  
+		- Show the timestamps where the spike started and peaked (the start and end of each finding).  
 		- Show the values before and after the spike.  
-		- Show the relative and absolute increase between the values.`
+		- Show the relative and absolute increase between the values, as reported by detect_metric_anomalies.`
 
 	// Prepare data for substitution
 	data := map[string]string{
@@ -48,6 +48,16 @@ func MustTool[T any, R any](
 	return Tool{Tool: tool, Handler: handler}
 }
 
+// StructuredError is an error with details clients can act on, such as the
+// reason a query was rejected and how to narrow it. When a tool handler
+// returns one, possibly wrapped, the tool call returns a tool error result
+// holding the details as JSON instead of failing with the error message.
+type StructuredError interface {
+	error
+	// ErrorDetails returns the value marshaled to JSON in the result.
+	ErrorDetails() any
+}
+
 // ToolHandlerFunc is the type of a handler function for a tool.
 type ToolHandlerFunc[T any, R any] = func(ctx context.Context, request T) (R, error)
 
@@ -121,8 +131,15 @@ func ConvertTool[T any, R any](name, description string, toolHandler ToolHandler
 			}
 		}
 
-		// If there's an error, return nil result and the error
+		// If there's an error, return nil result and the error, unless it
+		// has details to return as a tool error result.
 		if handlerErr != nil {
+			var structuredErr StructuredError
+			if errors.As(handlerErr, &structuredErr) {
+				if details, err := json.Marshal(structuredErr.ErrorDetails()); err == nil {
+					return mcp.NewToolResultError(string(details)), nil
+				}
+			}
 			return nil, handlerErr
 		}
 
@@ -18,6 +18,9 @@ import (
 const (
 	defaultTimeout    = 30 * time.Second
 	rulesEndpointPath = "/api/prometheus/grafana/api/v1/rules"
+	// rulerRulesEndpointPath returns the definitions of the Grafana-managed
+	// rules, including the datasources of their queries.
+	rulerRulesEndpointPath = "/api/ruler/grafana/api/v1/rules"
 )
 
 type alertingClient struct {
@@ -95,6 +98,22 @@ func (c *alertingClient) GetRules(ctx context.Context) (*rulesResponse, error) {
 	return &rulesResponse, nil
 }
 
+// GetRulerRules returns the definitions of the Grafana-managed alert rules,
+// by folder.
+func (c *alertingClient) GetRulerRules(ctx context.Context) (rulerRulesResponse, error) {
+	resp, err := c.makeRequest(ctx, rulerRulesEndpointPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get alert rule definitions from Grafana API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var rulerRules rulerRulesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rulerRules); err != nil {
+		return nil, fmt.Errorf("failed to decode rules response from %s: %w", rulerRulesEndpointPath, err)
+	}
+	return rulerRules, nil
+}
+
 type rulesResponse struct {
 	Data struct {
 		RuleGroups []ruleGroup      `json:"groups"`
@@ -140,3 +159,32 @@ type alert struct {
 	ActiveAt    *time.Time    `json:"activeAt"`
 	Value       string        `json:"value"`
 }
+
+// rulerRulesResponse maps folder titles to the rule groups in the folder.
+type rulerRulesResponse map[string][]rulerRuleGroup
+
+type rulerRuleGroup struct {
+	Name     string      `json:"name"`
+	Interval string      `json:"interval"`
+	Rules    []rulerRule `json:"rules"`
+}
+
+type rulerRule struct {
+	GrafanaAlert grafanaAlertRule `json:"grafana_alert"`
+}
+
+type grafanaAlertRule struct {
+	UID          string           `json:"uid"`
+	Title        string           `json:"title"`
+	NamespaceUID string           `json:"namespace_uid"`
+	RuleGroup    string           `json:"rule_group"`
+	Data         []alertRuleQuery `json:"data"`
+}
+
+// alertRuleQuery is a query or expression of an alert rule. Expressions have
+// the datasource UID "__expr__".
+type alertRuleQuery struct {
+	RefID         string         `json:"refId"`
+	DatasourceUID string         `json:"datasourceUid"`
+	Model         map[string]any `json:"model"`
+}
@@ -101,6 +101,36 @@ func TestAlertingClient_GetRules_Error(t *testing.T) {
 	})
 }
 
+func TestAlertingClient_GetRulerRules(t *testing.T) {
+	server, client := setupMockServer(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/ruler/grafana/api/v1/rules", r.URL.Path)
+		require.Equal(t, "Bearer test-api-key", r.Header.Get("Authorization"))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, err := w.Write([]byte(`{"Team A": [{"name": "api", "interval": "1m", "rules": [{"grafana_alert": {
+			"uid": "rule-1", "title": "High error rate", "namespace_uid": "team-a", "rule_group": "api",
+			"data": [{"refId": "A", "datasourceUid": "prometheus", "model": {"expr": "up"}}, {"refId": "B", "datasourceUid": "__expr__"}]
+		}}]}]}`))
+		require.NoError(t, err)
+	})
+	defer server.Close()
+
+	rules, err := client.GetRulerRules(context.Background())
+	require.NoError(t, err)
+	require.Len(t, rules["Team A"], 1)
+	group := rules["Team A"][0]
+	require.Equal(t, "api", group.Name)
+	require.Len(t, group.Rules, 1)
+	rule := group.Rules[0].GrafanaAlert
+	require.Equal(t, "rule-1", rule.UID)
+	require.Equal(t, "team-a", rule.NamespaceUID)
+	require.Equal(t, []alertRuleQuery{
+		{RefID: "A", DatasourceUID: "prometheus", Model: map[string]any{"expr": "up"}},
+		{RefID: "B", DatasourceUID: "__expr__"},
+	}, rule.Data)
+}
+
 func TestNewAlertingClientFromContext(t *testing.T) {
 	ctx := mcpgrafana.WithGrafanaURL(context.Background(), "http://localhost:3000/")
 	ctx = mcpgrafana.WithGrafanaAPIKey(ctx, "test-api-key")
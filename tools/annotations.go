@@ -0,0 +1,209 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/grafana/grafana-openapi-client-go/client/annotations"
+	"github.com/grafana/grafana-openapi-client-go/models"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+
+	mcpgrafana "mcp-grafana-local"
+)
+
+// DefaultAnnotationsLimit is the default number of annotations returned.
+const DefaultAnnotationsLimit = 100
+
+type GetAnnotationsParams struct {
+	DashboardUID string   `json:"dashboardUid,omitempty" jsonschema:"description=Optionally\\, only return annotations of the dashboard with this UID"`
+	PanelID      int64    `json:"panelId,omitempty" jsonschema:"description=Optionally\\, only return annotations of this panel of the dashboard"`
+	Tags         []string `json:"tags,omitempty" jsonschema:"description=Optionally\\, only return annotations with these tags"`
+	MatchAny     bool     `json:"matchAny,omitempty" jsonschema:"description=Return annotations with any of the tags instead of all of them"`
+	Type         string   `json:"type,omitempty" jsonschema:"description=Optionally\\, either 'annotation' for annotations created by users and tools or 'alert' for alert state changes"`
+	From         string   `json:"from,omitempty" jsonschema:"description=Optionally\\, the start of the time range (RFC3339\\, epoch ms\\, or relative to now like 'now-6h')"`
+	To           string   `json:"to,omitempty" jsonschema:"description=Optionally\\, the end of the time range (RFC3339\\, epoch ms\\, or relative to now like 'now')"`
+	Limit        int64    `json:"limit,omitempty" jsonschema:"description=The maximum number of annotations to return (default 100)"`
+}
+
+func (p GetAnnotationsParams) validate() error {
+	if p.Type != "" && p.Type != "annotation" && p.Type != "alert" {
+		return fmt.Errorf("invalid type %q, must be 'annotation' or 'alert'", p.Type)
+	}
+	if p.PanelID != 0 && p.DashboardUID == "" {
+		return fmt.Errorf("dashboardUid is required to filter by panelId")
+	}
+	return nil
+}
+
+// annotationSummary is the compact form of an annotation. Times are RFC3339;
+// TimeEnd is only set for region annotations.
+type annotationSummary struct {
+	ID           int64    `json:"id"`
+	Time         string   `json:"time"`
+	TimeEnd      string   `json:"timeEnd,omitempty"`
+	Text         string   `json:"text,omitempty"`
+	Tags         []string `json:"tags,omitempty"`
+	DashboardUID string   `json:"dashboardUid,omitempty"`
+	PanelID      int64    `json:"panelId,omitempty"`
+	Login        string   `json:"login,omitempty"`
+	// AlertName and NewState are set for alert state changes.
+	AlertName string `json:"alertName,omitempty"`
+	NewState  string `json:"newState,omitempty"`
+
+	time time.Time
+}
+
+func newAnnotationSummary(a *models.Annotation) annotationSummary {
+	s := annotationSummary{
+		ID:           a.ID,
+		Text:         a.Text,
+		Tags:         a.Tags,
+		DashboardUID: a.DashboardUID,
+		PanelID:      a.PanelID,
+		Login:        a.Login,
+		AlertName:    a.AlertName,
+		NewState:     a.NewState,
+		time:         time.UnixMilli(a.Time),
+	}
+	s.Time = s.time.UTC().Format(time.RFC3339)
+	if a.TimeEnd != 0 && a.TimeEnd != a.Time {
+		s.TimeEnd = time.UnixMilli(a.TimeEnd).UTC().Format(time.RFC3339)
+	}
+	return s
+}
+
+func getAnnotations(ctx context.Context, args GetAnnotationsParams) ([]annotationSummary, error) {
+	if err := args.validate(); err != nil {
+		return nil, err
+	}
+	limit := args.Limit
+	if limit <= 0 {
+		limit = DefaultAnnotationsLimit
+	}
+
+	now := time.Now()
+	params := annotations.NewGetAnnotationsParamsWithContext(ctx).WithLimit(&limit).WithTags(args.Tags)
+	if args.DashboardUID != "" {
+		params.SetDashboardUID(&args.DashboardUID)
+	}
+	if args.PanelID != 0 {
+		params.SetPanelID(&args.PanelID)
+	}
+	if args.MatchAny {
+		params.SetMatchAny(&args.MatchAny)
+	}
+	if args.Type != "" {
+		params.SetType(&args.Type)
+	}
+	for _, bound := range []struct {
+		value string
+		set   func(*int64)
+		name  string
+	}{{args.From, params.SetFrom, "from"}, {args.To, params.SetTo, "to"}} {
+		if bound.value == "" {
+			continue
+		}
+		t, err := parseUserTime(bound.value, now)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s time: %w", bound.name, err)
+		}
+		ms := t.UnixMilli()
+		bound.set(&ms)
+	}
+
+	c := mcpgrafana.GrafanaClientFromContext(ctx)
+	resp, err := c.Annotations.GetAnnotations(params)
+	if err != nil {
+		return nil, fmt.Errorf("get annotations: %w", err)
+	}
+	result := make([]annotationSummary, 0, len(resp.Payload))
+	for _, a := range resp.Payload {
+		result = append(result, newAnnotationSummary(a))
+	}
+	slices.SortStableFunc(result, func(a, b annotationSummary) int { return a.time.Compare(b.time) })
+	return result, nil
+}
+
+var GetAnnotations = mcpgrafana.MustTool(
+	"get_annotations",
+	"Get Grafana annotations, such as deployments, incidents or alert state changes, filtered by dashboard, panel, tags, type and time range. Returns the annotations in chronological order with their ID, time, end time for regions, text and tags.",
+	getAnnotations,
+	mcp.WithTitleAnnotation("Get annotations"),
+	mcp.WithIdempotentHintAnnotation(true),
+	mcp.WithReadOnlyHintAnnotation(true),
+)
+
+type CreateAnnotationParams struct {
+	Text         string   `json:"text" jsonschema:"required,description=The text of the annotation\\, e.g. 'Deploy started'"`
+	Tags         []string `json:"tags,omitempty" jsonschema:"description=Optionally\\, tags of the annotation\\, e.g. 'deploy' or 'incident'"`
+	DashboardUID string   `json:"dashboardUid,omitempty" jsonschema:"description=Optionally\\, the UID of the dashboard to add the annotation to. Without it the annotation is shown on all dashboards querying its tags"`
+	PanelID      int64    `json:"panelId,omitempty" jsonschema:"description=Optionally\\, the ID of the panel of the dashboard to add the annotation to"`
+	Time         string   `json:"time,omitempty" jsonschema:"description=The time of the annotation (RFC3339\\, epoch ms\\, or relative to now like 'now-5m'). Defaults to now"`
+	TimeEnd      string   `json:"timeEnd,omitempty" jsonschema:"description=Optionally\\, the end time to create a region annotation"`
+}
+
+func (p CreateAnnotationParams) validate() error {
+	if p.Text == "" {
+		return fmt.Errorf("text is required")
+	}
+	if p.PanelID != 0 && p.DashboardUID == "" {
+		return fmt.Errorf("dashboardUid is required to annotate a panel")
+	}
+	return nil
+}
+
+func createAnnotation(ctx context.Context, args CreateAnnotationParams) (*models.PostAnnotationOKBody, error) {
+	if err := args.validate(); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	start := now
+	if args.Time != "" {
+		var err error
+		if start, err = parseUserTime(args.Time, now); err != nil {
+			return nil, fmt.Errorf("parsing time: %w", err)
+		}
+	}
+	cmd := &models.PostAnnotationsCmd{
+		Text:         &args.Text,
+		Tags:         args.Tags,
+		DashboardUID: args.DashboardUID,
+		PanelID:      args.PanelID,
+		Time:         start.UnixMilli(),
+	}
+	if args.TimeEnd != "" {
+		end, err := parseUserTime(args.TimeEnd, now)
+		if err != nil {
+			return nil, fmt.Errorf("parsing end time: %w", err)
+		}
+		if end.Before(start) {
+			return nil, fmt.Errorf("end time %s is before time %s", end.Format(time.RFC3339), start.Format(time.RFC3339))
+		}
+		cmd.TimeEnd = end.UnixMilli()
+	}
+	if cmd.Tags == nil {
+		cmd.Tags = []string{}
+	}
+
+	c := mcpgrafana.GrafanaClientFromContext(ctx)
+	resp, err := c.Annotations.PostAnnotation(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("create annotation: %w", err)
+	}
+	return resp.Payload, nil
+}
+
+var CreateAnnotation = mcpgrafana.MustTool(
+	"create_annotation",
+	"Create an annotation to mark an event, such as 'deploy started' or 'mitigation applied' during an incident, at a point in time or over a time range. Annotations can be attached to a dashboard or panel, or be organization wide and shown on dashboards through their tags. Returns the ID of the annotation.",
+	createAnnotation,
+	mcp.WithTitleAnnotation("Create annotation"),
+)
+
+func AddAnnotationTools(mcp *server.MCPServer) {
+	GetAnnotations.Register(mcp)
+	CreateAnnotation.Register(mcp)
+}
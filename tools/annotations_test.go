@@ -0,0 +1,71 @@
+// Requires a Grafana instance running on localhost:3000,
+// with a Prometheus datasource provisioned.
+// Run with `go test -tags integration`.
+//go:build integration
+
+package tools
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnnotationTools(t *testing.T) {
+	ctx := newTestContext()
+	dashboard := getExistingTestDashboard(t, ctx, "")
+
+	created, err := createAnnotation(ctx, CreateAnnotationParams{
+		Text:         "Integration test deploy",
+		Tags:         []string{"integration-test", "deploy"},
+		DashboardUID: dashboard.UID,
+		Time:         "now-10m",
+		TimeEnd:      "now-5m",
+	})
+	require.NoError(t, err)
+	require.NotNil(t, created.ID)
+
+	t.Run("get annotations", func(t *testing.T) {
+		result, err := getAnnotations(ctx, GetAnnotationsParams{
+			DashboardUID: dashboard.UID,
+			Tags:         []string{"integration-test"},
+			From:         "now-1h",
+			To:           "now",
+		})
+		require.NoError(t, err)
+		require.NotEmpty(t, result)
+		last := result[len(result)-1]
+		assert.Equal(t, *created.ID, last.ID)
+		assert.Equal(t, "Integration test deploy", last.Text)
+		assert.NotEmpty(t, last.TimeEnd)
+	})
+
+	t.Run("get annotations outside time range", func(t *testing.T) {
+		result, err := getAnnotations(ctx, GetAnnotationsParams{
+			Tags: []string{"integration-test"},
+			From: "now-3h",
+			To:   "now-2h",
+		})
+		require.NoError(t, err)
+		for _, a := range result {
+			assert.NotEqual(t, *created.ID, a.ID)
+		}
+	})
+
+	t.Run("query prometheus with annotations", func(t *testing.T) {
+		result, err := queryPrometheus(ctx, QueryPrometheusParams{
+			DatasourceUID:      "prometheus",
+			Expr:               "up",
+			From:               "now-1h",
+			To:                 "now",
+			IncludeAnnotations: true,
+			AnnotationTags:     []string{"integration-test"},
+		})
+		require.NoError(t, err)
+		annotated, ok := result.(prometheusQueryResult)
+		require.True(t, ok)
+		assert.NotNil(t, annotated.Result)
+		assert.NotEmpty(t, annotated.Annotations)
+	})
+}
@@ -0,0 +1,40 @@
+//go:build unit
+// +build unit
+
+package tools
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana-openapi-client-go/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewAnnotationSummary(t *testing.T) {
+	point := newAnnotationSummary(&models.Annotation{
+		ID:           1,
+		Time:         1700000000000,
+		TimeEnd:      1700000000000,
+		Text:         "Deploy",
+		Tags:         []string{"deploy"},
+		DashboardUID: "abc",
+		PanelID:      2,
+	})
+	assert.Equal(t, "2023-11-14T22:13:20Z", point.Time)
+	assert.Empty(t, point.TimeEnd)
+	assert.Equal(t, "Deploy", point.Text)
+	assert.Equal(t, int64(2), point.PanelID)
+
+	region := newAnnotationSummary(&models.Annotation{ID: 2, Time: 1700000000000, TimeEnd: 1700000060000})
+	assert.Equal(t, "2023-11-14T22:14:20Z", region.TimeEnd)
+}
+
+func TestAnnotationParamsValidate(t *testing.T) {
+	assert.NoError(t, GetAnnotationsParams{Type: "alert"}.validate())
+	assert.Error(t, GetAnnotationsParams{Type: "deploy"}.validate())
+	assert.Error(t, GetAnnotationsParams{PanelID: 1}.validate())
+
+	assert.NoError(t, CreateAnnotationParams{Text: "Deploy"}.validate())
+	assert.Error(t, CreateAnnotationParams{}.validate())
+	assert.Error(t, CreateAnnotationParams{Text: "Deploy", PanelID: 1}.validate())
+}
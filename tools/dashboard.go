@@ -3,17 +3,24 @@ package tools
 import (
 	"context"
 	"fmt"
-	"regexp"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 	"log/slog"
 
 	"github.com/grafana/grafana-openapi-client-go/models"
 	mcpgrafana "mcp-grafana-local"
+	"mcp-grafana-local/internal/interpolate"
 )
 
 type GetDashboardByUIDParams struct {
-	UID string `json:"uid" jsonschema:"required,description=The UID of the dashboard"`
+	UID         string `json:"uid" jsonschema:"required,description=The UID of the dashboard"`
+	IncludeLink bool   `json:"includeLink,omitempty" jsonschema:"description=If true\\, also return a link to the dashboard"`
+}
+
+// dashboardWithLink is a dashboard with a link to it.
+type dashboardWithLink struct {
+	*models.DashboardFullWithMeta
+	Link string `json:"link,omitempty"`
 }
 
 func getDashboardByUID(ctx context.Context, args GetDashboardByUIDParams) (*models.DashboardFullWithMeta, error) {
@@ -25,12 +32,26 @@ func getDashboardByUID(ctx context.Context, args GetDashboardByUIDParams) (*mode
 	return dashboard.Payload, nil
 }
 
+func getDashboardByUIDTool(ctx context.Context, args GetDashboardByUIDParams) (*dashboardWithLink, error) {
+	dashboard, err := getDashboardByUID(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	result := &dashboardWithLink{DashboardFullWithMeta: dashboard}
+	if args.IncludeLink {
+		result.Link = dashboardLink(ctx, args.UID, nil, "", "", 0)
+	}
+	return result, nil
+}
+
 type UpdateDashboardParams struct {
 	Dashboard map[string]interface{} `json:"dashboard" jsonschema:"required,description=The full dashboard JSON"`
 	FolderUID string                 `json:"folderUid" jsonschema:"optional,description=The UID of the dashboard's folder"`
 	Message   string                 `json:"message" jsonschema:"optional,description=Set a commit message for the version history"`
 	Overwrite bool                   `json:"overwrite" jsonschema:"optional,description=Overwrite the dashboard if it exists. Otherwise create one"`
 	UserID    int64                  `json:"userId" jsonschema:"optional,ID of the user making the change"`
+
+	IncludeLink bool `json:"includeLink,omitempty" jsonschema:"description=If true\\, also return a link to the saved dashboard"`
 }
 
 // updateDashboard can be used to save an existing dashboard, or create a new one.
@@ -52,10 +73,15 @@ func updateDashboard(ctx context.Context, args UpdateDashboardParams) (*models.P
 	return dashboard.Payload, nil
 }
 
+func updateDashboardTool(ctx context.Context, args UpdateDashboardParams) (*savedDashboard, error) {
+	body, err := updateDashboard(ctx, args)
+	return savedDashboardResult(ctx, body, err, args.IncludeLink)
+}
+
 var GetDashboardByUID = mcpgrafana.MustTool(
 	"get_dashboard_by_uid",
-	"Retrieves the complete dashboard, including panels, variables, and settings, for a specific dashboard identified by its UID.",
-	getDashboardByUID,
+	"Retrieves the complete dashboard, including panels, variables, and settings, for a specific dashboard identified by its UID. Set includeLink to true to also get a link to the dashboard.",
+	getDashboardByUIDTool,
 	mcp.WithTitleAnnotation("Get dashboard details"),
 	mcp.WithIdempotentHintAnnotation(true),
 	mcp.WithReadOnlyHintAnnotation(true),
@@ -63,14 +89,15 @@ var GetDashboardByUID = mcpgrafana.MustTool(
 
 var UpdateDashboard = mcpgrafana.MustTool(
 	"update_dashboard",
-	"Create or update a dashboard",
-	updateDashboard,
+	"Create or update a dashboard. Set includeLink to true to also get a link to the saved dashboard.",
+	updateDashboardTool,
 	mcp.WithTitleAnnotation("Create or update dashboard"),
 	mcp.WithDestructiveHintAnnotation(true),
 )
 
 type DashboardPanelQueriesParams struct {
-	UID string `json:"uid" jsonschema:"required,description=The UID of the dashboard"`
+	UID         string `json:"uid" jsonschema:"required,description=The UID of the dashboard"`
+	IncludeLink bool   `json:"includeLink,omitempty" jsonschema:"description=If true\\, also return a link to the panel of each query"`
 }
 
 type datasourceInfo struct {
@@ -79,113 +106,265 @@ type datasourceInfo struct {
 }
 
 type panelQuery struct {
-	Title      string         `json:"title"`
-	Query      string         `json:"query"`
-	Datasource datasourceInfo `json:"datasource"`
-	Variables  []string       `json:"variables"`
+	PanelID  int    `json:"panelId"`
+	Title    string `json:"title"`
+	RefID    string `json:"refId,omitempty"`
+	Query    string `json:"query"`
+	Language string `json:"language,omitempty"`
+	Hidden   bool   `json:"hidden,omitempty"`
+	// Datasource is the panel's datasource. TargetDatasource is only set if
+	// the query uses a different one, as queries of mixed panels do.
+	Datasource       datasourceInfo  `json:"datasource"`
+	TargetDatasource *datasourceInfo `json:"targetDatasource,omitempty"`
+	Variables        []string        `json:"variables"`
+	// LibraryPanelUID is set if the panel is a library panel.
+	LibraryPanelUID string `json:"libraryPanelUid,omitempty"`
+	Link            string `json:"link,omitempty"`
+
+	// panel and target are the raw panel and target the query was read from.
+	panel  map[string]any
+	target map[string]any
 }
 
-func GetDashboardPanelQueriesTool(ctx context.Context, args DashboardPanelQueriesParams) ([]panelQuery, error) {
-	var variableRegex = regexp.MustCompile(`\$\w+`)
+// targetQueryField is the field of a panel target holding the query text, and
+// the language of the query.
+type targetQueryField struct {
+	field    string
+	language string
+}
 
-	
+var (
+	// targetQueryFields maps datasource types to the field holding their
+	// query text.
+	targetQueryFields = map[string]targetQueryField{
+		"prometheus":                    {"expr", "promql"},
+		"loki":                          {"expr", "logql"},
+		"tempo":                         {"query", "traceql"},
+		"elasticsearch":                 {"query", "lucene"},
+		"grafana-opensearch-datasource": {"query", "lucene"},
+		"mysql":                         {"rawSql", "sql"},
+		"postgres":                      {"rawSql", "sql"},
+		"grafana-postgresql-datasource": {"rawSql", "sql"},
+		"mssql":                         {"rawSql", "sql"},
+		"grafana-clickhouse-datasource": {"rawSql", "sql"},
+		"influxdb":                      {"query", "influxql"},
+		"graphite":                      {"target", "graphite"},
+		"cloudwatch":                    {"expression", "cloudwatch"},
+	}
+
+	// fallbackQueryFields are tried in order when the datasource type is
+	// unknown, e.g. because it is a variable.
+	fallbackQueryFields = []targetQueryField{
+		{"expr", ""},
+		{"rawSql", "sql"},
+		{"query", ""},
+		{"target", ""},
+		{"expression", ""},
+	}
+)
 
-	// Recursive function to extract queries from any level of panel nesting
-	var extractQueries func(panels []any) []panelQuery
-	extractQueries = func(panels []any) []panelQuery {
-		var result []panelQuery
+// datasourceFromRef reads a datasource reference object of a panel or target.
+// It returns false if there is none.
+func datasourceFromRef(ref any) (datasourceInfo, bool) {
+	dsMap, ok := ref.(map[string]any)
+	if !ok {
+		return datasourceInfo{}, false
+	}
+	var dsInfo datasourceInfo
+	dsInfo.UID, _ = dsMap["uid"].(string)
+	dsInfo.Type, _ = dsMap["type"].(string)
+	return dsInfo, dsInfo.UID != "" || dsInfo.Type != ""
+}
 
-		for _, p := range panels {
-			panel, ok := p.(map[string]any)
+// queryFieldFor returns the field holding the query text of a panel target,
+// depending on the type of the target's datasource.
+func queryFieldFor(target map[string]any, dsType string) (targetQueryField, bool) {
+	if f, ok := targetQueryFields[dsType]; ok {
+		return f, true
+	}
+	for _, f := range fallbackQueryFields {
+		if query, _ := target[f.field].(string); query != "" {
+			return f, true
+		}
+	}
+	return targetQueryField{}, false
+}
+
+// targetDatasourceType returns the datasource type of a panel target, which
+// is the panel's unless the target has its own datasource.
+func targetDatasourceType(panel, target map[string]any) string {
+	if targetDs, ok := datasourceFromRef(target["datasource"]); ok && targetDs.Type != "" {
+		return targetDs.Type
+	}
+	panelDs, _ := datasourceFromRef(panel["datasource"])
+	return panelDs.Type
+}
+
+// targetQuery returns the query text of a panel target and its language,
+// depending on the type of the target's datasource.
+func targetQuery(target map[string]any, dsType string) (string, string) {
+	f, ok := queryFieldFor(target, dsType)
+	if !ok {
+		return "", ""
+	}
+	query, _ := target[f.field].(string)
+	language := f.language
+	switch dsType {
+	case "influxdb":
+		// Flux queries are saved without the InfluxQL editor settings.
+		if _, ok := target["rawQuery"]; !ok {
+			language = "flux"
+		}
+	case "tempo":
+		// Other query types, such as trace ID lookups, aren't TraceQL.
+		if queryType, _ := target["queryType"].(string); queryType != "" && queryType != "traceql" && queryType != "traceqlSearch" {
+			language = queryType
+		}
+	}
+	return query, language
+}
+
+// extractPanelQueries returns the queries of the given panels, including
+// panels nested in rows at any level.
+func extractPanelQueries(panels []any) []panelQuery {
+	var result []panelQuery
+
+	for _, p := range panels {
+		panel, ok := p.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		// If this is a row panel with nested panels in "collapsed"
+		if collapsed, ok := panel["collapsed"].([]any); ok {
+			result = append(result, extractPanelQueries(collapsed)...)
+		}
+
+		// Some nested dashboards use "panels" as a key within a panel (rare)
+		if innerPanels, ok := panel["panels"].([]any); ok {
+			result = append(result, extractPanelQueries(innerPanels)...)
+		}
+
+		title, _ := panel["title"].(string)
+		id, _ := panel["id"].(float64)
+		dsInfo, _ := datasourceFromRef(panel["datasource"])
+
+		// Extract queries
+		targets, ok := panel["targets"].([]any)
+		if !ok {
+			continue
+		}
+		for _, t := range targets {
+			target, ok := t.(map[string]any)
 			if !ok {
 				continue
 			}
 
-			// If this is a row panel with nested panels in "collapsed"
-			if collapsed, ok := panel["collapsed"].([]any); ok {
-				result = append(result, extractQueries(collapsed)...)
+			q := panelQuery{
+				PanelID:         int(id),
+				Title:           title,
+				Datasource:      dsInfo,
+				LibraryPanelUID: libraryPanelUID(panel),
+				panel:           panel,
+				target:          target,
 			}
-
-			// Some nested dashboards use "panels" as a key within a panel (rare)
-			if innerPanels, ok := panel["panels"].([]any); ok {
-				result = append(result, extractQueries(innerPanels)...)
+			if targetDs, ok := datasourceFromRef(target["datasource"]); ok && targetDs != dsInfo {
+				q.TargetDatasource = &targetDs
 			}
 
-			title, _ := panel["title"].(string)
-
-			// Handle datasource
-			var dsInfo datasourceInfo
-			if dsField, dsExists := panel["datasource"]; dsExists && dsField != nil {
-				if dsMap, ok := dsField.(map[string]any); ok {
-					if uid, ok := dsMap["uid"].(string); ok {
-						dsInfo.UID = uid
-					}
-					if dsType, ok := dsMap["type"].(string); ok {
-						dsInfo.Type = dsType
-					}
-				}
+			q.Query, q.Language = targetQuery(target, targetDatasourceType(panel, target))
+			if q.Query == "" {
+				continue
 			}
+			q.RefID, _ = target["refId"].(string)
+			q.Hidden, _ = target["hide"].(bool)
+			q.Variables = interpolate.Variables(q.Query)
+			result = append(result, q)
+		}
+	}
+
+	return result
+}
+
+// dashboardPanels returns the top-level panels of a dashboard.
+func dashboardPanels(dashboard *models.DashboardFullWithMeta) (map[string]any, []any, error) {
+	db, ok := dashboard.Dashboard.(map[string]any)
+	if !ok {
+		return nil, nil, fmt.Errorf("dashboard is not a JSON object")
+	}
+
+	panels, ok := db["panels"].([]any)
+	if !ok {
+		return nil, nil, fmt.Errorf("panels is not a JSON array")
+	}
+	return db, panels, nil
+}
+
+// dashboardModel returns a dashboard and its top-level panels. Dashboards
+// without a panels array, such as dashboards with only variables or legacy
+// dashboards with rows, have no panels, but their variables and annotations
+// can still be read.
+func dashboardModel(dashboard *models.DashboardFullWithMeta) (map[string]any, []any, bool) {
+	db, ok := dashboard.Dashboard.(map[string]any)
+	if !ok {
+		return nil, nil, false
+	}
+	panels, _ := db["panels"].([]any)
+	return db, panels, true
+}
 
-			// Extract queries
-			targets, ok := panel["targets"].([]any)
+// forEachDashboard calls fn with every dashboard of the instance and its
+// panels, with library panels resolved. Dashboards which aren't JSON objects
+// are skipped.
+func forEachDashboard(ctx context.Context, fn func(hit searchHit, db map[string]any, panels []any)) error {
+	lookup := libraryPanelModels(ctx)
+	for page := 1; ; page++ {
+		result, err := searchDashboards(ctx, SearchDashboardsParams{Type: searchTypeDashboard, Limit: maxSearchLimit, Page: page})
+		if err != nil {
+			return err
+		}
+		for _, hit := range result.Hits {
+			dashboard, err := getDashboardByUID(ctx, GetDashboardByUIDParams{UID: hit.UID})
+			if err != nil {
+				return err
+			}
+			db, panels, ok := dashboardModel(dashboard)
 			if !ok {
 				continue
 			}
-			for _, t := range targets {
-				target, ok := t.(map[string]any)
-				if !ok {
-					continue
-				}
-				expr, _ := target["expr"].(string)
-				if expr != "" {
-					rawVars := variableRegex.FindAllString(expr, -1)
-					var uniqueVars []string
-					seen := make(map[string]bool)
-					for _, v := range rawVars {
-						name := v[1:]
-						if !seen[name] {
-							seen[name] = true
-							uniqueVars = append(uniqueVars, name)
-						}
-					}
-
-					result = append(result, panelQuery{
-						Title:      title,
-						Query:      expr,
-						Datasource: dsInfo,
-						Variables:  uniqueVars,
-					})
-				}
-			}
+			fn(hit, db, resolveLibraryPanels(panels, lookup))
+		}
+		if !result.HasMore {
+			return nil
 		}
-
-		return result
 	}
+}
 
+func GetDashboardPanelQueriesTool(ctx context.Context, args DashboardPanelQueriesParams) ([]panelQuery, error) {
 	// Load the dashboard
-	dashboard, err := getDashboardByUID(ctx, GetDashboardByUIDParams(args))
+	dashboard, err := getDashboardByUID(ctx, GetDashboardByUIDParams{UID: args.UID})
 	if err != nil {
 		return nil, fmt.Errorf("get dashboard by uid: %w", err)
 	}
 
-	db, ok := dashboard.Dashboard.(map[string]any)
-	if !ok {
-		return nil, fmt.Errorf("dashboard is not a JSON object")
-	}
-
-	panels, ok := db["panels"].([]any)
-	if !ok {
-		return nil, fmt.Errorf("panels is not a JSON array")
+	_, panels, err := dashboardPanels(dashboard)
+	if err != nil {
+		return nil, err
 	}
 
 	// Extract all queries recursively
-	return extractQueries(panels), nil
+	queries := extractPanelQueries(resolveLibraryPanels(panels, libraryPanelModels(ctx)))
+	if args.IncludeLink {
+		for i := range queries {
+			queries[i].Link = dashboardLink(ctx, args.UID, nil, "", "", queries[i].PanelID)
+		}
+	}
+	return queries, nil
 }
 
-
 var GetDashboardPanelQueries = mcpgrafana.MustTool(
 	"get_dashboard_panel_queries",
-	"Get the title, query string, and datasource information for each panel in a dashboard. The datasource is an object with fields `uid` (which may be a concrete UID or a template variable like \"$datasource\") and `type`. If the datasource UID is a template variable, it won't be usable directly for queries. Returns an array of objects, each representing a panel, with fields: title, query, and datasource (an object with uid and type).",
+	"Get the title, query string, and datasource information for each panel in a dashboard. The datasource is an object with fields `uid` (which may be a concrete UID or a template variable like \"$datasource\") and `type`. If the datasource UID is a template variable, it won't be usable directly for queries. Queries are read from the field used by the datasource type (e.g. `expr` for Prometheus and Loki, `rawSql` for SQL datasources, `query` for Tempo and Elasticsearch). Returns an array of objects, each representing a panel query, with fields: panelId, title, refId, query, language (e.g. promql, logql, sql, traceql), hidden, datasource (the panel datasource, an object with uid and type), targetDatasource (only set when the query uses a different datasource than the panel, as in mixed panels) and variables (the template variables used by the query). Library panels are resolved to their queries, with libraryPanelUid set. Set includeLink to true to also get a link viewing the panel of each query.",
 	GetDashboardPanelQueriesTool,
 	mcp.WithTitleAnnotation("Get dashboard panel queries"),
 	mcp.WithIdempotentHintAnnotation(true),
@@ -195,6 +374,21 @@ var GetDashboardPanelQueries = mcpgrafana.MustTool(
 func AddDashboardTools(mcp *server.MCPServer) {
 	slog.Info("Registering dashboard tools")
 	GetDashboardByUID.Register(mcp)
+	GetDashboardSummary.Register(mcp)
 	UpdateDashboard.Register(mcp)
+	CreateDashboardFromSpec.Register(mcp)
 	GetDashboardPanelQueries.Register(mcp)
+	GetDashboardVariables.Register(mcp)
+	RunPanelQuery.Register(mcp)
+	PatchDashboard.Register(mcp)
+	ListDashboardVersions.Register(mcp)
+	DiffDashboardVersions.Register(mcp)
+	RestoreDashboardVersion.Register(mcp)
+	LintDashboard.Register(mcp)
+	FindMetricUsage.Register(mcp)
+	ListLibraryPanels.Register(mcp)
+	GetLibraryPanel.Register(mcp)
+	FindLibraryPanelsByName.Register(mcp)
+	ExportDashboards.Register(mcp)
+	ImportDashboards.Register(mcp)
 }
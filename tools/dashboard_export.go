@@ -0,0 +1,375 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/grafana/grafana-openapi-client-go/client/dashboards"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	mcpgrafana "mcp-grafana-local"
+)
+
+// Exported dashboards are written to <directory>/<folder UID>/<UID>.json, or
+// to <directory>/<UID>.json for dashboards in the root folder.
+
+// exportStrippedKeys are the dashboard fields which differ between Grafana
+// instances or change on every save, and so are left out of exports.
+var exportStrippedKeys = []string{"id", "version"}
+
+// Import actions.
+const (
+	importActionCreate    = "create"
+	importActionUpdate    = "update"
+	importActionUnchanged = "unchanged"
+)
+
+type ExportDashboardsParams struct {
+	Directory  string   `json:"directory" jsonschema:"required,description=The local directory to write the dashboards to. It is created if it doesn't exist"`
+	FolderUIDs []string `json:"folderUids,omitempty" jsonschema:"description=Optionally\\, only export the dashboards in these folders. Use 'general' for the root folder"`
+	Tags       []string `json:"tags,omitempty" jsonschema:"description=Optionally\\, only export the dashboards with all of these tags"`
+	Prune      bool     `json:"prune,omitempty" jsonschema:"description=Delete the files of dashboards which weren't exported\\, e.g. because they were deleted or moved to another folder. Only the exported folders are pruned\\, and with tags the dashboards without them are deleted too"`
+}
+
+type exportedDashboard struct {
+	UID       string `json:"uid"`
+	Title     string `json:"title"`
+	FolderUID string `json:"folderUid,omitempty"`
+	Path      string `json:"path"`
+}
+
+type exportResult struct {
+	Directory  string              `json:"directory"`
+	Dashboards []exportedDashboard `json:"dashboards"`
+	// Pruned are the paths of the deleted dashboard files.
+	Pruned []string `json:"pruned,omitempty"`
+}
+
+// normalizeDashboard returns the dashboard without its instance specific
+// fields.
+func normalizeDashboard(db map[string]any) map[string]any {
+	return withoutKeys(db, exportStrippedKeys...)
+}
+
+// marshalDashboard encodes a dashboard as indented JSON. Object keys are
+// sorted, so exporting an unchanged dashboard gives the same file.
+func marshalDashboard(db map[string]any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(db); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// dashboardFilePath returns the path of a dashboard file relative to the
+// export directory.
+func dashboardFilePath(folderUID, uid string) (string, error) {
+	for _, part := range []string{folderUID, uid} {
+		if strings.ContainsAny(part, `/\`) || part == "." || part == ".." {
+			return "", fmt.Errorf("invalid UID %q for a file name", part)
+		}
+	}
+	if uid == "" {
+		return "", fmt.Errorf("dashboard has no UID")
+	}
+	return filepath.Join(folderUID, uid+".json"), nil
+}
+
+func ExportDashboardsTool(ctx context.Context, args ExportDashboardsParams) (*exportResult, error) {
+	if args.Directory == "" {
+		return nil, fmt.Errorf("directory is required")
+	}
+	var hits []searchHit
+	for page := 1; ; page++ {
+		result, err := searchDashboards(ctx, SearchDashboardsParams{
+			Type:       searchTypeDashboard,
+			FolderUIDs: args.FolderUIDs,
+			Tags:       args.Tags,
+			Limit:      maxSearchLimit,
+			Page:       page,
+		})
+		if err != nil {
+			return nil, err
+		}
+		hits = append(hits, result.Hits...)
+		if !result.HasMore {
+			break
+		}
+	}
+
+	result := &exportResult{Directory: args.Directory, Dashboards: []exportedDashboard{}}
+	written := map[string]bool{}
+	for _, hit := range hits {
+		dashboard, err := getDashboardByUID(ctx, GetDashboardByUIDParams{UID: hit.UID})
+		if err != nil {
+			return nil, err
+		}
+		db, ok := dashboard.Dashboard.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("dashboard %s is not a JSON object", hit.UID)
+		}
+		path, err := dashboardFilePath(hit.FolderUID, hit.UID)
+		if err != nil {
+			return nil, err
+		}
+		data, err := marshalDashboard(normalizeDashboard(db))
+		if err != nil {
+			return nil, fmt.Errorf("encode dashboard %s: %w", hit.UID, err)
+		}
+		fullPath := filepath.Join(args.Directory, path)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+			return nil, fmt.Errorf("create directory: %w", err)
+		}
+		if err := os.WriteFile(fullPath, data, 0o644); err != nil {
+			return nil, fmt.Errorf("write dashboard %s: %w", hit.UID, err)
+		}
+		result.Dashboards = append(result.Dashboards, exportedDashboard{
+			UID:       hit.UID,
+			Title:     hit.Title,
+			FolderUID: hit.FolderUID,
+			Path:      path,
+		})
+		written[path] = true
+	}
+	if args.Prune {
+		pruned, err := pruneDashboardDir(args.Directory, args.FolderUIDs, written)
+		if err != nil {
+			return nil, err
+		}
+		result.Pruned = pruned
+	}
+	return result, nil
+}
+
+// pruneDashboardDir deletes the dashboard files of an export directory which
+// weren't written, in the given folders or in all folders if there are none.
+// Files which aren't dashboards, i.e. JSON objects with a uid, are kept.
+func pruneDashboardDir(dir string, folderUIDs []string, written map[string]bool) ([]string, error) {
+	pruned := []string{}
+	err := walkDashboardDir(dir, func(rel, folderUID string) error {
+		if written[rel] {
+			return nil
+		}
+		folder := folderUID
+		if folder == "" {
+			folder = "general"
+		}
+		if len(folderUIDs) > 0 && !slices.Contains(folderUIDs, folder) {
+			return nil
+		}
+		path := filepath.Join(dir, rel)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var db map[string]any
+		if json.Unmarshal(data, &db) != nil {
+			return nil
+		}
+		if uid, _ := db["uid"].(string); uid == "" {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		pruned = append(pruned, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("prune dashboards in %s: %w", dir, err)
+	}
+	return pruned, nil
+}
+
+var ExportDashboards = mcpgrafana.MustTool(
+	"export_dashboards",
+	"Export dashboards to a local directory on the machine running this server, e.g. to keep them in git. Optionally only exports the dashboards in the given folders or with the given tags. Each dashboard is written to <folderUid>/<uid>.json, or <uid>.json for the root folder, as indented JSON with sorted keys and without its id and version, so exports of unchanged dashboards are identical. Files of dashboards which were deleted or moved are kept unless prune is true, which deletes the dashboard files of the exported folders that weren't exported. Returns the exported dashboards and their paths, and the pruned paths.",
+	ExportDashboardsTool,
+	mcp.WithTitleAnnotation("Export dashboards"),
+	mcp.WithIdempotentHintAnnotation(true),
+)
+
+type ImportDashboardsParams struct {
+	Directory string `json:"directory" jsonschema:"required,description=The local directory with dashboards exported by export_dashboards"`
+	Apply     bool   `json:"apply,omitempty" jsonschema:"description=Save the changed dashboards. By default only the changes are returned\\, so they can be reviewed first"`
+	Message   string `json:"message,omitempty" jsonschema:"description=Optionally\\, the version history message of the saved dashboards"`
+}
+
+type importedDashboard struct {
+	UID       string `json:"uid"`
+	Title     string `json:"title"`
+	FolderUID string `json:"folderUid,omitempty"`
+	Path      string `json:"path"`
+	// Action is "create", "update" or "unchanged".
+	Action string `json:"action"`
+	// Changes are the differences to the dashboard in Grafana, for updates,
+	// at JSON pointers into the dashboard, or at "folderUid" if the dashboard
+	// moves to another folder.
+	Changes []fieldChange `json:"changes,omitempty"`
+}
+
+type importResult struct {
+	DryRun     bool                `json:"dryRun"`
+	Dashboards []importedDashboard `json:"dashboards"`
+}
+
+// dashboardFile is a dashboard read from an export directory.
+type dashboardFile struct {
+	path      string
+	folderUID string
+	dashboard map[string]any
+}
+
+// walkDashboardDir calls fn with the path, relative to dir, and folder UID
+// of each JSON file in the layout of an export directory.
+func walkDashboardDir(dir string, fn func(rel, folderUID string) error) error {
+	return filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		depth := len(strings.Split(rel, string(filepath.Separator)))
+		if d.IsDir() {
+			// Skip directories such as .git, and anything below folders.
+			if rel != "." && (strings.HasPrefix(d.Name(), ".") || depth > 1) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) != ".json" {
+			return nil
+		}
+		folderUID := ""
+		if depth == 2 {
+			folderUID = filepath.Dir(rel)
+		}
+		return fn(rel, folderUID)
+	})
+}
+
+// readDashboardDir reads the dashboards exported to a directory. Each UID
+// must be in a single file, so that its folder is unambiguous.
+func readDashboardDir(dir string) ([]dashboardFile, error) {
+	var files []dashboardFile
+	paths := map[string]string{}
+	err := walkDashboardDir(dir, func(rel, folderUID string) error {
+		data, err := os.ReadFile(filepath.Join(dir, rel))
+		if err != nil {
+			return err
+		}
+		var db map[string]any
+		if err := json.Unmarshal(data, &db); err != nil {
+			return fmt.Errorf("parse %s: %w", rel, err)
+		}
+		uid, _ := db["uid"].(string)
+		if uid == "" {
+			return fmt.Errorf("dashboard %s has no uid", rel)
+		}
+		if other, ok := paths[uid]; ok {
+			return fmt.Errorf("dashboard uid %s is in both %s and %s, delete the stale file or export again with prune", uid, other, rel)
+		}
+		paths[uid] = rel
+		files = append(files, dashboardFile{path: rel, folderUID: folderUID, dashboard: db})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read dashboards from %s: %w", dir, err)
+	}
+	return files, nil
+}
+
+// planDashboardImport compares a dashboard file with the dashboard in
+// Grafana, which is nil if it doesn't exist yet.
+func planDashboardImport(file dashboardFile, current map[string]any, currentFolderUID string) importedDashboard {
+	uid, _ := file.dashboard["uid"].(string)
+	title, _ := file.dashboard["title"].(string)
+	imported := importedDashboard{
+		UID:       uid,
+		Title:     title,
+		FolderUID: file.folderUID,
+		Path:      file.path,
+		Action:    importActionCreate,
+	}
+	if current == nil {
+		return imported
+	}
+	diffJSON("", normalizeDashboard(current), normalizeDashboard(file.dashboard), &imported.Changes)
+	if currentFolderUID != file.folderUID {
+		imported.Changes = append(imported.Changes, fieldChange{Path: "folderUid", Before: currentFolderUID, After: file.folderUID})
+	}
+	imported.Action = importActionUpdate
+	if len(imported.Changes) == 0 {
+		imported.Action = importActionUnchanged
+	}
+	return imported
+}
+
+func ImportDashboardsTool(ctx context.Context, args ImportDashboardsParams) (*importResult, error) {
+	if args.Directory == "" {
+		return nil, fmt.Errorf("directory is required")
+	}
+	files, err := readDashboardDir(args.Directory)
+	if err != nil {
+		return nil, err
+	}
+
+	c := mcpgrafana.GrafanaClientFromContext(ctx)
+	result := &importResult{DryRun: !args.Apply, Dashboards: []importedDashboard{}}
+	for _, file := range files {
+		uid, _ := file.dashboard["uid"].(string)
+		var current map[string]any
+		var currentFolderUID string
+		resp, err := c.Dashboards.GetDashboardByUID(uid)
+		var notFound *dashboards.GetDashboardByUIDNotFound
+		switch {
+		case errors.As(err, &notFound):
+		case err != nil:
+			return nil, fmt.Errorf("get dashboard by uid %s: %w", uid, err)
+		default:
+			current, _ = resp.Payload.Dashboard.(map[string]any)
+			if resp.Payload.Meta != nil {
+				currentFolderUID = resp.Payload.Meta.FolderUID
+			}
+		}
+		imported := planDashboardImport(file, current, currentFolderUID)
+		result.Dashboards = append(result.Dashboards, imported)
+
+		if !args.Apply || imported.Action == importActionUnchanged {
+			continue
+		}
+		message := args.Message
+		if message == "" {
+			message = "Imported from " + filepath.ToSlash(file.path)
+		}
+		if _, err := updateDashboard(ctx, UpdateDashboardParams{
+			Dashboard: normalizeDashboard(file.dashboard),
+			FolderUID: file.folderUID,
+			Message:   message,
+			Overwrite: true,
+		}); err != nil {
+			return nil, fmt.Errorf("import %s: %w", file.path, err)
+		}
+	}
+	return result, nil
+}
+
+var ImportDashboards = mcpgrafana.MustTool(
+	"import_dashboards",
+	"Import dashboards from a local directory written by export_dashboards, creating or overwriting the dashboards with the same UIDs in the folders named by their subdirectories. By default this is a dry run returning, for each dashboard, whether it would be created, updated or is unchanged, with the changed fields. Review the changes, then call it again with apply set to true to save them.",
+	ImportDashboardsTool,
+	mcp.WithTitleAnnotation("Import dashboards"),
+	mcp.WithDestructiveHintAnnotation(true),
+)
@@ -0,0 +1,142 @@
+//go:build unit
+// +build unit
+
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarshalDashboard(t *testing.T) {
+	db := map[string]any{
+		"uid":     "abc",
+		"title":   "Service <overview>",
+		"id":      float64(12),
+		"version": float64(3),
+		"panels":  []any{map[string]any{"type": "stat", "id": float64(1)}},
+	}
+	data, err := marshalDashboard(normalizeDashboard(db))
+	require.NoError(t, err)
+	assert.Equal(t, `{
+  "panels": [
+    {
+      "id": 1,
+      "type": "stat"
+    }
+  ],
+  "title": "Service <overview>",
+  "uid": "abc"
+}
+`, string(data))
+}
+
+func TestDashboardFilePath(t *testing.T) {
+	path, err := dashboardFilePath("", "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "abc.json", path)
+
+	path, err = dashboardFilePath("team-a", "abc")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join("team-a", "abc.json"), path)
+
+	_, err = dashboardFilePath("..", "abc")
+	assert.Error(t, err)
+	_, err = dashboardFilePath("", "a/b")
+	assert.Error(t, err)
+}
+
+func TestReadDashboardDir(t *testing.T) {
+	dir := t.TempDir()
+	write := func(path, content string) {
+		full := filepath.Join(dir, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(full), 0o755))
+		require.NoError(t, os.WriteFile(full, []byte(content), 0o644))
+	}
+	write("root.json", `{"uid": "root", "title": "Root"}`)
+	write("team-a/service.json", `{"uid": "service", "title": "Service"}`)
+	write("team-a/README.md", `Not a dashboard`)
+	write("team-a/nested/ignored.json", `{"uid": "ignored"}`)
+	write(".git/config.json", `{}`)
+
+	files, err := readDashboardDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	assert.Equal(t, "root.json", files[0].path)
+	assert.Empty(t, files[0].folderUID)
+	assert.Equal(t, filepath.Join("team-a", "service.json"), files[1].path)
+	assert.Equal(t, "team-a", files[1].folderUID)
+
+	// After a move, the dashboard would be imported to either folder.
+	write("team-b/service.json", `{"uid": "service", "title": "Service"}`)
+	_, err = readDashboardDir(dir)
+	assert.ErrorContains(t, err, "dashboard uid service is in both "+filepath.Join("team-a", "service.json")+" and "+filepath.Join("team-b", "service.json"))
+	require.NoError(t, os.Remove(filepath.Join(dir, "team-b", "service.json")))
+
+	write("invalid.json", `{"title": "No UID"}`)
+	_, err = readDashboardDir(dir)
+	assert.ErrorContains(t, err, "has no uid")
+}
+
+func TestPruneDashboardDir(t *testing.T) {
+	dir := t.TempDir()
+	write := func(path, content string) {
+		full := filepath.Join(dir, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(full), 0o755))
+		require.NoError(t, os.WriteFile(full, []byte(content), 0o644))
+	}
+	exists := func(path string) bool {
+		_, err := os.Stat(filepath.Join(dir, path))
+		return err == nil
+	}
+	write("root.json", `{"uid": "root"}`)
+	write("deleted.json", `{"uid": "deleted"}`)
+	write("team-a/service.json", `{"uid": "service"}`)
+	write("team-b/service.json", `{"uid": "service"}`)
+	write("team-b/settings.json", `{"theme": "dark"}`)
+	write("team-c/other.json", `{"uid": "other"}`)
+
+	written := map[string]bool{"root.json": true, filepath.Join("team-a", "service.json"): true}
+
+	// Only the exported folders are pruned.
+	pruned, err := pruneDashboardDir(dir, []string{"team-a", "team-b"}, written)
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join("team-b", "service.json")}, pruned)
+	assert.True(t, exists("deleted.json"))
+	assert.True(t, exists("team-b/settings.json"))
+
+	pruned, err = pruneDashboardDir(dir, nil, written)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"deleted.json", filepath.Join("team-c", "other.json")}, pruned)
+	assert.True(t, exists("root.json"))
+	assert.True(t, exists("team-a/service.json"))
+}
+
+func TestPlanDashboardImport(t *testing.T) {
+	file := dashboardFile{
+		path:      "team-a/service.json",
+		folderUID: "team-a",
+		dashboard: map[string]any{"uid": "service", "title": "Service", "refresh": "1m"},
+	}
+
+	created := planDashboardImport(file, nil, "")
+	assert.Equal(t, importActionCreate, created.Action)
+	assert.Equal(t, "Service", created.Title)
+
+	current := map[string]any{"uid": "service", "title": "Service", "refresh": "1m", "id": float64(7), "version": float64(4)}
+	unchanged := planDashboardImport(file, current, "team-a")
+	assert.Equal(t, importActionUnchanged, unchanged.Action)
+	assert.Empty(t, unchanged.Changes)
+
+	current = map[string]any{"uid": "service", "title": "Service", "refresh": "5m"}
+	updated := planDashboardImport(file, current, "team-b")
+	assert.Equal(t, importActionUpdate, updated.Action)
+	assert.Equal(t, []fieldChange{
+		{Path: "/refresh", Before: "5m", After: "1m"},
+		{Path: "folderUid", Before: "team-b", After: "team-a"},
+	}, updated.Changes)
+}
@@ -0,0 +1,438 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	mcpgrafana "mcp-grafana-local"
+	"mcp-grafana-local/internal/interpolate"
+	"mcp-grafana-local/internal/jsonpatch"
+)
+
+// The rules checked by lint_dashboard.
+const (
+	lintRuleHardcodedDatasource = "hardcoded-datasource"
+	lintRuleMissingUnit         = "missing-unit"
+	lintRuleRateInterval        = "rate-interval"
+	lintRuleMissingTitle        = "missing-title"
+	lintRuleDuplicatePanelID    = "duplicate-panel-id"
+	lintRuleUnusedVariable      = "unused-variable"
+	lintRuleHighCardinality     = "high-cardinality"
+	lintRuleInvalidQuery        = "invalid-query"
+)
+
+var lintRules = []string{
+	lintRuleHardcodedDatasource,
+	lintRuleMissingUnit,
+	lintRuleRateInterval,
+	lintRuleMissingTitle,
+	lintRuleDuplicatePanelID,
+	lintRuleUnusedVariable,
+	lintRuleHighCardinality,
+	lintRuleInvalidQuery,
+}
+
+// Severities of lint findings.
+const (
+	lintSeverityError   = "error"
+	lintSeverityWarning = "warning"
+	lintSeverityInfo    = "info"
+)
+
+var (
+	// unitPanelTypes are the panel types displaying numbers, which should
+	// have a unit.
+	unitPanelTypes = []string{"timeseries", "stat", "gauge", "bargauge", "barchart", "trend"}
+
+	// rateFunctions are the PromQL functions whose range should be
+	// $__rate_interval.
+	rateFunctions = []string{"rate", "irate", "increase"}
+
+	// highCardinalityLabels are labels that usually have an unbounded number
+	// of values, so grouping by them returns many series.
+	highCardinalityLabels = []string{"id", "container_id", "path", "url", "uri", "user", "user_id", "email", "ip", "client_ip", "session_id", "request_id", "trace_id"}
+)
+
+type LintDashboardParams struct {
+	UID   string   `json:"uid" jsonschema:"required,description=The UID of the dashboard"`
+	Rules []string `json:"rules,omitempty" jsonschema:"description=Optionally\\, the rules to check. Defaults to all rules: hardcoded-datasource\\, missing-unit\\, rate-interval\\, missing-title\\, duplicate-panel-id\\, unused-variable\\, high-cardinality and invalid-query"`
+}
+
+func (p LintDashboardParams) validate() error {
+	for _, rule := range p.Rules {
+		if !slices.Contains(lintRules, rule) {
+			return fmt.Errorf("unknown rule %q, must be one of %s", rule, strings.Join(lintRules, ", "))
+		}
+	}
+	return nil
+}
+
+type lintFinding struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	// Path is the JSON Pointer of the offending value in the dashboard, or
+	// of where it is missing.
+	Path    string `json:"path"`
+	PanelID int    `json:"panelId,omitempty"`
+	RefID   string `json:"refId,omitempty"`
+	Message string `json:"message"`
+}
+
+type lintResult struct {
+	UID      string        `json:"uid"`
+	Version  int64         `json:"version"`
+	Findings []lintFinding `json:"findings"`
+}
+
+func lintDashboard(ctx context.Context, args LintDashboardParams) (*lintResult, error) {
+	if err := args.validate(); err != nil {
+		return nil, err
+	}
+	dashboard, err := getDashboardByUID(ctx, GetDashboardByUIDParams{UID: args.UID})
+	if err != nil {
+		return nil, err
+	}
+	db, ok := dashboard.Dashboard.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("dashboard is not a JSON object")
+	}
+
+	result := &lintResult{UID: args.UID, Findings: lintDashboardJSON(db, args.Rules)}
+	if version, ok := db["version"].(float64); ok {
+		result.Version = int64(version)
+	}
+	return result, nil
+}
+
+var LintDashboard = mcpgrafana.MustTool(
+	"lint_dashboard",
+	"Check a dashboard against best practices: hard-coded datasource UIDs instead of datasource variables (hardcoded-datasource), panels without a unit (missing-unit), rate(), irate() and increase() without $__rate_interval (rate-interval), panels without a title (missing-title), duplicate panel IDs (duplicate-panel-id), template variables that are never used (unused-variable), Prometheus queries likely to return many series (high-cardinality) and Prometheus queries that can't be parsed and so can't be checked (invalid-query). Each finding has a rule, a severity (error, warning or info), a message and the JSON Pointer path of the offending value, which can be used with patch_dashboard together with the returned version to fix it.",
+	lintDashboard,
+	mcp.WithTitleAnnotation("Lint dashboard"),
+	mcp.WithIdempotentHintAnnotation(true),
+	mcp.WithReadOnlyHintAnnotation(true),
+)
+
+// dashboardLinter collects the findings of the enabled rules.
+type dashboardLinter struct {
+	rules    []string
+	findings []lintFinding
+	// panelIDs maps panel IDs to the path of the first panel using them.
+	panelIDs map[int]string
+}
+
+// lintDashboardJSON checks a dashboard JSON model against the given rules,
+// or all rules if none are given.
+func lintDashboardJSON(db map[string]any, rules []string) []lintFinding {
+	if len(rules) == 0 {
+		rules = lintRules
+	}
+	l := &dashboardLinter{rules: rules, findings: []lintFinding{}, panelIDs: map[int]string{}}
+
+	panels, _ := db["panels"].([]any)
+	l.lintPanels(panels, jsonpatch.Pointer("panels"))
+	l.lintVariables(db)
+	return l.findings
+}
+
+func (l *dashboardLinter) enabled(rule string) bool {
+	return slices.Contains(l.rules, rule)
+}
+
+func (l *dashboardLinter) report(f lintFinding) {
+	if l.enabled(f.Rule) {
+		l.findings = append(l.findings, f)
+	}
+}
+
+func (l *dashboardLinter) lintPanels(panels []any, path string) {
+	for i, p := range panels {
+		panel, ok := p.(map[string]any)
+		if !ok {
+			continue
+		}
+		panelPath := path + jsonpatch.Pointer(strconv.Itoa(i))
+		l.lintPanel(panel, panelPath)
+		for _, key := range []string{"collapsed", "panels"} {
+			if nested, ok := panel[key].([]any); ok {
+				l.lintPanels(nested, panelPath+jsonpatch.Pointer(key))
+			}
+		}
+	}
+}
+
+func (l *dashboardLinter) lintPanel(panel map[string]any, path string) {
+	id, hasID := panel["id"].(float64)
+	panelID := int(id)
+	if hasID {
+		if first, ok := l.panelIDs[panelID]; ok {
+			l.report(lintFinding{
+				Rule:     lintRuleDuplicatePanelID,
+				Severity: lintSeverityError,
+				Path:     path + jsonpatch.Pointer("id"),
+				PanelID:  panelID,
+				Message:  fmt.Sprintf("Panel ID %d is also used by the panel at %s. Panels are addressed by ID, so give each one a unique ID.", panelID, first),
+			})
+		} else {
+			l.panelIDs[panelID] = path
+		}
+	}
+
+	panelType, _ := panel["type"].(string)
+	if panelType == "row" {
+		return
+	}
+
+	if title, _ := panel["title"].(string); strings.TrimSpace(title) == "" && panelType != "text" {
+		l.report(lintFinding{
+			Rule:     lintRuleMissingTitle,
+			Severity: lintSeverityWarning,
+			Path:     path + jsonpatch.Pointer("title"),
+			PanelID:  panelID,
+			Message:  "Panel has no title.",
+		})
+	}
+
+	l.lintDatasourceRef(panel["datasource"], path+jsonpatch.Pointer("datasource"), panelID, "")
+
+	targets, _ := panel["targets"].([]any)
+	if slices.Contains(unitPanelTypes, panelType) && len(targets) > 0 {
+		fieldConfig, _ := panel["fieldConfig"].(map[string]any)
+		defaults, _ := fieldConfig["defaults"].(map[string]any)
+		if unit, _ := defaults["unit"].(string); unit == "" {
+			l.report(lintFinding{
+				Rule:     lintRuleMissingUnit,
+				Severity: lintSeverityInfo,
+				Path:     path + jsonpatch.Pointer("fieldConfig", "defaults", "unit"),
+				PanelID:  panelID,
+				Message:  fmt.Sprintf("%s panel has no unit.", panelType),
+			})
+		}
+	}
+
+	for i, t := range targets {
+		target, ok := t.(map[string]any)
+		if !ok {
+			continue
+		}
+		targetPath := path + jsonpatch.Pointer("targets", strconv.Itoa(i))
+		refID, _ := target["refId"].(string)
+		l.lintDatasourceRef(target["datasource"], targetPath+jsonpatch.Pointer("datasource"), panelID, refID)
+
+		dsType := targetDatasourceType(panel, target)
+		query, language := targetQuery(target, dsType)
+		if language == "promql" && query != "" {
+			field, _ := queryFieldFor(target, dsType)
+			l.lintPromQL(query, targetPath+jsonpatch.Pointer(field.field), panelID, refID)
+		}
+	}
+}
+
+// lintDatasourceRef reports datasource references by UID or name rather than
+// through a datasource variable.
+func (l *dashboardLinter) lintDatasourceRef(ref any, path string, panelID int, refID string) {
+	var uid string
+	switch ref := ref.(type) {
+	case string:
+		uid = ref
+	case map[string]any:
+		uid, _ = ref["uid"].(string)
+		path += jsonpatch.Pointer("uid")
+	}
+	switch uid {
+	case "", "default", grafanaDatasourceUID, "-- Grafana --", mixedDatasourceUID, dashboardDatasourceUID:
+		return
+	}
+	if len(interpolate.Variables(uid)) > 0 {
+		return
+	}
+	l.report(lintFinding{
+		Rule:     lintRuleHardcodedDatasource,
+		Severity: lintSeverityWarning,
+		Path:     path,
+		PanelID:  panelID,
+		RefID:    refID,
+		Message:  fmt.Sprintf("Datasource %q is hard-coded. Use a datasource variable such as ${datasource} so the dashboard works with other datasources.", uid),
+	})
+}
+
+// lintPromQL checks the rate-interval and high-cardinality rules. Queries
+// that can't be parsed are reported, as they can't be checked.
+func (l *dashboardLinter) lintPromQL(query, path string, panelID int, refID string) {
+	if !l.enabled(lintRuleRateInterval) && !l.enabled(lintRuleHighCardinality) && !l.enabled(lintRuleInvalidQuery) {
+		return
+	}
+	expr, restore, err := parseTemplatedPromQL(query)
+	if err != nil {
+		l.report(lintFinding{
+			Rule:     lintRuleInvalidQuery,
+			Severity: lintSeverityError,
+			Path:     path,
+			PanelID:  panelID,
+			RefID:    refID,
+			Message:  fmt.Sprintf("Query can't be parsed as PromQL, so it wasn't checked: %s", restore.Replace(err.Error())),
+		})
+		return
+	}
+
+	reported := map[string]bool{}
+	report := func(rule, message string) {
+		if !reported[message] {
+			reported[message] = true
+			l.report(lintFinding{Rule: rule, Severity: lintSeverityWarning, Path: path, PanelID: panelID, RefID: refID, Message: message})
+		}
+	}
+
+	parser.Inspect(expr, func(node parser.Node, ancestors []parser.Node) error {
+		switch n := node.(type) {
+		case *parser.Call:
+			if !slices.Contains(rateFunctions, n.Func.Name) || len(n.Args) == 0 {
+				return nil
+			}
+			var queryRange time.Duration
+			switch arg := n.Args[0].(type) {
+			case *parser.MatrixSelector:
+				queryRange = arg.Range
+			case *parser.SubqueryExpr:
+				queryRange = arg.Range
+			}
+			if restore.Replace(model.Duration(queryRange).String()) != "$__rate_interval" {
+				report(lintRuleRateInterval, fmt.Sprintf("%s() should use [$__rate_interval] as its range, so it adapts to the scrape interval and the dashboard time range.", n.Func.Name))
+			}
+		case *parser.AggregateExpr:
+			if n.Without {
+				return nil
+			}
+			for _, label := range n.Grouping {
+				if slices.Contains(highCardinalityLabels, label) {
+					report(lintRuleHighCardinality, fmt.Sprintf("%s by %q returns a series for each %s, which usually has many values.", n.Op, label, label))
+				}
+			}
+		case *parser.VectorSelector:
+			metric := selectorMetricName(n)
+			if metric == "" {
+				report(lintRuleHighCardinality, fmt.Sprintf("Selector %s matches series of any metric name. Select a single metric.", restore.Replace(n.String())))
+				return nil
+			}
+			if hasLabelFilter(n.LabelMatchers) || isAggregated(ancestors) {
+				return nil
+			}
+			report(lintRuleHighCardinality, fmt.Sprintf("Every series of %s is returned. Add label matchers, e.g. for the dashboard variables, or aggregate it.", restore.Replace(metric)))
+		}
+		return nil
+	})
+}
+
+// parseTemplatedPromQL parses a PromQL query, replacing its template
+// variables with placeholders suiting their position first. The returned
+// replacer turns the placeholders back into the variables, such as the range
+// of rate(x[$__rate_interval]).
+func parseTemplatedPromQL(query string) (parser.Expr, *strings.Replacer, error) {
+	query, restore := replaceWithPlaceholders(query)
+	expr, err := parser.ParseExpr(query)
+	return expr, restore, err
+}
+
+// hasLabelFilter reports whether any matcher other than the metric name
+// restricts the selected series.
+func hasLabelFilter(matchers []*labels.Matcher) bool {
+	for _, m := range matchers {
+		if m.Name == labels.MetricName {
+			continue
+		}
+		if m.Type == labels.MatchRegexp && (m.Value == ".*" || m.Value == ".+") {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// isAggregated reports whether any of the ancestors of a node reduces the
+// number of series by aggregating them.
+func isAggregated(ancestors []parser.Node) bool {
+	for _, n := range ancestors {
+		if agg, ok := n.(*parser.AggregateExpr); ok && !agg.Without {
+			return true
+		}
+	}
+	return false
+}
+
+// lintVariables checks the datasources of template variables and reports
+// variables that aren't referenced anywhere in the dashboard.
+func (l *dashboardLinter) lintVariables(db map[string]any) {
+	templating, _ := db["templating"].(map[string]any)
+	list, _ := templating["list"].([]any)
+
+	used := map[string]bool{}
+	allUsed := false
+	var collect func(value any)
+	collect = func(value any) {
+		switch v := value.(type) {
+		case string:
+			if strings.Contains(v, "__all_variables") {
+				allUsed = true
+			}
+			for _, name := range interpolate.Variables(v) {
+				used[name] = true
+			}
+		case map[string]any:
+			for key, e := range v {
+				if key == "repeat" {
+					if name, ok := e.(string); ok {
+						used[name] = true
+					}
+				}
+				collect(e)
+			}
+		case []any:
+			for _, e := range v {
+				collect(e)
+			}
+		}
+	}
+	collect(withoutKeys(db, "templating"))
+	for _, item := range list {
+		if v, ok := item.(map[string]any); ok {
+			// The selected values may look like references.
+			collect(withoutKeys(v, "current", "options"))
+		}
+	}
+	links, _ := db["links"].([]any)
+	for _, link := range links {
+		if link, ok := link.(map[string]any); ok && link["includeVars"] == true {
+			allUsed = true
+		}
+	}
+
+	for i, item := range list {
+		v, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		path := jsonpatch.Pointer("templating", "list", strconv.Itoa(i))
+		l.lintDatasourceRef(v["datasource"], path+jsonpatch.Pointer("datasource"), 0, "")
+
+		name, _ := v["name"].(string)
+		// Ad hoc filters apply to queries without being referenced.
+		if name == "" || v["type"] == "adhoc" || allUsed || used[name] {
+			continue
+		}
+		l.report(lintFinding{
+			Rule:     lintRuleUnusedVariable,
+			Severity: lintSeverityInfo,
+			Path:     path,
+			Message:  fmt.Sprintf("Variable %q isn't used by any panel, variable or link.", name),
+		})
+	}
+}
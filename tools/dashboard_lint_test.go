@@ -0,0 +1,109 @@
+//go:build unit
+// +build unit
+
+package tools
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLintDashboardJSON(t *testing.T) {
+	var db map[string]any
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"templating": {"list": [
+			{"name": "datasource", "type": "datasource", "query": "prometheus"},
+			{"name": "job", "type": "query", "datasource": {"type": "prometheus", "uid": "${datasource}"}, "query": "label_values(up, job)"},
+			{"name": "instance", "type": "query", "datasource": {"type": "prometheus", "uid": "prom-uid"}, "query": "label_values(up{job=\"$job\"}, instance)"},
+			{"name": "unused", "type": "custom", "query": "a,b", "current": {"value": "$unused"}},
+			{"name": "filters", "type": "adhoc"}
+		]},
+		"panels": [
+			{
+				"id": 1, "type": "timeseries", "title": "Requests",
+				"datasource": {"type": "prometheus", "uid": "${datasource}"},
+				"fieldConfig": {"defaults": {"unit": "reqps"}},
+				"targets": [
+					{"refId": "A", "expr": "sum by (job) (rate(http_requests_total{job=~\"$job\"}[$__rate_interval]))"},
+					{"refId": "B", "expr": "sum by (path) (rate(http_requests_total{job=~\"$job\", instance=~\"$instance\"}[5m]))"}
+				]
+			},
+			{
+				"id": 2, "type": "stat", "title": "",
+				"datasource": {"type": "prometheus", "uid": "prom-uid"},
+				"targets": [{"refId": "A", "expr": "up"}]
+			},
+			{"id": 3, "type": "row", "title": "Details", "collapsed": true, "panels": [
+				{
+					"id": 2, "type": "table", "title": "Mixed",
+					"datasource": {"type": "datasource", "uid": "-- Mixed --"},
+					"targets": [
+						{"refId": "A", "datasource": {"type": "prometheus", "uid": "prom-uid"}, "expr": "{__name__=~\"node_.+\"}"},
+						{"refId": "B", "datasource": {"type": "prometheus", "uid": "$datasource"}, "expr": "sum by ($label) (label_replace(up, \"$label\", \"$1\", \"job\", \"(.*)\"))"}
+					]
+				}
+			]},
+			{"id": 4, "type": "text", "options": {"content": "Requests are filtered by $job"}}
+		]
+	}`), &db))
+
+	assert.Equal(t, []lintFinding{
+		{Rule: lintRuleHighCardinality, Severity: lintSeverityWarning, Path: "/panels/0/targets/1/expr", PanelID: 1, RefID: "B", Message: `sum by "path" returns a series for each path, which usually has many values.`},
+		{Rule: lintRuleRateInterval, Severity: lintSeverityWarning, Path: "/panels/0/targets/1/expr", PanelID: 1, RefID: "B", Message: "rate() should use [$__rate_interval] as its range, so it adapts to the scrape interval and the dashboard time range."},
+		{Rule: lintRuleMissingTitle, Severity: lintSeverityWarning, Path: "/panels/1/title", PanelID: 2, Message: "Panel has no title."},
+		{Rule: lintRuleHardcodedDatasource, Severity: lintSeverityWarning, Path: "/panels/1/datasource/uid", PanelID: 2, Message: `Datasource "prom-uid" is hard-coded. Use a datasource variable such as ${datasource} so the dashboard works with other datasources.`},
+		{Rule: lintRuleMissingUnit, Severity: lintSeverityInfo, Path: "/panels/1/fieldConfig/defaults/unit", PanelID: 2, Message: "stat panel has no unit."},
+		{Rule: lintRuleHighCardinality, Severity: lintSeverityWarning, Path: "/panels/1/targets/0/expr", PanelID: 2, RefID: "A", Message: "Every series of up is returned. Add label matchers, e.g. for the dashboard variables, or aggregate it."},
+		{Rule: lintRuleDuplicatePanelID, Severity: lintSeverityError, Path: "/panels/2/panels/0/id", PanelID: 2, Message: "Panel ID 2 is also used by the panel at /panels/1. Panels are addressed by ID, so give each one a unique ID."},
+		{Rule: lintRuleHardcodedDatasource, Severity: lintSeverityWarning, Path: "/panels/2/panels/0/targets/0/datasource/uid", PanelID: 2, RefID: "A", Message: `Datasource "prom-uid" is hard-coded. Use a datasource variable such as ${datasource} so the dashboard works with other datasources.`},
+		{Rule: lintRuleHighCardinality, Severity: lintSeverityWarning, Path: "/panels/2/panels/0/targets/0/expr", PanelID: 2, RefID: "A", Message: `Selector {__name__=~"node_.+"} matches series of any metric name. Select a single metric.`},
+		{Rule: lintRuleHardcodedDatasource, Severity: lintSeverityWarning, Path: "/templating/list/2/datasource/uid", Message: `Datasource "prom-uid" is hard-coded. Use a datasource variable such as ${datasource} so the dashboard works with other datasources.`},
+		{Rule: lintRuleUnusedVariable, Severity: lintSeverityInfo, Path: "/templating/list/3", Message: `Variable "unused" isn't used by any panel, variable or link.`},
+	}, lintDashboardJSON(db, nil))
+
+	t.Run("selected rules", func(t *testing.T) {
+		findings := lintDashboardJSON(db, []string{lintRuleDuplicatePanelID, lintRuleMissingTitle})
+		require.Len(t, findings, 2)
+		assert.Equal(t, lintRuleMissingTitle, findings[0].Rule)
+		assert.Equal(t, lintRuleDuplicatePanelID, findings[1].Rule)
+	})
+
+	t.Run("dashboard links with variables", func(t *testing.T) {
+		db["links"] = []any{map[string]any{"type": "dashboards", "includeVars": true}}
+		defer delete(db, "links")
+		assert.Empty(t, lintDashboardJSON(db, []string{lintRuleUnusedVariable}))
+	})
+}
+
+func TestLintPromQLTemplated(t *testing.T) {
+	lint := func(expr string) []lintFinding {
+		return lintDashboardJSON(map[string]any{"panels": []any{map[string]any{
+			"id": float64(1), "type": "timeseries", "title": "Requests",
+			"datasource":  map[string]any{"type": "prometheus", "uid": "${datasource}"},
+			"fieldConfig": map[string]any{"defaults": map[string]any{"unit": "reqps"}},
+			"targets":     []any{map[string]any{"refId": "A", "expr": expr}},
+		}}}, nil)
+	}
+
+	assert.Empty(t, lint(`sum by ($group) (rate(http_requests_total{job="$job"}[${__rate_interval}]))`))
+	assert.Empty(t, lint(`sum(rate({__name__="http_requests_total"}[$__rate_interval]))`))
+	assert.Empty(t, lint(`$metric{job="$job"}`))
+	assert.Equal(t, []lintFinding{{
+		Rule: lintRuleRateInterval, Severity: lintSeverityWarning, Path: "/panels/0/targets/0/expr", PanelID: 1, RefID: "A",
+		Message: "rate() should use [$__rate_interval] as its range, so it adapts to the scrape interval and the dashboard time range.",
+	}}, lint(`sum(rate(http_requests_total{job="$job"}[$__range_s]))`))
+
+	findings := lint(`sum(rate(http_requests_total{job="$job"}[5m])`)
+	require.Len(t, findings, 1)
+	assert.Equal(t, lintRuleInvalidQuery, findings[0].Rule)
+	assert.Equal(t, lintSeverityError, findings[0].Severity)
+	assert.Equal(t, "/panels/0/targets/0/expr", findings[0].Path)
+}
+
+func TestLintDashboardParamsValidate(t *testing.T) {
+	assert.NoError(t, LintDashboardParams{UID: "a", Rules: []string{lintRuleUnusedVariable}}.validate())
+	assert.ErrorContains(t, LintDashboardParams{UID: "a", Rules: []string{"no-such-rule"}}.validate(), "unknown rule")
+}
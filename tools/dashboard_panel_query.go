@@ -0,0 +1,301 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+
+	mcpgrafana "mcp-grafana-local"
+	"mcp-grafana-local/internal/interpolate"
+)
+
+type RunPanelQueryParams struct {
+	DashboardUID  string            `json:"dashboardUid" jsonschema:"required,description=The UID of the dashboard"`
+	PanelID       int               `json:"panelId,omitempty" jsonschema:"description=The ID of the panel to run. Either panelId or panelTitle is required"`
+	PanelTitle    string            `json:"panelTitle,omitempty" jsonschema:"description=The title of the panel to run\\, matched case-insensitively. Either panelId or panelTitle is required"`
+	Variables     map[string]string `json:"variables,omitempty" jsonschema:"description=Optionally\\, values for template variables overriding the current values saved in the dashboard. Use '{a\\,b}' for multiple values"`
+	From          string            `json:"from,omitempty" jsonschema:"description=Optionally\\, the start time (RFC3339\\, epoch ms\\, or relative to now like 'now-1h'). Defaults to the dashboard time range"`
+	To            string            `json:"to,omitempty" jsonschema:"description=Optionally\\, the end time (RFC3339\\, epoch ms\\, or relative to now like 'now'). Defaults to the dashboard time range"`
+	MaxDataPoints int               `json:"maxDataPoints,omitempty" jsonschema:"description=Optionally\\, the maximum number of points per series of range queries. Defaults to the panel's max data points or 200"`
+	Summarize     bool              `json:"summarize,omitempty" jsonschema:"description=If true\\, return per-series statistics for the top series of Prometheus queries instead of every sample"`
+	TopN          int               `json:"topN,omitempty" jsonschema:"description=The number of series to include when summarize is true. Defaults to 10"`
+	IncludeLink   bool              `json:"includeLink,omitempty" jsonschema:"description=If true\\, also return a link to the panel with the variables and time range used\\, and a link to each query in Grafana Explore"`
+}
+
+type panelTargetResult struct {
+	RefID        string         `json:"refId,omitempty"`
+	Datasource   datasourceInfo `json:"datasource"`
+	Query        string         `json:"query"`
+	LegendFormat string         `json:"legendFormat,omitempty"`
+	Result       any            `json:"result,omitempty"`
+	Error        string         `json:"error,omitempty"`
+	ExploreLink  string         `json:"exploreLink,omitempty"`
+}
+
+type runPanelQueryResult struct {
+	PanelID    int                 `json:"panelId"`
+	PanelTitle string              `json:"panelTitle"`
+	From       string              `json:"from"`
+	To         string              `json:"to"`
+	Targets    []panelTargetResult `json:"targets"`
+	Link       string              `json:"link,omitempty"`
+}
+
+func (p RunPanelQueryParams) validate() error {
+	if p.PanelID == 0 && p.PanelTitle == "" {
+		return fmt.Errorf("either panelId or panelTitle is required")
+	}
+	if p.MaxDataPoints < 0 {
+		return fmt.Errorf("invalid maxDataPoints: %d, must not be negative", p.MaxDataPoints)
+	}
+	if p.TopN < 0 {
+		return fmt.Errorf("invalid topN: %d, must not be negative", p.TopN)
+	}
+	return nil
+}
+
+func runPanelQuery(ctx context.Context, args RunPanelQueryParams) (*runPanelQueryResult, error) {
+	if err := args.validate(); err != nil {
+		return nil, err
+	}
+
+	dashboard, err := getDashboardByUID(ctx, GetDashboardByUIDParams{UID: args.DashboardUID})
+	if err != nil {
+		return nil, err
+	}
+	db, panels, err := dashboardPanels(dashboard)
+	if err != nil {
+		return nil, err
+	}
+
+	queries, err := findPanelQueries(extractPanelQueries(resolveLibraryPanels(panels, libraryPanelModels(ctx))), args.PanelID, args.PanelTitle)
+	if err != nil {
+		return nil, err
+	}
+
+	from, to, err := dashboardTimeRange(db, args.From, args.To)
+	if err != nil {
+		return nil, err
+	}
+	if to.Before(from) {
+		return nil, fmt.Errorf("end time %s is before start time %s", to.Format(time.RFC3339), from.Format(time.RFC3339))
+	}
+	_, variables := resolveDashboardVariables(ctx, db, args.Variables, from, to)
+
+	result := &runPanelQueryResult{
+		PanelID:    queries[0].PanelID,
+		PanelTitle: queries[0].Title,
+		From:       from.UTC().Format(time.RFC3339),
+		To:         to.UTC().Format(time.RFC3339),
+		Targets:    make([]panelTargetResult, 0, len(queries)),
+	}
+	for _, q := range queries {
+		if q.Hidden {
+			continue
+		}
+		target := runPanelTarget(ctx, q, variables, from, to, args)
+		if args.IncludeLink && target.Datasource.UID != "" {
+			target.ExploreLink = panelTargetExploreLink(ctx, q, target, result.From, result.To)
+		}
+		result.Targets = append(result.Targets, target)
+	}
+	if args.IncludeLink {
+		result.Link = dashboardLink(ctx, args.DashboardUID, args.Variables, result.From, result.To, result.PanelID)
+	}
+	return result, nil
+}
+
+// panelTargetExploreLink returns the Explore URL of a panel query, as it was
+// run with the variables interpolated.
+func panelTargetExploreLink(ctx context.Context, q panelQuery, target panelTargetResult, from, to string) string {
+	query := map[string]any{"expr": target.Query}
+	switch target.Datasource.Type {
+	case "prometheus":
+		instant, _ := q.target["instant"].(bool)
+		isRange, _ := q.target["range"].(bool)
+		query["instant"], query["range"] = instant && !isRange, !instant || isRange
+	case "loki":
+		query["queryType"] = "range"
+	}
+	return exploreLink(ctx, target.Datasource, query, from, to)
+}
+
+var RunPanelQuery = mcpgrafana.MustTool(
+	"run_panel_query",
+	"Run the queries of a dashboard panel and return the results of each query, labeled with its refId and legend format. The panel is identified by its ID or title. The panel's datasource is resolved (including `$datasource` variables and per-query datasources of mixed panels) and template variables are interpolated using their current dashboard values or the values given in `variables`. The time range defaults to the dashboard's. Prometheus and Loki queries are supported; hidden queries are skipped. Prefer summarize for long time ranges. Set includeLink to true to also get a link to the panel with the variables and time range used, and an Explore link for each query, so a human can check the results.",
+	runPanelQuery,
+	mcp.WithTitleAnnotation("Run panel query"),
+	mcp.WithIdempotentHintAnnotation(true),
+	mcp.WithReadOnlyHintAnnotation(true),
+)
+
+// findPanelQueries returns the queries of the panel with the given ID, or
+// with the given title if id is zero.
+func findPanelQueries(queries []panelQuery, id int, title string) ([]panelQuery, error) {
+	var (
+		result []panelQuery
+		ids    []int
+	)
+	for _, q := range queries {
+		if id != 0 && q.PanelID != id {
+			continue
+		}
+		if id == 0 && !strings.EqualFold(strings.TrimSpace(q.Title), strings.TrimSpace(title)) {
+			continue
+		}
+		result = append(result, q)
+		if !slices.Contains(ids, q.PanelID) {
+			ids = append(ids, q.PanelID)
+		}
+	}
+
+	if len(result) == 0 {
+		if id != 0 {
+			return nil, fmt.Errorf("no queries found for panel %d", id)
+		}
+		return nil, fmt.Errorf("no queries found for panel titled %q", title)
+	}
+	if len(ids) > 1 {
+		return nil, fmt.Errorf("several panels are titled %q (ids %v), use panelId to select one", title, ids)
+	}
+	return result, nil
+}
+
+// runPanelTarget runs a single panel query. Errors are reported in the
+// result so that the other queries of the panel still run.
+func runPanelTarget(ctx context.Context, q panelQuery, variables map[string]interpolate.Variable, from, to time.Time, args RunPanelQueryParams) panelTargetResult {
+	result := panelTargetResult{RefID: q.RefID, Query: q.Query}
+	result.LegendFormat, _ = q.target["legendFormat"].(string)
+
+	// Queries of mixed panels have their own datasource, and other queries
+	// may repeat the panel's.
+	ref := q.panel["datasource"]
+	if targetRef, ok := q.target["datasource"]; ok && targetRef != nil {
+		ref = targetRef
+	}
+	ds, err := resolveDatasource(ctx, ref, variables)
+	if err != nil {
+		result.Error = fmt.Sprintf("resolving datasource: %s", err)
+		return result
+	}
+	result.Datasource = ds
+
+	switch ds.Type {
+	case "prometheus":
+		result.Result, result.Query, err = runPanelPrometheusTarget(ctx, q, ds, variables, from, to, args)
+	case "loki":
+		result.Result, result.Query, err = runPanelLokiTarget(ctx, q, ds, variables, from, to)
+	default:
+		err = fmt.Errorf("running queries of %q datasources is not supported", ds.Type)
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func runPanelPrometheusTarget(ctx context.Context, q panelQuery, ds datasourceInfo, variables map[string]interpolate.Variable, from, to time.Time, args RunPanelQueryParams) (any, string, error) {
+	maxDataPoints := args.MaxDataPoints
+	if maxDataPoints == 0 {
+		if panelMax, ok := q.panel["maxDataPoints"].(float64); ok && panelMax > 0 {
+			maxDataPoints = int(panelMax)
+		}
+	}
+
+	step, err := computeStep(from, to, 0, maxDataPoints)
+	if err != nil {
+		return nil, q.Query, err
+	}
+	minInterval, err := panelMinInterval(q, variables)
+	if err != nil {
+		return nil, q.Query, err
+	}
+	if minInterval > step {
+		step = minInterval
+	}
+
+	expr, err := interpolateQuery(q.Query, interpolate.Options{
+		Variables:     variables,
+		From:          from,
+		To:            to,
+		Interval:      step,
+		MaxDataPoints: maxDataPoints,
+		DefaultFormat: interpolate.FormatPrometheus,
+	})
+	if err != nil {
+		return nil, q.Query, err
+	}
+
+	// Instant queries are evaluated at the end of the time range, as in
+	// Grafana.
+	r := promv1.Range{Start: from, End: to, Step: step}
+	instant, _ := q.target["instant"].(bool)
+	isRange, _ := q.target["range"].(bool)
+	if instant && !isRange {
+		r = promv1.Range{Start: to}
+	}
+
+	value, err := executePrometheusQuery(ctx, ds.UID, expr, r)
+	if err != nil {
+		return nil, expr, err
+	}
+	if args.Summarize {
+		return summarizePrometheusResult(value, args.TopN), expr, nil
+	}
+	return value, expr, nil
+}
+
+// panelMinInterval returns the minimum interval of a query, set on the
+// query or on its panel.
+func panelMinInterval(q panelQuery, variables map[string]interpolate.Variable) (time.Duration, error) {
+	interval, _ := q.target["interval"].(string)
+	if interval == "" {
+		interval, _ = q.panel["interval"].(string)
+	}
+	if interval == "" {
+		return 0, nil
+	}
+	interval, err := interpolateValue(interval, interpolate.Options{Variables: variables})
+	if err != nil {
+		return 0, err
+	}
+	// Grafana allows a leading '>' to mark the interval as a minimum.
+	d, err := model.ParseDuration(strings.TrimPrefix(strings.TrimSpace(interval), ">"))
+	if err != nil {
+		return 0, fmt.Errorf("parsing min interval %q: %w", interval, err)
+	}
+	return time.Duration(d), nil
+}
+
+func runPanelLokiTarget(ctx context.Context, q panelQuery, ds datasourceInfo, variables map[string]interpolate.Variable, from, to time.Time) (any, string, error) {
+	query, err := interpolateQuery(q.Query, interpolate.Options{
+		Variables:     variables,
+		From:          from,
+		To:            to,
+		DefaultFormat: interpolate.FormatPrometheus,
+	})
+	if err != nil {
+		return nil, q.Query, err
+	}
+
+	client, err := newLokiClient(ctx, ds.UID)
+	if err != nil {
+		return nil, query, fmt.Errorf("creating Loki client: %w", err)
+	}
+
+	limit := 0
+	if maxLines, ok := q.target["maxLines"].(float64); ok {
+		limit = int(maxLines)
+	}
+	streams, err := client.fetchLogs(ctx, query, from.Format(time.RFC3339), to.Format(time.RFC3339), enforceLogLimit(limit), "backward")
+	if err != nil {
+		return nil, query, err
+	}
+	return logEntriesFromStreams(streams), query, nil
+}
@@ -0,0 +1,209 @@
+//go:build unit
+// +build unit
+
+package tools
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"mcp-grafana-local/internal/interpolate"
+)
+
+const testPanelsJSON = `[
+	{
+		"id": 1,
+		"title": "Requests",
+		"datasource": {"type": "prometheus", "uid": "$datasource"},
+		"interval": "$min_interval",
+		"targets": [
+			{"refId": "A", "expr": "sum(rate(http_requests_total{job=\"$job\"}[$__rate_interval]))"},
+			{"refId": "B", "expr": "up", "hide": true}
+		]
+	},
+	{
+		"id": 2,
+		"type": "row",
+		"title": "Details",
+		"panels": [
+			{
+				"id": 3,
+				"title": "Errors",
+				"datasource": {"type": "loki", "uid": "loki"},
+				"targets": [{"refId": "A", "expr": "{app=\"$app\"} |= \"error\""}]
+			},
+			{
+				"id": 4,
+				"title": "errors",
+				"targets": [{"refId": "A", "expr": "errors_total", "interval": "1m"}]
+			}
+		]
+	},
+	{"id": 5, "title": "Text", "type": "text"}
+]`
+
+func testPanelQueries(t *testing.T) []panelQuery {
+	var panels []any
+	require.NoError(t, json.Unmarshal([]byte(testPanelsJSON), &panels))
+	return extractPanelQueries(panels)
+}
+
+func TestExtractPanelQueries(t *testing.T) {
+	queries := testPanelQueries(t)
+	require.Len(t, queries, 4)
+
+	assert.Equal(t, 1, queries[0].PanelID)
+	assert.Equal(t, "Requests", queries[0].Title)
+	assert.Equal(t, datasourceInfo{UID: "$datasource", Type: "prometheus"}, queries[0].Datasource)
+	assert.Equal(t, []string{"job"}, queries[0].Variables)
+	assert.Equal(t, "A", queries[0].RefID)
+	assert.True(t, queries[1].Hidden)
+
+	assert.Equal(t, 3, queries[2].PanelID)
+	assert.Equal(t, []string{"app"}, queries[2].Variables)
+	assert.Equal(t, 4, queries[3].PanelID)
+	assert.Equal(t, "", queries[3].Language)
+}
+
+func TestExtractPanelQueriesDatasourceTypes(t *testing.T) {
+	var panels []any
+	require.NoError(t, json.Unmarshal([]byte(`[
+		{
+			"id": 1,
+			"title": "Logs",
+			"datasource": {"type": "loki", "uid": "loki"},
+			"targets": [{"refId": "A", "expr": "{app=\"api\"}", "editorMode": "builder"}]
+		},
+		{
+			"id": 2,
+			"title": "Orders",
+			"datasource": {"type": "grafana-postgresql-datasource", "uid": "pg"},
+			"targets": [{"refId": "A", "rawSql": "SELECT count(*) FROM orders WHERE $__timeFilter(created_at)", "hide": true}]
+		},
+		{
+			"id": 3,
+			"title": "Traces",
+			"datasource": {"type": "tempo", "uid": "tempo"},
+			"targets": [
+				{"refId": "A", "queryType": "traceql", "query": "{ status = error }"},
+				{"refId": "B", "queryType": "traceId", "query": "abc123"}
+			]
+		},
+		{
+			"id": 4,
+			"title": "Search",
+			"datasource": {"type": "elasticsearch", "uid": "es"},
+			"targets": [{"refId": "A", "query": "level:error"}]
+		},
+		{
+			"id": 5,
+			"title": "Mixed",
+			"datasource": {"type": "datasource", "uid": "-- Mixed --"},
+			"targets": [
+				{"refId": "A", "datasource": {"type": "prometheus", "uid": "prom"}, "expr": "up"},
+				{"refId": "B", "datasource": {"type": "mysql", "uid": "mysql"}, "rawSql": "SELECT 1"}
+			]
+		},
+		{
+			"id": 6,
+			"title": "Variable datasource",
+			"datasource": {"uid": "$ds"},
+			"targets": [
+				{"refId": "A", "datasource": {"uid": "$ds"}, "rawSql": "SELECT 2"},
+				{"refId": "B", "expr": "up"}
+			]
+		}
+	]`), &panels))
+
+	queries := extractPanelQueries(panels)
+	require.Len(t, queries, 9)
+
+	type summary struct {
+		panelID  int
+		refID    string
+		query    string
+		language string
+		hidden   bool
+	}
+	summaries := make([]summary, 0, len(queries))
+	for _, q := range queries {
+		summaries = append(summaries, summary{q.PanelID, q.RefID, q.Query, q.Language, q.Hidden})
+	}
+	assert.Equal(t, []summary{
+		{1, "A", `{app="api"}`, "logql", false},
+		{2, "A", "SELECT count(*) FROM orders WHERE $__timeFilter(created_at)", "sql", true},
+		{3, "A", "{ status = error }", "traceql", false},
+		{3, "B", "abc123", "traceId", false},
+		{4, "A", "level:error", "lucene", false},
+		{5, "A", "up", "promql", false},
+		{5, "B", "SELECT 1", "sql", false},
+		{6, "A", "SELECT 2", "sql", false},
+		{6, "B", "up", "", false},
+	}, summaries)
+
+	assert.Nil(t, queries[0].TargetDatasource)
+	assert.Empty(t, queries[1].Variables)
+	assert.Equal(t, datasourceInfo{UID: "-- Mixed --", Type: "datasource"}, queries[5].Datasource)
+	assert.Equal(t, &datasourceInfo{UID: "prom", Type: "prometheus"}, queries[5].TargetDatasource)
+	assert.Equal(t, &datasourceInfo{UID: "mysql", Type: "mysql"}, queries[6].TargetDatasource)
+	assert.Nil(t, queries[7].TargetDatasource)
+	assert.Equal(t, []string{"ds"}, interpolate.Variables(queries[7].Datasource.UID))
+}
+
+func TestFindPanelQueries(t *testing.T) {
+	queries := testPanelQueries(t)
+
+	found, err := findPanelQueries(queries, 1, "")
+	require.NoError(t, err)
+	assert.Len(t, found, 2)
+
+	found, err = findPanelQueries(queries, 0, " requests ")
+	require.NoError(t, err)
+	assert.Len(t, found, 2)
+	assert.Equal(t, 1, found[0].PanelID)
+
+	_, err = findPanelQueries(queries, 0, "Errors")
+	assert.ErrorContains(t, err, "several panels")
+
+	found, err = findPanelQueries(queries, 4, "Errors")
+	require.NoError(t, err)
+	assert.Equal(t, "errors_total", found[0].Query)
+
+	_, err = findPanelQueries(queries, 5, "")
+	assert.ErrorContains(t, err, "no queries found for panel 5")
+}
+
+func TestPanelMinInterval(t *testing.T) {
+	queries := testPanelQueries(t)
+	variables := map[string]interpolate.Variable{
+		"min_interval": {Name: "min_interval", Values: []string{">30s"}},
+	}
+
+	interval, err := panelMinInterval(queries[0], variables)
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, interval)
+
+	_, err = panelMinInterval(queries[0], nil)
+	var unresolved *UnresolvedVariablesError
+	assert.ErrorAs(t, err, &unresolved)
+
+	interval, err = panelMinInterval(queries[2], nil)
+	require.NoError(t, err)
+	assert.Zero(t, interval)
+
+	interval, err = panelMinInterval(queries[3], nil)
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, interval)
+}
+
+func TestRunPanelQueryParamsValidate(t *testing.T) {
+	assert.Error(t, RunPanelQueryParams{DashboardUID: "a"}.validate())
+	assert.NoError(t, RunPanelQueryParams{DashboardUID: "a", PanelID: 1}.validate())
+	assert.NoError(t, RunPanelQueryParams{DashboardUID: "a", PanelTitle: "x"}.validate())
+	assert.Error(t, RunPanelQueryParams{DashboardUID: "a", PanelID: 1, MaxDataPoints: -1}.validate())
+	assert.Error(t, RunPanelQueryParams{DashboardUID: "a", PanelID: 1, TopN: -1}.validate())
+}
@@ -0,0 +1,221 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/grafana-openapi-client-go/models"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	mcpgrafana "mcp-grafana-local"
+	"mcp-grafana-local/internal/jsonpatch"
+)
+
+// opSetQuery is the panel operation replacing the query of a panel target.
+const opSetQuery = "set_query"
+
+type JSONPatchOperation struct {
+	Op    string `json:"op" jsonschema:"required,description=The operation: 'add'\\, 'remove'\\, 'replace'\\, 'move'\\, 'copy' or 'test'"`
+	Path  string `json:"path" jsonschema:"required,description=JSON Pointer to the location to change\\, e.g. '/panels/0/title' or '/tags/-' to append to an array"`
+	From  string `json:"from,omitempty" jsonschema:"description=JSON Pointer to the value to move or copy"`
+	Value any    `json:"value,omitempty" jsonschema:"description=The value to add or replace\\, or to compare with for 'test'"`
+}
+
+type PanelOperation struct {
+	PanelID int    `json:"panelId" jsonschema:"required,description=The ID of the panel to change"`
+	Op      string `json:"op" jsonschema:"required,description=Either 'set_query' to replace the query of the target with the given refId\\, or a JSON Patch operation ('add'\\, 'remove'\\, 'replace'\\, 'move'\\, 'copy' or 'test') with paths relative to the panel"`
+	Path    string `json:"path,omitempty" jsonschema:"description=JSON Pointer relative to the panel\\, e.g. '/title' or '/fieldConfig/defaults/unit'. An empty path is the panel itself\\, so 'remove' with an empty path removes the panel"`
+	From    string `json:"from,omitempty" jsonschema:"description=JSON Pointer relative to the panel of the value to move or copy"`
+	Value   any    `json:"value,omitempty" jsonschema:"description=The value to add or replace\\, or to compare with for 'test'"`
+	RefID   string `json:"refId,omitempty" jsonschema:"description=The refId of the target whose query 'set_query' replaces"`
+	Query   string `json:"query,omitempty" jsonschema:"description=The new query text for 'set_query'"`
+}
+
+type PatchDashboardParams struct {
+	UID             string               `json:"uid" jsonschema:"required,description=The UID of the dashboard to patch"`
+	Operations      []JSONPatchOperation `json:"operations,omitempty" jsonschema:"description=RFC 6902 JSON Patch operations applied to the dashboard JSON\\, in order"`
+	PanelOperations []PanelOperation     `json:"panelOperations,omitempty" jsonschema:"description=Operations on panels identified by ID\\, applied in order after operations"`
+	Version         int64                `json:"version,omitempty" jsonschema:"description=Optionally\\, the dashboard version the operations were written against. The patch is rejected if the dashboard has changed since"`
+	Message         string               `json:"message,omitempty" jsonschema:"description=Optionally\\, a commit message for the version history"`
+	IncludeLink     bool                 `json:"includeLink,omitempty" jsonschema:"description=If true\\, also return a link to the patched dashboard"`
+}
+
+func (p PatchDashboardParams) validate() error {
+	if len(p.Operations) == 0 && len(p.PanelOperations) == 0 {
+		return fmt.Errorf("at least one operation or panel operation is required")
+	}
+	return nil
+}
+
+func patchDashboard(ctx context.Context, args PatchDashboardParams) (*models.PostDashboardOKBody, error) {
+	if err := args.validate(); err != nil {
+		return nil, err
+	}
+
+	dashboard, err := getDashboardByUID(ctx, GetDashboardByUIDParams{UID: args.UID})
+	if err != nil {
+		return nil, err
+	}
+	db, ok := dashboard.Dashboard.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("dashboard is not a JSON object")
+	}
+
+	if args.Version != 0 {
+		version, _ := db["version"].(float64)
+		if int64(version) != args.Version {
+			return nil, fmt.Errorf("dashboard %s is at version %d, not %d: it has changed since the operations were written, fetch it again", args.UID, int64(version), args.Version)
+		}
+	}
+
+	patched, err := patchDashboardJSON(db, args.Operations, args.PanelOperations)
+	if err != nil {
+		return nil, err
+	}
+
+	// The patched dashboard keeps the version it was fetched at, so Grafana
+	// rejects the save if the dashboard was changed in the meantime.
+	c := mcpgrafana.GrafanaClientFromContext(ctx)
+	var folderUID string
+	if dashboard.Meta != nil {
+		folderUID = dashboard.Meta.FolderUID
+	}
+	resp, err := c.Dashboards.PostDashboard(&models.SaveDashboardCommand{
+		Dashboard: patched,
+		FolderUID: folderUID,
+		Message:   args.Message,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to save dashboard: %w", err)
+	}
+	return resp.Payload, nil
+}
+
+func patchDashboardTool(ctx context.Context, args PatchDashboardParams) (*savedDashboard, error) {
+	body, err := patchDashboard(ctx, args)
+	return savedDashboardResult(ctx, body, err, args.IncludeLink)
+}
+
+var PatchDashboard = mcpgrafana.MustTool(
+	"patch_dashboard",
+	"Change parts of an existing dashboard without sending the full dashboard JSON. Applies RFC 6902 JSON Patch `operations` to the dashboard JSON and then `panelOperations`, which address panels by ID: either JSON Patch operations with paths relative to the panel, or `set_query` to replace the query of a panel target by refId. All operations are applied or none. Pass the `version` returned by get_dashboard_by_uid to reject the patch if the dashboard changed since. The dashboard stays in its folder. Set includeLink to true to also get a link to the patched dashboard.",
+	patchDashboardTool,
+	mcp.WithTitleAnnotation("Patch dashboard"),
+	mcp.WithDestructiveHintAnnotation(true),
+)
+
+// patchDashboardJSON applies JSON Patch operations and then panel operations
+// to a dashboard, returning the patched copy.
+func patchDashboardJSON(db map[string]any, operations []JSONPatchOperation, panelOperations []PanelOperation) (map[string]any, error) {
+	ops := make([]jsonpatch.Operation, 0, len(operations))
+	for _, op := range operations {
+		ops = append(ops, jsonpatch.Operation(op))
+	}
+	doc, err := jsonpatch.Apply(db, ops)
+	if err != nil {
+		return nil, fmt.Errorf("applying operations: %w", err)
+	}
+
+	// Panel operations are resolved one at a time, as earlier operations
+	// may move or remove panels.
+	for i, panelOp := range panelOperations {
+		op, err := resolvePanelOperation(doc, panelOp)
+		if err == nil {
+			doc, err = jsonpatch.Apply(doc, []jsonpatch.Operation{op})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("applying panel operation %d (%s on panel %d): %w", i, panelOp.Op, panelOp.PanelID, err)
+		}
+	}
+
+	patched, ok := doc.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("patched dashboard is not a JSON object")
+	}
+	return patched, nil
+}
+
+// resolvePanelOperation converts a panel operation to a JSON Patch operation
+// on the whole dashboard.
+func resolvePanelOperation(doc any, op PanelOperation) (jsonpatch.Operation, error) {
+	panelPath, err := findPanelPointer(doc, op.PanelID)
+	if err != nil {
+		return jsonpatch.Operation{}, err
+	}
+
+	if op.Op != opSetQuery {
+		for _, p := range []string{op.Path, op.From} {
+			if p != "" && !strings.HasPrefix(p, "/") {
+				return jsonpatch.Operation{}, fmt.Errorf("invalid path %q: must be empty or start with '/'", p)
+			}
+		}
+		resolved := jsonpatch.Operation{Op: op.Op, Path: panelPath + op.Path, Value: op.Value}
+		if op.Op == jsonpatch.OpMove || op.Op == jsonpatch.OpCopy {
+			resolved.From = panelPath + op.From
+		}
+		return resolved, nil
+	}
+
+	if op.RefID == "" {
+		return jsonpatch.Operation{}, fmt.Errorf("refId is required for %s", opSetQuery)
+	}
+	value, err := jsonpatch.Get(doc, panelPath)
+	if err != nil {
+		return jsonpatch.Operation{}, err
+	}
+	panel, _ := value.(map[string]any)
+	targets, _ := panel["targets"].([]any)
+	for i, t := range targets {
+		target, ok := t.(map[string]any)
+		if !ok || target["refId"] != op.RefID {
+			continue
+		}
+		field, ok := queryFieldFor(target, targetDatasourceType(panel, target))
+		if !ok {
+			field.field = "expr"
+		}
+		return jsonpatch.Operation{
+			Op:    jsonpatch.OpAdd,
+			Path:  panelPath + jsonpatch.Pointer("targets", strconv.Itoa(i), field.field),
+			Value: op.Query,
+		}, nil
+	}
+	return jsonpatch.Operation{}, fmt.Errorf("panel has no target with refId %q", op.RefID)
+}
+
+// findPanelPointer returns the JSON Pointer of the panel with the given ID,
+// searching panels nested in rows.
+func findPanelPointer(doc any, id int) (string, error) {
+	db, ok := doc.(map[string]any)
+	if !ok {
+		return "", fmt.Errorf("dashboard is not a JSON object")
+	}
+	var find func(panels []any, path string) (string, bool)
+	find = func(panels []any, path string) (string, bool) {
+		for i, p := range panels {
+			panel, ok := p.(map[string]any)
+			if !ok {
+				continue
+			}
+			panelPath := path + jsonpatch.Pointer(strconv.Itoa(i))
+			if panelID, ok := panel["id"].(float64); ok && int(panelID) == id {
+				return panelPath, true
+			}
+			for _, key := range []string{"collapsed", "panels"} {
+				if nested, ok := panel[key].([]any); ok {
+					if found, ok := find(nested, panelPath+jsonpatch.Pointer(key)); ok {
+						return found, true
+					}
+				}
+			}
+		}
+		return "", false
+	}
+	panels, _ := db["panels"].([]any)
+	if path, ok := find(panels, jsonpatch.Pointer("panels")); ok {
+		return path, nil
+	}
+	return "", fmt.Errorf("panel %d not found", id)
+}
@@ -0,0 +1,130 @@
+//go:build unit
+// +build unit
+
+package tools
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPatchDashboardJSON = `{
+	"uid": "abc",
+	"title": "Service",
+	"version": 3,
+	"tags": ["a"],
+	"panels": [
+		{
+			"id": 1,
+			"title": "Requests",
+			"datasource": {"type": "prometheus", "uid": "prom"},
+			"targets": [{"refId": "A", "expr": "rate(x[5m])"}]
+		},
+		{
+			"id": 2,
+			"type": "row",
+			"title": "Database",
+			"panels": [
+				{
+					"id": 3,
+					"title": "Queries",
+					"datasource": {"type": "mysql", "uid": "db"},
+					"targets": [{"refId": "A", "rawSql": "SELECT 1"}]
+				}
+			]
+		}
+	]
+}`
+
+func testPatchDashboard(t *testing.T) map[string]any {
+	var db map[string]any
+	require.NoError(t, json.Unmarshal([]byte(testPatchDashboardJSON), &db))
+	return db
+}
+
+func TestPatchDashboardJSON(t *testing.T) {
+	t.Run("json patch operations", func(t *testing.T) {
+		db := testPatchDashboard(t)
+		patched, err := patchDashboardJSON(db, []JSONPatchOperation{
+			{Op: "replace", Path: "/title", Value: "Service v2"},
+			{Op: "add", Path: "/tags/-", Value: "b"},
+		}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "Service v2", patched["title"])
+		assert.Equal(t, []any{"a", "b"}, patched["tags"])
+		assert.Equal(t, "Service", db["title"], "the original dashboard is unchanged")
+	})
+
+	t.Run("panel operations", func(t *testing.T) {
+		patched, err := patchDashboardJSON(testPatchDashboard(t), nil, []PanelOperation{
+			{PanelID: 1, Op: "set_query", RefID: "A", Query: "rate(x[$__rate_interval])"},
+			{PanelID: 3, Op: "set_query", RefID: "A", Query: "SELECT 2"},
+			{PanelID: 3, Op: "replace", Path: "/title", Value: "DB queries"},
+			{PanelID: 3, Op: "add", Path: "/fieldConfig", Value: map[string]any{"defaults": map[string]any{"unit": "ops"}}},
+		})
+		require.NoError(t, err)
+
+		panels := patched["panels"].([]any)
+		requests := panels[0].(map[string]any)
+		assert.Equal(t, "rate(x[$__rate_interval])", requests["targets"].([]any)[0].(map[string]any)["expr"])
+
+		queries := panels[1].(map[string]any)["panels"].([]any)[0].(map[string]any)
+		assert.Equal(t, "DB queries", queries["title"])
+		assert.Equal(t, "SELECT 2", queries["targets"].([]any)[0].(map[string]any)["rawSql"])
+		assert.Equal(t, "ops", queries["fieldConfig"].(map[string]any)["defaults"].(map[string]any)["unit"])
+	})
+
+	t.Run("panel operations follow earlier operations", func(t *testing.T) {
+		patched, err := patchDashboardJSON(testPatchDashboard(t), []JSONPatchOperation{
+			{Op: "move", From: "/panels/0", Path: "/panels/-"},
+		}, []PanelOperation{
+			{PanelID: 1, Op: "test", Path: "/title", Value: "Requests"},
+			{PanelID: 3, Op: "remove"},
+		})
+		require.NoError(t, err)
+		panels := patched["panels"].([]any)
+		require.Len(t, panels, 2)
+		assert.Equal(t, float64(1), panels[1].(map[string]any)["id"])
+		assert.Empty(t, panels[0].(map[string]any)["panels"])
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		db := testPatchDashboard(t)
+
+		_, err := patchDashboardJSON(db, []JSONPatchOperation{{Op: "test", Path: "/version", Value: 2}}, nil)
+		assert.ErrorContains(t, err, "test failed")
+
+		_, err = patchDashboardJSON(db, nil, []PanelOperation{{PanelID: 42, Op: "remove"}})
+		assert.ErrorContains(t, err, "panel 42 not found")
+
+		_, err = patchDashboardJSON(db, nil, []PanelOperation{{PanelID: 1, Op: "set_query", RefID: "B", Query: "up"}})
+		assert.ErrorContains(t, err, `no target with refId "B"`)
+
+		_, err = patchDashboardJSON(db, nil, []PanelOperation{{PanelID: 1, Op: "set_query", Query: "up"}})
+		assert.ErrorContains(t, err, "refId is required")
+
+		_, err = patchDashboardJSON(db, nil, []PanelOperation{{PanelID: 1, Op: "replace", Path: "title", Value: "x"}})
+		assert.ErrorContains(t, err, "invalid path")
+
+		_, err = patchDashboardJSON(db, []JSONPatchOperation{{Op: "replace", Path: "", Value: []any{}}}, nil)
+		assert.ErrorContains(t, err, "not a JSON object")
+	})
+}
+
+func TestFindPanelPointer(t *testing.T) {
+	db := testPatchDashboard(t)
+
+	path, err := findPanelPointer(db, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "/panels/0", path)
+
+	path, err = findPanelPointer(db, 3)
+	require.NoError(t, err)
+	assert.Equal(t, "/panels/1/panels/0", path)
+
+	_, err = findPanelPointer(db, 4)
+	assert.Error(t, err)
+}
@@ -0,0 +1,502 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/grafana/grafana-openapi-client-go/models"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	mcpgrafana "mcp-grafana-local"
+	"mcp-grafana-local/internal/interpolate"
+)
+
+const (
+	// dashboardGridWidth is the number of columns of the dashboard grid.
+	dashboardGridWidth = 24
+	// defaultSpecPanelHeight is the height of panels without an explicit
+	// height, in grid units of 30 pixels.
+	defaultSpecPanelHeight = 8
+	// maxSpecPanelsPerLine is the number of panels placed side by side when
+	// panels don't have an explicit width.
+	maxSpecPanelsPerLine = 4
+
+	defaultSpecPanelType    = "timeseries"
+	defaultSpecVariableType = "query"
+	defaultThresholdColor   = "green"
+)
+
+var specVariableTypes = []string{"query", "custom", "constant", "textbox", "interval", "datasource"}
+
+type DashboardSpecVariable struct {
+	Name       string `json:"name" jsonschema:"required,description=The variable name\\, referenced in queries as $name"`
+	Type       string `json:"type,omitempty" jsonschema:"description=The variable type: 'query' (default)\\, 'custom'\\, 'constant'\\, 'textbox'\\, 'interval' or 'datasource'"`
+	Label      string `json:"label,omitempty" jsonschema:"description=The label shown in the variable picker"`
+	Query      string `json:"query,omitempty" jsonschema:"description=For query variables the query\\, e.g. 'label_values(up\\, job)'; for custom and interval variables the comma separated values; for constant and textbox variables the value; for datasource variables the datasource type\\, e.g. 'prometheus'"`
+	Datasource string `json:"datasource,omitempty" jsonschema:"description=The UID of the datasource of a query variable. Defaults to the dashboard datasource"`
+	Multi      bool   `json:"multi,omitempty" jsonschema:"description=Whether several values can be selected"`
+	IncludeAll bool   `json:"includeAll,omitempty" jsonschema:"description=Whether to add an 'All' option"`
+	Current    string `json:"current,omitempty" jsonschema:"description=The initially selected value"`
+}
+
+type DashboardSpecQuery struct {
+	Query      string `json:"query" jsonschema:"required,description=The query text\\, e.g. PromQL for Prometheus or LogQL for Loki"`
+	Legend     string `json:"legend,omitempty" jsonschema:"description=The legend format\\, e.g. '{{job}}'"`
+	Datasource string `json:"datasource,omitempty" jsonschema:"description=The UID of the datasource\\, if different from the panel datasource"`
+}
+
+type DashboardSpecThreshold struct {
+	Value float64 `json:"value" jsonschema:"required,description=The value from which the color applies"`
+	Color string  `json:"color" jsonschema:"required,description=The color\\, e.g. 'orange'\\, 'red' or '#ff0000'"`
+}
+
+type DashboardSpecPanel struct {
+	Title       string                   `json:"title" jsonschema:"required,description=The panel title"`
+	Type        string                   `json:"type,omitempty" jsonschema:"description=The panel type\\, e.g. 'timeseries' (default)\\, 'stat'\\, 'gauge'\\, 'bargauge'\\, 'table'\\, 'logs' or 'text'"`
+	Description string                   `json:"description,omitempty" jsonschema:"description=The panel description"`
+	Datasource  string                   `json:"datasource,omitempty" jsonschema:"description=The UID of the panel datasource or a datasource variable like '${datasource}'. Defaults to the dashboard datasource"`
+	Queries     []DashboardSpecQuery     `json:"queries,omitempty" jsonschema:"description=The panel queries"`
+	Unit        string                   `json:"unit,omitempty" jsonschema:"description=The unit of the values\\, e.g. 'percent'\\, 'percentunit'\\, 'bytes'\\, 's'\\, 'ms'\\, 'reqps' or 'short'"`
+	Min         *float64                 `json:"min,omitempty" jsonschema:"description=The minimum of the value axis"`
+	Max         *float64                 `json:"max,omitempty" jsonschema:"description=The maximum of the value axis"`
+	Thresholds  []DashboardSpecThreshold `json:"thresholds,omitempty" jsonschema:"description=Thresholds in increasing order. Values below the first threshold are green"`
+	Content     string                   `json:"content,omitempty" jsonschema:"description=The markdown content of text panels"`
+	Width       int                      `json:"width,omitempty" jsonschema:"description=The width in grid columns\\, from 1 to 24. By default panels share the line with up to 3 others"`
+	Height      int                      `json:"height,omitempty" jsonschema:"description=The height in grid units of 30 pixels (default 8)"`
+}
+
+type DashboardSpecRow struct {
+	Title     string               `json:"title,omitempty" jsonschema:"description=The row title. Only the first row may have no title\\, in which case its panels are shown above all rows"`
+	Collapsed bool                 `json:"collapsed,omitempty" jsonschema:"description=Whether the row is collapsed"`
+	Panels    []DashboardSpecPanel `json:"panels" jsonschema:"required,description=The panels of the row\\, laid out left to right and top to bottom"`
+}
+
+type CreateDashboardFromSpecParams struct {
+	Title       string                  `json:"title" jsonschema:"required,description=The dashboard title"`
+	UID         string                  `json:"uid,omitempty" jsonschema:"description=The dashboard UID. Generated by Grafana if not set"`
+	Description string                  `json:"description,omitempty" jsonschema:"description=The dashboard description"`
+	Tags        []string                `json:"tags,omitempty" jsonschema:"description=The dashboard tags"`
+	FolderUID   string                  `json:"folderUid,omitempty" jsonschema:"description=The UID of the folder to save the dashboard in"`
+	Datasource  string                  `json:"datasource,omitempty" jsonschema:"description=The UID of the datasource used by panels and variables without their own\\, or a datasource variable like '${datasource}'. Defaults to the default datasource"`
+	From        string                  `json:"from,omitempty" jsonschema:"description=The start of the default time range (default 'now-6h')"`
+	To          string                  `json:"to,omitempty" jsonschema:"description=The end of the default time range (default 'now')"`
+	Refresh     string                  `json:"refresh,omitempty" jsonschema:"description=The auto-refresh interval\\, e.g. '30s'"`
+	Variables   []DashboardSpecVariable `json:"variables,omitempty" jsonschema:"description=The template variables"`
+	Rows        []DashboardSpecRow      `json:"rows" jsonschema:"required,description=The rows of panels"`
+	Message     string                  `json:"message,omitempty" jsonschema:"description=A commit message for the version history"`
+	Overwrite   bool                    `json:"overwrite,omitempty" jsonschema:"description=Overwrite an existing dashboard with the same UID or title in the folder"`
+	IncludeLink bool                    `json:"includeLink,omitempty" jsonschema:"description=If true\\, also return a link to the saved dashboard"`
+}
+
+func (p CreateDashboardFromSpecParams) validate() error {
+	if p.Title == "" {
+		return fmt.Errorf("title is required")
+	}
+	if len(p.Rows) == 0 {
+		return fmt.Errorf("at least one row is required")
+	}
+	names := map[string]bool{}
+	for _, v := range p.Variables {
+		if v.Name == "" {
+			return fmt.Errorf("variable name is required")
+		}
+		if names[v.Name] {
+			return fmt.Errorf("duplicate variable %q", v.Name)
+		}
+		names[v.Name] = true
+		if v.Type != "" && !slices.Contains(specVariableTypes, v.Type) {
+			return fmt.Errorf("variable %q has unknown type %q, must be one of %s", v.Name, v.Type, strings.Join(specVariableTypes, ", "))
+		}
+		if v.Type == "datasource" && v.Query == "" {
+			return fmt.Errorf("datasource variable %q needs the datasource type as its query", v.Name)
+		}
+	}
+	for i, row := range p.Rows {
+		if row.Title == "" && i > 0 {
+			return fmt.Errorf("row %d has no title: only the first row may have no title", i)
+		}
+		for _, panel := range row.Panels {
+			if panel.Width < 0 || panel.Width > dashboardGridWidth {
+				return fmt.Errorf("panel %q has width %d, must be between 1 and %d", panel.Title, panel.Width, dashboardGridWidth)
+			}
+			if panel.Height < 0 {
+				return fmt.Errorf("panel %q has a negative height", panel.Title)
+			}
+			for j := 1; j < len(panel.Thresholds); j++ {
+				if panel.Thresholds[j].Value <= panel.Thresholds[j-1].Value {
+					return fmt.Errorf("panel %q has thresholds out of order: they must be increasing", panel.Title)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func createDashboardFromSpec(ctx context.Context, args CreateDashboardFromSpecParams) (*models.PostDashboardOKBody, error) {
+	if err := args.validate(); err != nil {
+		return nil, err
+	}
+	db, err := buildDashboardFromSpec(args, func(uid string) (datasourceInfo, error) {
+		return resolveDatasource(ctx, uid, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updateDashboard(ctx, UpdateDashboardParams{
+		Dashboard: db,
+		FolderUID: args.FolderUID,
+		Message:   args.Message,
+		Overwrite: args.Overwrite,
+	})
+}
+
+func createDashboardFromSpecTool(ctx context.Context, args CreateDashboardFromSpecParams) (*savedDashboard, error) {
+	body, err := createDashboardFromSpec(ctx, args)
+	return savedDashboardResult(ctx, body, err, args.IncludeLink)
+}
+
+var CreateDashboardFromSpec = mcpgrafana.MustTool(
+	"create_dashboard_from_spec",
+	"Create a dashboard from a compact spec instead of the full dashboard JSON: a title, template variables, and rows of panels with their type, queries, unit and thresholds. The panels are laid out on the grid automatically, left to right and top to bottom within each row, and queries are written to the field used by their datasource type. Datasources can be given by UID or as a datasource variable like '${datasource}'. Returns the UID, URL and version of the saved dashboard. Set includeLink to true to also get a link to the saved dashboard.",
+	createDashboardFromSpecTool,
+	mcp.WithTitleAnnotation("Create dashboard from spec"),
+	mcp.WithDestructiveHintAnnotation(true),
+)
+
+// dashboardSpecBuilder expands a dashboard spec into dashboard JSON.
+type dashboardSpecBuilder struct {
+	spec CreateDashboardFromSpecParams
+	// lookup returns the datasource with the given UID, or the default one
+	// if the UID is empty.
+	lookup      func(uid string) (datasourceInfo, error)
+	datasources map[string]datasourceInfo
+	nextID      int
+}
+
+// buildDashboardFromSpec expands a validated spec into dashboard JSON,
+// looking up the types of the datasources it references with lookup.
+func buildDashboardFromSpec(spec CreateDashboardFromSpecParams, lookup func(uid string) (datasourceInfo, error)) (map[string]any, error) {
+	b := &dashboardSpecBuilder{spec: spec, lookup: lookup, datasources: map[string]datasourceInfo{}, nextID: 1}
+
+	from, to := spec.From, spec.To
+	if from == "" {
+		from = "now-6h"
+	}
+	if to == "" {
+		to = "now"
+	}
+	tags := spec.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	db := map[string]any{
+		"title":         spec.Title,
+		"tags":          tags,
+		"time":          map[string]any{"from": from, "to": to},
+		"timezone":      "browser",
+		"editable":      true,
+		"schemaVersion": 39,
+		"annotations": map[string]any{"list": []any{map[string]any{
+			"builtIn":    1,
+			"datasource": map[string]any{"type": "grafana", "uid": "-- Grafana --"},
+			"enable":     true,
+			"hide":       true,
+			"iconColor":  "rgba(0, 211, 255, 1)",
+			"name":       "Annotations & Alerts",
+			"type":       "dashboard",
+		}}},
+	}
+	if spec.UID != "" {
+		db["uid"] = spec.UID
+	}
+	if spec.Description != "" {
+		db["description"] = spec.Description
+	}
+	if spec.Refresh != "" {
+		db["refresh"] = spec.Refresh
+	}
+
+	variables := make([]any, 0, len(spec.Variables))
+	for _, v := range spec.Variables {
+		variable, err := b.variable(v)
+		if err != nil {
+			return nil, fmt.Errorf("variable %q: %w", v.Name, err)
+		}
+		variables = append(variables, variable)
+	}
+	db["templating"] = map[string]any{"list": variables}
+
+	panels, err := b.panels()
+	if err != nil {
+		return nil, err
+	}
+	db["panels"] = panels
+	return db, nil
+}
+
+// datasource returns the datasource reference for a UID, falling back to
+// the dashboard datasource.
+func (b *dashboardSpecBuilder) datasource(uid string) (datasourceInfo, error) {
+	if uid == "" {
+		uid = b.spec.Datasource
+	}
+	if ds, ok := b.datasources[uid]; ok {
+		return ds, nil
+	}
+
+	var ds datasourceInfo
+	if names := interpolate.Variables(uid); len(names) > 0 {
+		// The type of a datasource variable is its query.
+		ds.UID = uid
+		for _, v := range b.spec.Variables {
+			if v.Name == names[0] {
+				if v.Type != "datasource" {
+					return datasourceInfo{}, fmt.Errorf("%s does not refer to a datasource variable", uid)
+				}
+				ds.Type = v.Query
+			}
+		}
+		if ds.Type == "" {
+			return datasourceInfo{}, fmt.Errorf("%s does not refer to a variable of the spec", uid)
+		}
+	} else {
+		var err error
+		if ds, err = b.lookup(uid); err != nil {
+			return datasourceInfo{}, err
+		}
+	}
+	b.datasources[uid] = ds
+	return ds, nil
+}
+
+func (b *dashboardSpecBuilder) variable(v DashboardSpecVariable) (map[string]any, error) {
+	varType := v.Type
+	if varType == "" {
+		varType = defaultSpecVariableType
+	}
+	variable := map[string]any{
+		"name":    v.Name,
+		"type":    varType,
+		"query":   v.Query,
+		"hide":    0,
+		"options": []any{},
+		"current": map[string]any{},
+	}
+	if v.Label != "" {
+		variable["label"] = v.Label
+	}
+
+	var options []variableOption
+	switch varType {
+	case "query":
+		ds, err := b.datasource(v.Datasource)
+		if err != nil {
+			return nil, err
+		}
+		variable["datasource"] = datasourceRef(ds)
+		variable["definition"] = v.Query
+		// Refresh the options when the time range changes.
+		variable["refresh"] = 2
+		variable["sort"] = 1
+	case "custom", "interval":
+		options = parseCustomVariableOptions(v.Query)
+		if varType == "interval" {
+			variable["auto"] = false
+		}
+	case "constant":
+		variable["hide"] = 2
+		options = []variableOption{newVariableOption(v.Query, v.Query)}
+	case "textbox":
+		options = []variableOption{newVariableOption(v.Query, v.Query)}
+	case "datasource":
+		variable["refresh"] = 1
+		variable["regex"] = ""
+	}
+	if varType == "query" || varType == "custom" || varType == "datasource" {
+		variable["multi"] = v.Multi
+		variable["includeAll"] = v.IncludeAll
+	}
+
+	current := v.Current
+	if current == "" && len(options) > 0 {
+		current = options[0].Value
+	}
+	if current != "" {
+		variable["current"] = map[string]any{"text": current, "value": current}
+	}
+	if len(options) > 0 {
+		opts := make([]any, 0, len(options))
+		for _, o := range options {
+			text := o.Text
+			if text == "" {
+				text = o.Value
+			}
+			opts = append(opts, map[string]any{"text": text, "value": o.Value, "selected": o.Value == current})
+		}
+		variable["options"] = opts
+	}
+	return variable, nil
+}
+
+// panels lays out the rows of the spec on the grid. Rows take a full line,
+// and panels fill lines from left to right, starting a new line when the
+// next panel doesn't fit.
+func (b *dashboardSpecBuilder) panels() ([]any, error) {
+	panels := []any{}
+	y := 0
+	for _, row := range b.spec.Rows {
+		var rowPanel map[string]any
+		if row.Title != "" {
+			rowPanel = map[string]any{
+				"id":        b.id(),
+				"type":      "row",
+				"title":     row.Title,
+				"collapsed": row.Collapsed,
+				"gridPos":   map[string]any{"h": 1, "w": dashboardGridWidth, "x": 0, "y": y},
+				"panels":    []any{},
+			}
+			panels = append(panels, rowPanel)
+			y++
+		}
+
+		defaultWidth := dashboardGridWidth / max(1, min(len(row.Panels), maxSpecPanelsPerLine))
+		x, lineHeight := 0, 0
+		var rowPanels []any
+		for _, p := range row.Panels {
+			width, height := p.Width, p.Height
+			if width == 0 {
+				width = defaultWidth
+			}
+			if height == 0 {
+				height = defaultSpecPanelHeight
+			}
+			if x+width > dashboardGridWidth {
+				x, y, lineHeight = 0, y+lineHeight, 0
+			}
+			panel, err := b.panel(p)
+			if err != nil {
+				return nil, fmt.Errorf("panel %q: %w", p.Title, err)
+			}
+			panel["gridPos"] = map[string]any{"h": height, "w": width, "x": x, "y": y}
+			rowPanels = append(rowPanels, panel)
+			x += width
+			lineHeight = max(lineHeight, height)
+		}
+		y += lineHeight
+
+		// Collapsed rows contain their panels, while the panels of expanded
+		// rows follow them.
+		if rowPanel != nil && row.Collapsed {
+			rowPanel["panels"] = append([]any{}, rowPanels...)
+		} else {
+			panels = append(panels, rowPanels...)
+		}
+	}
+	return panels, nil
+}
+
+func (b *dashboardSpecBuilder) panel(p DashboardSpecPanel) (map[string]any, error) {
+	panelType := p.Type
+	if panelType == "" {
+		panelType = defaultSpecPanelType
+	}
+	panel := map[string]any{
+		"id":      b.id(),
+		"type":    panelType,
+		"title":   p.Title,
+		"options": map[string]any{},
+	}
+	if p.Description != "" {
+		panel["description"] = p.Description
+	}
+	if panelType == "text" {
+		panel["options"] = map[string]any{"mode": "markdown", "content": p.Content}
+		return panel, nil
+	}
+
+	ds, err := b.datasource(p.Datasource)
+	if err != nil {
+		return nil, err
+	}
+	panel["datasource"] = datasourceRef(ds)
+
+	targets := make([]any, 0, len(p.Queries))
+	mixed := false
+	for i, q := range p.Queries {
+		targetDs := ds
+		if q.Datasource != "" {
+			if targetDs, err = b.datasource(q.Datasource); err != nil {
+				return nil, fmt.Errorf("query %d: %w", i, err)
+			}
+			mixed = mixed || targetDs != ds
+		}
+		field, ok := targetQueryFields[targetDs.Type]
+		if !ok {
+			field.field = "expr"
+		}
+		target := map[string]any{
+			"refId":      refID(i),
+			"datasource": datasourceRef(targetDs),
+			field.field:  q.Query,
+		}
+		if q.Legend != "" {
+			target["legendFormat"] = q.Legend
+		}
+		if targetDs.Type == "influxdb" {
+			target["rawQuery"] = true
+		}
+		targets = append(targets, target)
+	}
+	if mixed {
+		panel["datasource"] = map[string]any{"type": "datasource", "uid": mixedDatasourceUID}
+	}
+	panel["targets"] = targets
+
+	defaults := map[string]any{}
+	if p.Unit != "" {
+		defaults["unit"] = p.Unit
+	}
+	if p.Min != nil {
+		defaults["min"] = *p.Min
+	}
+	if p.Max != nil {
+		defaults["max"] = *p.Max
+	}
+	if len(p.Thresholds) > 0 {
+		steps := []any{map[string]any{"color": defaultThresholdColor, "value": nil}}
+		for _, t := range p.Thresholds {
+			steps = append(steps, map[string]any{"color": t.Color, "value": t.Value})
+		}
+		defaults["thresholds"] = map[string]any{"mode": "absolute", "steps": steps}
+		if panelType == "timeseries" {
+			defaults["custom"] = map[string]any{"thresholdsStyle": map[string]any{"mode": "line"}}
+		}
+	}
+	panel["fieldConfig"] = map[string]any{"defaults": defaults, "overrides": []any{}}
+	return panel, nil
+}
+
+func (b *dashboardSpecBuilder) id() int {
+	id := b.nextID
+	b.nextID++
+	return id
+}
+
+func datasourceRef(ds datasourceInfo) map[string]any {
+	ref := map[string]any{"uid": ds.UID}
+	if ds.Type != "" {
+		ref["type"] = ds.Type
+	}
+	return ref
+}
+
+// refID returns the refId Grafana gives to the i-th query of a panel: A to
+// Z, then AA, AB and so on.
+func refID(i int) string {
+	if i < 26 {
+		return string(rune('A' + i))
+	}
+	return refID(i/26-1) + refID(i%26)
+}
@@ -0,0 +1,148 @@
+//go:build unit
+// +build unit
+
+package tools
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildDashboardFromSpec(t *testing.T) {
+	lookup := func(uid string) (datasourceInfo, error) {
+		switch uid {
+		case "", "prom":
+			return datasourceInfo{UID: "prom", Type: "prometheus"}, nil
+		case "loki":
+			return datasourceInfo{UID: "loki", Type: "loki"}, nil
+		}
+		return datasourceInfo{}, fmt.Errorf("datasource %s not found", uid)
+	}
+	spec := CreateDashboardFromSpecParams{
+		Title:      "Service",
+		UID:        "svc",
+		Tags:       []string{"team-a"},
+		Datasource: "${datasource}",
+		Variables: []DashboardSpecVariable{
+			{Name: "datasource", Type: "datasource", Query: "prometheus"},
+			{Name: "job", Query: "label_values(up, job)", Multi: true, IncludeAll: true},
+			{Name: "quantile", Type: "custom", Query: "p50 : 0.5,p99 : 0.99"},
+		},
+		Rows: []DashboardSpecRow{
+			{Panels: []DashboardSpecPanel{
+				{Title: "Up", Type: "stat", Queries: []DashboardSpecQuery{{Query: `sum(up{job=~"$job"})`}}, Thresholds: []DashboardSpecThreshold{{Value: 1, Color: "red"}}},
+				{Title: "Requests", Unit: "reqps", Queries: []DashboardSpecQuery{
+					{Query: `sum by (job) (rate(http_requests_total{job=~"$job"}[$__rate_interval]))`, Legend: "{{job}}"},
+					{Query: `sum(rate({job=~"$job"} |= "error" [$__rate_interval]))`, Datasource: "loki"},
+				}},
+				{Title: "Wide", Width: 16},
+			}},
+			{Title: "Details", Collapsed: true, Panels: []DashboardSpecPanel{
+				{Title: "Notes", Type: "text", Content: "# Runbook"},
+			}},
+		},
+	}
+	require.NoError(t, spec.validate())
+
+	db, err := buildDashboardFromSpec(spec, lookup)
+	require.NoError(t, err)
+
+	assert.Equal(t, "svc", db["uid"])
+	assert.Equal(t, map[string]any{"from": "now-6h", "to": "now"}, db["time"])
+
+	variables := db["templating"].(map[string]any)["list"].([]any)
+	require.Len(t, variables, 3)
+	job := variables[1].(map[string]any)
+	assert.Equal(t, "query", job["type"])
+	assert.Equal(t, map[string]any{"uid": "${datasource}", "type": "prometheus"}, job["datasource"])
+	assert.Equal(t, true, job["includeAll"])
+	quantile := variables[2].(map[string]any)
+	assert.Equal(t, map[string]any{"text": "0.5", "value": "0.5"}, quantile["current"])
+	assert.Len(t, quantile["options"], 2)
+
+	panels := db["panels"].([]any)
+	require.Len(t, panels, 4)
+	gridPos := func(i int) map[string]any { return panels[i].(map[string]any)["gridPos"].(map[string]any) }
+	// Three panels share the first line, except the last one, which is too
+	// wide and moves to the next line.
+	assert.Equal(t, map[string]any{"h": 8, "w": 8, "x": 0, "y": 0}, gridPos(0))
+	assert.Equal(t, map[string]any{"h": 8, "w": 8, "x": 8, "y": 0}, gridPos(1))
+	assert.Equal(t, map[string]any{"h": 8, "w": 16, "x": 0, "y": 8}, gridPos(2))
+	assert.Equal(t, map[string]any{"h": 1, "w": 24, "x": 0, "y": 16}, gridPos(3))
+
+	stat := panels[0].(map[string]any)
+	assert.Equal(t, 1, stat["id"])
+	assert.Equal(t, map[string]any{"uid": "${datasource}", "type": "prometheus"}, stat["datasource"])
+	assert.Equal(t, map[string]any{"mode": "absolute", "steps": []any{
+		map[string]any{"color": "green", "value": nil},
+		map[string]any{"color": "red", "value": float64(1)},
+	}}, stat["fieldConfig"].(map[string]any)["defaults"].(map[string]any)["thresholds"])
+
+	mixed := panels[1].(map[string]any)
+	assert.Equal(t, map[string]any{"type": "datasource", "uid": "-- Mixed --"}, mixed["datasource"])
+	targets := mixed["targets"].([]any)
+	require.Len(t, targets, 2)
+	assert.Equal(t, "A", targets[0].(map[string]any)["refId"])
+	assert.Equal(t, "{{job}}", targets[0].(map[string]any)["legendFormat"])
+	assert.Equal(t, "B", targets[1].(map[string]any)["refId"])
+	assert.Equal(t, map[string]any{"uid": "loki", "type": "loki"}, targets[1].(map[string]any)["datasource"])
+
+	row := panels[3].(map[string]any)
+	assert.Equal(t, "row", row["type"])
+	nested := row["panels"].([]any)
+	require.Len(t, nested, 1)
+	assert.Equal(t, map[string]any{"h": 8, "w": 24, "x": 0, "y": 17}, nested[0].(map[string]any)["gridPos"])
+
+	// The extracted queries match the spec.
+	queries := extractPanelQueries(panels)
+	require.Len(t, queries, 3)
+	assert.Equal(t, "logql", queries[2].Language)
+	assert.Equal(t, []string{"job"}, queries[2].Variables)
+}
+
+func TestBuildDashboardFromSpecErrors(t *testing.T) {
+	lookup := func(uid string) (datasourceInfo, error) {
+		return datasourceInfo{}, fmt.Errorf("datasource %s not found", uid)
+	}
+
+	_, err := buildDashboardFromSpec(CreateDashboardFromSpecParams{
+		Title: "Service",
+		Rows:  []DashboardSpecRow{{Panels: []DashboardSpecPanel{{Title: "Up", Datasource: "missing"}}}},
+	}, lookup)
+	assert.ErrorContains(t, err, `panel "Up": datasource missing not found`)
+
+	_, err = buildDashboardFromSpec(CreateDashboardFromSpecParams{
+		Title:      "Service",
+		Datasource: "$ds",
+		Rows:       []DashboardSpecRow{{Panels: []DashboardSpecPanel{{Title: "Up"}}}},
+	}, lookup)
+	assert.ErrorContains(t, err, "does not refer to a variable of the spec")
+}
+
+func TestCreateDashboardFromSpecParamsValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		spec CreateDashboardFromSpecParams
+		err  string
+	}{
+		{"no rows", CreateDashboardFromSpecParams{Title: "A"}, "at least one row"},
+		{"untitled row", CreateDashboardFromSpecParams{Title: "A", Rows: []DashboardSpecRow{{Title: "R"}, {}}}, "only the first row may have no title"},
+		{"unknown variable type", CreateDashboardFromSpecParams{Title: "A", Rows: []DashboardSpecRow{{}}, Variables: []DashboardSpecVariable{{Name: "v", Type: "adhoc"}}}, "unknown type"},
+		{"too wide", CreateDashboardFromSpecParams{Title: "A", Rows: []DashboardSpecRow{{Panels: []DashboardSpecPanel{{Title: "P", Width: 25}}}}}, "width 25"},
+		{"unordered thresholds", CreateDashboardFromSpecParams{Title: "A", Rows: []DashboardSpecRow{{Panels: []DashboardSpecPanel{{Title: "P", Thresholds: []DashboardSpecThreshold{{Value: 2, Color: "red"}, {Value: 1, Color: "orange"}}}}}}}, "out of order"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.ErrorContains(t, tc.spec.validate(), tc.err)
+		})
+	}
+}
+
+func TestRefID(t *testing.T) {
+	assert.Equal(t, "A", refID(0))
+	assert.Equal(t, "Z", refID(25))
+	assert.Equal(t, "AA", refID(26))
+	assert.Equal(t, "BA", refID(52))
+}
@@ -0,0 +1,201 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/grafana/grafana-openapi-client-go/models"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	mcpgrafana "mcp-grafana-local"
+)
+
+type GetDashboardSummaryParams struct {
+	UID         string `json:"uid" jsonschema:"required,description=The UID of the dashboard"`
+	IncludeLink bool   `json:"includeLink,omitempty" jsonschema:"description=If true\\, also return a link to the dashboard with its current variable values and time range"`
+}
+
+type dashboardFolderSummary struct {
+	UID   string `json:"uid,omitempty"`
+	Title string `json:"title,omitempty"`
+}
+
+type dashboardTimeSummary struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type dashboardVariableSummary struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Label   string   `json:"label,omitempty"`
+	Query   string   `json:"query,omitempty"`
+	Multi   bool     `json:"multi,omitempty"`
+	Current []string `json:"current"`
+}
+
+type dashboardRowSummary struct {
+	ID         int    `json:"id"`
+	Title      string `json:"title"`
+	Collapsed  bool   `json:"collapsed,omitempty"`
+	PanelCount int    `json:"panelCount"`
+}
+
+type dashboardPanelSummary struct {
+	ID         int             `json:"id"`
+	Title      string          `json:"title"`
+	Type       string          `json:"type"`
+	Row        string          `json:"row,omitempty"`
+	Datasource *datasourceInfo `json:"datasource,omitempty"`
+	QueryCount int             `json:"queryCount"`
+	Repeat     string          `json:"repeat,omitempty"`
+}
+
+type dashboardSummary struct {
+	UID         string                     `json:"uid"`
+	Title       string                     `json:"title"`
+	Description string                     `json:"description,omitempty"`
+	Tags        []string                   `json:"tags"`
+	Folder      *dashboardFolderSummary    `json:"folder,omitempty"`
+	URL         string                     `json:"url,omitempty"`
+	Link        string                     `json:"link,omitempty"`
+	Version     int64                      `json:"version"`
+	Time        *dashboardTimeSummary      `json:"time,omitempty"`
+	Refresh     string                     `json:"refresh,omitempty"`
+	Variables   []dashboardVariableSummary `json:"variables"`
+	Rows        []dashboardRowSummary      `json:"rows,omitempty"`
+	Panels      []dashboardPanelSummary    `json:"panels"`
+}
+
+func getDashboardSummary(ctx context.Context, args GetDashboardSummaryParams) (*dashboardSummary, error) {
+	dashboard, err := getDashboardByUID(ctx, GetDashboardByUIDParams{UID: args.UID})
+	if err != nil {
+		return nil, err
+	}
+	db, ok := dashboard.Dashboard.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("dashboard is not a JSON object")
+	}
+	summary := summarizeDashboard(db, dashboard.Meta)
+	if args.IncludeLink {
+		summary.Link = dashboardSummaryLink(ctx, summary)
+	}
+	return summary, nil
+}
+
+// dashboardSummaryLink returns the URL of a summarized dashboard, with the
+// current variable values and time range made explicit so that the link
+// shows what the summary describes even after the dashboard is changed.
+func dashboardSummaryLink(ctx context.Context, summary *dashboardSummary) string {
+	variables := map[string]string{}
+	for _, v := range summary.Variables {
+		switch {
+		case len(v.Current) == 1:
+			variables[v.Name] = v.Current[0]
+		case len(v.Current) > 1:
+			variables[v.Name] = "{" + strings.Join(v.Current, ",") + "}"
+		}
+	}
+	var from, to string
+	if summary.Time != nil {
+		from, to = summary.Time.From, summary.Time.To
+	}
+	return dashboardLink(ctx, summary.UID, variables, from, to, 0)
+}
+
+var GetDashboardSummary = mcpgrafana.MustTool(
+	"get_dashboard_summary",
+	"Get a compact summary of a dashboard: its title, tags, folder, time range, template variables with their current values, rows, and for each panel its ID, title, type, row, datasource and number of queries. Much smaller than get_dashboard_by_uid, so call this first and then use get_dashboard_panel_queries, get_dashboard_variables or run_panel_query for details. Set includeLink to true to also get a full link to the dashboard with its current variable values and time range.",
+	getDashboardSummary,
+	mcp.WithTitleAnnotation("Get dashboard summary"),
+	mcp.WithIdempotentHintAnnotation(true),
+	mcp.WithReadOnlyHintAnnotation(true),
+)
+
+// summarizeDashboard returns the summary of a dashboard JSON model. meta may
+// be nil.
+func summarizeDashboard(db map[string]any, meta *models.DashboardMeta) *dashboardSummary {
+	summary := &dashboardSummary{
+		Tags:      stringValues(db["tags"]),
+		Variables: []dashboardVariableSummary{},
+		Panels:    []dashboardPanelSummary{},
+	}
+	summary.UID, _ = db["uid"].(string)
+	summary.Title, _ = db["title"].(string)
+	summary.Description, _ = db["description"].(string)
+	summary.Refresh, _ = db["refresh"].(string)
+	if version, ok := db["version"].(float64); ok {
+		summary.Version = int64(version)
+	}
+	if timeRange, ok := db["time"].(map[string]any); ok {
+		from, _ := timeRange["from"].(string)
+		to, _ := timeRange["to"].(string)
+		summary.Time = &dashboardTimeSummary{From: from, To: to}
+	}
+	if meta != nil {
+		summary.URL = meta.URL
+		if meta.FolderUID != "" || meta.FolderTitle != "" {
+			summary.Folder = &dashboardFolderSummary{UID: meta.FolderUID, Title: meta.FolderTitle}
+		}
+	}
+
+	for _, v := range parseDashboardVariables(db) {
+		summary.Variables = append(summary.Variables, dashboardVariableSummary{
+			Name:    v.Name,
+			Type:    v.Type,
+			Label:   v.Label,
+			Query:   v.Query,
+			Multi:   v.Multi,
+			Current: v.Current,
+		})
+	}
+
+	panels, _ := db["panels"].([]any)
+	summarizePanels(summary, panels, -1)
+	return summary
+}
+
+// summarizePanels adds the given panels to the summary. Panels following an
+// expanded row at the top level belong to it, while collapsed rows contain
+// their panels. row is the index of the enclosing row in summary.Rows, or -1.
+func summarizePanels(summary *dashboardSummary, panels []any, row int) {
+	for _, p := range panels {
+		panel, ok := p.(map[string]any)
+		if !ok {
+			continue
+		}
+		id, _ := panel["id"].(float64)
+		title, _ := panel["title"].(string)
+		panelType, _ := panel["type"].(string)
+
+		if panelType == "row" {
+			collapsed, _ := panel["collapsed"].(bool)
+			summary.Rows = append(summary.Rows, dashboardRowSummary{ID: int(id), Title: title, Collapsed: collapsed})
+			row = len(summary.Rows) - 1
+			if nested, ok := panel["panels"].([]any); ok {
+				summarizePanels(summary, nested, row)
+			}
+			continue
+		}
+
+		s := dashboardPanelSummary{ID: int(id), Title: title, Type: panelType}
+		s.Repeat, _ = panel["repeat"].(string)
+		if ds, ok := datasourceFromRef(panel["datasource"]); ok {
+			s.Datasource = &ds
+		}
+		if targets, ok := panel["targets"].([]any); ok {
+			s.QueryCount = len(targets)
+		}
+		if row >= 0 {
+			s.Row = summary.Rows[row].Title
+			summary.Rows[row].PanelCount++
+		}
+		summary.Panels = append(summary.Panels, s)
+
+		// Some nested dashboards use "panels" as a key within a panel (rare)
+		if nested, ok := panel["panels"].([]any); ok {
+			summarizePanels(summary, nested, row)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+//go:build unit
+// +build unit
+
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	"github.com/grafana/grafana-openapi-client-go/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	mcpgrafana "mcp-grafana-local"
+)
+
+func TestSummarizeDashboard(t *testing.T) {
+	var db map[string]any
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"uid": "svc",
+		"title": "Service",
+		"tags": ["team-a", "prod"],
+		"version": 7,
+		"time": {"from": "now-6h", "to": "now"},
+		"refresh": "30s",
+		"templating": {"list": [
+			{"name": "job", "type": "query", "query": "label_values(job)", "multi": true, "current": {"value": ["api", "db"]}}
+		]},
+		"panels": [
+			{
+				"id": 1,
+				"type": "stat",
+				"title": "Uptime",
+				"datasource": {"type": "prometheus", "uid": "prom"},
+				"targets": [{"refId": "A", "expr": "up"}],
+				"fieldConfig": {"defaults": {"unit": "s"}},
+				"options": {"reduceOptions": {"calcs": ["lastNotNull"]}}
+			},
+			{"id": 2, "type": "row", "title": "Traffic", "collapsed": false},
+			{
+				"id": 3,
+				"type": "timeseries",
+				"title": "Requests",
+				"repeat": "job",
+				"targets": [{"refId": "A", "expr": "a"}, {"refId": "B", "expr": "b"}]
+			},
+			{
+				"id": 4,
+				"type": "row",
+				"title": "Errors",
+				"collapsed": true,
+				"panels": [{"id": 5, "type": "logs", "title": "Error logs", "datasource": {"type": "loki", "uid": "loki"}, "targets": [{"refId": "A", "expr": "{app=\"api\"}"}]}]
+			},
+			{"id": 6, "type": "text", "title": "Notes"}
+		]
+	}`), &db))
+
+	summary := summarizeDashboard(db, &models.DashboardMeta{FolderUID: "f1", FolderTitle: "Team A", URL: "/d/svc/service"})
+
+	assert.Equal(t, "svc", summary.UID)
+	assert.Equal(t, "Service", summary.Title)
+	assert.Equal(t, []string{"team-a", "prod"}, summary.Tags)
+	assert.Equal(t, &dashboardFolderSummary{UID: "f1", Title: "Team A"}, summary.Folder)
+	assert.Equal(t, "/d/svc/service", summary.URL)
+	assert.Equal(t, int64(7), summary.Version)
+	assert.Equal(t, &dashboardTimeSummary{From: "now-6h", To: "now"}, summary.Time)
+	assert.Equal(t, "30s", summary.Refresh)
+	assert.Equal(t, []dashboardVariableSummary{
+		{Name: "job", Type: "query", Query: "label_values(job)", Multi: true, Current: []string{"api", "db"}},
+	}, summary.Variables)
+	assert.Equal(t, []dashboardRowSummary{
+		{ID: 2, Title: "Traffic", PanelCount: 1},
+		{ID: 4, Title: "Errors", Collapsed: true, PanelCount: 2},
+	}, summary.Rows)
+	assert.Equal(t, []dashboardPanelSummary{
+		{ID: 1, Title: "Uptime", Type: "stat", Datasource: &datasourceInfo{UID: "prom", Type: "prometheus"}, QueryCount: 1},
+		{ID: 3, Title: "Requests", Type: "timeseries", Row: "Traffic", QueryCount: 2, Repeat: "job"},
+		{ID: 5, Title: "Error logs", Type: "logs", Row: "Errors", Datasource: &datasourceInfo{UID: "loki", Type: "loki"}, QueryCount: 1},
+		{ID: 6, Title: "Notes", Type: "text", Row: "Errors"},
+	}, summary.Panels)
+}
+
+func TestSummarizeDashboardWithoutMeta(t *testing.T) {
+	summary := summarizeDashboard(map[string]any{"title": "Empty"}, nil)
+	assert.Equal(t, "Empty", summary.Title)
+	assert.Nil(t, summary.Folder)
+	assert.Empty(t, summary.Tags)
+	assert.Empty(t, summary.Panels)
+	assert.Empty(t, summary.Rows)
+}
+
+func TestDashboardSummaryLink(t *testing.T) {
+	ctx := mcpgrafana.WithGrafanaURL(context.Background(), "https://grafana.example.com")
+	summary := &dashboardSummary{
+		UID:  "svc",
+		Time: &dashboardTimeSummary{From: "now-6h", To: "now"},
+		Variables: []dashboardVariableSummary{
+			{Name: "job", Current: []string{"api"}},
+			{Name: "instance", Current: []string{"a", "b"}},
+			{Name: "empty"},
+		},
+	}
+	u, err := url.Parse(dashboardSummaryLink(ctx, summary))
+	require.NoError(t, err)
+	assert.Equal(t, "/d/svc", u.Path)
+	assert.Equal(t, url.Values{
+		"var-job":      {"api"},
+		"var-instance": {"a", "b"},
+		"from":         {"now-6h"},
+		"to":           {"now"},
+	}, u.Query())
+}
@@ -7,9 +7,9 @@ package tools
 
 import (
 	"context"
+	"path/filepath"
 	"testing"
 
-	"github.com/grafana/grafana-openapi-client-go/models"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -21,7 +21,7 @@ const (
 // getExistingDashboardUID will fetch an existing dashboard for test purposes
 // It will search for exisiting dashboards and return the first, otherwise
 // will trigger a test error
-func getExistingTestDashboard(t *testing.T, ctx context.Context, dashboardName string) *models.Hit {
+func getExistingTestDashboard(t *testing.T, ctx context.Context, dashboardName string) *searchHit {
 	// Make sure we query for the existing dashboard, not a folder
 	if dashboardName == "" {
 		dashboardName = "Demo"
@@ -30,13 +30,13 @@ func getExistingTestDashboard(t *testing.T, ctx context.Context, dashboardName s
 		Query: dashboardName,
 	})
 	require.NoError(t, err)
-	require.Greater(t, len(searchResults), 0, "No dashboards found")
-	return searchResults[0]
+	require.Greater(t, len(searchResults.Hits), 0, "No dashboards found")
+	return &searchResults.Hits[0]
 }
 
 // getExistingTestDashboardJSON will fetch the JSON map for an existing
 // dashboard in the test environment
-func getTestDashboardJSON(t *testing.T, ctx context.Context, dashboard *models.Hit) map[string]interface{} {
+func getTestDashboardJSON(t *testing.T, ctx context.Context, dashboard *searchHit) map[string]interface{} {
 	result, err := getDashboardByUID(ctx, GetDashboardByUIDParams{
 		UID: dashboard.UID,
 	})
@@ -64,6 +64,22 @@ func TestDashboardTools(t *testing.T) {
 		assert.NotNil(t, result.Meta)
 	})
 
+	t.Run("get dashboard summary", func(t *testing.T) {
+		ctx := newTestContext()
+
+		dashboard := getExistingTestDashboard(t, ctx, "")
+
+		result, err := getDashboardSummary(ctx, GetDashboardSummaryParams{
+			UID: dashboard.UID,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, dashboard.UID, result.UID)
+		assert.Equal(t, dashboard.Title, result.Title)
+		require.NotEmpty(t, result.Panels)
+		assert.Equal(t, "Node Load", result.Panels[0].Title)
+		assert.Equal(t, 1, result.Panels[0].QueryCount)
+	})
+
 	t.Run("get dashboard by uid - invalid uid", func(t *testing.T) {
 		ctx := newTestContext()
 
@@ -131,6 +147,54 @@ func TestDashboardTools(t *testing.T) {
 		require.NoError(t, err)
 	})
 
+	t.Run("patch dashboard", func(t *testing.T) {
+		ctx := newTestContext()
+
+		// Patch the non-provisioned dashboard we've created
+		dashboard := getExistingTestDashboard(t, ctx, newTestDashboardName)
+		dashboardMap := getTestDashboardJSON(t, ctx, dashboard)
+		version, _ := dashboardMap["version"].(float64)
+
+		result, err := patchDashboard(ctx, PatchDashboardParams{
+			UID: dashboard.UID,
+			Operations: []JSONPatchOperation{
+				{Op: "add", Path: "/tags/-", Value: "patched"},
+			},
+			PanelOperations: []PanelOperation{
+				{PanelID: 1, Op: "set_query", RefID: "A", Query: "node_load5"},
+			},
+			Version: int64(version),
+			Message: "patching dashboard",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, dashboard.UID, *result.UID)
+
+		patched := getTestDashboardJSON(t, ctx, dashboard)
+		assert.Contains(t, patched["tags"], "patched")
+
+		// Restore the query checked by the panel query tests
+		_, err = patchDashboard(ctx, PatchDashboardParams{
+			UID: dashboard.UID,
+			PanelOperations: []PanelOperation{
+				{PanelID: 1, Op: "set_query", RefID: "A", Query: "node_load1"},
+			},
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("patch dashboard - stale version", func(t *testing.T) {
+		ctx := newTestContext()
+
+		dashboard := getExistingTestDashboard(t, ctx, newTestDashboardName)
+
+		_, err := patchDashboard(ctx, PatchDashboardParams{
+			UID:        dashboard.UID,
+			Operations: []JSONPatchOperation{{Op: "replace", Path: "/title", Value: newTestDashboardName}},
+			Version:    -1,
+		})
+		require.Error(t, err)
+	})
+
 	t.Run("get dashboard panel queries", func(t *testing.T) {
 		ctx := newTestContext()
 
@@ -151,6 +215,188 @@ func TestDashboardTools(t *testing.T) {
 			assert.Equal(t, panelQuery.Query, "node_load1")
 			assert.NotEmpty(t, panelQuery.Datasource.UID)
 			assert.Equal(t, panelQuery.Datasource.Type, "prometheus")
+			assert.Equal(t, "promql", panelQuery.Language)
+			assert.Equal(t, "A", panelQuery.RefID)
+		}
+	})
+
+	t.Run("get dashboard variables", func(t *testing.T) {
+		ctx := newTestContext()
+
+		// The demo dashboard doesn't define any variables.
+		dashboard := getExistingTestDashboard(t, ctx, "")
+
+		result, err := getDashboardVariables(ctx, GetDashboardVariablesParams{
+			UID: dashboard.UID,
+		})
+		require.NoError(t, err)
+		assert.Empty(t, result)
+	})
+
+	t.Run("run panel query", func(t *testing.T) {
+		ctx := newTestContext()
+
+		dashboard := getExistingTestDashboard(t, ctx, "")
+
+		result, err := runPanelQuery(ctx, RunPanelQueryParams{
+			DashboardUID: dashboard.UID,
+			PanelTitle:   "Node Load",
+			From:         "now-1h",
+			To:           "now",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "Node Load", result.PanelTitle)
+		require.Len(t, result.Targets, 1)
+		assert.Equal(t, "A", result.Targets[0].RefID)
+		assert.Equal(t, "node_load1", result.Targets[0].Query)
+	})
+
+	t.Run("run panel query - unknown panel", func(t *testing.T) {
+		ctx := newTestContext()
+
+		dashboard := getExistingTestDashboard(t, ctx, "")
+
+		_, err := runPanelQuery(ctx, RunPanelQueryParams{
+			DashboardUID: dashboard.UID,
+			PanelID:      12345,
+		})
+		require.Error(t, err)
+	})
+
+	t.Run("get dashboard variables - invalid uid", func(t *testing.T) {
+		ctx := newTestContext()
+
+		_, err := getDashboardVariables(ctx, GetDashboardVariablesParams{
+			UID: "non-existent-uid",
+		})
+		require.Error(t, err)
+	})
+
+	t.Run("dashboard versions", func(t *testing.T) {
+		ctx := newTestContext()
+
+		dashboard := getExistingTestDashboard(t, ctx, newTestDashboardName)
+		dashboardMap := getTestDashboardJSON(t, ctx, dashboard)
+		version, _ := dashboardMap["version"].(float64)
+
+		_, err := patchDashboard(ctx, PatchDashboardParams{
+			UID: dashboard.UID,
+			PanelOperations: []PanelOperation{
+				{PanelID: 1, Op: "replace", Path: "/title", Value: "Versioned Load"},
+			},
+			Message: "rename panel",
+		})
+		require.NoError(t, err)
+
+		versions, err := listDashboardVersions(ctx, ListDashboardVersionsParams{UID: dashboard.UID, Limit: 2})
+		require.NoError(t, err)
+		require.Len(t, versions, 2)
+		assert.Equal(t, int64(version)+1, versions[0].Version)
+		assert.Equal(t, "rename panel", versions[0].Message)
+
+		diff, err := diffDashboardVersions(ctx, DiffDashboardVersionsParams{UID: dashboard.UID})
+		require.NoError(t, err)
+		assert.Equal(t, int64(version), diff.BaseVersion)
+		assert.Equal(t, int64(version)+1, diff.NewVersion)
+		require.Len(t, diff.PanelsChanged, 1)
+		assert.Equal(t, []fieldChange{{Path: "/title", Before: "Node Load", After: "Versioned Load"}}, diff.PanelsChanged[0].Changes)
+
+		_, err = restoreDashboardVersion(ctx, RestoreDashboardVersionParams{UID: dashboard.UID, Version: int64(version)})
+		require.NoError(t, err)
+		restored := getTestDashboardJSON(t, ctx, dashboard)
+		panels, _ := restored["panels"].([]any)
+		require.NotEmpty(t, panels)
+		assert.Equal(t, "Node Load", panels[0].(map[string]any)["title"])
+	})
+
+	t.Run("lint dashboard", func(t *testing.T) {
+		ctx := newTestContext()
+
+		dashboard := getExistingTestDashboard(t, ctx, "")
+		result, err := lintDashboard(ctx, LintDashboardParams{
+			UID:   dashboard.UID,
+			Rules: []string{lintRuleHardcodedDatasource},
+		})
+		require.NoError(t, err)
+		assert.NotZero(t, result.Version)
+		require.NotEmpty(t, result.Findings)
+		assert.Equal(t, "/panels/0/datasource/uid", result.Findings[0].Path)
+		assert.Equal(t, 1, result.Findings[0].PanelID)
+	})
+
+	t.Run("create dashboard from spec", func(t *testing.T) {
+		ctx := newTestContext()
+
+		result, err := createDashboardFromSpec(ctx, CreateDashboardFromSpecParams{
+			Title:      "Spec Test",
+			UID:        "spec-test",
+			Datasource: "prometheus",
+			Variables: []DashboardSpecVariable{
+				{Name: "job", Query: "label_values(up, job)"},
+			},
+			Rows: []DashboardSpecRow{
+				{Panels: []DashboardSpecPanel{
+					{Title: "Up", Type: "stat", Queries: []DashboardSpecQuery{{Query: `up{job="$job"}`}}},
+					{Title: "Load", Unit: "short", Queries: []DashboardSpecQuery{{Query: "node_load1", Legend: "{{instance}}"}}},
+				}},
+			},
+			Overwrite: true,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "spec-test", *result.UID)
+
+		queries, err := GetDashboardPanelQueriesTool(ctx, DashboardPanelQueriesParams{UID: "spec-test"})
+		require.NoError(t, err)
+		require.Len(t, queries, 2)
+		assert.Equal(t, "node_load1", queries[1].Query)
+		assert.Equal(t, "prometheus", queries[1].Datasource.Type)
+	})
+
+	t.Run("export and import dashboards", func(t *testing.T) {
+		ctx := newTestContext()
+		dir := t.TempDir()
+		demo := getExistingTestDashboard(t, ctx, "")
+
+		exported, err := ExportDashboardsTool(ctx, ExportDashboardsParams{Directory: dir})
+		require.NoError(t, err)
+		var path string
+		for _, d := range exported.Dashboards {
+			if d.UID == demo.UID {
+				path = d.Path
+			}
+		}
+		require.NotEmpty(t, path, "demo dashboard should be exported")
+		assert.FileExists(t, filepath.Join(dir, path))
+
+		imported, err := ImportDashboardsTool(ctx, ImportDashboardsParams{Directory: dir})
+		require.NoError(t, err)
+		assert.True(t, imported.DryRun)
+		for _, d := range imported.Dashboards {
+			if d.UID == demo.UID {
+				assert.Equal(t, importActionUnchanged, d.Action)
+				assert.Empty(t, d.Changes)
+			}
+		}
+	})
+
+	t.Run("find metric usage", func(t *testing.T) {
+		ctx := newTestContext()
+		demo := getExistingTestDashboard(t, ctx, "")
+		result, err := findMetricUsage(ctx, FindMetricUsageParams{Metric: "node_load1"})
+		require.NoError(t, err)
+		var found bool
+		for _, usage := range result.Dashboards {
+			if usage.DashboardUID == demo.UID && usage.PanelID == 1 {
+				found = true
+				assert.Equal(t, "node_load1", usage.Query)
+			}
+		}
+		assert.True(t, found, "demo dashboard should use node_load1")
+
+		result, err = findMetricUsage(ctx, FindMetricUsageParams{Metric: "node_load15"})
+		require.NoError(t, err)
+		for _, usage := range result.Dashboards {
+			assert.NotEqual(t, demo.UID, usage.DashboardUID)
 		}
 	})
 }
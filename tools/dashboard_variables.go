@@ -0,0 +1,867 @@
+package tools
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+
+	mcpgrafana "mcp-grafana-local"
+	"mcp-grafana-local/internal/interpolate"
+)
+
+const (
+	// DefaultDashboardVariableMaxOptions is the default number of options
+	// returned for each variable.
+	DefaultDashboardVariableMaxOptions = 100
+
+	// defaultDashboardFrom and defaultDashboardTo are used when a dashboard
+	// has no time range, as in Grafana.
+	defaultDashboardFrom = "now-6h"
+	defaultDashboardTo   = "now"
+)
+
+// Datasource UIDs with a special meaning in dashboards.
+const (
+	grafanaDatasourceUID   = "grafana"
+	mixedDatasourceUID     = "-- Mixed --"
+	dashboardDatasourceUID = "-- Dashboard --"
+)
+
+var (
+	// Prometheus and Loki variable query functions, as supported by Grafana.
+	labelNamesQueryRegex  = regexp.MustCompile(`^label_names\(\s*(.*?)\s*\)\s*$`)
+	labelValuesQueryRegex = regexp.MustCompile(`^label_values\((?:(.+),\s*)?([a-zA-Z_$][a-zA-Z0-9_]*)\)\s*$`)
+	metricsQueryRegex     = regexp.MustCompile(`^metrics\((.+)\)\s*$`)
+	queryResultQueryRegex = regexp.MustCompile(`^query_result\((.+)\)\s*$`)
+)
+
+type GetDashboardVariablesParams struct {
+	UID         string            `json:"uid" jsonschema:"required,description=The UID of the dashboard"`
+	Variables   map[string]string `json:"variables,omitempty" jsonschema:"description=Optionally\\, values to use instead of the current values of variables. Queries of variables that depend on other variables are evaluated with these values. Use '{a\\,b}' for multiple values."`
+	From        string            `json:"from,omitempty" jsonschema:"description=Optionally\\, the start of the time range used to evaluate variable queries. Supports RFC3339 and relative times like 'now-1h'. Defaults to the dashboard time range."`
+	To          string            `json:"to,omitempty" jsonschema:"description=Optionally\\, the end of the time range used to evaluate variable queries. Defaults to the dashboard time range."`
+	MaxOptions  int               `json:"maxOptions,omitempty" jsonschema:"description=Optionally\\, the maximum number of options to return per variable (default 100)"`
+	IncludeLink bool              `json:"includeLink,omitempty" jsonschema:"description=If true\\, also return a link to the dashboard with the given variables and time range"`
+}
+
+type variableOption struct {
+	// Text is only set when it differs from Value.
+	Text  string `json:"text,omitempty"`
+	Value string `json:"value"`
+}
+
+type dashboardVariable struct {
+	Name           string           `json:"name"`
+	Label          string           `json:"label,omitempty"`
+	Type           string           `json:"type"`
+	Hidden         bool             `json:"hidden,omitempty"`
+	Query          string           `json:"query,omitempty"`
+	Datasource     *datasourceInfo  `json:"datasource,omitempty"`
+	Multi          bool             `json:"multi,omitempty"`
+	IncludeAll     bool             `json:"includeAll,omitempty"`
+	AllValue       string           `json:"allValue,omitempty"`
+	Current        []string         `json:"current"`
+	Options        []variableOption `json:"options,omitempty"`
+	OmittedOptions int              `json:"omittedOptions,omitempty"`
+	// Error is set when the options could not be evaluated. Options then
+	// holds the options saved in the dashboard, if any.
+	Error string `json:"error,omitempty"`
+
+	datasourceRef any
+	regex         string
+	sort          int
+	auto          bool
+	autoCount     int
+	autoMin       string
+}
+
+// interpolateVariable returns the variable as used to interpolate queries
+// that reference it.
+func (v dashboardVariable) interpolateVariable() interpolate.Variable {
+	options := make([]string, 0, len(v.Options))
+	for _, o := range v.Options {
+		if o.Value != interpolate.AllValue {
+			options = append(options, o.Value)
+		}
+	}
+	return interpolate.Variable{
+		Name:       v.Name,
+		Values:     v.Current,
+		Multi:      v.Multi,
+		IncludeAll: v.IncludeAll,
+		AllValue:   v.AllValue,
+		Options:    options,
+	}
+}
+
+func (p GetDashboardVariablesParams) validate() error {
+	if p.MaxOptions < 0 {
+		return fmt.Errorf("maxOptions must not be negative")
+	}
+	return nil
+}
+
+func getDashboardVariables(ctx context.Context, args GetDashboardVariablesParams) ([]dashboardVariable, error) {
+	if err := args.validate(); err != nil {
+		return nil, err
+	}
+	maxOptions := args.MaxOptions
+	if maxOptions == 0 {
+		maxOptions = DefaultDashboardVariableMaxOptions
+	}
+
+	dashboard, err := getDashboardByUID(ctx, GetDashboardByUIDParams{UID: args.UID})
+	if err != nil {
+		return nil, err
+	}
+	db, ok := dashboard.Dashboard.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("dashboard is not a JSON object")
+	}
+
+	from, to, err := dashboardTimeRange(db, args.From, args.To)
+	if err != nil {
+		return nil, err
+	}
+
+	variables, _ := resolveDashboardVariables(ctx, db, args.Variables, from, to)
+	for i := range variables {
+		v := &variables[i]
+		if len(v.Options) > maxOptions {
+			v.OmittedOptions = len(v.Options) - maxOptions
+			v.Options = v.Options[:maxOptions]
+		}
+	}
+	return variables, nil
+}
+
+// resolveDashboardVariables reads the variables of a dashboard and resolves
+// their options, in order, so that each variable can depend on the previous
+// ones. Values in overrides replace the current values of variables. It
+// also returns the variables as used to interpolate queries.
+func resolveDashboardVariables(ctx context.Context, db map[string]any, overrides map[string]string, from, to time.Time) ([]dashboardVariable, map[string]interpolate.Variable) {
+	variables := parseDashboardVariables(db)
+	values := interpolate.FromMap(overrides)
+	resolved := make(map[string]interpolate.Variable, len(variables)+len(values))
+	for i := range variables {
+		v := &variables[i]
+		if err := resolveVariableOptions(ctx, v, resolved, from, to); err != nil {
+			v.Error = err.Error()
+		}
+		if o, ok := values[v.Name]; ok {
+			v.Current = o.Values
+		}
+		resolved[v.Name] = v.interpolateVariable()
+	}
+	// Overrides for variables the dashboard doesn't define are still
+	// available to queries.
+	for name, v := range values {
+		if _, ok := resolved[name]; !ok {
+			resolved[name] = v
+		}
+	}
+	return variables, resolved
+}
+
+// dashboardVariablesResult is the result of get_dashboard_variables with a
+// link to the dashboard.
+type dashboardVariablesResult struct {
+	Variables []dashboardVariable `json:"variables"`
+	Link      string              `json:"link"`
+}
+
+func getDashboardVariablesTool(ctx context.Context, args GetDashboardVariablesParams) (any, error) {
+	variables, err := getDashboardVariables(ctx, args)
+	if err != nil || !args.IncludeLink {
+		return variables, err
+	}
+	return dashboardVariablesResult{
+		Variables: variables,
+		Link:      dashboardLink(ctx, args.UID, args.Variables, args.From, args.To, 0),
+	}, nil
+}
+
+var GetDashboardVariables = mcpgrafana.MustTool(
+	"get_dashboard_variables",
+	"List the template variables of a dashboard with their type, current value and available options. Options of query variables are evaluated against their Prometheus or Loki datasource (label_values, label_names, metrics, query_result); variables that depend on other variables use the current values of those variables unless overridden with `variables`. Use this to find valid values to pass as `variables` to the query tools. Set includeLink to true to get an object with the variables and a link to the dashboard with the given variables and time range.",
+	getDashboardVariablesTool,
+	mcp.WithTitleAnnotation("Get dashboard variables"),
+	mcp.WithIdempotentHintAnnotation(true),
+	mcp.WithReadOnlyHintAnnotation(true),
+)
+
+// dashboardTimeRange returns the given time range, defaulting to the time
+// range saved in the dashboard.
+func dashboardTimeRange(db map[string]any, from, to string) (time.Time, time.Time, error) {
+	timeRange, _ := db["time"].(map[string]any)
+	if from == "" {
+		from, _ = timeRange["from"].(string)
+	}
+	if from == "" {
+		from = defaultDashboardFrom
+	}
+	if to == "" {
+		to, _ = timeRange["to"].(string)
+	}
+	if to == "" {
+		to = defaultDashboardTo
+	}
+
+	fromTime, err := parseTime(from)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("parsing from time: %w", err)
+	}
+	toTime, err := parseTime(to)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("parsing to time: %w", err)
+	}
+	return fromTime, toTime, nil
+}
+
+// parseDashboardVariables reads the variables in the dashboard's
+// `templating.list`.
+func parseDashboardVariables(db map[string]any) []dashboardVariable {
+	templating, _ := db["templating"].(map[string]any)
+	list, _ := templating["list"].([]any)
+
+	variables := make([]dashboardVariable, 0, len(list))
+	for _, item := range list {
+		raw, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		name, _ := raw["name"].(string)
+		if name == "" {
+			continue
+		}
+		v := dashboardVariable{
+			Name:          name,
+			Current:       []string{},
+			datasourceRef: raw["datasource"],
+		}
+		v.Label, _ = raw["label"].(string)
+		v.Type, _ = raw["type"].(string)
+		v.Multi, _ = raw["multi"].(bool)
+		v.IncludeAll, _ = raw["includeAll"].(bool)
+		v.AllValue, _ = raw["allValue"].(string)
+		v.regex, _ = raw["regex"].(string)
+		v.auto, _ = raw["auto"].(bool)
+		v.autoMin, _ = raw["auto_min"].(string)
+		if hide, ok := raw["hide"].(float64); ok {
+			v.Hidden = hide == 2
+		}
+		if sort, ok := raw["sort"].(float64); ok {
+			v.sort = int(sort)
+		}
+		if count, ok := raw["auto_count"].(float64); ok {
+			v.autoCount = int(count)
+		}
+		v.Query = variableQuery(raw)
+
+		if current, ok := raw["current"].(map[string]any); ok {
+			v.Current = stringValues(current["value"])
+		}
+		if options, ok := raw["options"].([]any); ok {
+			for _, o := range options {
+				option, ok := o.(map[string]any)
+				if !ok {
+					continue
+				}
+				for _, value := range stringValues(option["value"]) {
+					text, _ := option["text"].(string)
+					v.Options = append(v.Options, newVariableOption(text, value))
+				}
+			}
+		}
+		variables = append(variables, v)
+	}
+	return variables
+}
+
+// variableQuery returns the query of a variable as a string. Newer versions of
+// the Prometheus and Loki datasources save the query as an object, in which
+// case the `query` field or the human readable `definition` is used.
+func variableQuery(raw map[string]any) string {
+	switch query := raw["query"].(type) {
+	case string:
+		return query
+	case map[string]any:
+		if q, ok := query["query"].(string); ok && q != "" {
+			return q
+		}
+		if q := lokiVariableQuery(query); q != "" {
+			return q
+		}
+	}
+	definition, _ := raw["definition"].(string)
+	return definition
+}
+
+// lokiVariableQuery converts a Loki variable query object to the equivalent
+// `label_names()` or `label_values()` query.
+func lokiVariableQuery(query map[string]any) string {
+	label, _ := query["label"].(string)
+	stream, _ := query["stream"].(string)
+	switch fmt.Sprint(query["type"]) {
+	case "0":
+		return "label_names()"
+	case "1":
+		if label == "" {
+			return ""
+		}
+		if stream != "" {
+			return fmt.Sprintf("label_values(%s, %s)", stream, label)
+		}
+		return fmt.Sprintf("label_values(%s)", label)
+	}
+	return ""
+}
+
+// stringValues converts a variable value, which is either a string or a list
+// of strings, to a list of strings.
+func stringValues(value any) []string {
+	switch value := value.(type) {
+	case string:
+		return []string{value}
+	case []any:
+		values := make([]string, 0, len(value))
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return []string{}
+}
+
+func newVariableOption(text, value string) variableOption {
+	if text == value {
+		text = ""
+	}
+	return variableOption{Text: text, Value: value}
+}
+
+// resolveVariableOptions sets the options of a variable from its definition,
+// evaluating queries through the variable's datasource. Variables referenced
+// by queries are interpolated with the already resolved variables.
+func resolveVariableOptions(ctx context.Context, v *dashboardVariable, resolved map[string]interpolate.Variable, from, to time.Time) error {
+	switch v.Type {
+	case "custom":
+		v.Options = parseCustomVariableOptions(v.Query)
+	case "constant":
+		v.Options = []variableOption{{Value: v.Query}}
+		v.Current = []string{v.Query}
+	case "textbox":
+		if len(v.Current) == 0 && v.Query != "" {
+			v.Current = []string{v.Query}
+		}
+	case "interval":
+		v.Options = intervalVariableOptions(v, to.Sub(from))
+		autoValue := "$__auto_interval_" + v.Name
+		for i, value := range v.Current {
+			if value == autoValue && v.auto {
+				v.Current[i] = v.Options[0].Value
+			}
+		}
+	case "datasource":
+		options, err := datasourceVariableOptions(ctx, v.Query, v.regex)
+		if err != nil {
+			return err
+		}
+		v.Options = options
+	case "query":
+		ds, err := resolveDatasource(ctx, v.datasourceRef, resolved)
+		if err != nil {
+			return fmt.Errorf("resolving datasource: %w", err)
+		}
+		v.Datasource = &ds
+
+		query, err := interpolateQuery(v.Query, interpolate.Options{
+			Variables:     resolved,
+			From:          from,
+			To:            to,
+			DefaultFormat: interpolate.FormatPrometheus,
+		})
+		if err != nil {
+			return err
+		}
+
+		var values []string
+		switch ds.Type {
+		case "prometheus":
+			promClient, err := promClientFromContext(ctx, ds.UID)
+			if err != nil {
+				return fmt.Errorf("getting Prometheus client: %w", err)
+			}
+			values, err = evaluatePrometheusVariableQuery(ctx, promClient, query, from, to)
+			if err != nil {
+				return err
+			}
+		case "loki":
+			lokiClient, err := newLokiClient(ctx, ds.UID)
+			if err != nil {
+				return fmt.Errorf("creating Loki client: %w", err)
+			}
+			values, err = evaluateLokiVariableQuery(ctx, lokiClient, query, from, to)
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("evaluating variable queries of %q datasources is not supported, options are those saved in the dashboard", ds.Type)
+		}
+
+		options, err := filterVariableOptions(values, v.regex)
+		if err != nil {
+			return err
+		}
+		sortVariableOptions(options, v.sort)
+		if v.IncludeAll {
+			options = append([]variableOption{{Text: "All", Value: interpolate.AllValue}}, options...)
+		}
+		v.Options = options
+	}
+	return nil
+}
+
+// parseCustomVariableOptions parses the comma separated values of a custom
+// variable. Values can be escaped with a backslash and given a different
+// text with `text : value`.
+func parseCustomVariableOptions(query string) []variableOption {
+	var (
+		options []variableOption
+		current strings.Builder
+	)
+	flush := func() {
+		item := strings.TrimSpace(current.String())
+		current.Reset()
+		if item == "" {
+			return
+		}
+		text, value, ok := strings.Cut(item, " : ")
+		if !ok {
+			text, value = item, item
+		}
+		options = append(options, newVariableOption(strings.TrimSpace(text), strings.TrimSpace(value)))
+	}
+	for i := 0; i < len(query); i++ {
+		switch {
+		case query[i] == '\\' && i+1 < len(query) && query[i+1] == ',':
+			current.WriteByte(',')
+			i++
+		case query[i] == ',':
+			flush()
+		default:
+			current.WriteByte(query[i])
+		}
+	}
+	flush()
+	return options
+}
+
+// intervalVariableOptions returns the options of an interval variable. If
+// the variable has an auto option, it comes first with the interval
+// computed from the time range.
+func intervalVariableOptions(v *dashboardVariable, timeRange time.Duration) []variableOption {
+	var options []variableOption
+	if v.auto {
+		count := v.autoCount
+		if count <= 0 {
+			count = 30
+		}
+		minInterval := 10 * time.Second
+		if d, err := model.ParseDuration(v.autoMin); err == nil {
+			minInterval = time.Duration(d)
+		}
+		interval := interpolate.CalculateInterval(timeRange, count, minInterval)
+		options = append(options, variableOption{Text: "auto", Value: interpolate.FormatInterval(interval)})
+	}
+	for _, value := range strings.Split(v.Query, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			options = append(options, variableOption{Value: value})
+		}
+	}
+	return options
+}
+
+// datasourceVariableOptions lists the datasources of the given type whose
+// name matches regex.
+func datasourceVariableOptions(ctx context.Context, dsType, regex string) ([]variableOption, error) {
+	re, err := compileVariableRegex(regex)
+	if err != nil {
+		return nil, err
+	}
+	datasources, err := listDatasources(ctx, ListDatasourcesParams{})
+	if err != nil {
+		return nil, err
+	}
+	var options []variableOption
+	for _, ds := range datasources {
+		if ds.Type != dsType || (re != nil && !re.MatchString(ds.Name)) {
+			continue
+		}
+		options = append(options, newVariableOption(ds.Name, ds.UID))
+	}
+	return options, nil
+}
+
+// evaluatePrometheusVariableQuery evaluates a Prometheus variable query. It
+// supports the same functions as Grafana's Prometheus datasource; any other
+// query is treated as a series selector.
+func evaluatePrometheusVariableQuery(ctx context.Context, promClient promv1.API, query string, from, to time.Time) ([]string, error) {
+	query = strings.TrimSpace(query)
+
+	if m := labelNamesQueryRegex.FindStringSubmatch(query); m != nil {
+		var matches []string
+		if m[1] != "" {
+			matches = []string{m[1]}
+		}
+		names, _, err := promClient.LabelNames(ctx, matches, from, to)
+		if err != nil {
+			return nil, fmt.Errorf("listing Prometheus label names: %w", err)
+		}
+		return names, nil
+	}
+
+	if m := labelValuesQueryRegex.FindStringSubmatch(query); m != nil {
+		var matches []string
+		if m[1] != "" {
+			matches = []string{m[1]}
+		}
+		values, _, err := promClient.LabelValues(ctx, m[2], matches, from, to)
+		if err != nil {
+			return nil, fmt.Errorf("listing Prometheus label values: %w", err)
+		}
+		result := make([]string, 0, len(values))
+		for _, v := range values {
+			result = append(result, string(v))
+		}
+		return result, nil
+	}
+
+	if m := metricsQueryRegex.FindStringSubmatch(query); m != nil {
+		re, err := regexp.Compile(m[1])
+		if err != nil {
+			return nil, fmt.Errorf("compiling metrics regex: %w", err)
+		}
+		values, _, err := promClient.LabelValues(ctx, model.MetricNameLabel, nil, from, to)
+		if err != nil {
+			return nil, fmt.Errorf("listing Prometheus metric names: %w", err)
+		}
+		var result []string
+		for _, v := range values {
+			if re.MatchString(string(v)) {
+				result = append(result, string(v))
+			}
+		}
+		return result, nil
+	}
+
+	if m := queryResultQueryRegex.FindStringSubmatch(query); m != nil {
+		value, _, err := promClient.Query(ctx, m[1], to)
+		if err != nil {
+			return nil, fmt.Errorf("querying Prometheus: %w", err)
+		}
+		vector, ok := value.(model.Vector)
+		if !ok {
+			return nil, fmt.Errorf("query_result expected a vector result, got %s", value.Type())
+		}
+		result := make([]string, 0, len(vector))
+		for _, s := range vector {
+			result = append(result, fmt.Sprintf("%s %s %d", formatVariableMetric(s.Metric), s.Value, int64(s.Timestamp)))
+		}
+		return result, nil
+	}
+
+	series, _, err := promClient.Series(ctx, []string{query}, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("listing Prometheus series: %w", err)
+	}
+	result := make([]string, 0, len(series))
+	for _, s := range series {
+		result = append(result, formatVariableMetric(model.Metric(s)))
+	}
+	return result, nil
+}
+
+// formatVariableMetric formats a metric the way Grafana does for variable
+// options: the metric name followed by the other labels in braces.
+func formatVariableMetric(metric model.Metric) string {
+	var b strings.Builder
+	b.WriteString(string(metric[model.MetricNameLabel]))
+
+	names := make([]string, 0, len(metric))
+	for name := range metric {
+		if name != model.MetricNameLabel {
+			names = append(names, string(name))
+		}
+	}
+	if len(names) == 0 {
+		return b.String()
+	}
+	slices.Sort(names)
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=%q", name, string(metric[model.LabelName(name)]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// evaluateLokiVariableQuery evaluates a `label_names()` or `label_values()`
+// Loki variable query.
+func evaluateLokiVariableQuery(ctx context.Context, client *Client, query string, from, to time.Time) ([]string, error) {
+	query = strings.TrimSpace(query)
+
+	params := url.Values{}
+	params.Add("start", from.Format(time.RFC3339))
+	params.Add("end", to.Format(time.RFC3339))
+
+	if labelNamesQueryRegex.MatchString(query) {
+		return client.fetchLabelData(ctx, "/loki/api/v1/labels", params)
+	}
+	if m := labelValuesQueryRegex.FindStringSubmatch(query); m != nil {
+		if m[1] != "" {
+			params.Add("query", m[1])
+		}
+		return client.fetchLabelData(ctx, fmt.Sprintf("/loki/api/v1/label/%s/values", m[2]), params)
+	}
+	return nil, fmt.Errorf("unsupported Loki variable query %q, expected label_names() or label_values()", query)
+}
+
+// compileVariableRegex compiles the regex of a variable, which may be written
+// as `/pattern/flags`.
+func compileVariableRegex(regex string) (*regexp.Regexp, error) {
+	if regex == "" {
+		return nil, nil
+	}
+	if len(regex) > 1 && strings.HasPrefix(regex, "/") {
+		if end := strings.LastIndex(regex, "/"); end > 0 {
+			pattern, flags := regex[1:end], regex[end+1:]
+			if strings.Contains(flags, "i") {
+				pattern = "(?i)" + pattern
+			}
+			regex = pattern
+		}
+	}
+	re, err := regexp.Compile(regex)
+	if err != nil {
+		return nil, fmt.Errorf("compiling variable regex: %w", err)
+	}
+	return re, nil
+}
+
+// filterVariableOptions applies the regex of a query variable to its values,
+// as Grafana does: values that don't match are dropped, and the first
+// capture group, or the `text` and `value` named groups, select the option.
+// Duplicate values are removed.
+func filterVariableOptions(values []string, regex string) ([]variableOption, error) {
+	re, err := compileVariableRegex(regex)
+	if err != nil {
+		return nil, err
+	}
+
+	options := make([]variableOption, 0, len(values))
+	seen := map[string]bool{}
+	for _, value := range values {
+		text := value
+		if re != nil {
+			m := re.FindStringSubmatch(value)
+			if m == nil {
+				continue
+			}
+			textIdx, valueIdx := re.SubexpIndex("text"), re.SubexpIndex("value")
+			switch {
+			case textIdx > 0 || valueIdx > 0:
+				if valueIdx > 0 && m[valueIdx] != "" {
+					value = m[valueIdx]
+				} else {
+					value = m[textIdx]
+				}
+				text = value
+				if textIdx > 0 && m[textIdx] != "" {
+					text = m[textIdx]
+				}
+			case len(m) > 1:
+				value, text = m[1], m[1]
+			}
+		}
+		if seen[value] {
+			continue
+		}
+		seen[value] = true
+		options = append(options, newVariableOption(text, value))
+	}
+	return options, nil
+}
+
+// sortVariableOptions sorts options using the sort setting of a variable:
+// 1 and 2 sort alphabetically, 3 and 4 numerically, 5 and 6 alphabetically
+// ignoring case, and 7 and 8 naturally. Odd values sort ascending and even
+// values descending. 0 keeps the datasource's order.
+func sortVariableOptions(options []variableOption, sortOrder int) {
+	if sortOrder <= 0 {
+		return
+	}
+	text := func(o variableOption) string {
+		return cmp.Or(o.Text, o.Value)
+	}
+	var compare func(a, b variableOption) int
+	switch (sortOrder + 1) / 2 {
+	case 1:
+		compare = func(a, b variableOption) int { return strings.Compare(text(a), text(b)) }
+	case 2:
+		compare = func(a, b variableOption) int { return cmp.Compare(leadingNumber(text(a)), leadingNumber(text(b))) }
+	case 3:
+		compare = func(a, b variableOption) int {
+			return strings.Compare(strings.ToLower(text(a)), strings.ToLower(text(b)))
+		}
+	case 4:
+		compare = func(a, b variableOption) int { return naturalCompare(text(a), text(b)) }
+	default:
+		return
+	}
+	if sortOrder%2 == 0 {
+		ascending := compare
+		compare = func(a, b variableOption) int { return ascending(b, a) }
+	}
+	slices.SortStableFunc(options, compare)
+}
+
+var leadingNumberRegex = regexp.MustCompile(`\d+`)
+
+// leadingNumber returns the first number in s, or -1 if there is none, as
+// Grafana's numerical sort does.
+func leadingNumber(s string) int {
+	n, err := strconv.Atoi(leadingNumberRegex.FindString(s))
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// naturalCompare compares strings treating runs of digits as numbers.
+func naturalCompare(a, b string) int {
+	for a != "" && b != "" {
+		da, db := leadingDigits(a), leadingDigits(b)
+		if da != "" && db != "" {
+			na, _ := strconv.Atoi(da)
+			nb, _ := strconv.Atoi(db)
+			if c := cmp.Compare(na, nb); c != 0 {
+				return c
+			}
+			a, b = a[len(da):], b[len(db):]
+			continue
+		}
+		if c := cmp.Compare(a[0], b[0]); c != 0 {
+			return c
+		}
+		a, b = a[1:], b[1:]
+	}
+	return cmp.Compare(len(a), len(b))
+}
+
+func leadingDigits(s string) string {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return s[:i]
+}
+
+// resolveDatasource resolves a datasource reference from a dashboard to a
+// concrete datasource. The reference may be an object with a UID and type, a
+// datasource name as saved by older versions of Grafana, or nil for the
+// default datasource. UIDs and names referencing variables, such as
+// `$datasource`, are resolved using the given variables.
+func resolveDatasource(ctx context.Context, ref any, variables map[string]interpolate.Variable) (datasourceInfo, error) {
+	var uid, dsType string
+	switch ref := ref.(type) {
+	case string:
+		uid = ref
+	case map[string]any:
+		uid, _ = ref["uid"].(string)
+		dsType, _ = ref["type"].(string)
+	}
+
+	uid, err := interpolateDatasourceRef(uid, variables)
+	if err != nil {
+		return datasourceInfo{}, err
+	}
+
+	switch uid {
+	case "", "default":
+		return defaultDatasource(ctx)
+	case grafanaDatasourceUID, "-- Grafana --":
+		return datasourceInfo{UID: grafanaDatasourceUID, Type: "grafana"}, nil
+	case mixedDatasourceUID:
+		return datasourceInfo{UID: mixedDatasourceUID, Type: "datasource"}, nil
+	case dashboardDatasourceUID:
+		return datasourceInfo{UID: dashboardDatasourceUID, Type: "datasource"}, nil
+	}
+
+	ds, err := getDatasourceByUID(ctx, GetDatasourceByUIDParams{UID: uid})
+	if err != nil {
+		// Datasource variables and older dashboards reference datasources by name.
+		byName, nameErr := getDatasourceByName(ctx, GetDatasourceByNameParams{Name: uid})
+		if nameErr != nil {
+			return datasourceInfo{}, err
+		}
+		ds = byName
+	}
+	if ds.Type != "" {
+		dsType = ds.Type
+	}
+	return datasourceInfo{UID: ds.UID, Type: dsType}, nil
+}
+
+// interpolateDatasourceRef replaces the variables in a datasource UID or
+// name. Datasource variables with several values, or "All" selected, resolve
+// to their first value.
+func interpolateDatasourceRef(ref string, variables map[string]interpolate.Variable) (string, error) {
+	names := interpolate.Variables(ref)
+	if len(names) == 0 {
+		return ref, nil
+	}
+	single := make(map[string]interpolate.Variable, len(names))
+	for _, name := range names {
+		v, ok := variables[name]
+		if !ok {
+			continue
+		}
+		values := v.Values
+		if len(values) == 1 && values[0] == interpolate.AllValue {
+			values = v.Options
+		}
+		if len(values) > 0 {
+			single[name] = interpolate.Variable{Name: name, Values: values[:1]}
+		}
+	}
+	return interpolateValue(ref, interpolate.Options{Variables: single})
+}
+
+func defaultDatasource(ctx context.Context) (datasourceInfo, error) {
+	datasources, err := listDatasources(ctx, ListDatasourcesParams{})
+	if err != nil {
+		return datasourceInfo{}, err
+	}
+	for _, ds := range datasources {
+		if ds.IsDefault {
+			return datasourceInfo{UID: ds.UID, Type: ds.Type}, nil
+		}
+	}
+	return datasourceInfo{}, fmt.Errorf("no default datasource configured")
+}
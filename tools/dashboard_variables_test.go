@@ -0,0 +1,285 @@
+//go:build unit
+// +build unit
+
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"mcp-grafana-local/internal/interpolate"
+)
+
+// fakePromAPI records the calls made by variable queries. Methods that are
+// not overridden panic through the nil embedded interface.
+type fakePromAPI struct {
+	promv1.API
+
+	labelNamesMatches  []string
+	labelValuesName    string
+	labelValuesMatches []string
+	query              string
+	seriesMatches      []string
+}
+
+func (f *fakePromAPI) LabelNames(ctx context.Context, matches []string, startTime, endTime time.Time, opts ...promv1.Option) ([]string, promv1.Warnings, error) {
+	f.labelNamesMatches = matches
+	return []string{"instance", "job"}, nil, nil
+}
+
+func (f *fakePromAPI) LabelValues(ctx context.Context, label string, matches []string, startTime, endTime time.Time, opts ...promv1.Option) (model.LabelValues, promv1.Warnings, error) {
+	f.labelValuesName = label
+	f.labelValuesMatches = matches
+	if label == model.MetricNameLabel {
+		return model.LabelValues{"up", "node_load1", "node_load5"}, nil, nil
+	}
+	return model.LabelValues{"api", "db"}, nil, nil
+}
+
+func (f *fakePromAPI) Query(ctx context.Context, query string, ts time.Time, opts ...promv1.Option) (model.Value, promv1.Warnings, error) {
+	f.query = query
+	return model.Vector{{
+		Metric:    model.Metric{"__name__": "up", "job": "api"},
+		Value:     1,
+		Timestamp: 1000,
+	}}, nil, nil
+}
+
+func (f *fakePromAPI) Series(ctx context.Context, matches []string, startTime, endTime time.Time, opts ...promv1.Option) ([]model.LabelSet, promv1.Warnings, error) {
+	f.seriesMatches = matches
+	return []model.LabelSet{{"__name__": "up", "job": "api", "instance": "a"}}, nil, nil
+}
+
+func TestEvaluatePrometheusVariableQuery(t *testing.T) {
+	ctx := context.Background()
+	from, to := time.Unix(0, 0), time.Unix(3600, 0)
+
+	t.Run("label_names", func(t *testing.T) {
+		api := &fakePromAPI{}
+		values, err := evaluatePrometheusVariableQuery(ctx, api, "label_names()", from, to)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"instance", "job"}, values)
+		assert.Empty(t, api.labelNamesMatches)
+	})
+
+	t.Run("label_values with metric", func(t *testing.T) {
+		api := &fakePromAPI{}
+		values, err := evaluatePrometheusVariableQuery(ctx, api, `label_values(up{env="prod"}, job)`, from, to)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"api", "db"}, values)
+		assert.Equal(t, "job", api.labelValuesName)
+		assert.Equal(t, []string{`up{env="prod"}`}, api.labelValuesMatches)
+	})
+
+	t.Run("label_values without metric", func(t *testing.T) {
+		api := &fakePromAPI{}
+		_, err := evaluatePrometheusVariableQuery(ctx, api, "label_values(job)", from, to)
+		require.NoError(t, err)
+		assert.Equal(t, "job", api.labelValuesName)
+		assert.Empty(t, api.labelValuesMatches)
+	})
+
+	t.Run("metrics", func(t *testing.T) {
+		values, err := evaluatePrometheusVariableQuery(ctx, &fakePromAPI{}, "metrics(node_.*)", from, to)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"node_load1", "node_load5"}, values)
+	})
+
+	t.Run("query_result", func(t *testing.T) {
+		api := &fakePromAPI{}
+		values, err := evaluatePrometheusVariableQuery(ctx, api, "query_result(up == 1)", from, to)
+		require.NoError(t, err)
+		assert.Equal(t, "up == 1", api.query)
+		assert.Equal(t, []string{`up{job="api"} 1 1000`}, values)
+	})
+
+	t.Run("series", func(t *testing.T) {
+		api := &fakePromAPI{}
+		values, err := evaluatePrometheusVariableQuery(ctx, api, `up{job="api"}`, from, to)
+		require.NoError(t, err)
+		assert.Equal(t, []string{`up{job="api"}`}, api.seriesMatches)
+		assert.Equal(t, []string{`up{instance="a",job="api"}`}, values)
+	})
+}
+
+func TestParseDashboardVariables(t *testing.T) {
+	var db map[string]any
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"templating": {"list": [
+			{
+				"name": "job",
+				"type": "query",
+				"datasource": {"type": "prometheus", "uid": "$datasource"},
+				"query": {"query": "label_values(up, job)", "refId": "A"},
+				"definition": "label_values(up, job)",
+				"multi": true,
+				"includeAll": true,
+				"current": {"text": ["All"], "value": ["$__all"]},
+				"options": [{"text": "All", "value": "$__all"}, {"text": "api", "value": "api"}],
+				"regex": "/a.*/",
+				"sort": 1,
+				"hide": 2
+			},
+			{
+				"name": "app",
+				"type": "query",
+				"query": {"type": 1, "label": "app", "stream": "{env=\"prod\"}"}
+			},
+			{
+				"name": "env",
+				"label": "Environment",
+				"type": "custom",
+				"query": "prod,dev",
+				"current": {"text": "prod", "value": "prod"}
+			},
+			{"type": "custom", "query": "unnamed"}
+		]}
+	}`), &db))
+
+	variables := parseDashboardVariables(db)
+	require.Len(t, variables, 3)
+
+	job := variables[0]
+	assert.Equal(t, "job", job.Name)
+	assert.Equal(t, "query", job.Type)
+	assert.Equal(t, "label_values(up, job)", job.Query)
+	assert.True(t, job.Multi)
+	assert.True(t, job.IncludeAll)
+	assert.True(t, job.Hidden)
+	assert.Equal(t, []string{interpolate.AllValue}, job.Current)
+	assert.Equal(t, []variableOption{{Text: "All", Value: interpolate.AllValue}, {Value: "api"}}, job.Options)
+	assert.Equal(t, "/a.*/", job.regex)
+	assert.Equal(t, 1, job.sort)
+	assert.Equal(t, map[string]any{"type": "prometheus", "uid": "$datasource"}, job.datasourceRef)
+	assert.Equal(t, interpolate.Variable{
+		Name:       "job",
+		Values:     []string{interpolate.AllValue},
+		Multi:      true,
+		IncludeAll: true,
+		Options:    []string{"api"},
+	}, job.interpolateVariable())
+
+	assert.Equal(t, `label_values({env="prod"}, app)`, variables[1].Query)
+	assert.Equal(t, []string{}, variables[1].Current)
+
+	assert.Equal(t, "Environment", variables[2].Label)
+	assert.Equal(t, []string{"prod"}, variables[2].Current)
+}
+
+func TestResolveStaticVariableOptions(t *testing.T) {
+	ctx := context.Background()
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+
+	t.Run("custom", func(t *testing.T) {
+		v := dashboardVariable{Type: "custom", Query: `a, b\,c, Production : prod`}
+		require.NoError(t, resolveVariableOptions(ctx, &v, nil, from, to))
+		assert.Equal(t, []variableOption{{Value: "a"}, {Value: "b,c"}, {Text: "Production", Value: "prod"}}, v.Options)
+	})
+
+	t.Run("constant", func(t *testing.T) {
+		v := dashboardVariable{Type: "constant", Query: "prod"}
+		require.NoError(t, resolveVariableOptions(ctx, &v, nil, from, to))
+		assert.Equal(t, []string{"prod"}, v.Current)
+	})
+
+	t.Run("textbox defaults to its query", func(t *testing.T) {
+		v := dashboardVariable{Type: "textbox", Query: "default"}
+		require.NoError(t, resolveVariableOptions(ctx, &v, nil, from, to))
+		assert.Equal(t, []string{"default"}, v.Current)
+	})
+
+	t.Run("interval with auto", func(t *testing.T) {
+		v := dashboardVariable{
+			Name:    "interval",
+			Type:    "interval",
+			Query:   "1m,10m,1h",
+			Current: []string{"$__auto_interval_interval"},
+			auto:    true,
+		}
+		require.NoError(t, resolveVariableOptions(ctx, &v, nil, from, to))
+		assert.Equal(t, []variableOption{{Text: "auto", Value: "1h"}, {Value: "1m"}, {Value: "10m"}, {Value: "1h"}}, v.Options)
+		assert.Equal(t, []string{"1h"}, v.Current)
+	})
+}
+
+func TestFilterVariableOptions(t *testing.T) {
+	values := []string{"prod-eu", "prod-us", "dev-eu", "prod-eu"}
+
+	options, err := filterVariableOptions(values, "")
+	require.NoError(t, err)
+	assert.Equal(t, []variableOption{{Value: "prod-eu"}, {Value: "prod-us"}, {Value: "dev-eu"}}, options)
+
+	options, err = filterVariableOptions(values, "/^prod-(.*)$/")
+	require.NoError(t, err)
+	assert.Equal(t, []variableOption{{Value: "eu"}, {Value: "us"}}, options)
+
+	options, err = filterVariableOptions(values, "/(?P<text>[a-z]+)-(?P<value>[a-z]+)/")
+	require.NoError(t, err)
+	assert.Equal(t, []variableOption{{Text: "prod", Value: "eu"}, {Text: "prod", Value: "us"}}, options)
+
+	options, err = filterVariableOptions([]string{"API", "db"}, "/api/i")
+	require.NoError(t, err)
+	assert.Equal(t, []variableOption{{Value: "API"}}, options)
+
+	_, err = filterVariableOptions(values, "(")
+	assert.Error(t, err)
+}
+
+func TestSortVariableOptions(t *testing.T) {
+	options := func(values ...string) []variableOption {
+		result := make([]variableOption, 0, len(values))
+		for _, v := range values {
+			result = append(result, variableOption{Value: v})
+		}
+		return result
+	}
+
+	testCases := []struct {
+		sort     int
+		expected []variableOption
+	}{
+		{0, options("b10", "B2", "a1")},
+		{1, options("B2", "a1", "b10")},
+		{2, options("b10", "a1", "B2")},
+		{3, options("a1", "B2", "b10")},
+		{4, options("b10", "B2", "a1")},
+		{5, options("a1", "b10", "B2")},
+		{7, options("B2", "a1", "b10")},
+	}
+	for _, tc := range testCases {
+		o := options("b10", "B2", "a1")
+		sortVariableOptions(o, tc.sort)
+		assert.Equal(t, tc.expected, o, "sort %d", tc.sort)
+	}
+}
+
+func TestInterpolateDatasourceRef(t *testing.T) {
+	variables := map[string]interpolate.Variable{
+		"ds":  {Values: []string{"prom-a", "prom-b"}, Multi: true},
+		"all": {Values: []string{interpolate.AllValue}, IncludeAll: true, Options: []string{"loki-a"}},
+	}
+
+	uid, err := interpolateDatasourceRef("fixed", variables)
+	require.NoError(t, err)
+	assert.Equal(t, "fixed", uid)
+
+	uid, err = interpolateDatasourceRef("${ds}", variables)
+	require.NoError(t, err)
+	assert.Equal(t, "prom-a", uid)
+
+	uid, err = interpolateDatasourceRef("$all", variables)
+	require.NoError(t, err)
+	assert.Equal(t, "loki-a", uid)
+
+	_, err = interpolateDatasourceRef("$missing", variables)
+	var unresolved *UnresolvedVariablesError
+	assert.ErrorAs(t, err, &unresolved)
+}
@@ -0,0 +1,429 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/grafana/grafana-openapi-client-go/client/dashboard_versions"
+	"github.com/grafana/grafana-openapi-client-go/models"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	mcpgrafana "mcp-grafana-local"
+	"mcp-grafana-local/internal/jsonpatch"
+)
+
+// DefaultDashboardVersionsLimit is the default number of versions returned by
+// list_dashboard_versions.
+const DefaultDashboardVersionsLimit = 20
+
+type ListDashboardVersionsParams struct {
+	UID   string `json:"uid" jsonschema:"required,description=The UID of the dashboard"`
+	Limit int    `json:"limit,omitempty" jsonschema:"description=Optionally\\, the maximum number of versions to return\\, newest first (default 20)"`
+}
+
+type dashboardVersionSummary struct {
+	Version       int64  `json:"version"`
+	ParentVersion int64  `json:"parentVersion,omitempty"`
+	RestoredFrom  int64  `json:"restoredFrom,omitempty"`
+	Created       string `json:"created"`
+	CreatedBy     string `json:"createdBy,omitempty"`
+	Message       string `json:"message,omitempty"`
+}
+
+func listDashboardVersions(ctx context.Context, args ListDashboardVersionsParams) ([]dashboardVersionSummary, error) {
+	limit := int64(args.Limit)
+	if limit <= 0 {
+		limit = DefaultDashboardVersionsLimit
+	}
+
+	c := mcpgrafana.GrafanaClientFromContext(ctx)
+	params := dashboard_versions.NewGetDashboardVersionsByUIDParamsWithContext(ctx).
+		WithUID(args.UID).
+		WithLimit(&limit)
+	resp, err := c.DashboardVersions.GetDashboardVersionsByUID(params)
+	if err != nil {
+		return nil, fmt.Errorf("list dashboard versions for uid %s: %w", args.UID, err)
+	}
+
+	versions := make([]dashboardVersionSummary, 0, len(resp.Payload))
+	for _, v := range resp.Payload {
+		versions = append(versions, dashboardVersionSummary{
+			Version:       v.Version,
+			ParentVersion: v.ParentVersion,
+			RestoredFrom:  v.RestoredFrom,
+			Created:       time.Time(v.Created).UTC().Format(time.RFC3339),
+			CreatedBy:     v.CreatedBy,
+			Message:       v.Message,
+		})
+	}
+	return versions, nil
+}
+
+var ListDashboardVersions = mcpgrafana.MustTool(
+	"list_dashboard_versions",
+	"List the saved versions of a dashboard, newest first, with the version number, creation time, author and commit message of each.",
+	listDashboardVersions,
+	mcp.WithTitleAnnotation("List dashboard versions"),
+	mcp.WithIdempotentHintAnnotation(true),
+	mcp.WithReadOnlyHintAnnotation(true),
+)
+
+type DiffDashboardVersionsParams struct {
+	UID         string `json:"uid" jsonschema:"required,description=The UID of the dashboard"`
+	BaseVersion int64  `json:"baseVersion,omitempty" jsonschema:"description=Optionally\\, the version to compare from. Defaults to the version before newVersion"`
+	NewVersion  int64  `json:"newVersion,omitempty" jsonschema:"description=Optionally\\, the version to compare to. Defaults to the current version"`
+}
+
+// fieldChange is a change of a single value. Before is unset for added
+// values and After for removed ones.
+type fieldChange struct {
+	Path   string `json:"path"`
+	Before any    `json:"before,omitempty"`
+	After  any    `json:"after,omitempty"`
+}
+
+type panelRef struct {
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+}
+
+type queryChange struct {
+	RefID  string `json:"refId"`
+	Change string `json:"change"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+type panelChange struct {
+	ID      int           `json:"id"`
+	Title   string        `json:"title"`
+	Queries []queryChange `json:"queries,omitempty"`
+	Changes []fieldChange `json:"changes,omitempty"`
+}
+
+type variableChange struct {
+	Name    string        `json:"name"`
+	Changes []fieldChange `json:"changes"`
+}
+
+type dashboardDiff struct {
+	UID              string           `json:"uid"`
+	BaseVersion      int64            `json:"baseVersion"`
+	NewVersion       int64            `json:"newVersion"`
+	Changes          []fieldChange    `json:"changes,omitempty"`
+	VariablesAdded   []string         `json:"variablesAdded,omitempty"`
+	VariablesRemoved []string         `json:"variablesRemoved,omitempty"`
+	VariablesChanged []variableChange `json:"variablesChanged,omitempty"`
+	PanelsAdded      []panelRef       `json:"panelsAdded,omitempty"`
+	PanelsRemoved    []panelRef       `json:"panelsRemoved,omitempty"`
+	PanelsChanged    []panelChange    `json:"panelsChanged,omitempty"`
+}
+
+func diffDashboardVersions(ctx context.Context, args DiffDashboardVersionsParams) (*dashboardDiff, error) {
+	if args.BaseVersion < 0 || args.NewVersion < 0 {
+		return nil, fmt.Errorf("versions must not be negative")
+	}
+
+	newVersion := args.NewVersion
+	var newDashboard map[string]any
+	if newVersion == 0 {
+		dashboard, err := getDashboardByUID(ctx, GetDashboardByUIDParams{UID: args.UID})
+		if err != nil {
+			return nil, err
+		}
+		db, ok := dashboard.Dashboard.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("dashboard is not a JSON object")
+		}
+		newDashboard = db
+		version, _ := db["version"].(float64)
+		newVersion = int64(version)
+	} else {
+		db, err := getDashboardVersion(ctx, args.UID, newVersion)
+		if err != nil {
+			return nil, err
+		}
+		newDashboard = db
+	}
+
+	baseVersion := args.BaseVersion
+	if baseVersion == 0 {
+		baseVersion = newVersion - 1
+	}
+	if baseVersion < 1 {
+		return nil, fmt.Errorf("version %d has no previous version to compare with", newVersion)
+	}
+	baseDashboard, err := getDashboardVersion(ctx, args.UID, baseVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := diffDashboards(baseDashboard, newDashboard)
+	diff.UID = args.UID
+	diff.BaseVersion = baseVersion
+	diff.NewVersion = newVersion
+	return diff, nil
+}
+
+var DiffDashboardVersions = mcpgrafana.MustTool(
+	"diff_dashboard_versions",
+	"Compare two versions of a dashboard. By default compares the current version with the previous one, e.g. to review a change just made with update_dashboard or patch_dashboard. Returns the changed dashboard settings, added, removed and changed variables, added and removed panels, and for changed panels the query changes by refId and the other changed fields as JSON Pointer paths with before and after values.",
+	diffDashboardVersions,
+	mcp.WithTitleAnnotation("Diff dashboard versions"),
+	mcp.WithIdempotentHintAnnotation(true),
+	mcp.WithReadOnlyHintAnnotation(true),
+)
+
+type RestoreDashboardVersionParams struct {
+	UID     string `json:"uid" jsonschema:"required,description=The UID of the dashboard"`
+	Version int64  `json:"version" jsonschema:"required,description=The version to restore"`
+}
+
+func restoreDashboardVersion(ctx context.Context, args RestoreDashboardVersionParams) (*models.RestoreDashboardVersionByUIDOKBody, error) {
+	if args.Version <= 0 {
+		return nil, fmt.Errorf("version must be positive")
+	}
+	c := mcpgrafana.GrafanaClientFromContext(ctx)
+	resp, err := c.DashboardVersions.RestoreDashboardVersionByUID(args.UID, &models.RestoreDashboardVersionCommand{Version: args.Version})
+	if err != nil {
+		return nil, fmt.Errorf("restore dashboard %s to version %d: %w", args.UID, args.Version, err)
+	}
+	return resp.Payload, nil
+}
+
+var RestoreDashboardVersion = mcpgrafana.MustTool(
+	"restore_dashboard_version",
+	"Restore a dashboard to a previous version. The restored content is saved as a new version, so the restore itself can be reviewed with diff_dashboard_versions and rolled back.",
+	restoreDashboardVersion,
+	mcp.WithTitleAnnotation("Restore dashboard version"),
+	mcp.WithDestructiveHintAnnotation(true),
+)
+
+func getDashboardVersion(ctx context.Context, uid string, version int64) (map[string]any, error) {
+	c := mcpgrafana.GrafanaClientFromContext(ctx)
+	resp, err := c.DashboardVersions.GetDashboardVersionByUID(uid, version)
+	if err != nil {
+		return nil, fmt.Errorf("get version %d of dashboard %s: %w", version, uid, err)
+	}
+	db, ok := resp.Payload.Data.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("version %d of dashboard %s is not a JSON object", version, uid)
+	}
+	return db, nil
+}
+
+// diffDashboards compares two dashboard JSON models. Panels are matched by
+// ID, variables by name and panel queries by refId.
+func diffDashboards(base, updated map[string]any) *dashboardDiff {
+	diff := &dashboardDiff{}
+
+	// Everything but panels and variables, which are compared below, and
+	// the fields Grafana updates on every save.
+	ignored := []string{"panels", "templating", "version", "id"}
+	diffJSON("", withoutKeys(base, ignored...), withoutKeys(updated, ignored...), &diff.Changes)
+
+	baseVars, newVars := variablesByName(base), variablesByName(updated)
+	for _, name := range sortedKeys(newVars) {
+		if _, ok := baseVars[name]; !ok {
+			diff.VariablesAdded = append(diff.VariablesAdded, name)
+		}
+	}
+	for _, name := range sortedKeys(baseVars) {
+		newVar, ok := newVars[name]
+		if !ok {
+			diff.VariablesRemoved = append(diff.VariablesRemoved, name)
+			continue
+		}
+		var changes []fieldChange
+		diffJSON("", baseVars[name], newVar, &changes)
+		if len(changes) > 0 {
+			diff.VariablesChanged = append(diff.VariablesChanged, variableChange{Name: name, Changes: changes})
+		}
+	}
+
+	basePanels, newPanels := panelsByID(base), panelsByID(updated)
+	for _, id := range sortedKeys(newPanels) {
+		if _, ok := basePanels[id]; !ok {
+			diff.PanelsAdded = append(diff.PanelsAdded, newPanelRef(id, newPanels[id]))
+		}
+	}
+	for _, id := range sortedKeys(basePanels) {
+		newPanel, ok := newPanels[id]
+		if !ok {
+			diff.PanelsRemoved = append(diff.PanelsRemoved, newPanelRef(id, basePanels[id]))
+			continue
+		}
+		if change := diffPanel(id, basePanels[id], newPanel); change != nil {
+			diff.PanelsChanged = append(diff.PanelsChanged, *change)
+		}
+	}
+	return diff
+}
+
+func diffPanel(id int, base, updated map[string]any) *panelChange {
+	change := panelChange{ID: id}
+	change.Title, _ = updated["title"].(string)
+
+	// Nested panels of rows are compared on their own.
+	diffJSON("", withoutKeys(base, "targets", "panels"), withoutKeys(updated, "targets", "panels"), &change.Changes)
+
+	baseTargets, _ := base["targets"].([]any)
+	newTargets, _ := updated["targets"].([]any)
+	baseByRef := map[string]map[string]any{}
+	for _, t := range baseTargets {
+		if target, ok := t.(map[string]any); ok {
+			refID, _ := target["refId"].(string)
+			baseByRef[refID] = target
+		}
+	}
+	seen := map[string]bool{}
+	for i, t := range newTargets {
+		target, ok := t.(map[string]any)
+		if !ok {
+			continue
+		}
+		refID, _ := target["refId"].(string)
+		seen[refID] = true
+		newField, _ := queryFieldFor(target, targetDatasourceType(updated, target))
+		newQuery, _ := targetQuery(target, targetDatasourceType(updated, target))
+
+		baseTarget, ok := baseByRef[refID]
+		if !ok {
+			change.Queries = append(change.Queries, queryChange{RefID: refID, Change: "added", After: newQuery})
+			continue
+		}
+		baseField, _ := queryFieldFor(baseTarget, targetDatasourceType(base, baseTarget))
+		baseQuery, _ := targetQuery(baseTarget, targetDatasourceType(base, baseTarget))
+		if baseQuery != newQuery {
+			change.Queries = append(change.Queries, queryChange{RefID: refID, Change: "changed", Before: baseQuery, After: newQuery})
+		}
+		diffJSON(jsonpatch.Pointer("targets", strconv.Itoa(i)), withoutKeys(baseTarget, baseField.field), withoutKeys(target, newField.field), &change.Changes)
+	}
+	for _, t := range baseTargets {
+		target, ok := t.(map[string]any)
+		if !ok {
+			continue
+		}
+		refID, _ := target["refId"].(string)
+		if !seen[refID] {
+			query, _ := targetQuery(target, targetDatasourceType(base, target))
+			change.Queries = append(change.Queries, queryChange{RefID: refID, Change: "removed", Before: query})
+		}
+	}
+
+	if len(change.Queries) == 0 && len(change.Changes) == 0 {
+		return nil
+	}
+	return &change
+}
+
+// diffJSON appends the changes between two decoded JSON values to changes.
+// Objects are compared key by key and arrays of the same length element by
+// element; other changes are reported for the whole value.
+func diffJSON(path string, base, updated any, changes *[]fieldChange) {
+	switch b := base.(type) {
+	case map[string]any:
+		n, ok := updated.(map[string]any)
+		if !ok {
+			break
+		}
+		keys := sortedKeys(b)
+		for _, k := range sortedKeys(n) {
+			if _, ok := b[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		for _, k := range keys {
+			childPath := path + jsonpatch.Pointer(k)
+			bv, inBase := b[k]
+			nv, inNew := n[k]
+			switch {
+			case !inBase:
+				*changes = append(*changes, fieldChange{Path: childPath, After: nv})
+			case !inNew:
+				*changes = append(*changes, fieldChange{Path: childPath, Before: bv})
+			default:
+				diffJSON(childPath, bv, nv, changes)
+			}
+		}
+		return
+	case []any:
+		n, ok := updated.([]any)
+		if !ok || len(n) != len(b) {
+			break
+		}
+		for i := range b {
+			diffJSON(path+jsonpatch.Pointer(strconv.Itoa(i)), b[i], n[i], changes)
+		}
+		return
+	}
+	if !jsonpatch.Equal(base, updated) {
+		*changes = append(*changes, fieldChange{Path: path, Before: base, After: updated})
+	}
+}
+
+// panelsByID returns all panels of a dashboard, including panels nested in
+// rows, by ID.
+func panelsByID(db map[string]any) map[int]map[string]any {
+	result := map[int]map[string]any{}
+	var walk func(panels []any)
+	walk = func(panels []any) {
+		for _, p := range panels {
+			panel, ok := p.(map[string]any)
+			if !ok {
+				continue
+			}
+			if id, ok := panel["id"].(float64); ok {
+				result[int(id)] = panel
+			}
+			if nested, ok := panel["panels"].([]any); ok {
+				walk(nested)
+			}
+		}
+	}
+	panels, _ := db["panels"].([]any)
+	walk(panels)
+	return result
+}
+
+func variablesByName(db map[string]any) map[string]any {
+	result := map[string]any{}
+	templating, _ := db["templating"].(map[string]any)
+	list, _ := templating["list"].([]any)
+	for _, item := range list {
+		if v, ok := item.(map[string]any); ok {
+			if name, ok := v["name"].(string); ok {
+				result[name] = v
+			}
+		}
+	}
+	return result
+}
+
+func newPanelRef(id int, panel map[string]any) panelRef {
+	title, _ := panel["title"].(string)
+	return panelRef{ID: id, Title: title}
+}
+
+// withoutKeys returns a shallow copy of m without the given keys.
+func withoutKeys(m map[string]any, keys ...string) map[string]any {
+	result := make(map[string]any, len(m))
+	for k, v := range m {
+		if !slices.Contains(keys, k) {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+func sortedKeys[K int | string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,108 @@
+//go:build unit
+// +build unit
+
+package tools
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffDashboards(t *testing.T) {
+	decodeDashboard := func(s string) map[string]any {
+		var db map[string]any
+		require.NoError(t, json.Unmarshal([]byte(s), &db))
+		return db
+	}
+
+	base := decodeDashboard(`{
+		"title": "Service",
+		"version": 3,
+		"tags": ["prod"],
+		"templating": {"list": [
+			{"name": "job", "type": "query", "query": "label_values(job)"},
+			{"name": "old", "type": "custom", "query": "a,b"}
+		]},
+		"panels": [
+			{
+				"id": 1, "type": "timeseries", "title": "Requests",
+				"datasource": {"type": "prometheus", "uid": "prom"},
+				"gridPos": {"x": 0, "y": 0, "w": 12, "h": 8},
+				"targets": [
+					{"refId": "A", "expr": "rate(http_requests_total[5m])", "legendFormat": "{{job}}"},
+					{"refId": "B", "expr": "up"}
+				]
+			},
+			{"id": 2, "type": "stat", "title": "Removed"},
+			{"id": 3, "type": "row", "title": "Row", "collapsed": true, "panels": [
+				{"id": 4, "type": "logs", "title": "Logs", "datasource": {"type": "loki", "uid": "loki"}, "targets": [{"refId": "A", "expr": "{job=\"api\"}"}]}
+			]}
+		]
+	}`)
+	updated := decodeDashboard(`{
+		"title": "Service",
+		"version": 4,
+		"tags": ["prod", "team-a"],
+		"templating": {"list": [
+			{"name": "job", "type": "query", "query": "label_values(up, job)"},
+			{"name": "new", "type": "textbox"}
+		]},
+		"panels": [
+			{
+				"id": 1, "type": "timeseries", "title": "Requests",
+				"datasource": {"type": "prometheus", "uid": "prom"},
+				"gridPos": {"x": 0, "y": 0, "w": 24, "h": 8},
+				"targets": [
+					{"refId": "A", "expr": "sum(rate(http_requests_total[5m]))", "legendFormat": "total"},
+					{"refId": "C", "expr": "up == 0"}
+				]
+			},
+			{"id": 3, "type": "row", "title": "Row", "collapsed": true, "panels": [
+				{"id": 4, "type": "logs", "title": "Logs", "datasource": {"type": "loki", "uid": "loki"}, "targets": [{"refId": "A", "expr": "{job=\"api\"}"}]},
+				{"id": 5, "type": "stat", "title": "Added"}
+			]}
+		]
+	}`)
+
+	diff := diffDashboards(base, updated)
+
+	assert.Equal(t, []fieldChange{{Path: "/tags", Before: []any{"prod"}, After: []any{"prod", "team-a"}}}, diff.Changes)
+	assert.Equal(t, []string{"new"}, diff.VariablesAdded)
+	assert.Equal(t, []string{"old"}, diff.VariablesRemoved)
+	assert.Equal(t, []variableChange{
+		{Name: "job", Changes: []fieldChange{{Path: "/query", Before: "label_values(job)", After: "label_values(up, job)"}}},
+	}, diff.VariablesChanged)
+	assert.Equal(t, []panelRef{{ID: 5, Title: "Added"}}, diff.PanelsAdded)
+	assert.Equal(t, []panelRef{{ID: 2, Title: "Removed"}}, diff.PanelsRemoved)
+	assert.Equal(t, []panelChange{
+		{
+			ID:    1,
+			Title: "Requests",
+			Queries: []queryChange{
+				{RefID: "A", Change: "changed", Before: "rate(http_requests_total[5m])", After: "sum(rate(http_requests_total[5m]))"},
+				{RefID: "C", Change: "added", After: "up == 0"},
+				{RefID: "B", Change: "removed", Before: "up"},
+			},
+			Changes: []fieldChange{
+				{Path: "/gridPos/w", Before: float64(12), After: float64(24)},
+				{Path: "/targets/0/legendFormat", Before: "{{job}}", After: "total"},
+			},
+		},
+	}, diff.PanelsChanged)
+}
+
+func TestDiffDashboardsUnchanged(t *testing.T) {
+	db := map[string]any{
+		"title":   "Service",
+		"version": float64(1),
+		"panels":  []any{map[string]any{"id": float64(1), "title": "A", "targets": []any{map[string]any{"refId": "A", "expr": "up"}}}},
+	}
+	diff := diffDashboards(db, db)
+	assert.Empty(t, diff.Changes)
+	assert.Empty(t, diff.PanelsAdded)
+	assert.Empty(t, diff.PanelsRemoved)
+	assert.Empty(t, diff.PanelsChanged)
+}
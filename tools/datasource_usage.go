@@ -0,0 +1,387 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+
+	"github.com/grafana/grafana-openapi-client-go/client/library_elements"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	mcpgrafana "mcp-grafana-local"
+	"mcp-grafana-local/internal/interpolate"
+)
+
+// libraryPanelPageSize is the number of library panels fetched per request
+// when checking all of them.
+const libraryPanelPageSize = 100
+
+type AnalyzeDatasourceUsageParams struct {
+	UID  string `json:"uid,omitempty" jsonschema:"description=The UID of the datasource. Either uid or name is required"`
+	Name string `json:"name,omitempty" jsonschema:"description=The name of the datasource"`
+}
+
+func (p AnalyzeDatasourceUsageParams) validate() error {
+	if p.UID == "" && p.Name == "" {
+		return fmt.Errorf("either uid or name is required")
+	}
+	return nil
+}
+
+type panelDatasourceUsage struct {
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+	// Via is the datasource variable through which the panel uses the
+	// datasource, such as "$datasource", if any.
+	Via             string `json:"via,omitempty"`
+	LibraryPanelUID string `json:"libraryPanelUid,omitempty"`
+	URL             string `json:"url,omitempty"`
+}
+
+type dashboardDatasourceUsage struct {
+	UID         string                 `json:"uid"`
+	Title       string                 `json:"title"`
+	FolderTitle string                 `json:"folderTitle,omitempty"`
+	URL         string                 `json:"url,omitempty"`
+	Panels      []panelDatasourceUsage `json:"panels,omitempty"`
+	// Variables are the datasource variables whose current value is the
+	// datasource, and the query variables querying it.
+	Variables []string `json:"variables,omitempty"`
+	// Annotations are the names of the annotation queries using it.
+	Annotations []string `json:"annotations,omitempty"`
+}
+
+type libraryPanelDatasourceUsage struct {
+	UID                 string `json:"uid"`
+	Name                string `json:"name"`
+	FolderTitle         string `json:"folderTitle,omitempty"`
+	ConnectedDashboards int64  `json:"connectedDashboards"`
+}
+
+type alertRuleDatasourceUsage struct {
+	UID    string `json:"uid"`
+	Title  string `json:"title"`
+	Folder string `json:"folder"`
+	Group  string `json:"group"`
+	// RefIDs are the queries of the rule using the datasource.
+	RefIDs []string `json:"refIds"`
+	URL    string   `json:"url,omitempty"`
+}
+
+type datasourceUsage struct {
+	Datasource    dataSourceSummary             `json:"datasource"`
+	Dashboards    []dashboardDatasourceUsage    `json:"dashboards"`
+	LibraryPanels []libraryPanelDatasourceUsage `json:"libraryPanels"`
+	AlertRules    []alertRuleDatasourceUsage    `json:"alertRules"`
+}
+
+// datasourceMatcher tells whether datasource references of dashboards refer
+// to a datasource.
+type datasourceMatcher struct {
+	ds dataSourceSummary
+}
+
+// matchesValue reports whether a datasource UID or name, as saved in a
+// reference or as the value of a datasource variable, is the datasource.
+func (m datasourceMatcher) matchesValue(value string) bool {
+	switch value {
+	case m.ds.UID, m.ds.Name:
+		return true
+	case "", "default":
+		return m.ds.IsDefault
+	}
+	return false
+}
+
+// matchRef reports whether a datasource reference of a panel, target or
+// variable refers to the datasource, resolving datasource variables with the
+// given values. It returns the variable through which it does, if any.
+func (m datasourceMatcher) matchRef(ref any, variables map[string][]string) (string, bool) {
+	var uid string
+	switch ref := ref.(type) {
+	case nil:
+		return "", m.ds.IsDefault
+	case string:
+		uid = ref
+	case map[string]any:
+		uid, _ = ref["uid"].(string)
+		if uid == "" {
+			// References with only a type are to the default datasource.
+			dsType, _ := ref["type"].(string)
+			return "", m.ds.IsDefault && (dsType == "" || dsType == m.ds.Type)
+		}
+	default:
+		return "", false
+	}
+
+	names := interpolate.Variables(uid)
+	if len(names) == 0 {
+		return "", m.matchesValue(uid)
+	}
+	for _, name := range names {
+		for _, value := range variables[name] {
+			if m.matchesValue(value) {
+				return "$" + name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// datasourceVariableValues returns the current values of the datasource
+// variables of a dashboard, by name. Variables with "All" selected have all
+// of their options.
+func datasourceVariableValues(variables []dashboardVariable) map[string][]string {
+	result := map[string][]string{}
+	for _, v := range variables {
+		if v.Type != "datasource" {
+			continue
+		}
+		values := v.Current
+		if slices.Contains(values, interpolate.AllValue) {
+			values = nil
+			for _, o := range v.Options {
+				values = append(values, o.Value)
+				if o.Text != "" {
+					values = append(values, o.Text)
+				}
+			}
+		}
+		result[v.Name] = values
+	}
+	return result
+}
+
+// dashboardUsage returns how a dashboard uses the datasource, or nil if it
+// doesn't. panels must have their library panels resolved.
+func (m datasourceMatcher) dashboardUsage(db map[string]any, panels []any) *dashboardDatasourceUsage {
+	usage := &dashboardDatasourceUsage{}
+	variables := parseDashboardVariables(db)
+	values := datasourceVariableValues(variables)
+
+	for _, v := range variables {
+		switch v.Type {
+		case "datasource":
+			if slices.ContainsFunc(values[v.Name], m.matchesValue) {
+				usage.Variables = append(usage.Variables, v.Name)
+			}
+		case "query", "adhoc":
+			if _, ok := m.matchRef(v.datasourceRef, values); ok {
+				usage.Variables = append(usage.Variables, v.Name)
+			}
+		}
+	}
+
+	annotations, _ := db["annotations"].(map[string]any)
+	list, _ := annotations["list"].([]any)
+	for _, item := range list {
+		a, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		if ref, ok := a["datasource"]; ok && ref != nil {
+			if _, ok := m.matchRef(ref, values); ok {
+				name, _ := a["name"].(string)
+				usage.Annotations = append(usage.Annotations, name)
+			}
+		}
+	}
+
+	var walk func(panels []any)
+	walk = func(panels []any) {
+		for _, p := range panels {
+			panel, ok := p.(map[string]any)
+			if !ok {
+				continue
+			}
+			if nested, ok := panel["panels"].([]any); ok {
+				walk(nested)
+			}
+			if via, ok := m.panelUsesDatasource(panel, values); ok {
+				id, _ := panel["id"].(float64)
+				title, _ := panel["title"].(string)
+				usage.Panels = append(usage.Panels, panelDatasourceUsage{
+					ID:              int(id),
+					Title:           title,
+					Via:             via,
+					LibraryPanelUID: libraryPanelUID(panel),
+				})
+			}
+		}
+	}
+	walk(panels)
+
+	if len(usage.Panels) == 0 && len(usage.Variables) == 0 && len(usage.Annotations) == 0 {
+		return nil
+	}
+	return usage
+}
+
+// panelUsesDatasource reports whether any query of a panel uses the
+// datasource. Queries without a datasource use the panel's.
+func (m datasourceMatcher) panelUsesDatasource(panel map[string]any, variables map[string][]string) (string, bool) {
+	targets, _ := panel["targets"].([]any)
+	for _, t := range targets {
+		target, ok := t.(map[string]any)
+		if !ok {
+			continue
+		}
+		ref := target["datasource"]
+		if ref == nil {
+			ref = panel["datasource"]
+		}
+		if ds, ok := datasourceFromRef(ref); ok && ds.UID == mixedDatasourceUID {
+			continue
+		}
+		if via, ok := m.matchRef(ref, variables); ok {
+			return via, true
+		}
+	}
+	return "", false
+}
+
+// alertRuleUsage returns the alert rules with queries of the datasource.
+func (m datasourceMatcher) alertRuleUsage(rules rulerRulesResponse) []alertRuleDatasourceUsage {
+	result := []alertRuleDatasourceUsage{}
+	for _, folder := range sortedKeys(rules) {
+		for _, group := range rules[folder] {
+			for _, rule := range group.Rules {
+				var refIDs []string
+				for _, q := range rule.GrafanaAlert.Data {
+					if q.DatasourceUID == m.ds.UID {
+						refIDs = append(refIDs, q.RefID)
+					}
+				}
+				if len(refIDs) == 0 {
+					continue
+				}
+				result = append(result, alertRuleDatasourceUsage{
+					UID:    rule.GrafanaAlert.UID,
+					Title:  rule.GrafanaAlert.Title,
+					Folder: folder,
+					Group:  group.Name,
+					RefIDs: refIDs,
+				})
+			}
+		}
+	}
+	return result
+}
+
+// libraryPanelUsage returns the library panels with queries of the
+// datasource. Datasource variables in library panels depend on the
+// dashboard, so only direct references are found.
+func (m datasourceMatcher) libraryPanelUsage(ctx context.Context) ([]libraryPanelDatasourceUsage, error) {
+	c := mcpgrafana.GrafanaClientFromContext(ctx)
+	result := []libraryPanelDatasourceUsage{}
+	kind := int64(libraryPanelKind)
+	perPage := int64(libraryPanelPageSize)
+	for page := int64(1); ; page++ {
+		params := library_elements.NewGetLibraryElementsParamsWithContext(ctx).WithKind(&kind).WithPerPage(&perPage).WithPage(&page)
+		resp, err := c.LibraryElements.GetLibraryElements(params)
+		if err != nil {
+			return nil, fmt.Errorf("list library panels: %w", err)
+		}
+		r := resp.Payload.Result
+		if r == nil {
+			return result, nil
+		}
+		for _, e := range r.Elements {
+			model, ok := e.Model.(map[string]any)
+			if !ok {
+				continue
+			}
+			if _, ok := m.panelUsesDatasource(model, nil); ok {
+				summary := newLibraryPanelSummary(e)
+				result = append(result, libraryPanelDatasourceUsage{
+					UID:                 summary.UID,
+					Name:                summary.Name,
+					FolderTitle:         summary.FolderTitle,
+					ConnectedDashboards: summary.ConnectedDashboards,
+				})
+			}
+		}
+		if int64(len(r.Elements)) < perPage {
+			return result, nil
+		}
+	}
+}
+
+func findDatasource(ctx context.Context, uid, name string) (dataSourceSummary, error) {
+	datasources, err := listDatasources(ctx, ListDatasourcesParams{})
+	if err != nil {
+		return dataSourceSummary{}, err
+	}
+	for _, ds := range datasources {
+		if (uid != "" && ds.UID == uid) || (uid == "" && ds.Name == name) {
+			return ds, nil
+		}
+	}
+	if uid != "" {
+		return dataSourceSummary{}, fmt.Errorf("datasource with UID %q not found", uid)
+	}
+	return dataSourceSummary{}, fmt.Errorf("datasource named %q not found", name)
+}
+
+func analyzeDatasourceUsage(ctx context.Context, args AnalyzeDatasourceUsageParams) (*datasourceUsage, error) {
+	if err := args.validate(); err != nil {
+		return nil, err
+	}
+	ds, err := findDatasource(ctx, args.UID, args.Name)
+	if err != nil {
+		return nil, err
+	}
+	m := datasourceMatcher{ds: ds}
+	result := &datasourceUsage{Datasource: ds, Dashboards: []dashboardDatasourceUsage{}}
+
+	err = forEachDashboard(ctx, func(hit searchHit, db map[string]any, panels []any) {
+		usage := m.dashboardUsage(db, panels)
+		if usage == nil {
+			return
+		}
+		usage.UID = hit.UID
+		usage.Title = hit.Title
+		usage.FolderTitle = hit.FolderTitle
+		path := hit.URL
+		if path == "" {
+			path = dashboardLinkPath(hit.UID)
+		}
+		usage.URL = grafanaLink(ctx, path, nil)
+		for i := range usage.Panels {
+			usage.Panels[i].URL = grafanaLink(ctx, path, url.Values{"viewPanel": {strconv.Itoa(usage.Panels[i].ID)}})
+		}
+		result.Dashboards = append(result.Dashboards, *usage)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("analyze dashboards: %w", err)
+	}
+
+	if result.LibraryPanels, err = m.libraryPanelUsage(ctx); err != nil {
+		return nil, err
+	}
+
+	c, err := newAlertingClientFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := c.GetRulerRules(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("analyze alert rules: %w", err)
+	}
+	result.AlertRules = m.alertRuleUsage(rules)
+	for i := range result.AlertRules {
+		result.AlertRules[i].URL = grafanaLink(ctx, alertRuleLinkPath(result.AlertRules[i].UID), nil)
+	}
+	return result, nil
+}
+
+var AnalyzeDatasourceUsage = mcpgrafana.MustTool(
+	"analyze_datasource_usage",
+	"Find everything that depends on a datasource before changing or migrating it: the dashboards with panels, queries, variables or annotations using it, the library panels and the Grafana-managed alert rules querying it. References by UID and by name are found, as are references through datasource variables, such as $datasource, whose current value is the datasource, and references to the default datasource if it is the default. Returns the dependencies with links to the dashboards, panels and alert rules in Grafana. This loads every dashboard, so it can be slow on large instances.",
+	analyzeDatasourceUsage,
+	mcp.WithTitleAnnotation("Analyze datasource usage"),
+	mcp.WithIdempotentHintAnnotation(true),
+	mcp.WithReadOnlyHintAnnotation(true),
+)
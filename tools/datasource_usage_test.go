@@ -0,0 +1,106 @@
+//go:build unit
+// +build unit
+
+package tools
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana-openapi-client-go/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatasourceMatcherDashboardUsage(t *testing.T) {
+	m := datasourceMatcher{ds: dataSourceSummary{UID: "prom-1", Name: "Prometheus", Type: "prometheus", IsDefault: true}}
+	prom := map[string]any{"uid": "prom-1", "type": "prometheus"}
+	loki := map[string]any{"uid": "loki-1", "type": "loki"}
+	db := map[string]any{
+		"templating": map[string]any{"list": []any{
+			map[string]any{"name": "datasource", "type": "datasource", "query": "prometheus", "current": map[string]any{"value": "Prometheus"}},
+			map[string]any{"name": "logs", "type": "datasource", "query": "loki", "current": map[string]any{"value": "loki-1"}},
+			map[string]any{"name": "job", "type": "query", "datasource": map[string]any{"uid": "$datasource"}, "query": "label_values(job)"},
+			map[string]any{"name": "app", "type": "query", "datasource": loki, "query": "label_values(app)"},
+			map[string]any{"name": "env", "type": "custom", "query": "prod,dev"},
+		}},
+		"annotations": map[string]any{"list": []any{
+			map[string]any{"name": "Annotations & Alerts", "builtIn": float64(1), "datasource": map[string]any{"uid": "-- Grafana --", "type": "grafana"}},
+			map[string]any{"name": "Deploys", "datasource": "Prometheus"},
+		}},
+	}
+	panels := []any{
+		map[string]any{"id": float64(1), "title": "Direct", "datasource": prom, "targets": []any{map[string]any{"refId": "A"}}},
+		map[string]any{"id": float64(2), "title": "Logs", "datasource": loki, "targets": []any{map[string]any{"refId": "A"}}},
+		map[string]any{"id": float64(3), "title": "Variable", "datasource": map[string]any{"uid": "${datasource}"}, "targets": []any{map[string]any{"refId": "A"}}},
+		map[string]any{"id": float64(4), "title": "Mixed", "datasource": map[string]any{"uid": mixedDatasourceUID}, "targets": []any{
+			map[string]any{"refId": "A", "datasource": loki},
+			map[string]any{"refId": "B", "datasource": prom},
+		}},
+		map[string]any{"id": float64(5), "title": "Default", "targets": []any{map[string]any{"refId": "A"}}},
+		map[string]any{"id": float64(6), "title": "Text", "type": "text"},
+		map[string]any{"id": float64(7), "type": "row", "collapsed": true, "panels": []any{
+			map[string]any{"id": float64(8), "title": "Library", "datasource": prom, "libraryPanel": map[string]any{"uid": "lib"}, "targets": []any{map[string]any{"refId": "A"}}},
+		}},
+	}
+
+	usage := m.dashboardUsage(db, panels)
+	require.NotNil(t, usage)
+	assert.Equal(t, []string{"datasource", "job"}, usage.Variables)
+	assert.Equal(t, []string{"Deploys"}, usage.Annotations)
+	assert.Equal(t, []panelDatasourceUsage{
+		{ID: 1, Title: "Direct"},
+		{ID: 3, Title: "Variable", Via: "$datasource"},
+		{ID: 4, Title: "Mixed"},
+		{ID: 5, Title: "Default"},
+		{ID: 8, Title: "Library", LibraryPanelUID: "lib"},
+	}, usage.Panels)
+
+	lokiMatcher := datasourceMatcher{ds: dataSourceSummary{UID: "loki-1", Name: "Loki", Type: "loki"}}
+	usage = lokiMatcher.dashboardUsage(db, panels)
+	require.NotNil(t, usage)
+	assert.Equal(t, []string{"logs", "app"}, usage.Variables)
+	assert.Empty(t, usage.Annotations)
+	assert.Equal(t, []panelDatasourceUsage{{ID: 2, Title: "Logs"}, {ID: 4, Title: "Mixed"}}, usage.Panels)
+
+	unused := datasourceMatcher{ds: dataSourceSummary{UID: "tempo-1", Name: "Tempo", Type: "tempo"}}
+	assert.Nil(t, unused.dashboardUsage(db, panels))
+}
+
+func TestDatasourceMatcherDashboardWithoutPanels(t *testing.T) {
+	m := datasourceMatcher{ds: dataSourceSummary{UID: "prom-1", Name: "Prometheus", Type: "prometheus"}}
+	// The dashboard has no panels array, like dashboards with only variables
+	// or legacy dashboards with rows.
+	db, panels, ok := dashboardModel(&models.DashboardFullWithMeta{Dashboard: map[string]any{
+		"uid": "vars",
+		"templating": map[string]any{"list": []any{
+			map[string]any{"name": "datasource", "type": "datasource", "query": "prometheus", "current": map[string]any{"value": "prom-1"}},
+		}},
+	}})
+	require.True(t, ok)
+	assert.Empty(t, panels)
+
+	usage := m.dashboardUsage(db, panels)
+	require.NotNil(t, usage)
+	assert.Equal(t, []string{"datasource"}, usage.Variables)
+	assert.Empty(t, usage.Panels)
+
+	_, _, ok = dashboardModel(&models.DashboardFullWithMeta{Dashboard: "not a dashboard"})
+	assert.False(t, ok)
+}
+
+func TestDatasourceMatcherAlertRuleUsage(t *testing.T) {
+	m := datasourceMatcher{ds: dataSourceSummary{UID: "prom-1", Name: "Prometheus"}}
+	rules := rulerRulesResponse{
+		"Team B": {{Name: "db", Rules: []rulerRule{{GrafanaAlert: grafanaAlertRule{UID: "r2", Title: "Slow queries", Data: []alertRuleQuery{
+			{RefID: "A", DatasourceUID: "loki-1"},
+		}}}}}},
+		"Team A": {{Name: "api", Rules: []rulerRule{{GrafanaAlert: grafanaAlertRule{UID: "r1", Title: "Errors", Data: []alertRuleQuery{
+			{RefID: "A", DatasourceUID: "prom-1"},
+			{RefID: "B", DatasourceUID: "prom-1"},
+			{RefID: "C", DatasourceUID: "__expr__"},
+		}}}}}},
+	}
+	assert.Equal(t, []alertRuleDatasourceUsage{
+		{UID: "r1", Title: "Errors", Folder: "Team A", Group: "api", RefIDs: []string{"A", "B"}},
+	}, m.alertRuleUsage(rules))
+}
@@ -92,4 +92,30 @@ func TestDatasourcesTools(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, "Prometheus", result.Name)
 	})
+
+	t.Run("analyze datasource usage", func(t *testing.T) {
+		ctx := newTestContext()
+		demo := getExistingTestDashboard(t, ctx, "")
+		result, err := analyzeDatasourceUsage(ctx, AnalyzeDatasourceUsageParams{UID: "robustperception"})
+		require.NoError(t, err)
+		assert.Equal(t, "robustperception", result.Datasource.UID)
+
+		var found bool
+		for _, d := range result.Dashboards {
+			if d.UID != demo.UID {
+				continue
+			}
+			found = true
+			require.NotEmpty(t, d.Panels)
+			assert.Equal(t, 1, d.Panels[0].ID)
+			assert.Contains(t, d.Panels[0].URL, "viewPanel=1")
+		}
+		assert.True(t, found, "demo dashboard should use the datasource")
+	})
+
+	t.Run("analyze datasource usage - not found", func(t *testing.T) {
+		ctx := newTestContext()
+		_, err := analyzeDatasourceUsage(ctx, AnalyzeDatasourceUsageParams{Name: "non-existent"})
+		require.Error(t, err)
+	})
 }
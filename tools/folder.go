@@ -0,0 +1,282 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/grafana/grafana-openapi-client-go/client/folders"
+	"github.com/grafana/grafana-openapi-client-go/models"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+
+	mcpgrafana "mcp-grafana-local"
+)
+
+// folderPageSize is the number of folders fetched per request when listing
+// folders recursively.
+const folderPageSize = 1000
+
+type folderSummary struct {
+	UID       string `json:"uid"`
+	Title     string `json:"title"`
+	ParentUID string `json:"parentUid,omitempty"`
+	// Path is the slash separated titles of the folder and its parents,
+	// only set when listing recursively.
+	Path string `json:"path,omitempty"`
+}
+
+type folderDetails struct {
+	UID       string `json:"uid"`
+	Title     string `json:"title"`
+	URL       string `json:"url,omitempty"`
+	ParentUID string `json:"parentUid,omitempty"`
+	// Parents are the ancestors of the folder, starting at the root.
+	Parents []folderSummary `json:"parents,omitempty"`
+	Version int64           `json:"version"`
+	// Counts are the numbers of folders, dashboards, library panels and
+	// alert rules within the folder and its subfolders.
+	Counts map[string]int64 `json:"counts,omitempty"`
+}
+
+func newFolderDetails(f *models.Folder) *folderDetails {
+	details := &folderDetails{
+		UID:       f.UID,
+		Title:     f.Title,
+		URL:       f.URL,
+		ParentUID: f.ParentUID,
+		Version:   f.Version,
+	}
+	for _, p := range f.Parents {
+		details.Parents = append(details.Parents, folderSummary{UID: p.UID, Title: p.Title, ParentUID: p.ParentUID})
+	}
+	return details
+}
+
+type ListFoldersParams struct {
+	ParentUID string `json:"parentUid,omitempty" jsonschema:"description=Optionally\\, the UID of the folder whose subfolders to list. Defaults to the top-level folders"`
+	Recursive bool   `json:"recursive,omitempty" jsonschema:"description=Also list the subfolders of the listed folders\\, at any depth"`
+}
+
+func listFolders(ctx context.Context, args ListFoldersParams) ([]folderSummary, error) {
+	result := []folderSummary{}
+	var walk func(parentUID, parentPath string) error
+	walk = func(parentUID, parentPath string) error {
+		children, err := listChildFolders(ctx, parentUID)
+		if err != nil {
+			return err
+		}
+		for _, f := range children {
+			summary := folderSummary{UID: f.UID, Title: f.Title, ParentUID: f.ParentUID}
+			if !args.Recursive {
+				result = append(result, summary)
+				continue
+			}
+			summary.Path = f.Title
+			if parentPath != "" {
+				summary.Path = parentPath + "/" + f.Title
+			}
+			result = append(result, summary)
+			if err := walk(f.UID, summary.Path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(args.ParentUID, ""); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// listChildFolders returns all subfolders of a folder, or the top-level
+// folders if parentUID is empty.
+func listChildFolders(ctx context.Context, parentUID string) ([]*models.FolderSearchHit, error) {
+	c := mcpgrafana.GrafanaClientFromContext(ctx)
+	var result []*models.FolderSearchHit
+	limit := int64(folderPageSize)
+	for page := int64(1); ; page++ {
+		params := folders.NewGetFoldersParamsWithContext(ctx).WithLimit(&limit).WithPage(&page)
+		if parentUID != "" {
+			params.SetParentUID(&parentUID)
+		}
+		resp, err := c.Folders.GetFolders(params)
+		if err != nil {
+			return nil, fmt.Errorf("list folders in %q: %w", parentUID, err)
+		}
+		result = append(result, resp.Payload...)
+		if int64(len(resp.Payload)) < limit {
+			return result, nil
+		}
+	}
+}
+
+var ListFolders = mcpgrafana.MustTool(
+	"list_folders",
+	"List the folders of the Grafana instance, or the subfolders of a folder. With recursive, lists the whole folder hierarchy below it, with the path of each folder. Returns the UID, title and parent UID of each folder. Use a folder UID as the folderUid of update_dashboard to save a dashboard in it.",
+	listFolders,
+	mcp.WithTitleAnnotation("List folders"),
+	mcp.WithIdempotentHintAnnotation(true),
+	mcp.WithReadOnlyHintAnnotation(true),
+)
+
+type GetFolderParams struct {
+	UID string `json:"uid" jsonschema:"required,description=The UID of the folder"`
+}
+
+func getFolder(ctx context.Context, args GetFolderParams) (*folderDetails, error) {
+	c := mcpgrafana.GrafanaClientFromContext(ctx)
+	resp, err := c.Folders.GetFolderByUID(args.UID)
+	if err != nil {
+		return nil, fmt.Errorf("get folder %s: %w", args.UID, err)
+	}
+	details := newFolderDetails(resp.Payload)
+
+	// Counts are only available in recent Grafana versions.
+	counts, err := c.Folders.GetFolderDescendantCounts(args.UID)
+	if err != nil {
+		slog.Debug("Unable to get folder descendant counts", "uid", args.UID, "error", err)
+	} else {
+		details.Counts = counts.Payload
+	}
+	return details, nil
+}
+
+var GetFolder = mcpgrafana.MustTool(
+	"get_folder",
+	"Get a folder by UID, with its title, URL, version, parent folders and the number of folders, dashboards, library panels and alert rules it contains.",
+	getFolder,
+	mcp.WithTitleAnnotation("Get folder"),
+	mcp.WithIdempotentHintAnnotation(true),
+	mcp.WithReadOnlyHintAnnotation(true),
+)
+
+type CreateFolderParams struct {
+	Title       string `json:"title" jsonschema:"required,description=The title of the folder"`
+	UID         string `json:"uid,omitempty" jsonschema:"description=Optionally\\, the UID of the folder. Generated by Grafana if not set"`
+	ParentUID   string `json:"parentUid,omitempty" jsonschema:"description=Optionally\\, the UID of the parent folder. Defaults to the top level"`
+	Description string `json:"description,omitempty" jsonschema:"description=Optionally\\, a description of the folder"`
+}
+
+func createFolder(ctx context.Context, args CreateFolderParams) (*folderDetails, error) {
+	if args.Title == "" {
+		return nil, fmt.Errorf("title is required")
+	}
+	c := mcpgrafana.GrafanaClientFromContext(ctx)
+	resp, err := c.Folders.CreateFolder(&models.CreateFolderCommand{
+		Title:       args.Title,
+		UID:         args.UID,
+		ParentUID:   args.ParentUID,
+		Description: args.Description,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create folder %q: %w", args.Title, err)
+	}
+	return newFolderDetails(resp.Payload), nil
+}
+
+var CreateFolder = mcpgrafana.MustTool(
+	"create_folder",
+	"Create a folder, optionally inside another folder. Returns the created folder with its UID.",
+	createFolder,
+	mcp.WithTitleAnnotation("Create folder"),
+)
+
+type RenameFolderParams struct {
+	UID         string `json:"uid" jsonschema:"required,description=The UID of the folder"`
+	Title       string `json:"title" jsonschema:"required,description=The new title of the folder"`
+	Description string `json:"description,omitempty" jsonschema:"description=Optionally\\, a new description of the folder"`
+	Version     int64  `json:"version,omitempty" jsonschema:"description=Optionally\\, the folder version the change was made against. The change is rejected if the folder has changed since"`
+}
+
+func renameFolder(ctx context.Context, args RenameFolderParams) (*folderDetails, error) {
+	if args.Title == "" {
+		return nil, fmt.Errorf("title is required")
+	}
+	c := mcpgrafana.GrafanaClientFromContext(ctx)
+	version := args.Version
+	if version == 0 {
+		current, err := c.Folders.GetFolderByUID(args.UID)
+		if err != nil {
+			return nil, fmt.Errorf("get folder %s: %w", args.UID, err)
+		}
+		version = current.Payload.Version
+	}
+	resp, err := c.Folders.UpdateFolder(args.UID, &models.UpdateFolderCommand{
+		Title:       args.Title,
+		Description: args.Description,
+		Version:     version,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("rename folder %s: %w", args.UID, err)
+	}
+	return newFolderDetails(resp.Payload), nil
+}
+
+var RenameFolder = mcpgrafana.MustTool(
+	"rename_folder",
+	"Change the title and description of a folder. Its UID, and so links to its dashboards, stay the same.",
+	renameFolder,
+	mcp.WithTitleAnnotation("Rename folder"),
+	mcp.WithIdempotentHintAnnotation(true),
+)
+
+type MoveFolderParams struct {
+	UID       string `json:"uid" jsonschema:"required,description=The UID of the folder to move"`
+	ParentUID string `json:"parentUid,omitempty" jsonschema:"description=The UID of the new parent folder. Leave empty to move the folder to the top level"`
+}
+
+func moveFolder(ctx context.Context, args MoveFolderParams) (*folderDetails, error) {
+	if args.UID == args.ParentUID {
+		return nil, fmt.Errorf("cannot move a folder into itself")
+	}
+	c := mcpgrafana.GrafanaClientFromContext(ctx)
+	resp, err := c.Folders.MoveFolder(args.UID, &models.MoveFolderCommand{ParentUID: args.ParentUID})
+	if err != nil {
+		return nil, fmt.Errorf("move folder %s to %q: %w", args.UID, args.ParentUID, err)
+	}
+	return newFolderDetails(resp.Payload), nil
+}
+
+var MoveFolder = mcpgrafana.MustTool(
+	"move_folder",
+	"Move a folder, with its dashboards and subfolders, into another folder or to the top level. Requires nested folders to be enabled in Grafana.",
+	moveFolder,
+	mcp.WithTitleAnnotation("Move folder"),
+	mcp.WithIdempotentHintAnnotation(true),
+)
+
+type DeleteFolderParams struct {
+	UID              string `json:"uid" jsonschema:"required,description=The UID of the folder to delete"`
+	ForceDeleteRules bool   `json:"forceDeleteRules,omitempty" jsonschema:"description=Also delete the alert rules in the folder. Otherwise deleting a folder containing alert rules fails"`
+}
+
+func deleteFolder(ctx context.Context, args DeleteFolderParams) (*models.DeleteFolderOKBody, error) {
+	c := mcpgrafana.GrafanaClientFromContext(ctx)
+	params := folders.NewDeleteFolderParamsWithContext(ctx).WithFolderUID(args.UID)
+	if args.ForceDeleteRules {
+		params.SetForceDeleteRules(&args.ForceDeleteRules)
+	}
+	resp, err := c.Folders.DeleteFolder(params)
+	if err != nil {
+		return nil, fmt.Errorf("delete folder %s: %w", args.UID, err)
+	}
+	return resp.Payload, nil
+}
+
+var DeleteFolder = mcpgrafana.MustTool(
+	"delete_folder",
+	"Delete a folder. This also deletes all dashboards, library panels and subfolders in it, so check its contents with get_folder first.",
+	deleteFolder,
+	mcp.WithTitleAnnotation("Delete folder"),
+	mcp.WithDestructiveHintAnnotation(true),
+)
+
+func AddFolderTools(mcp *server.MCPServer) {
+	ListFolders.Register(mcp)
+	GetFolder.Register(mcp)
+	CreateFolder.Register(mcp)
+	RenameFolder.Register(mcp)
+	MoveFolder.Register(mcp)
+	DeleteFolder.Register(mcp)
+}
@@ -0,0 +1,72 @@
+// Requires a Grafana instance running on localhost:3000,
+// with nested folders enabled.
+// Run with `go test -tags integration`.
+//go:build integration
+
+package tools
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFolderTools(t *testing.T) {
+	ctx := newTestContext()
+
+	parent, err := createFolder(ctx, CreateFolderParams{Title: "Folder Test Parent", UID: "folder-test-parent"})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, _ = deleteFolder(ctx, DeleteFolderParams{UID: parent.UID})
+	})
+	child, err := createFolder(ctx, CreateFolderParams{Title: "Folder Test Child", UID: "folder-test-child", ParentUID: parent.UID})
+	require.NoError(t, err)
+	assert.Equal(t, parent.UID, child.ParentUID)
+
+	t.Run("list folders", func(t *testing.T) {
+		result, err := listFolders(ctx, ListFoldersParams{})
+		require.NoError(t, err)
+		assert.Contains(t, result, folderSummary{UID: parent.UID, Title: parent.Title})
+
+		result, err = listFolders(ctx, ListFoldersParams{ParentUID: parent.UID})
+		require.NoError(t, err)
+		assert.Equal(t, []folderSummary{{UID: child.UID, Title: child.Title, ParentUID: parent.UID}}, result)
+	})
+
+	t.Run("list folders recursively", func(t *testing.T) {
+		result, err := listFolders(ctx, ListFoldersParams{Recursive: true})
+		require.NoError(t, err)
+		assert.Contains(t, result, folderSummary{UID: child.UID, Title: child.Title, ParentUID: parent.UID, Path: "Folder Test Parent/Folder Test Child"})
+	})
+
+	t.Run("get folder", func(t *testing.T) {
+		result, err := getFolder(ctx, GetFolderParams{UID: child.UID})
+		require.NoError(t, err)
+		assert.Equal(t, child.Title, result.Title)
+		require.Len(t, result.Parents, 1)
+		assert.Equal(t, parent.UID, result.Parents[0].UID)
+	})
+
+	t.Run("rename folder", func(t *testing.T) {
+		result, err := renameFolder(ctx, RenameFolderParams{UID: child.UID, Title: "Folder Test Renamed"})
+		require.NoError(t, err)
+		assert.Equal(t, "Folder Test Renamed", result.Title)
+
+		_, err = renameFolder(ctx, RenameFolderParams{UID: child.UID, Title: "Folder Test Stale", Version: result.Version - 1})
+		require.Error(t, err)
+	})
+
+	t.Run("move folder", func(t *testing.T) {
+		result, err := moveFolder(ctx, MoveFolderParams{UID: child.UID})
+		require.NoError(t, err)
+		assert.Empty(t, result.ParentUID)
+	})
+
+	t.Run("delete folder", func(t *testing.T) {
+		_, err := deleteFolder(ctx, DeleteFolderParams{UID: child.UID})
+		require.NoError(t, err)
+		_, err = getFolder(ctx, GetFolderParams{UID: child.UID})
+		require.Error(t, err)
+	})
+}
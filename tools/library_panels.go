@@ -0,0 +1,269 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"time"
+
+	"github.com/grafana/grafana-openapi-client-go/client/library_elements"
+	"github.com/grafana/grafana-openapi-client-go/models"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	mcpgrafana "mcp-grafana-local"
+)
+
+const (
+	// libraryPanelKind is the kind of library elements that are panels.
+	libraryPanelKind = 1
+
+	// DefaultLibraryPanelsLimit is the default number of library panels
+	// listed per page.
+	DefaultLibraryPanelsLimit = 50
+)
+
+type libraryPanelSummary struct {
+	UID         string `json:"uid"`
+	Name        string `json:"name"`
+	Type        string `json:"type,omitempty"`
+	Description string `json:"description,omitempty"`
+	FolderUID   string `json:"folderUid,omitempty"`
+	FolderTitle string `json:"folderTitle,omitempty"`
+	// ConnectedDashboards is the number of dashboards using the panel.
+	ConnectedDashboards int64  `json:"connectedDashboards"`
+	Version             int64  `json:"version"`
+	Updated             string `json:"updated,omitempty"`
+}
+
+func newLibraryPanelSummary(e *models.LibraryElementDTO) libraryPanelSummary {
+	s := libraryPanelSummary{
+		UID:         e.UID,
+		Name:        e.Name,
+		Type:        e.Type,
+		Description: e.Description,
+		FolderUID:   e.FolderUID,
+		Version:     e.Version,
+	}
+	if e.Meta != nil {
+		s.FolderTitle = e.Meta.FolderName
+		s.ConnectedDashboards = e.Meta.ConnectedDashboards
+		if updated := time.Time(e.Meta.Updated); !updated.IsZero() {
+			s.Updated = updated.UTC().Format(time.RFC3339)
+		}
+	}
+	return s
+}
+
+type ListLibraryPanelsParams struct {
+	Query     string `json:"query,omitempty" jsonschema:"description=Optionally\\, only list library panels whose name or description contains this text"`
+	PanelType string `json:"panelType,omitempty" jsonschema:"description=Optionally\\, only list library panels of this visualization type\\, e.g. 'timeseries' or 'stat'"`
+	Limit     int64  `json:"limit,omitempty" jsonschema:"description=The maximum number of library panels to return (default 50)"`
+	Page      int64  `json:"page,omitempty" jsonschema:"description=The page of results to return\\, starting at 1"`
+}
+
+type libraryPanelList struct {
+	Panels []libraryPanelSummary `json:"panels"`
+	Total  int64                 `json:"total"`
+	Page   int64                 `json:"page"`
+}
+
+func listLibraryPanels(ctx context.Context, args ListLibraryPanelsParams) (*libraryPanelList, error) {
+	limit := args.Limit
+	if limit <= 0 {
+		limit = DefaultLibraryPanelsLimit
+	}
+	page := max(args.Page, 1)
+	kind := int64(libraryPanelKind)
+	params := library_elements.NewGetLibraryElementsParamsWithContext(ctx).
+		WithKind(&kind).
+		WithPerPage(&limit).
+		WithPage(&page)
+	if args.Query != "" {
+		params.SetSearchString(&args.Query)
+	}
+	if args.PanelType != "" {
+		params.SetTypeFilter(&args.PanelType)
+	}
+
+	c := mcpgrafana.GrafanaClientFromContext(ctx)
+	resp, err := c.LibraryElements.GetLibraryElements(params)
+	if err != nil {
+		return nil, fmt.Errorf("list library panels: %w", err)
+	}
+	result := &libraryPanelList{Panels: []libraryPanelSummary{}, Page: page}
+	if r := resp.Payload.Result; r != nil {
+		result.Total = r.TotalCount
+		for _, e := range r.Elements {
+			result.Panels = append(result.Panels, newLibraryPanelSummary(e))
+		}
+	}
+	return result, nil
+}
+
+var ListLibraryPanels = mcpgrafana.MustTool(
+	"list_library_panels",
+	"List the library panels, which are panels shared between dashboards, optionally searching their name and description and filtering by visualization type. Returns the UID, name, type, folder and number of connected dashboards of each panel, and the total number of matching panels.",
+	listLibraryPanels,
+	mcp.WithTitleAnnotation("List library panels"),
+	mcp.WithIdempotentHintAnnotation(true),
+	mcp.WithReadOnlyHintAnnotation(true),
+)
+
+type GetLibraryPanelParams struct {
+	UID string `json:"uid" jsonschema:"required,description=The UID of the library panel"`
+}
+
+type libraryPanelDetails struct {
+	libraryPanelSummary
+	// DashboardUIDs are the UIDs of the dashboards using the panel.
+	DashboardUIDs []string     `json:"dashboardUids"`
+	Queries       []panelQuery `json:"queries"`
+	Model         any          `json:"model"`
+}
+
+func getLibraryPanel(ctx context.Context, args GetLibraryPanelParams) (*libraryPanelDetails, error) {
+	c := mcpgrafana.GrafanaClientFromContext(ctx)
+	resp, err := c.LibraryElements.GetLibraryElementByUID(args.UID)
+	if err != nil {
+		return nil, fmt.Errorf("get library panel %s: %w", args.UID, err)
+	}
+	element := resp.Payload.Result
+	if element == nil {
+		return nil, fmt.Errorf("library panel %s not found", args.UID)
+	}
+	details := &libraryPanelDetails{
+		libraryPanelSummary: newLibraryPanelSummary(element),
+		DashboardUIDs:       []string{},
+		Queries:             []panelQuery{},
+		Model:               element.Model,
+	}
+	if model, ok := element.Model.(map[string]any); ok {
+		if queries := extractPanelQueries([]any{model}); queries != nil {
+			details.Queries = queries
+		}
+	}
+
+	connections, err := c.LibraryElements.GetLibraryElementConnections(args.UID)
+	if err != nil {
+		return nil, fmt.Errorf("get connections of library panel %s: %w", args.UID, err)
+	}
+	for _, conn := range connections.Payload.Result {
+		details.DashboardUIDs = append(details.DashboardUIDs, conn.ConnectionUID)
+	}
+	return details, nil
+}
+
+var GetLibraryPanel = mcpgrafana.MustTool(
+	"get_library_panel",
+	"Get a library panel by UID, with its queries, the UIDs of the dashboards using it and its full panel model.",
+	getLibraryPanel,
+	mcp.WithTitleAnnotation("Get library panel"),
+	mcp.WithIdempotentHintAnnotation(true),
+	mcp.WithReadOnlyHintAnnotation(true),
+)
+
+type FindLibraryPanelsByNameParams struct {
+	Name string `json:"name" jsonschema:"required,description=The exact name of the library panel"`
+}
+
+func findLibraryPanelsByName(ctx context.Context, args FindLibraryPanelsByNameParams) ([]libraryPanelSummary, error) {
+	if args.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	c := mcpgrafana.GrafanaClientFromContext(ctx)
+	resp, err := c.LibraryElements.GetLibraryElementByName(args.Name)
+	if err != nil {
+		return nil, fmt.Errorf("find library panels named %q: %w", args.Name, err)
+	}
+	result := []libraryPanelSummary{}
+	for _, e := range resp.Payload.Result {
+		if e.Kind == libraryPanelKind {
+			result = append(result, newLibraryPanelSummary(e))
+		}
+	}
+	return result, nil
+}
+
+var FindLibraryPanelsByName = mcpgrafana.MustTool(
+	"find_library_panels_by_name",
+	"Find the library panels with the given name. Names are only unique within a folder, so this can return several panels. Use list_library_panels to search by part of the name.",
+	findLibraryPanelsByName,
+	mcp.WithTitleAnnotation("Find library panels by name"),
+	mcp.WithIdempotentHintAnnotation(true),
+	mcp.WithReadOnlyHintAnnotation(true),
+)
+
+// libraryPanelLookup returns the panel model of a library panel by UID.
+type libraryPanelLookup func(uid string) (map[string]any, error)
+
+// libraryPanelModels returns a lookup fetching library panel models from
+// Grafana, fetching each panel only once.
+func libraryPanelModels(ctx context.Context) libraryPanelLookup {
+	c := mcpgrafana.GrafanaClientFromContext(ctx)
+	cache := map[string]map[string]any{}
+	return func(uid string) (map[string]any, error) {
+		if model, ok := cache[uid]; ok {
+			return model, nil
+		}
+		resp, err := c.LibraryElements.GetLibraryElementByUID(uid)
+		if err != nil {
+			return nil, fmt.Errorf("get library panel %s: %w", uid, err)
+		}
+		var model map[string]any
+		if resp.Payload.Result != nil {
+			model, _ = resp.Payload.Result.Model.(map[string]any)
+		}
+		if model == nil {
+			return nil, fmt.Errorf("library panel %s has no panel model", uid)
+		}
+		cache[uid] = model
+		return model, nil
+	}
+}
+
+// libraryPanelUID returns the UID of the library panel a dashboard panel
+// refers to, or an empty string if it isn't a library panel.
+func libraryPanelUID(panel map[string]any) string {
+	ref, _ := panel["libraryPanel"].(map[string]any)
+	uid, _ := ref["uid"].(string)
+	return uid
+}
+
+// resolveLibraryPanels returns the panels with library panel references
+// replaced by the library panels' models, including panels in collapsed rows.
+// The dashboard panel's ID, position and library panel reference are kept.
+// Panels whose library panel can't be fetched are left as they are.
+func resolveLibraryPanels(panels []any, lookup libraryPanelLookup) []any {
+	result := make([]any, 0, len(panels))
+	for _, p := range panels {
+		panel, ok := p.(map[string]any)
+		if !ok {
+			result = append(result, p)
+			continue
+		}
+		if inner, ok := panel["panels"].([]any); ok {
+			panel = maps.Clone(panel)
+			panel["panels"] = resolveLibraryPanels(inner, lookup)
+		}
+		uid := libraryPanelUID(panel)
+		if uid == "" {
+			result = append(result, panel)
+			continue
+		}
+		model, err := lookup(uid)
+		if err != nil {
+			slog.Warn("Unable to resolve library panel", "uid", uid, "error", err)
+			result = append(result, panel)
+			continue
+		}
+		resolved := maps.Clone(model)
+		for _, key := range []string{"id", "gridPos", "libraryPanel"} {
+			if v, ok := panel[key]; ok {
+				resolved[key] = v
+			}
+		}
+		result = append(result, resolved)
+	}
+	return result
+}
@@ -0,0 +1,88 @@
+// Requires a Grafana instance running on localhost:3000,
+// with a Prometheus datasource provisioned.
+// Run with `go test -tags integration`.
+//go:build integration
+
+package tools
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana-openapi-client-go/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	mcpgrafana "mcp-grafana-local"
+)
+
+func TestLibraryPanelTools(t *testing.T) {
+	ctx := newTestContext()
+	c := mcpgrafana.GrafanaClientFromContext(ctx)
+
+	const uid = "library-panel-test"
+	_, err := c.LibraryElements.CreateLibraryElement(&models.CreateLibraryElementCommand{
+		UID:  uid,
+		Name: "Library Panel Test",
+		Kind: libraryPanelKind,
+		Model: map[string]any{
+			"title":      "Library Panel Test",
+			"type":       "timeseries",
+			"datasource": map[string]any{"uid": "prometheus", "type": "prometheus"},
+			"targets": []any{
+				map[string]any{"refId": "A", "expr": "up"},
+			},
+		},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, _ = c.LibraryElements.DeleteLibraryElementByUID(uid)
+	})
+
+	t.Run("list library panels", func(t *testing.T) {
+		result, err := listLibraryPanels(ctx, ListLibraryPanelsParams{Query: "Library Panel Test"})
+		require.NoError(t, err)
+		require.Len(t, result.Panels, 1)
+		assert.Equal(t, uid, result.Panels[0].UID)
+		assert.Equal(t, "timeseries", result.Panels[0].Type)
+	})
+
+	t.Run("find library panels by name", func(t *testing.T) {
+		result, err := findLibraryPanelsByName(ctx, FindLibraryPanelsByNameParams{Name: "Library Panel Test"})
+		require.NoError(t, err)
+		require.Len(t, result, 1)
+		assert.Equal(t, uid, result[0].UID)
+	})
+
+	t.Run("dashboard panel queries resolve library panels", func(t *testing.T) {
+		_, err := updateDashboard(ctx, UpdateDashboardParams{
+			Dashboard: map[string]any{
+				"uid":   "library-panel-dashboard-test",
+				"title": "Library Panel Dashboard Test",
+				"panels": []any{
+					map[string]any{
+						"id":           float64(1),
+						"gridPos":      map[string]any{"x": 0, "y": 0, "w": 12, "h": 8},
+						"libraryPanel": map[string]any{"uid": uid, "name": "Library Panel Test"},
+					},
+				},
+			},
+			Overwrite: true,
+		})
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_, _ = c.Dashboards.DeleteDashboardByUID("library-panel-dashboard-test")
+		})
+
+		queries, err := GetDashboardPanelQueriesTool(ctx, DashboardPanelQueriesParams{UID: "library-panel-dashboard-test"})
+		require.NoError(t, err)
+		require.Len(t, queries, 1)
+		assert.Equal(t, "up", queries[0].Query)
+		assert.Equal(t, uid, queries[0].LibraryPanelUID)
+
+		panel, err := getLibraryPanel(ctx, GetLibraryPanelParams{UID: uid})
+		require.NoError(t, err)
+		assert.Contains(t, panel.DashboardUIDs, "library-panel-dashboard-test")
+		require.Len(t, panel.Queries, 1)
+		assert.Equal(t, "up", panel.Queries[0].Query)
+	})
+}
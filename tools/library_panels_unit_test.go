@@ -0,0 +1,78 @@
+//go:build unit
+// +build unit
+
+package tools
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveLibraryPanels(t *testing.T) {
+	libraryPanels := map[string]map[string]any{
+		"lib-cpu": {
+			"id":         float64(99),
+			"title":      "CPU usage",
+			"type":       "timeseries",
+			"datasource": map[string]any{"uid": "prometheus", "type": "prometheus"},
+			"gridPos":    map[string]any{"x": float64(0), "y": float64(0), "w": float64(12), "h": float64(8)},
+			"targets": []any{
+				map[string]any{"refId": "A", "expr": "rate(cpu_seconds_total[$__rate_interval])"},
+			},
+		},
+	}
+	var lookups []string
+	lookup := func(uid string) (map[string]any, error) {
+		lookups = append(lookups, uid)
+		model, ok := libraryPanels[uid]
+		if !ok {
+			return nil, fmt.Errorf("library panel %s not found", uid)
+		}
+		return model, nil
+	}
+
+	gridPos := map[string]any{"x": float64(12), "y": float64(4), "w": float64(12), "h": float64(8)}
+	panels := []any{
+		map[string]any{
+			"id":           float64(3),
+			"gridPos":      gridPos,
+			"libraryPanel": map[string]any{"uid": "lib-cpu", "name": "CPU usage"},
+		},
+		map[string]any{
+			"id":        float64(4),
+			"type":      "row",
+			"collapsed": true,
+			"panels": []any{
+				map[string]any{"id": float64(5), "libraryPanel": map[string]any{"uid": "lib-cpu"}},
+				map[string]any{"id": float64(6), "libraryPanel": map[string]any{"uid": "lib-missing"}},
+			},
+		},
+	}
+
+	resolved := resolveLibraryPanels(panels, lookup)
+	require.Len(t, resolved, 2)
+	first := resolved[0].(map[string]any)
+	assert.Equal(t, float64(3), first["id"])
+	assert.Equal(t, gridPos, first["gridPos"])
+	assert.Equal(t, "CPU usage", first["title"])
+	assert.Equal(t, map[string]any{"uid": "lib-cpu", "name": "CPU usage"}, first["libraryPanel"])
+	assert.Equal(t, []string{"lib-cpu", "lib-cpu", "lib-missing"}, lookups)
+
+	// The library panel model and the original panels are unchanged.
+	assert.Equal(t, float64(99), libraryPanels["lib-cpu"]["id"])
+	assert.NotContains(t, panels[0].(map[string]any), "title")
+
+	queries := extractPanelQueries(resolved)
+	require.Len(t, queries, 2)
+	assert.Equal(t, 3, queries[0].PanelID)
+	assert.Equal(t, 5, queries[1].PanelID)
+	for _, q := range queries {
+		assert.Equal(t, "CPU usage", q.Title)
+		assert.Equal(t, "lib-cpu", q.LibraryPanelUID)
+		assert.Equal(t, "rate(cpu_seconds_total[$__rate_interval])", q.Query)
+		assert.Equal(t, datasourceInfo{UID: "prometheus", Type: "prometheus"}, q.Datasource)
+	}
+}
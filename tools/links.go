@@ -0,0 +1,126 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-openapi-client-go/models"
+
+	mcpgrafana "mcp-grafana-local"
+	"mcp-grafana-local/internal/interpolate"
+)
+
+// grafanaLink returns the URL of a page of the Grafana instance, so that
+// humans can open what a tool looked at. path is relative to the Grafana URL,
+// such as the URL of a search hit.
+func grafanaLink(ctx context.Context, path string, params url.Values) string {
+	link := strings.TrimRight(mcpgrafana.GrafanaURLFromContext(ctx), "/") + "/" + strings.TrimLeft(path, "/")
+	if len(params) > 0 {
+		link += "?" + params.Encode()
+	}
+	return link
+}
+
+// dashboardLinkPath returns the path of a dashboard, which Grafana redirects
+// to the URL with the dashboard's slug.
+func dashboardLinkPath(uid string) string {
+	return "/d/" + url.PathEscape(uid)
+}
+
+// alertRuleLinkPath returns the path of the page of a Grafana-managed alert
+// rule.
+func alertRuleLinkPath(uid string) string {
+	return "/alerting/grafana/" + url.PathEscape(uid) + "/view"
+}
+
+// linkTime returns a time of a tool's arguments in a form Grafana accepts in
+// URLs. RFC3339 times are converted to epoch milliseconds, while relative
+// times such as "now-1h" and epoch milliseconds are kept.
+func linkTime(input string) string {
+	if t, err := time.Parse(time.RFC3339, input); err == nil {
+		return strconv.FormatInt(t.UnixMilli(), 10)
+	}
+	return input
+}
+
+// linkQuery replaces the template variables given to a tool in a query, so
+// that it can be run outside of the dashboard. Built-in variables such as
+// $__rate_interval are left for Grafana to fill in.
+func linkQuery(query string, variables map[string]string) string {
+	result, _, err := interpolate.Interpolate(query, interpolate.Options{
+		Variables:     interpolate.FromMap(variables),
+		DefaultFormat: interpolate.FormatPrometheus,
+	})
+	if err != nil {
+		return query
+	}
+	return result
+}
+
+// exploreLink returns the URL of Grafana Explore showing a query of the
+// datasource over the time range, in the "panes" format of Grafana 10 and
+// later. query holds the datasource specific fields of the query, such as
+// "expr".
+func exploreLink(ctx context.Context, ds datasourceInfo, query map[string]any, from, to string) string {
+	q := maps.Clone(query)
+	q["refId"] = "A"
+	q["datasource"] = map[string]any{"uid": ds.UID, "type": ds.Type}
+	panes := map[string]any{
+		"a": map[string]any{
+			"datasource": ds.UID,
+			"queries":    []any{q},
+			"range":      map[string]any{"from": linkTime(from), "to": linkTime(to)},
+		},
+	}
+	// Marshalling maps of strings and JSON values can't fail.
+	data, _ := json.Marshal(panes)
+	return grafanaLink(ctx, "/explore", url.Values{
+		"schemaVersion": {"1"},
+		"panes":         {string(data)},
+	})
+}
+
+// dashboardLink returns the URL of a dashboard with the given variable
+// values and time range, which are left to the dashboard defaults if empty.
+// If panelID is set, the URL views that panel.
+func dashboardLink(ctx context.Context, uid string, variables map[string]string, from, to string, panelID int) string {
+	params := url.Values{}
+	for name, value := range variables {
+		params["var-"+strings.TrimPrefix(name, "$")] = interpolate.ParseValues(value)
+	}
+	if from != "" {
+		params.Set("from", linkTime(from))
+	}
+	if to != "" {
+		params.Set("to", linkTime(to))
+	}
+	if panelID != 0 {
+		params.Set("viewPanel", strconv.Itoa(panelID))
+	}
+	return grafanaLink(ctx, dashboardLinkPath(uid), params)
+}
+
+// savedDashboard is the result of saving a dashboard, with a link to the
+// dashboard if one was requested.
+type savedDashboard struct {
+	*models.PostDashboardOKBody
+	Link string `json:"link,omitempty"`
+}
+
+// savedDashboardResult returns the result of a tool saving a dashboard, with
+// a link to the dashboard if includeLink is set.
+func savedDashboardResult(ctx context.Context, body *models.PostDashboardOKBody, err error, includeLink bool) (*savedDashboard, error) {
+	if err != nil {
+		return nil, err
+	}
+	result := &savedDashboard{PostDashboardOKBody: body}
+	if includeLink && body.UID != nil {
+		result.Link = dashboardLink(ctx, *body.UID, nil, "", "", 0)
+	}
+	return result, nil
+}
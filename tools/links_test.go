@@ -0,0 +1,117 @@
+//go:build unit
+// +build unit
+
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	"github.com/grafana/grafana-openapi-client-go/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	mcpgrafana "mcp-grafana-local"
+)
+
+func TestGrafanaLink(t *testing.T) {
+	ctx := mcpgrafana.WithGrafanaURL(context.Background(), "https://grafana.example.com/")
+	assert.Equal(t, "https://grafana.example.com/d/abc/service", grafanaLink(ctx, "/d/abc/service", nil))
+	assert.Equal(t, "https://grafana.example.com/d/abc/service?viewPanel=2", grafanaLink(ctx, "/d/abc/service", url.Values{"viewPanel": {"2"}}))
+	assert.Equal(t, "https://grafana.example.com/alerting/grafana/r1/view", grafanaLink(ctx, alertRuleLinkPath("r1"), nil))
+	assert.Equal(t, "https://grafana.example.com/d/a%2Fb", grafanaLink(ctx, dashboardLinkPath("a/b"), nil))
+}
+
+func TestExploreLink(t *testing.T) {
+	ctx := mcpgrafana.WithGrafanaURL(context.Background(), "https://grafana.example.com")
+	link := exploreLink(ctx, datasourceInfo{UID: "prom", Type: "prometheus"}, map[string]any{"expr": `rate(x{job="a"}[5m])`}, "2024-01-01T00:00:00Z", "now")
+
+	u, err := url.Parse(link)
+	require.NoError(t, err)
+	assert.Equal(t, "/explore", u.Path)
+	assert.Equal(t, "1", u.Query().Get("schemaVersion"))
+
+	var panes map[string]any
+	require.NoError(t, json.Unmarshal([]byte(u.Query().Get("panes")), &panes))
+	assert.Equal(t, map[string]any{
+		"a": map[string]any{
+			"datasource": "prom",
+			"queries": []any{map[string]any{
+				"refId":      "A",
+				"expr":       `rate(x{job="a"}[5m])`,
+				"datasource": map[string]any{"uid": "prom", "type": "prometheus"},
+			}},
+			"range": map[string]any{"from": "1704067200000", "to": "now"},
+		},
+	}, panes)
+}
+
+func TestPrometheusExploreLink(t *testing.T) {
+	ctx := mcpgrafana.WithGrafanaURL(context.Background(), "https://grafana.example.com")
+	explorePane := func(link string) map[string]any {
+		u, err := url.Parse(link)
+		require.NoError(t, err)
+		var panes map[string]map[string]any
+		require.NoError(t, json.Unmarshal([]byte(u.Query().Get("panes")), &panes))
+		return panes["a"]
+	}
+
+	pane := explorePane(prometheusExploreLink(ctx, QueryPrometheusParams{DatasourceUID: "prom", Expr: "up", From: "now-1h", To: "now", QueryType: "instant"}))
+	assert.Equal(t, map[string]any{"from": "now-1h", "to": "now"}, pane["range"])
+	query := pane["queries"].([]any)[0].(map[string]any)
+	assert.Equal(t, true, query["instant"])
+	assert.Equal(t, false, query["range"])
+
+	// Instant queries without an end time are evaluated at the start time.
+	pane = explorePane(prometheusExploreLink(ctx, QueryPrometheusParams{DatasourceUID: "prom", Expr: "up", From: "now-1h", QueryType: "instant"}))
+	assert.Equal(t, map[string]any{"from": "now-1h", "to": "now-1h"}, pane["range"])
+
+	pane = explorePane(prometheusExploreLink(ctx, QueryPrometheusParams{DatasourceUID: "prom", Expr: "up", From: "now-1h", To: "now"}))
+	assert.Equal(t, map[string]any{"from": "now-1h", "to": "now"}, pane["range"])
+	assert.Equal(t, true, pane["queries"].([]any)[0].(map[string]any)["range"])
+}
+
+func TestDashboardLink(t *testing.T) {
+	ctx := mcpgrafana.WithGrafanaURL(context.Background(), "https://grafana.example.com")
+
+	assert.Equal(t, "https://grafana.example.com/d/abc", dashboardLink(ctx, "abc", nil, "", "", 0))
+
+	u, err := url.Parse(dashboardLink(ctx, "abc", map[string]string{"$job": "api", "instance": "{a,b}"}, "now-6h", "2024-01-01T00:00:00Z", 3))
+	require.NoError(t, err)
+	assert.Equal(t, "/d/abc", u.Path)
+	assert.Equal(t, url.Values{
+		"var-job":      {"api"},
+		"var-instance": {"a", "b"},
+		"from":         {"now-6h"},
+		"to":           {"1704067200000"},
+		"viewPanel":    {"3"},
+	}, u.Query())
+}
+
+func TestLinkQuery(t *testing.T) {
+	assert.Equal(t, `rate(x{job=~"(a|b)"}[$__rate_interval])`, linkQuery(`rate(x{job=~"$job"}[$__rate_interval])`, map[string]string{"job": "{a,b}"}))
+	assert.Equal(t, `x{job="$job"}`, linkQuery(`x{job="$job"}`, nil))
+}
+
+func TestSavedDashboardResult(t *testing.T) {
+	ctx := mcpgrafana.WithGrafanaURL(context.Background(), "https://grafana.example.com")
+	uid := "abc"
+	body := &models.PostDashboardOKBody{UID: &uid}
+
+	result, err := savedDashboardResult(ctx, body, nil, true)
+	require.NoError(t, err)
+	assert.Equal(t, "https://grafana.example.com/d/abc", result.Link)
+	data, err := json.Marshal(result)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"uid":"abc"`)
+	assert.Contains(t, string(data), `"link":"https://grafana.example.com/d/abc"`)
+
+	result, err = savedDashboardResult(ctx, body, nil, false)
+	require.NoError(t, err)
+	assert.Empty(t, result.Link)
+
+	_, err = savedDashboardResult(ctx, nil, assert.AnError, true)
+	assert.ErrorIs(t, err, assert.AnError)
+}
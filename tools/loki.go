@@ -12,9 +12,10 @@ import (
 	"strings"
 	"time"
 
-	mcpgrafana "mcp-grafana-local"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
+	mcpgrafana "mcp-grafana-local"
+	"mcp-grafana-local/internal/interpolate"
 )
 
 const (
@@ -140,7 +141,12 @@ func (c *Client) fetchData(ctx context.Context, urlPath string, startRFC3339, en
 	if endRFC3339 != "" {
 		params.Add("end", endRFC3339)
 	}
+	return c.fetchLabelData(ctx, urlPath, params)
+}
 
+// fetchLabelData fetches a list of label names or values from the Loki API
+// using the given query parameters
+func (c *Client) fetchLabelData(ctx context.Context, urlPath string, params url.Values) ([]string, error) {
 	bodyBytes, err := c.makeRequest(ctx, "GET", urlPath, params)
 	if err != nil {
 		return nil, err
@@ -320,6 +326,25 @@ func getDefaultTimeRange(startRFC3339, endRFC3339 string) (string, string) {
 	return startRFC3339, endRFC3339
 }
 
+// interpolateLogQL replaces the template variables in a LogQL query, using the
+// given RFC3339 time range for the built-in variables.
+func interpolateLogQL(query string, variables map[string]string, startRFC3339, endRFC3339 string) (string, error) {
+	start, err := time.Parse(time.RFC3339, startRFC3339)
+	if err != nil {
+		return "", fmt.Errorf("parsing start time: %w", err)
+	}
+	end, err := time.Parse(time.RFC3339, endRFC3339)
+	if err != nil {
+		return "", fmt.Errorf("parsing end time: %w", err)
+	}
+	return interpolateQuery(query, interpolate.Options{
+		Variables:     interpolate.FromMap(variables),
+		From:          start,
+		To:            end,
+		DefaultFormat: interpolate.FormatPrometheus,
+	})
+}
+
 // fetchLogs is a method to fetch logs from Loki API
 func (c *Client) fetchLogs(ctx context.Context, query, startRFC3339, endRFC3339 string, limit int, direction string) ([]LogStream, error) {
 	params := url.Values{}
@@ -358,12 +383,14 @@ func (c *Client) fetchLogs(ctx context.Context, query, startRFC3339, endRFC3339
 
 // QueryLokiLogsParams defines the parameters for querying Loki logs
 type QueryLokiLogsParams struct {
-	DatasourceUID string `json:"datasourceUid" jsonschema:"required,description=The UID of the datasource to query"`
-	LogQL         string `json:"logql" jsonschema:"required,description=The LogQL query to execute against Loki. This can be a simple label matcher or a complex query with filters\\, parsers\\, and expressions. Supports full LogQL syntax including label matchers\\, filter operators\\, pattern expressions\\, and pipeline operations."`
-	StartRFC3339  string `json:"startRfc3339,omitempty" jsonschema:"description=Optionally\\, the start time of the query in RFC3339 format"`
-	EndRFC3339    string `json:"endRfc3339,omitempty" jsonschema:"description=Optionally\\, the end time of the query in RFC3339 format"`
-	Limit         int    `json:"limit,omitempty" jsonschema:"description=Optionally\\, the maximum number of log lines to return (default: 10\\, max: 100)"`
-	Direction     string `json:"direction,omitempty" jsonschema:"description=Optionally\\, the direction of the query: 'forward' (oldest first) or 'backward' (newest first\\, default)"`
+	DatasourceUID string            `json:"datasourceUid" jsonschema:"required,description=The UID of the datasource to query"`
+	LogQL         string            `json:"logql" jsonschema:"required,description=The LogQL query to execute against Loki. This can be a simple label matcher or a complex query with filters\\, parsers\\, and expressions. Supports full LogQL syntax including label matchers\\, filter operators\\, pattern expressions\\, and pipeline operations."`
+	StartRFC3339  string            `json:"startRfc3339,omitempty" jsonschema:"description=Optionally\\, the start time of the query in RFC3339 format"`
+	EndRFC3339    string            `json:"endRfc3339,omitempty" jsonschema:"description=Optionally\\, the end time of the query in RFC3339 format"`
+	Limit         int               `json:"limit,omitempty" jsonschema:"description=Optionally\\, the maximum number of log lines to return (default: 10\\, max: 100)"`
+	Direction     string            `json:"direction,omitempty" jsonschema:"description=Optionally\\, the direction of the query: 'forward' (oldest first) or 'backward' (newest first\\, default)"`
+	Variables     map[string]string `json:"variables,omitempty" jsonschema:"description=Optionally\\, values for template variables (e.g. 'app') used in the query. Use '{a\\,b}' for multiple values. Built-in variables such as $__range and $__interval are filled in from the time range"`
+	IncludeLink   bool              `json:"includeLink,omitempty" jsonschema:"description=If true\\, return the entries with a link to the query in Grafana Explore"`
 }
 
 // LogEntry represents a single log entry or metric sample with metadata
@@ -395,6 +422,11 @@ func queryLokiLogs(ctx context.Context, args QueryLokiLogsParams) ([]LogEntry, e
 	// Get default time range if not provided
 	startTime, endTime := getDefaultTimeRange(args.StartRFC3339, args.EndRFC3339)
 
+	query, err := interpolateLogQL(args.LogQL, args.Variables, startTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+
 	// Apply limit constraints
 	limit := enforceLogLimit(args.Limit)
 
@@ -404,14 +436,41 @@ func queryLokiLogs(ctx context.Context, args QueryLokiLogsParams) ([]LogEntry, e
 		direction = "backward" // Most recent logs first
 	}
 
-	streams, err := client.fetchLogs(ctx, args.LogQL, startTime, endTime, limit, direction)
+	streams, err := client.fetchLogs(ctx, query, startTime, endTime, limit, direction)
 	if err != nil {
 		return nil, err
 	}
 
+	return logEntriesFromStreams(streams), nil
+}
+
+// lokiLogsResult is the result of query_loki_logs with a link to the query
+// in Grafana.
+type lokiLogsResult struct {
+	Entries []LogEntry `json:"entries"`
+	Link    string     `json:"link"`
+}
+
+func queryLokiLogsTool(ctx context.Context, args QueryLokiLogsParams) (any, error) {
+	entries, err := queryLokiLogs(ctx, args)
+	if err != nil || !args.IncludeLink {
+		return entries, err
+	}
+	// Link to the time range that was queried, including the defaults.
+	startTime, endTime := getDefaultTimeRange(args.StartRFC3339, args.EndRFC3339)
+	query := map[string]any{"expr": linkQuery(args.LogQL, args.Variables), "queryType": "range"}
+	return lokiLogsResult{
+		Entries: entries,
+		Link:    exploreLink(ctx, datasourceInfo{UID: args.DatasourceUID, Type: "loki"}, query, startTime, endTime),
+	}, nil
+}
+
+// logEntriesFromStreams converts the streams returned by Loki to a flat list
+// of log entries
+func logEntriesFromStreams(streams []LogStream) []LogEntry {
 	// Handle empty results
 	if len(streams) == 0 {
-		return []LogEntry{}, nil
+		return []LogEntry{}
 	}
 
 	// Convert the streams to a flat list of log entries
@@ -463,17 +522,17 @@ func queryLokiLogs(ctx context.Context, args QueryLokiLogsParams) ([]LogEntry, e
 
 	// If we processed all streams but still have no entries, return an empty slice
 	if len(entries) == 0 {
-		return []LogEntry{}, nil
+		return []LogEntry{}
 	}
 
-	return entries, nil
+	return entries
 }
 
 // QueryLokiLogs is a tool for querying logs from Loki
 var QueryLokiLogs = mcpgrafana.MustTool(
 	"query_loki_logs",
-	"Executes a LogQL query against a Loki datasource to retrieve log entries or metric values. Returns a list of results, each containing a timestamp, labels, and either a log line (`line`) or a numeric metric value (`value`). Defaults to the last hour, a limit of 10 entries, and 'backward' direction (newest first). Supports full LogQL syntax for log and metric queries (e.g., `{app=\"foo\"} |= \"error\"`, `rate({app=\"bar\"}[1m])`). Prefer using `query_loki_stats` first to check stream size and `list_loki_label_names` and `list_loki_label_values` to verify labels exist.",
-	queryLokiLogs,
+	"Executes a LogQL query against a Loki datasource to retrieve log entries or metric values. Returns a list of results, each containing a timestamp, labels, and either a log line (`line`) or a numeric metric value (`value`). Defaults to the last hour, a limit of 10 entries, and 'backward' direction (newest first). Supports full LogQL syntax for log and metric queries (e.g., `{app=\"foo\"} |= \"error\"`, `rate({app=\"bar\"}[1m])`). Prefer using `query_loki_stats` first to check stream size and `list_loki_label_names` and `list_loki_label_values` to verify labels exist. Set includeLink to true to get an object with the `entries` and a `link` opening the query in Grafana Explore, so a human can check the logs.",
+	queryLokiLogsTool,
 	mcp.WithTitleAnnotation("Query Loki logs"),
 	mcp.WithIdempotentHintAnnotation(true),
 	mcp.WithReadOnlyHintAnnotation(true),
@@ -505,10 +564,11 @@ func (c *Client) fetchStats(ctx context.Context, query, startRFC3339, endRFC3339
 
 // QueryLokiStatsParams defines the parameters for querying Loki stats
 type QueryLokiStatsParams struct {
-	DatasourceUID string `json:"datasourceUid" jsonschema:"required,description=The UID of the datasource to query"`
-	LogQL         string `json:"logql" jsonschema:"required,description=The LogQL matcher expression to execute. This parameter only accepts label matcher expressions and does not support full LogQL queries. Line filters\\, pattern operations\\, and metric aggregations are not supported by the stats API endpoint. Only simple label selectors can be used here."`
-	StartRFC3339  string `json:"startRfc3339,omitempty" jsonschema:"description=Optionally\\, the start time of the query in RFC3339 format"`
-	EndRFC3339    string `json:"endRfc3339,omitempty" jsonschema:"description=Optionally\\, the end time of the query in RFC3339 format"`
+	DatasourceUID string            `json:"datasourceUid" jsonschema:"required,description=The UID of the datasource to query"`
+	LogQL         string            `json:"logql" jsonschema:"required,description=The LogQL matcher expression to execute. This parameter only accepts label matcher expressions and does not support full LogQL queries. Line filters\\, pattern operations\\, and metric aggregations are not supported by the stats API endpoint. Only simple label selectors can be used here."`
+	StartRFC3339  string            `json:"startRfc3339,omitempty" jsonschema:"description=Optionally\\, the start time of the query in RFC3339 format"`
+	EndRFC3339    string            `json:"endRfc3339,omitempty" jsonschema:"description=Optionally\\, the end time of the query in RFC3339 format"`
+	Variables     map[string]string `json:"variables,omitempty" jsonschema:"description=Optionally\\, values for template variables (e.g. 'app') used in the selector. Use '{a\\,b}' for multiple values"`
 }
 
 // queryLokiStats queries stats from a Loki datasource using LogQL
@@ -521,7 +581,12 @@ func queryLokiStats(ctx context.Context, args QueryLokiStatsParams) (*Stats, err
 	// Get default time range if not provided
 	startTime, endTime := getDefaultTimeRange(args.StartRFC3339, args.EndRFC3339)
 
-	stats, err := client.fetchStats(ctx, args.LogQL, startTime, endTime)
+	query, err := interpolateLogQL(args.LogQL, args.Variables, startTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := client.fetchStats(ctx, query, startTime, endTime)
 	if err != nil {
 		return nil, err
 	}
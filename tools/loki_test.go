@@ -78,4 +78,20 @@ func TestLokiTools(t *testing.T) {
 		assert.NotNil(t, result, "Empty results should be an empty slice, not nil")
 		assert.Equal(t, 0, len(result), "Empty results should have length 0")
 	})
+
+	t.Run("query loki logs with link", func(t *testing.T) {
+		ctx := newTestContext()
+		result, err := queryLokiLogsTool(ctx, QueryLokiLogsParams{
+			DatasourceUID: "loki",
+			LogQL:         `{container=~".+"}`,
+			Limit:         10,
+			IncludeLink:   true,
+		})
+		require.NoError(t, err)
+		withLink, ok := result.(lokiLogsResult)
+		require.True(t, ok)
+		assert.NotNil(t, withLink.Entries)
+		assert.Contains(t, withLink.Link, "/explore?")
+		assert.Contains(t, withLink.Link, "loki")
+	})
 }
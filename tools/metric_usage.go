@@ -0,0 +1,397 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp/syntax"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	mcpgrafana "mcp-grafana-local"
+)
+
+type FindMetricUsageParams struct {
+	Metric   string `json:"metric,omitempty" jsonschema:"description=The metric name to find\\, e.g. 'http_requests_total'. Histogram and summary series must be given in full\\, e.g. 'http_request_duration_seconds_bucket'"`
+	Matchers string `json:"matchers,omitempty" jsonschema:"description=Label matchers to find\\, e.g. 'job=\"api\"' or '{job=~\"api|web\"\\, env=\"prod\"}'. Use 'label=~\".+\"' to find any use of a label\\, with any matcher type"`
+}
+
+func (p FindMetricUsageParams) validate() error {
+	if p.Metric == "" && p.Matchers == "" {
+		return fmt.Errorf("either metric or matchers is required")
+	}
+	return nil
+}
+
+// usageMatcher reports whether a series selector of a query uses the searched
+// metric and labels.
+type usageMatcher func(selector []*labels.Matcher) bool
+
+// newUsageMatcher returns a matcher for selectors selecting the metric, if
+// given, and using all of the label matchers.
+//
+// A label matcher of the search is used by a selector if the selector has a
+// matcher for the same label which selects a value matched by it, such as
+// job="api" for job=~"api|web", or which selects the searched value, such as
+// job=~"api|web" for job="api". A regex matching any value, such as
+// job=~".+", is used by any matcher of the label, including negative ones.
+func newUsageMatcher(metric, matchers string) (usageMatcher, error) {
+	var searched []*labels.Matcher
+	if matchers != "" {
+		selector := strings.TrimSpace(matchers)
+		if !strings.HasPrefix(selector, "{") {
+			selector = "{" + selector + "}"
+		}
+		var err error
+		if searched, err = parser.ParseMetricSelector(selector); err != nil {
+			return nil, fmt.Errorf("parsing matchers: %w", err)
+		}
+	}
+	if metric != "" {
+		searched = append(searched, labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, metric))
+	}
+	return func(selector []*labels.Matcher) bool {
+		for _, s := range searched {
+			if !selectorUses(selector, s) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+func selectorUses(selector []*labels.Matcher, searched *labels.Matcher) bool {
+	anyValue := matchesAnyValue(searched)
+	for _, m := range selector {
+		if m.Name != searched.Name {
+			continue
+		}
+		switch {
+		case anyValue:
+			return true
+		case m.Type == labels.MatchEqual && searched.Matches(m.Value):
+			return true
+		case m.Type == labels.MatchRegexp && searched.Type == labels.MatchEqual && m.Matches(searched.Value):
+			return true
+		case m.Type == searched.Type && m.Value == searched.Value:
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAnyValue reports whether a matcher is a regex matching any
+// non-empty value, such as label=~".+", which finds any matcher of the label.
+func matchesAnyValue(m *labels.Matcher) bool {
+	if m.Type != labels.MatchRegexp {
+		return false
+	}
+	re, err := syntax.Parse(m.Value, syntax.Perl)
+	if err != nil {
+		return false
+	}
+	re = re.Simplify()
+	if re.Op == syntax.OpCapture {
+		re = re.Sub[0]
+	}
+	if re.Op != syntax.OpPlus && re.Op != syntax.OpStar {
+		return false
+	}
+	return re.Sub[0].Op == syntax.OpAnyChar || re.Sub[0].Op == syntax.OpAnyCharNotNL
+}
+
+// promQLSelectors returns the label matchers of the series selectors of a
+// PromQL query, including the metric name.
+func promQLSelectors(query string) ([][]*labels.Matcher, error) {
+	expr, _, err := parseTemplatedPromQL(query)
+	if err != nil {
+		return nil, err
+	}
+	var result [][]*labels.Matcher
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		if vs, ok := node.(*parser.VectorSelector); ok {
+			result = append(result, vs.LabelMatchers)
+		}
+		return nil
+	})
+	return result, nil
+}
+
+// logQLSelectors returns the label matchers of the stream selectors of a
+// LogQL query. Stream selectors have the same syntax as PromQL selectors
+// without a metric name; braces in quoted strings, such as line_format
+// templates, are skipped.
+func logQLSelectors(query string) ([][]*labels.Matcher, error) {
+	query, _ = replaceWithPlaceholders(query)
+	var result [][]*labels.Matcher
+	var quote rune
+	start := -1
+	escaped := false
+	for i, r := range query {
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0:
+			if r == '\\' && quote == '"' {
+				escaped = true
+			} else if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '`':
+			quote = r
+		case r == '{' && start < 0:
+			start = i
+		case r == '}' && start >= 0:
+			matchers, err := parser.ParseMetricSelector(query[start : i+1])
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, matchers)
+			start = -1
+		}
+	}
+	if quote != 0 || start >= 0 {
+		return nil, fmt.Errorf("unterminated string or stream selector")
+	}
+	return result, nil
+}
+
+// panelQuerySelectors returns the selectors of a Prometheus or Loki panel
+// query. It returns false for queries of other datasources.
+func panelQuerySelectors(q panelQuery) ([][]*labels.Matcher, bool, error) {
+	switch q.Language {
+	case "promql":
+		selectors, err := promQLSelectors(q.Query)
+		return selectors, true, err
+	case "logql":
+		selectors, err := logQLSelectors(q.Query)
+		return selectors, true, err
+	case "":
+		// The datasource is unknown, e.g. because it is a variable, but the
+		// query is in an expr field, so it is PromQL or LogQL.
+		if selectors, err := promQLSelectors(q.Query); err == nil {
+			return selectors, true, nil
+		}
+		selectors, err := logQLSelectors(q.Query)
+		return selectors, true, err
+	}
+	return nil, false, nil
+}
+
+// ruleQuerySelectors returns the selectors of the query of an alert rule.
+// Grafana joins the queries of a rule with " | ", which also separates the
+// stages of LogQL queries, and includes server side expressions as JSON.
+// Parts are joined again until they parse as PromQL. The parts following a
+// bare stream selector are stages of a LogQL query, and anything left is read
+// as LogQL.
+func ruleQuerySelectors(query string) ([][]*labels.Matcher, error) {
+	var result [][]*labels.Matcher
+	var pending []string
+	inLogQuery := false
+	for _, part := range strings.Split(query, " | ") {
+		if strings.HasPrefix(part, "{\"") && json.Valid([]byte(part)) {
+			inLogQuery = false
+			continue
+		}
+		if inLogQuery && !strings.HasPrefix(part, "{") {
+			continue
+		}
+		pending = append(pending, part)
+		joined := strings.Join(pending, " | ")
+		if selectors, err := promQLSelectors(joined); err == nil {
+			result = append(result, selectors...)
+			inLogQuery = strings.HasPrefix(strings.TrimSpace(joined), "{")
+			pending = nil
+		}
+	}
+	if len(pending) > 0 {
+		selectors, err := logQLSelectors(strings.Join(pending, " | "))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, selectors...)
+	}
+	return result, nil
+}
+
+type dashboardQueryUsage struct {
+	DashboardUID    string `json:"dashboardUid"`
+	DashboardTitle  string `json:"dashboardTitle"`
+	FolderTitle     string `json:"folderTitle,omitempty"`
+	PanelID         int    `json:"panelId"`
+	PanelTitle      string `json:"panelTitle"`
+	RefID           string `json:"refId,omitempty"`
+	LibraryPanelUID string `json:"libraryPanelUid,omitempty"`
+	Query           string `json:"query"`
+}
+
+type alertRuleUsage struct {
+	UID       string `json:"uid"`
+	Name      string `json:"name"`
+	Group     string `json:"group"`
+	FolderUID string `json:"folderUid,omitempty"`
+	Query     string `json:"query"`
+}
+
+// unparsedQuery is a query which couldn't be parsed, so may use the metric
+// without being found.
+type unparsedQuery struct {
+	// Source is "dashboard" or "alert rule".
+	Source  string `json:"source"`
+	UID     string `json:"uid"`
+	PanelID int    `json:"panelId,omitempty"`
+	RefID   string `json:"refId,omitempty"`
+	Query   string `json:"query"`
+	Error   string `json:"error"`
+}
+
+type metricUsage struct {
+	Dashboards []dashboardQueryUsage `json:"dashboards"`
+	AlertRules []alertRuleUsage      `json:"alertRules"`
+	Unparsed   []unparsedQuery       `json:"unparsed,omitempty"`
+}
+
+// metricUsageIndex holds the selectors of the queries of dashboards and alert
+// rules.
+type metricUsageIndex struct {
+	dashboards []indexedQuery[dashboardQueryUsage]
+	rules      []indexedQuery[alertRuleUsage]
+	unparsed   []unparsedQuery
+}
+
+type indexedQuery[T any] struct {
+	usage     T
+	selectors [][]*labels.Matcher
+}
+
+// addDashboard indexes the Prometheus and Loki queries of a dashboard's
+// panels, which must have their library panels resolved.
+func (idx *metricUsageIndex) addDashboard(hit searchHit, panels []any) {
+	for _, q := range extractPanelQueries(panels) {
+		selectors, ok, err := panelQuerySelectors(q)
+		if !ok {
+			continue
+		}
+		if err != nil {
+			idx.unparsed = append(idx.unparsed, unparsedQuery{
+				Source:  "dashboard",
+				UID:     hit.UID,
+				PanelID: q.PanelID,
+				RefID:   q.RefID,
+				Query:   q.Query,
+				Error:   err.Error(),
+			})
+			continue
+		}
+		idx.dashboards = append(idx.dashboards, indexedQuery[dashboardQueryUsage]{
+			usage: dashboardQueryUsage{
+				DashboardUID:    hit.UID,
+				DashboardTitle:  hit.Title,
+				FolderTitle:     hit.FolderTitle,
+				PanelID:         q.PanelID,
+				PanelTitle:      q.Title,
+				RefID:           q.RefID,
+				LibraryPanelUID: q.LibraryPanelUID,
+				Query:           q.Query,
+			},
+			selectors: selectors,
+		})
+	}
+}
+
+func (idx *metricUsageIndex) addRuleGroups(groups []ruleGroup) {
+	for _, group := range groups {
+		for _, rule := range group.Rules {
+			selectors, err := ruleQuerySelectors(rule.Query)
+			if err != nil {
+				idx.unparsed = append(idx.unparsed, unparsedQuery{
+					Source: "alert rule",
+					UID:    rule.UID,
+					Query:  rule.Query,
+					Error:  err.Error(),
+				})
+				continue
+			}
+			idx.rules = append(idx.rules, indexedQuery[alertRuleUsage]{
+				usage: alertRuleUsage{
+					UID:       rule.UID,
+					Name:      rule.Name,
+					Group:     group.Name,
+					FolderUID: rule.FolderUID,
+					Query:     rule.Query,
+				},
+				selectors: selectors,
+			})
+		}
+	}
+}
+
+func matchingQueries[T any](queries []indexedQuery[T], match usageMatcher) []T {
+	result := []T{}
+	for _, q := range queries {
+		for _, selector := range q.selectors {
+			if match(selector) {
+				result = append(result, q.usage)
+				break
+			}
+		}
+	}
+	return result
+}
+
+func (idx *metricUsageIndex) find(match usageMatcher) *metricUsage {
+	return &metricUsage{
+		Dashboards: matchingQueries(idx.dashboards, match),
+		AlertRules: matchingQueries(idx.rules, match),
+		Unparsed:   idx.unparsed,
+	}
+}
+
+// buildMetricUsageIndex indexes the queries of all dashboards and alert rules.
+func buildMetricUsageIndex(ctx context.Context) (*metricUsageIndex, error) {
+	idx := &metricUsageIndex{}
+	err := forEachDashboard(ctx, func(hit searchHit, _ map[string]any, panels []any) {
+		idx.addDashboard(hit, panels)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := newAlertingClientFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := c.GetRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	idx.addRuleGroups(rules.Data.RuleGroups)
+	return idx, nil
+}
+
+func findMetricUsage(ctx context.Context, args FindMetricUsageParams) (*metricUsage, error) {
+	if err := args.validate(); err != nil {
+		return nil, err
+	}
+	match, err := newUsageMatcher(args.Metric, args.Matchers)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := buildMetricUsageIndex(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("find metric usage: %w", err)
+	}
+	return idx.find(match), nil
+}
+
+var FindMetricUsage = mcpgrafana.MustTool(
+	"find_metric_usage",
+	"Find the dashboard panels and alert rules whose PromQL or LogQL queries use a metric or label, e.g. before deprecating or renaming it. Queries are parsed, so only series selectors of the metric and matchers of the labels match, not mentions in other labels or strings. Template variables can't be resolved, so a matcher such as job=\"$job\" doesn't match a searched value. Returns the matching panel queries with their dashboard, the matching alert rules, and the queries which couldn't be parsed. This loads every dashboard, so it can be slow on large instances.",
+	findMetricUsage,
+	mcp.WithTitleAnnotation("Find metric usage"),
+	mcp.WithIdempotentHintAnnotation(true),
+	mcp.WithReadOnlyHintAnnotation(true),
+)
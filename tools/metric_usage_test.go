@@ -0,0 +1,183 @@
+//go:build unit
+// +build unit
+
+package tools
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsageMatcher(t *testing.T) {
+	selectors, err := promQLSelectors(`sum by (job) (rate(http_requests_total{job=~"api|web", env="prod"}[$__rate_interval])) / on() group_left up{job="$job"}`)
+	require.NoError(t, err)
+	require.Len(t, selectors, 2)
+
+	for _, tc := range []struct {
+		name     string
+		metric   string
+		matchers string
+		expected bool
+	}{
+		{"metric", "http_requests_total", "", true},
+		{"other metric", "http_requests", "", false},
+		{"label value selected by regex", "", `job="api"`, true},
+		{"label value not selected", "", `job="db"`, false},
+		{"equal value matched by regex", "", `env=~"prod|staging"`, true},
+		{"same regex", "", `job=~"api|web"`, true},
+		{"any value", "", `env=~".+"`, true},
+		{"unused label", "", `cluster=~".+"`, false},
+		{"metric and label", "http_requests_total", `{env="prod"}`, true},
+		{"metric and label of other selector", "up", `env="prod"`, false},
+		{"variable value", "up", `job="api"`, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			match, err := newUsageMatcher(tc.metric, tc.matchers)
+			require.NoError(t, err)
+			matched := match(selectors[0]) || match(selectors[1])
+			assert.Equal(t, tc.expected, matched)
+		})
+	}
+
+	_, err = newUsageMatcher("", `job=`)
+	assert.Error(t, err)
+}
+
+func TestUsageMatcherAnyValue(t *testing.T) {
+	for _, tc := range []struct {
+		query    string
+		matchers string
+		expected bool
+	}{
+		{`up{job=~"api|web"}`, `job=~".+"`, true},
+		{`up{job!="db"}`, `job=~".+"`, true},
+		{`up{job!~"db|cache"}`, `job=~".*"`, true},
+		{`up{job!~"db|cache"}`, `job=~"(?s:.+)"`, true},
+		{`up{env="prod"}`, `job=~".+"`, false},
+		{`up{job!="db"}`, `job=~"a.+"`, false},
+		{`up{job!="db"}`, `job="db"`, false},
+	} {
+		t.Run(tc.query+" "+tc.matchers, func(t *testing.T) {
+			selectors, err := promQLSelectors(tc.query)
+			require.NoError(t, err)
+			match, err := newUsageMatcher("", tc.matchers)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, match(selectors[0]))
+		})
+	}
+}
+
+func TestPromQLSelectorsTemplated(t *testing.T) {
+	match, err := newUsageMatcher("http_requests_total", "")
+	require.NoError(t, err)
+	for _, query := range []string{
+		`sum by ($group) (rate(http_requests_total{job="$job"}[$__rate_interval]))`,
+		`topk($n, sum without ($label) (rate(http_requests_total[$window])))`,
+	} {
+		selectors, err := promQLSelectors(query)
+		require.NoError(t, err, query)
+		require.Len(t, selectors, 1)
+		assert.True(t, match(selectors[0]), query)
+	}
+
+	selectors, err := promQLSelectors(`$metric{job="a"}`)
+	require.NoError(t, err)
+	require.Len(t, selectors, 1)
+	match, err = newUsageMatcher("", `job="a"`)
+	require.NoError(t, err)
+	assert.True(t, match(selectors[0]))
+}
+
+func TestLogQLSelectors(t *testing.T) {
+	selectors, err := logQLSelectors(`sum(count_over_time({app="api", env=~"$env"} |= "error" | line_format "{{.msg}}" [5m])) + count_over_time({app="web"} [5m])`)
+	require.NoError(t, err)
+	require.Len(t, selectors, 2)
+	assert.Equal(t, "app", selectors[0][0].Name)
+	assert.Equal(t, "api", selectors[0][0].Value)
+	assert.Equal(t, "web", selectors[1][0].Value)
+
+	_, err = logQLSelectors(`{app="api"} |= "unterminated`)
+	assert.Error(t, err)
+}
+
+func TestRuleQuerySelectors(t *testing.T) {
+	selectors, err := ruleQuerySelectors(`rate(errors_total{job="api"}[5m]) | {"refId":"B","type":"threshold"} | {app="api"} | json | level="error"`)
+	require.NoError(t, err)
+	require.Len(t, selectors, 2)
+
+	match, err := newUsageMatcher("errors_total", "")
+	require.NoError(t, err)
+	assert.True(t, match(selectors[0]))
+	match, err = newUsageMatcher("", `app="api"`)
+	require.NoError(t, err)
+	assert.True(t, match(selectors[1]))
+
+	selectors, err = ruleQuerySelectors(`sum(count_over_time({app="api"} | json | level="error" [5m])) | {"refId":"B","type":"reduce"}`)
+	require.NoError(t, err)
+	require.Len(t, selectors, 1)
+	assert.True(t, match(selectors[0]))
+}
+
+func TestMetricUsageIndex(t *testing.T) {
+	idx := &metricUsageIndex{}
+	idx.addDashboard(searchHit{UID: "svc", Title: "Service", FolderTitle: "Team A"}, []any{
+		map[string]any{
+			"id":         float64(1),
+			"title":      "Requests",
+			"datasource": map[string]any{"uid": "prom", "type": "prometheus"},
+			"targets": []any{
+				map[string]any{"refId": "A", "expr": `sum(rate(http_requests_total{job="api"}[5m]))`},
+				map[string]any{"refId": "B", "expr": `up{job="api"}`},
+			},
+		},
+		map[string]any{
+			"id":         float64(2),
+			"title":      "Broken",
+			"datasource": map[string]any{"uid": "prom", "type": "prometheus"},
+			"targets":    []any{map[string]any{"refId": "A", "expr": `sum(rate(http_requests_total[5m])`}},
+		},
+		map[string]any{
+			"id":         float64(3),
+			"title":      "Database",
+			"datasource": map[string]any{"uid": "pg", "type": "postgres"},
+			"targets":    []any{map[string]any{"refId": "A", "rawSql": "SELECT http_requests_total FROM t"}},
+		},
+	})
+	idx.addRuleGroups([]ruleGroup{{
+		Name: "api",
+		Rules: []alertingRule{
+			{UID: "r1", Name: "High error rate", FolderUID: "f1", Query: `rate(http_requests_total{code="500"}[5m]) > 1`},
+			{UID: "r2", Name: "Down", Query: `up == 0`},
+		},
+	}})
+
+	match, err := newUsageMatcher("http_requests_total", "")
+	require.NoError(t, err)
+	usage := idx.find(match)
+	assert.Equal(t, []dashboardQueryUsage{{
+		DashboardUID:   "svc",
+		DashboardTitle: "Service",
+		FolderTitle:    "Team A",
+		PanelID:        1,
+		PanelTitle:     "Requests",
+		RefID:          "A",
+		Query:          `sum(rate(http_requests_total{job="api"}[5m]))`,
+	}}, usage.Dashboards)
+	assert.Equal(t, []alertRuleUsage{{
+		UID:       "r1",
+		Name:      "High error rate",
+		Group:     "api",
+		FolderUID: "f1",
+		Query:     `rate(http_requests_total{code="500"}[5m]) > 1`,
+	}}, usage.AlertRules)
+	require.Len(t, usage.Unparsed, 1)
+	assert.Equal(t, 2, usage.Unparsed[0].PanelID)
+
+	match, err = newUsageMatcher("", `job="api"`)
+	require.NoError(t, err)
+	usage = idx.find(match)
+	assert.Len(t, usage.Dashboards, 2)
+	assert.Empty(t, usage.AlertRules)
+}
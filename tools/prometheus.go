@@ -8,8 +8,6 @@ import (
 	"strings"
 	"time"
 
-	
-	mcpgrafana "mcp-grafana-local"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 	"github.com/prometheus/client_golang/api"
@@ -17,6 +15,8 @@ import (
 	"github.com/prometheus/common/config"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/model/labels"
+	mcpgrafana "mcp-grafana-local"
+	"mcp-grafana-local/internal/interpolate"
 )
 
 var (
@@ -67,7 +67,11 @@ func promClientFromContext(ctx context.Context, uid string) (promv1.API, error)
 		return nil, fmt.Errorf("creating Prometheus client: %w", err)
 	}
 
-	return promv1.NewAPI(c), nil
+	// Queries are checked against the guardrails before they are sent.
+	return guardedPrometheusAPI{
+		API:        promv1.NewAPI(c),
+		guardrails: mcpgrafana.PrometheusGuardrailsFromContext(ctx),
+	}, nil
 }
 
 type ListPrometheusMetricMetadataParams struct {
@@ -104,136 +108,310 @@ var ListPrometheusMetricMetadata = mcpgrafana.MustTool(
 	mcp.WithReadOnlyHintAnnotation(true),
 )
 
+const (
+	// DefaultPrometheusMaxDataPoints is the number of points per series that
+	// range queries aim for when no explicit step is given.
+	DefaultPrometheusMaxDataPoints = 200
+
+	// maxPrometheusResolution is the maximum number of points per series that
+	// Prometheus will return for a single range query.
+	maxPrometheusResolution = 11000
+)
+
+var (
+	relativeTimeRegex     = regexp.MustCompile(`^now-((?:\d+[yMwdhms])+)$`)
+	relativeTimeUnitRegex = regexp.MustCompile(`(\d+)([yMwdhms])`)
+
+	// niceSteps are the steps automatic step sizing rounds up to, so that
+	// sample timestamps line up with human friendly boundaries.
+	niceSteps = []time.Duration{
+		time.Second,
+		5 * time.Second,
+		10 * time.Second,
+		15 * time.Second,
+		30 * time.Second,
+		time.Minute,
+		2 * time.Minute,
+		5 * time.Minute,
+		10 * time.Minute,
+		15 * time.Minute,
+		30 * time.Minute,
+		time.Hour,
+		2 * time.Hour,
+		3 * time.Hour,
+		6 * time.Hour,
+		12 * time.Hour,
+		24 * time.Hour,
+	}
+)
+
 // QueryPrometheusParams allows 'from' and 'to' to be RFC3339, epoch ms string, or relative time ("now-5m", "now-1h").
 type QueryPrometheusParams struct {
-    DatasourceUID string `json:"datasourceUid" jsonschema:"required,description=The UID of the datasource to query"`
-    Expr          string `json:"expr" jsonschema:"required,description=The PromQL expression to query"`
-    From          string `json:"from" jsonschema:"required,description=Start time (RFC3339, epoch ms, or relative to now like 'now-5m')"`
-    To            string `json:"to" jsonschema:"required,description=End time (RFC3339, epoch ms, or relative to now like 'now')"`
-    StepSeconds   int    `json:"stepSeconds,omitempty" jsonschema:"description=Time series step size in seconds. Required if queryType is 'range'"`
-    QueryType     string `json:"queryType,omitempty" jsonschema:"description=The type of query to use. Either 'range' or 'instant'"`
-	Variables     map[string]string `json:"variables,omitempty"` 
+	DatasourceUID string            `json:"datasourceUid" jsonschema:"required,description=The UID of the datasource to query"`
+	Expr          string            `json:"expr" jsonschema:"required,description=The PromQL expression to query"`
+	From          string            `json:"from" jsonschema:"required,description=Start time (RFC3339\\, epoch ms\\, or relative to now like 'now-5m'). For instant queries without 'to'\\, this is the evaluation time"`
+	To            string            `json:"to,omitempty" jsonschema:"description=End time (RFC3339\\, epoch ms\\, or relative to now like 'now'). Required if queryType is 'range'. Instant queries are evaluated at this time\\, with $__range set to the time range as in Grafana"`
+	StepSeconds   int               `json:"stepSeconds,omitempty" jsonschema:"description=Time series step size in seconds. If omitted for a range query\\, a step is chosen automatically from the time range and maxDataPoints"`
+	MaxDataPoints int               `json:"maxDataPoints,omitempty" jsonschema:"description=The maximum number of points per series to return when the step is chosen automatically. Defaults to 200"`
+	QueryType     string            `json:"queryType,omitempty" jsonschema:"description=The type of query to use. Either 'range' (default) or 'instant'"`
+	Variables     map[string]string `json:"variables,omitempty" jsonschema:"description=Optionally\\, values for template variables (e.g. 'job') used in the expression. Use '{a\\,b}' for multiple values. Built-in variables such as $__range\\, $__interval and $__rate_interval are filled in from the time range"`
+	Summarize     bool              `json:"summarize,omitempty" jsonschema:"description=If true\\, return per-series statistics (min\\, max\\, avg\\, last\\, p95 and trend) for the top series instead of every sample"`
+	TopN          int               `json:"topN,omitempty" jsonschema:"description=The number of series to include when summarize is true\\, ranked by average value. Defaults to 10"`
+
+	IncludeAnnotations     bool     `json:"includeAnnotations,omitempty" jsonschema:"description=If true\\, also return the Grafana annotations (e.g. deployments or incidents) within the time range of a range query"`
+	AnnotationTags         []string `json:"annotationTags,omitempty" jsonschema:"description=Optionally\\, only include annotations with all of these tags"`
+	AnnotationDashboardUID string   `json:"annotationDashboardUid,omitempty" jsonschema:"description=Optionally\\, only include annotations of the dashboard with this UID"`
+
+	IncludeLink bool `json:"includeLink,omitempty" jsonschema:"description=If true\\, also return a link to the query in Grafana Explore"`
+}
+
+// prometheusQueryResult is a query result with the annotations made during
+// its time range, so changes in the data can be related to events, and a
+// link to the query in Grafana.
+type prometheusQueryResult struct {
+	Result      any                 `json:"result"`
+	Annotations []annotationSummary `json:"annotations,omitempty"`
+	Link        string              `json:"link,omitempty"`
 }
 
+// parseTime parses a time string relative to the current time.
+// See parseUserTime for the supported formats.
+func parseTime(input string) (time.Time, error) {
+	return parseUserTime(input, time.Now())
+}
 
 // parseUserTime handles RFC3339, epoch ms, or relative ("now-5m", "now-1h").
+//
+// Relative times support the units y (years), M (months), w (weeks), d (days),
+// h (hours), m (minutes) and s (seconds), and may combine several of them,
+// e.g. "now-1d12h".
 func parseUserTime(input string, now time.Time) (time.Time, error) {
-    input = strings.TrimSpace(input)
-    if input == "" {
-        return time.Time{}, fmt.Errorf("empty time string")
-    }
-    if input == "now" {
-        return now, nil
-    }
-    // Try epoch ms
-    if ms, err := strconv.ParseInt(input, 10, 64); err == nil && ms > 1000000000000 {
-        return time.Unix(0, ms*int64(time.Millisecond)), nil
-    }
-    // Try RFC3339
-    if t, err := time.Parse(time.RFC3339, input); err == nil {
-        return t, nil
-    }
-    // Try relative: now-5m, now-1h, now-2h30m, now-2d
-    relRe := regexp.MustCompile(`^now-(\d+d)?(\d+h)?(\d+m)?(\d+s)?$`)
-    if matches := relRe.FindStringSubmatch(input); matches != nil {
-        durStr := ""
-        for i := 1; i <= 4; i++ {
-            if matches[i] != "" {
-                durStr += matches[i]
-            }
-        }
-        if d, err := parseDurationWithDays(durStr); err == nil {
-            return now.Add(-d), nil
-        }
-    }
-    return time.Time{}, fmt.Errorf("invalid time format: %s", input)
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return time.Time{}, fmt.Errorf("empty time string")
+	}
+	if input == "now" {
+		return now, nil
+	}
+	// Try epoch ms
+	if ms, err := strconv.ParseInt(input, 10, 64); err == nil && ms > 1000000000000 {
+		return time.Unix(0, ms*int64(time.Millisecond)), nil
+	}
+	// Try RFC3339
+	if t, err := time.Parse(time.RFC3339, input); err == nil {
+		return t, nil
+	}
+	// Try relative: now-5m, now-1h, now-2h30m, now-2d, now-1M
+	if matches := relativeTimeRegex.FindStringSubmatch(input); matches != nil {
+		t := now
+		for _, part := range relativeTimeUnitRegex.FindAllStringSubmatch(matches[1], -1) {
+			n, err := strconv.Atoi(part[1])
+			if err != nil {
+				return time.Time{}, fmt.Errorf("invalid time format: %s", input)
+			}
+			switch part[2] {
+			case "y":
+				t = t.AddDate(-n, 0, 0)
+			case "M":
+				t = t.AddDate(0, -n, 0)
+			case "w":
+				t = t.Add(-time.Duration(n) * 7 * 24 * time.Hour)
+			case "d":
+				t = t.Add(-time.Duration(n) * 24 * time.Hour)
+			case "h":
+				t = t.Add(-time.Duration(n) * time.Hour)
+			case "m":
+				t = t.Add(-time.Duration(n) * time.Minute)
+			case "s":
+				t = t.Add(-time.Duration(n) * time.Second)
+			}
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time format: %s", input)
 }
 
-// parseDurationWithDays supports days in duration (e.g. "2d5h30m").
-func parseDurationWithDays(s string) (time.Duration, error) {
-    // Replace "d" with hours for time.ParseDuration
-    re := regexp.MustCompile(`(\d+)d`)
-    s = re.ReplaceAllStringFunc(s, func(dayStr string) string {
-        days, _ := strconv.Atoi(strings.TrimSuffix(dayStr, "d"))
-        return fmt.Sprintf("%dh", days*24)
-    })
-    return time.ParseDuration(s)
+// computeStep returns the step to use for a range query between start and end.
+//
+// An explicit stepSeconds is honored as long as the query stays within the
+// Prometheus resolution limit. Otherwise the step is derived from the time
+// range so that each series has at most maxDataPoints points, rounded up to
+// the next entry of niceSteps (or whole days beyond that).
+func computeStep(start, end time.Time, stepSeconds, maxDataPoints int) (time.Duration, error) {
+	if stepSeconds < 0 {
+		return 0, fmt.Errorf("invalid stepSeconds: %d, must not be negative", stepSeconds)
+	}
+	if maxDataPoints < 0 {
+		return 0, fmt.Errorf("invalid maxDataPoints: %d, must not be negative", maxDataPoints)
+	}
+	queryRange := end.Sub(start)
+	if queryRange < 0 {
+		return 0, fmt.Errorf("end time %s is before start time %s", end.Format(time.RFC3339), start.Format(time.RFC3339))
+	}
+
+	if stepSeconds > 0 {
+		step := time.Duration(stepSeconds) * time.Second
+		if points := int64(queryRange/step) + 1; points > maxPrometheusResolution {
+			return 0, fmt.Errorf("a step of %ds over %s would return %d points per series, exceeding the maximum of %d: use a larger stepSeconds or omit it to choose one automatically", stepSeconds, queryRange, points, maxPrometheusResolution)
+		}
+		return step, nil
+	}
+
+	if maxDataPoints == 0 {
+		maxDataPoints = DefaultPrometheusMaxDataPoints
+	}
+	if maxDataPoints > maxPrometheusResolution {
+		maxDataPoints = maxPrometheusResolution
+	}
+	minStep := queryRange / time.Duration(maxDataPoints)
+	for _, step := range niceSteps {
+		if step >= minStep {
+			return step, nil
+		}
+	}
+	day := 24 * time.Hour
+	return (minStep + day - 1) / day * day, nil
 }
 
-type UnresolvedVariablesError struct {
-	Missing []string
+// runPrometheusQuery resolves the variables and time range in args and runs
+// the expression as an instant or range query, returning the raw result.
+func runPrometheusQuery(ctx context.Context, args QueryPrometheusParams) (model.Value, error) {
+	expr, r, err := resolvePrometheusQuery(args, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return executePrometheusQuery(ctx, args.DatasourceUID, expr, r)
+}
+
+// resolvePrometheusQuery interpolates the expression of args and returns it
+// with the range to run it over. As in Grafana, instant queries are evaluated
+// at the end of the time range, and the built-in range variables describe
+// the whole range. Instant queries without an end time are evaluated at the
+// start time.
+func resolvePrometheusQuery(args QueryPrometheusParams, now time.Time) (string, promv1.Range, error) {
+	queryType := args.QueryType
+	if queryType == "" {
+		queryType = "range"
+	}
+	if queryType != "range" && queryType != "instant" {
+		return "", promv1.Range{}, fmt.Errorf("invalid query type: %s, must be 'range' or 'instant'", queryType)
+	}
+
+	fromTime, err := parseUserTime(args.From, now)
+	if err != nil {
+		return "", promv1.Range{}, fmt.Errorf("parsing from time: %w", err)
+	}
+	toTime := fromTime
+	if queryType == "range" || args.To != "" {
+		toTime, err = parseUserTime(args.To, now)
+		if err != nil {
+			return "", promv1.Range{}, fmt.Errorf("parsing to time: %w", err)
+		}
+	}
+
+	step := time.Duration(0)
+	if queryType == "range" {
+		step, err = computeStep(fromTime, toTime, args.StepSeconds, args.MaxDataPoints)
+		if err != nil {
+			return "", promv1.Range{}, err
+		}
+	}
+
+	expr, err := interpolateQuery(args.Expr, interpolate.Options{
+		Variables:     interpolate.FromMap(args.Variables),
+		From:          fromTime,
+		To:            toTime,
+		Interval:      step,
+		MaxDataPoints: args.MaxDataPoints,
+		DefaultFormat: interpolate.FormatPrometheus,
+	})
+	if err != nil {
+		return "", promv1.Range{}, err
+	}
+
+	if queryType == "instant" {
+		return expr, promv1.Range{Start: toTime}, nil
+	}
+	return expr, promv1.Range{Start: fromTime, End: toTime, Step: step}, nil
 }
 
-func (e *UnresolvedVariablesError) Error() string {
-	return fmt.Sprintf("unresolved variables in query: %v", e.Missing, "please prompt user to provide variable values and resolve them")
+// executePrometheusQuery runs an interpolated expression against a Prometheus
+// datasource. A zero step runs an instant query evaluated at r.Start.
+func executePrometheusQuery(ctx context.Context, datasourceUID, expr string, r promv1.Range) (model.Value, error) {
+	promClient, err := promClientFromContext(ctx, datasourceUID)
+	if err != nil {
+		return nil, fmt.Errorf("getting Prometheus client: %w", err)
+	}
+
+	if r.Step == 0 {
+		result, _, err := promClient.Query(ctx, expr, r.Start)
+		if err != nil {
+			return nil, fmt.Errorf("querying Prometheus instant: %w", err)
+		}
+		return result, nil
+	}
+
+	result, _, err := promClient.QueryRange(ctx, expr, r)
+	if err != nil {
+		return nil, fmt.Errorf("querying Prometheus range: %w", err)
+	}
+	return result, nil
 }
 
+func queryPrometheus(ctx context.Context, args QueryPrometheusParams) (any, error) {
+	if args.TopN < 0 {
+		return nil, fmt.Errorf("invalid topN: %d, must not be negative", args.TopN)
+	}
+	if args.IncludeAnnotations && args.QueryType == "instant" {
+		return nil, fmt.Errorf("includeAnnotations is only supported for range queries")
+	}
+	result, err := runPrometheusQuery(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	var output any = result
+	if args.Summarize {
+		output = summarizePrometheusResult(result, args.TopN)
+	}
+	if !args.IncludeAnnotations && !args.IncludeLink {
+		return output, nil
+	}
+	queryResult := prometheusQueryResult{Result: output}
+	if args.IncludeAnnotations {
+		queryResult.Annotations, err = getAnnotations(ctx, GetAnnotationsParams{
+			DashboardUID: args.AnnotationDashboardUID,
+			Tags:         args.AnnotationTags,
+			From:         args.From,
+			To:           args.To,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("getting annotations: %w", err)
+		}
+	}
+	if args.IncludeLink {
+		queryResult.Link = prometheusExploreLink(ctx, args)
+	}
+	return queryResult, nil
+}
 
-func queryPrometheus(ctx context.Context, args QueryPrometheusParams) (model.Value, error) {
-	var variableRegex = regexp.MustCompile(`\$\w+`)
-    promClient, err := promClientFromContext(ctx, args.DatasourceUID)
-    if err != nil {
-        return nil, fmt.Errorf("getting Prometheus client: %w", err)
-    }
-
-    queryType := args.QueryType
-    if queryType == "" {
-        queryType = "range"
-    }
-
-	queryType = "range"
-
-	expr := args.Expr
-	for name, value := range args.Variables {
-		expr = strings.ReplaceAll(expr, "$"+name, value)
-	}
-
-	unresolved := variableRegex.FindAllString(expr, -1)
-	if len(unresolved) > 0 {
-		return nil, &UnresolvedVariablesError{Missing: unresolved}
-	}
-
-
-    now := time.Now()
-    var fromTime, toTime time.Time
-
-    fromTime, err = parseUserTime(args.From, now)
-    if err != nil {
-        return nil, fmt.Errorf("parsing from time: %w", err)
-    }
-
-    if queryType == "range" {
-        toTime, err = parseUserTime(args.To, now)
-        if err != nil {
-            return nil, fmt.Errorf("parsing to time: %w", err)
-        }
-        // Declare and initialize stepSeconds here.
-        // You can choose a default, e.g., 60 seconds.
-        stepSeconds := 30
-        step := time.Duration(stepSeconds) * time.Second
-        result, _, err := promClient.QueryRange(ctx, expr, promv1.Range{
-            Start: fromTime,
-            End:   toTime,
-            Step:  step,
-        })
-        if err != nil {
-            return nil, fmt.Errorf("querying Prometheus range: %w", err)
-        }
-        return result, nil
-    } else if queryType == "instant" {
-        result, _, err := promClient.Query(ctx, expr, fromTime)
-        if err != nil {
-            return nil, fmt.Errorf("querying Prometheus instant: %w", err)
-        }
-        return result, nil
-    }
-
-    return nil, fmt.Errorf("invalid query type: %s", queryType)
+// prometheusExploreLink returns the Explore URL of a query_prometheus query.
+// Instant queries link to their whole time range, as they are evaluated at
+// its end.
+func prometheusExploreLink(ctx context.Context, args QueryPrometheusParams) string {
+	query := map[string]any{"expr": linkQuery(args.Expr, args.Variables), "range": true, "instant": false}
+	to := args.To
+	if args.QueryType == "instant" {
+		query["range"], query["instant"] = false, true
+		if to == "" {
+			to = args.From
+		}
+	}
+	return exploreLink(ctx, datasourceInfo{UID: args.DatasourceUID, Type: "prometheus"}, query, args.From, to)
 }
 
 var QueryPrometheus = mcpgrafana.MustTool(
 	"query_prometheus",
-	"Query Prometheus using a PromQL expression. Supports both instant queries (at a single point in time) and range queries (over a time range). Time can be specified either in RFC3339 format or as relative time expressions like 'now', 'now-1h', 'now-30m', etc.",
+	"Query Prometheus using a PromQL expression. Supports both instant queries (at a single point in time) and range queries (over a time range). Time can be specified either in RFC3339 format or as relative time expressions like 'now', 'now-1h', 'now-30m', 'now-7d', etc. For range queries an explicit stepSeconds is honored; if it is omitted the step is chosen automatically so that each series has at most maxDataPoints points (default 200), which keeps long time ranges compact. Set summarize to true to get per-series min/max/avg/last/p95 and trend direction for the top N series instead of the raw samples; prefer this when only the shape of the data matters. Set includeAnnotations to true to also get the annotations, such as deployments, within the time range of a range query, optionally filtered by annotationTags; annotations are omitted if there are none. Set includeLink to true to also get a link opening the query in Grafana Explore, so a human can check the result. With either option the result is an object with the query result under `result`. Queries are checked against guardrails before they run: selectors need a metric name, and the time range, range selectors, points per series and (if configured) number of selected series are limited; rejected queries return a tool error holding a JSON object with the `guardrail`, a `message` and `suggestions` for narrowing the query.",
 	queryPrometheus,
 	mcp.WithTitleAnnotation("Query Prometheus metrics"),
 	mcp.WithIdempotentHintAnnotation(true),
@@ -477,6 +655,14 @@ var ListPrometheusLabelValues = mcpgrafana.MustTool(
 func AddPrometheusTools(mcp *server.MCPServer) {
 	ListPrometheusMetricMetadata.Register(mcp)
 	QueryPrometheus.Register(mcp)
+	ValidatePromQL.Register(mcp)
+	GetPrometheusCardinality.Register(mcp)
+	CountPrometheusSeries.Register(mcp)
+	ListPrometheusTargets.Register(mcp)
+	GetPrometheusTargetHealth.Register(mcp)
+	ListPrometheusRules.Register(mcp)
+	ListPrometheusAlerts.Register(mcp)
+	DetectMetricAnomalies.Register(mcp)
 	ListPrometheusMetricNames.Register(mcp)
 	ListPrometheusLabelNames.Register(mcp)
 	ListPrometheusLabelValues.Register(mcp)
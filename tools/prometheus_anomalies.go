@@ -0,0 +1,385 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/prometheus/common/model"
+	mcpgrafana "mcp-grafana-local"
+)
+
+const (
+	anomalyDetectorSpike      = "spike"
+	anomalyDetectorZScore     = "zscore"
+	anomalyDetectorLevelShift = "level_shift"
+
+	// DefaultSpikeRelativeThreshold is the minimum relative change between
+	// adjacent samples reported as a spike.
+	DefaultSpikeRelativeThreshold = 0.5
+	// DefaultZScoreThreshold is the minimum number of standard deviations
+	// from the series mean reported as an outlier.
+	DefaultZScoreThreshold = 3.0
+	// DefaultLevelShiftWindow is the number of samples compared on each side
+	// of a candidate level shift.
+	DefaultLevelShiftWindow = 5
+	// DefaultLevelShiftThreshold is the minimum difference between the window
+	// means, in pooled standard deviations, reported as a level shift.
+	DefaultLevelShiftThreshold = 3.0
+	// DefaultMaxAnomalyFindings is the maximum number of findings returned if
+	// not specified.
+	DefaultMaxAnomalyFindings = 50
+
+	// minSpikeBaseline avoids division by zero when computing the relative
+	// change from a zero sample.
+	minSpikeBaseline = 1e-6
+)
+
+var allAnomalyDetectors = []string{anomalyDetectorSpike, anomalyDetectorZScore, anomalyDetectorLevelShift}
+
+type DetectMetricAnomaliesParams struct {
+	DatasourceUID          string            `json:"datasourceUid" jsonschema:"required,description=The UID of the Prometheus datasource to query"`
+	Expr                   string            `json:"expr" jsonschema:"required,description=The PromQL expression to analyze"`
+	From                   string            `json:"from" jsonschema:"required,description=Start time (RFC3339\\, epoch ms\\, or relative to now like 'now-1h')"`
+	To                     string            `json:"to" jsonschema:"required,description=End time (RFC3339\\, epoch ms\\, or relative to now like 'now')"`
+	StepSeconds            int               `json:"stepSeconds,omitempty" jsonschema:"description=Optionally\\, the step size in seconds. Chosen automatically from the time range if omitted"`
+	MaxDataPoints          int               `json:"maxDataPoints,omitempty" jsonschema:"description=Optionally\\, the maximum number of points per series when the step is chosen automatically. Defaults to 200"`
+	Variables              map[string]string `json:"variables,omitempty" jsonschema:"description=Optionally\\, values for template variables used in the expression"`
+	Detectors              []string          `json:"detectors,omitempty" jsonschema:"description=The detectors to run: 'spike'\\, 'zscore' and/or 'level_shift'. Defaults to all of them"`
+	Direction              string            `json:"direction,omitempty" jsonschema:"description=Which changes to report: 'up' (increases)\\, 'down' (decreases) or 'both' (default)"`
+	SpikeRelativeThreshold float64           `json:"spikeRelativeThreshold,omitempty" jsonschema:"description=Minimum relative change between adjacent samples for a spike\\, computed as (current - previous) / max(|previous|\\, 1e-6). Defaults to 0.5 (50%)"`
+	SpikeAbsoluteThreshold float64           `json:"spikeAbsoluteThreshold,omitempty" jsonschema:"description=Minimum absolute change between adjacent samples for a spike. Defaults to 0 (no minimum)"`
+	ZScoreThreshold        float64           `json:"zScoreThreshold,omitempty" jsonschema:"description=Minimum number of standard deviations from the series mean for a z-score outlier. Defaults to 3"`
+	LevelShiftWindow       int               `json:"levelShiftWindow,omitempty" jsonschema:"description=Number of samples compared before and after a candidate level shift. Defaults to 5"`
+	LevelShiftThreshold    float64           `json:"levelShiftThreshold,omitempty" jsonschema:"description=Minimum difference between the means before and after a level shift\\, in pooled standard deviations. Defaults to 3"`
+	MaxFindings            int               `json:"maxFindings,omitempty" jsonschema:"description=The maximum number of findings to return. Defaults to 50"`
+	IncludeLink            bool              `json:"includeLink,omitempty" jsonschema:"description=If true\\, also return a link to the analyzed query in Grafana Explore"`
+}
+
+func (p DetectMetricAnomaliesParams) validate() error {
+	for _, d := range p.Detectors {
+		if !slices.Contains(allAnomalyDetectors, d) {
+			return fmt.Errorf("invalid detector: %s, must be one of %v", d, allAnomalyDetectors)
+		}
+	}
+	switch p.Direction {
+	case "", "up", "down", "both":
+	default:
+		return fmt.Errorf("invalid direction: %s, must be 'up', 'down' or 'both'", p.Direction)
+	}
+	if p.SpikeRelativeThreshold < 0 || p.SpikeAbsoluteThreshold < 0 || p.ZScoreThreshold < 0 || p.LevelShiftThreshold < 0 {
+		return fmt.Errorf("thresholds must not be negative")
+	}
+	if p.LevelShiftWindow < 0 {
+		return fmt.Errorf("invalid levelShiftWindow: %d, must not be negative", p.LevelShiftWindow)
+	}
+	if p.MaxFindings < 0 {
+		return fmt.Errorf("invalid maxFindings: %d, must not be negative", p.MaxFindings)
+	}
+	return nil
+}
+
+// anomalyDetectorConfig holds the detector settings with defaults applied.
+type anomalyDetectorConfig struct {
+	detectors              []string
+	direction              string
+	spikeRelativeThreshold float64
+	spikeAbsoluteThreshold float64
+	zScoreThreshold        float64
+	levelShiftWindow       int
+	levelShiftThreshold    float64
+}
+
+func (p DetectMetricAnomaliesParams) config() anomalyDetectorConfig {
+	cfg := anomalyDetectorConfig{
+		detectors:              p.Detectors,
+		direction:              p.Direction,
+		spikeRelativeThreshold: p.SpikeRelativeThreshold,
+		spikeAbsoluteThreshold: p.SpikeAbsoluteThreshold,
+		zScoreThreshold:        p.ZScoreThreshold,
+		levelShiftWindow:       p.LevelShiftWindow,
+		levelShiftThreshold:    p.LevelShiftThreshold,
+	}
+	if len(cfg.detectors) == 0 {
+		cfg.detectors = allAnomalyDetectors
+	}
+	if cfg.direction == "" {
+		cfg.direction = "both"
+	}
+	if cfg.spikeRelativeThreshold == 0 {
+		cfg.spikeRelativeThreshold = DefaultSpikeRelativeThreshold
+	}
+	if cfg.zScoreThreshold == 0 {
+		cfg.zScoreThreshold = DefaultZScoreThreshold
+	}
+	if cfg.levelShiftWindow == 0 {
+		cfg.levelShiftWindow = DefaultLevelShiftWindow
+	}
+	if cfg.levelShiftThreshold == 0 {
+		cfg.levelShiftThreshold = DefaultLevelShiftThreshold
+	}
+	return cfg
+}
+
+// anomalyFinding describes a single anomaly found in a series.
+//
+// For spikes, Start and End are the timestamps of the two adjacent samples and
+// Before and After their values. For level shifts, Before and After are the
+// means of the windows ending at Start and starting at End. For z-score
+// outliers, Start and End are the timestamp of the outlier, Before is the
+// series mean and After the outlier value.
+type anomalyFinding struct {
+	Detector      string            `json:"detector"`
+	Labels        map[string]string `json:"labels"`
+	Start         string            `json:"start"`
+	End           string            `json:"end"`
+	Before        float64           `json:"before"`
+	After         float64           `json:"after"`
+	Delta         float64           `json:"delta"`
+	RelativeDelta float64           `json:"relativeDelta"`
+	// Score is the z-score of an outlier, or the difference between the
+	// window means in pooled standard deviations for a level shift. It is
+	// omitted for level shifts between two perfectly flat windows.
+	Score float64 `json:"score,omitempty"`
+}
+
+type anomalyDetectionResult struct {
+	SeriesAnalyzed int              `json:"seriesAnalyzed"`
+	Findings       []anomalyFinding `json:"findings"`
+	// OmittedFindings is the number of findings dropped because of maxFindings.
+	OmittedFindings int    `json:"omittedFindings,omitempty"`
+	Link            string `json:"link,omitempty"`
+}
+
+func detectMetricAnomalies(ctx context.Context, args DetectMetricAnomaliesParams) (*anomalyDetectionResult, error) {
+	if err := args.validate(); err != nil {
+		return nil, fmt.Errorf("detect metric anomalies: %w", err)
+	}
+
+	query := QueryPrometheusParams{
+		DatasourceUID: args.DatasourceUID,
+		Expr:          args.Expr,
+		From:          args.From,
+		To:            args.To,
+		StepSeconds:   args.StepSeconds,
+		MaxDataPoints: args.MaxDataPoints,
+		QueryType:     "range",
+		Variables:     args.Variables,
+	}
+	result, err := runPrometheusQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	matrix, ok := result.(model.Matrix)
+	if !ok {
+		return nil, fmt.Errorf("detect metric anomalies: expected a range vector result, got %s", result.Type())
+	}
+
+	maxFindings := args.MaxFindings
+	if maxFindings == 0 {
+		maxFindings = DefaultMaxAnomalyFindings
+	}
+
+	findings := detectAnomalies(matrix, args.config())
+	out := &anomalyDetectionResult{
+		SeriesAnalyzed: len(matrix),
+		Findings:       findings,
+	}
+	if len(findings) > maxFindings {
+		out.Findings = findings[:maxFindings]
+		out.OmittedFindings = len(findings) - maxFindings
+	}
+	if args.IncludeLink {
+		out.Link = prometheusExploreLink(ctx, query)
+	}
+	return out, nil
+}
+
+// detectAnomalies runs the configured detectors over every series in the
+// matrix, returning the findings ordered by start time.
+func detectAnomalies(matrix model.Matrix, cfg anomalyDetectorConfig) []anomalyFinding {
+	findings := []anomalyFinding{}
+	for _, stream := range matrix {
+		points := make([]model.SamplePair, 0, len(stream.Values))
+		for _, p := range stream.Values {
+			v := float64(p.Value)
+			if !math.IsNaN(v) && !math.IsInf(v, 0) {
+				points = append(points, p)
+			}
+		}
+		lbls := make(map[string]string, len(stream.Metric))
+		for k, v := range stream.Metric {
+			lbls[string(k)] = string(v)
+		}
+
+		var series []anomalyFinding
+		for _, d := range cfg.detectors {
+			switch d {
+			case anomalyDetectorSpike:
+				series = append(series, detectSpikes(points, cfg)...)
+			case anomalyDetectorZScore:
+				series = append(series, detectZScoreOutliers(points, cfg)...)
+			case anomalyDetectorLevelShift:
+				series = append(series, detectLevelShifts(points, cfg)...)
+			}
+		}
+		for i := range series {
+			series[i].Labels = lbls
+		}
+		findings = append(findings, series...)
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Start < findings[j].Start
+	})
+	return findings
+}
+
+// matchesDirection reports whether a change of delta should be reported.
+func (cfg anomalyDetectorConfig) matchesDirection(delta float64) bool {
+	switch cfg.direction {
+	case "up":
+		return delta > 0
+	case "down":
+		return delta < 0
+	default:
+		return delta != 0
+	}
+}
+
+func detectSpikes(points []model.SamplePair, cfg anomalyDetectorConfig) []anomalyFinding {
+	var findings []anomalyFinding
+	for i := 1; i < len(points); i++ {
+		before, after := float64(points[i-1].Value), float64(points[i].Value)
+		delta := after - before
+		relative := delta / math.Max(math.Abs(before), minSpikeBaseline)
+		if !cfg.matchesDirection(delta) ||
+			math.Abs(relative) < cfg.spikeRelativeThreshold ||
+			math.Abs(delta) < cfg.spikeAbsoluteThreshold {
+			continue
+		}
+		findings = append(findings, newAnomalyFinding(anomalyDetectorSpike, points[i-1].Timestamp, points[i].Timestamp, before, after, 0))
+	}
+	return findings
+}
+
+func detectZScoreOutliers(points []model.SamplePair, cfg anomalyDetectorConfig) []anomalyFinding {
+	if len(points) < 3 {
+		return nil
+	}
+	values := sampleValues(points)
+	mean, stddev := meanStddev(values)
+	if stddev == 0 {
+		return nil
+	}
+
+	var findings []anomalyFinding
+	for i, v := range values {
+		z := (v - mean) / stddev
+		if !cfg.matchesDirection(z) || math.Abs(z) < cfg.zScoreThreshold {
+			continue
+		}
+		findings = append(findings, newAnomalyFinding(anomalyDetectorZScore, points[i].Timestamp, points[i].Timestamp, mean, v, z))
+	}
+	return findings
+}
+
+func detectLevelShifts(points []model.SamplePair, cfg anomalyDetectorConfig) []anomalyFinding {
+	w := cfg.levelShiftWindow
+	if len(points) < 2*w {
+		return nil
+	}
+	values := sampleValues(points)
+
+	// score returns the difference between the window means around i, in
+	// pooled standard deviations. A perfectly clean step with no noise has
+	// an infinite score.
+	score := func(i int) (float64, float64, float64) {
+		beforeMean, beforeStddev := meanStddev(values[i-w : i])
+		afterMean, afterStddev := meanStddev(values[i : i+w])
+		delta := afterMean - beforeMean
+		pooled := math.Sqrt((beforeStddev*beforeStddev + afterStddev*afterStddev) / 2)
+		if pooled == 0 {
+			if delta == 0 {
+				return 0, beforeMean, afterMean
+			}
+			return math.Inf(1), beforeMean, afterMean
+		}
+		return math.Abs(delta) / pooled, beforeMean, afterMean
+	}
+
+	var findings []anomalyFinding
+	for i := w; i <= len(values)-w; i++ {
+		s, beforeMean, afterMean := score(i)
+		if s < cfg.levelShiftThreshold || !cfg.matchesDirection(afterMean-beforeMean) {
+			continue
+		}
+		// Neighbouring positions see the same shift, so only report the
+		// strongest one within a window.
+		best := i
+		for j := i + 1; j < i+w && j <= len(values)-w; j++ {
+			if sj, _, _ := score(j); sj > s {
+				s, best = sj, j
+			}
+		}
+		_, beforeMean, afterMean = score(best)
+		if math.IsInf(s, 0) {
+			s = 0
+		}
+		findings = append(findings, newAnomalyFinding(anomalyDetectorLevelShift, points[best-1].Timestamp, points[best].Timestamp, beforeMean, afterMean, s))
+		i = best + w - 1
+	}
+	return findings
+}
+
+func newAnomalyFinding(detector string, start, end model.Time, before, after, score float64) anomalyFinding {
+	delta := after - before
+	return anomalyFinding{
+		Detector:      detector,
+		Start:         start.Time().UTC().Format(time.RFC3339),
+		End:           end.Time().UTC().Format(time.RFC3339),
+		Before:        before,
+		After:         after,
+		Delta:         delta,
+		RelativeDelta: delta / math.Max(math.Abs(before), minSpikeBaseline),
+		Score:         score,
+	}
+}
+
+func sampleValues(points []model.SamplePair) []float64 {
+	values := make([]float64, len(points))
+	for i, p := range points {
+		values[i] = float64(p.Value)
+	}
+	return values
+}
+
+// meanStddev returns the mean and population standard deviation of values.
+func meanStddev(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	var sq float64
+	for _, v := range values {
+		sq += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(sq / float64(len(values)))
+}
+
+var DetectMetricAnomalies = mcpgrafana.MustTool(
+	"detect_metric_anomalies",
+	"Run a PromQL range query and detect anomalies in every returned series, so that spikes do not have to be computed by hand. Supports three detectors: 'spike' (relative change between adjacent samples of at least spikeRelativeThreshold and an absolute change of at least spikeAbsoluteThreshold), 'zscore' (samples more than zScoreThreshold standard deviations from the series mean) and 'level_shift' (a sustained change of the mean over levelShiftWindow samples). Returns each finding with the series labels, start and end timestamps, values before and after, and the absolute and relative deltas. Set includeLink to true to also get a link opening the query in Grafana Explore.",
+	detectMetricAnomalies,
+	mcp.WithTitleAnnotation("Detect metric anomalies"),
+	mcp.WithIdempotentHintAnnotation(true),
+	mcp.WithReadOnlyHintAnnotation(true),
+)
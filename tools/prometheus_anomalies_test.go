@@ -0,0 +1,107 @@
+//go:build unit
+// +build unit
+
+package tools
+
+import (
+	"math"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectAnomalies(t *testing.T) {
+	t.Run("spike", func(t *testing.T) {
+		cfg := DetectMetricAnomaliesParams{
+			Detectors:              []string{"spike"},
+			Direction:              "up",
+			SpikeAbsoluteThreshold: 10,
+		}.config()
+		matrix := model.Matrix{sampleStream("a", 10, 12, 30, 31, 5, 6)}
+
+		findings := detectAnomalies(matrix, cfg)
+		require.Len(t, findings, 1)
+		f := findings[0]
+		assert.Equal(t, "spike", f.Detector)
+		assert.Equal(t, "a", f.Labels["instance"])
+		assert.Equal(t, "1970-01-01T00:01:00Z", f.Start)
+		assert.Equal(t, "1970-01-01T00:02:00Z", f.End)
+		assert.Equal(t, 12.0, f.Before)
+		assert.Equal(t, 30.0, f.After)
+		assert.Equal(t, 18.0, f.Delta)
+		assert.InDelta(t, 1.5, f.RelativeDelta, 1e-9)
+	})
+
+	t.Run("spike in both directions", func(t *testing.T) {
+		cfg := DetectMetricAnomaliesParams{Detectors: []string{"spike"}}.config()
+		findings := detectAnomalies(model.Matrix{sampleStream("a", 10, 12, 30, 31, 5, 6)}, cfg)
+		require.Len(t, findings, 2)
+		assert.Equal(t, 30.0, findings[0].After)
+		assert.Equal(t, 5.0, findings[1].After)
+		assert.Less(t, findings[1].Delta, 0.0)
+	})
+
+	t.Run("spike from zero", func(t *testing.T) {
+		cfg := DetectMetricAnomaliesParams{Detectors: []string{"spike"}}.config()
+		findings := detectAnomalies(model.Matrix{sampleStream("a", 0, 0, 1)}, cfg)
+		require.Len(t, findings, 1)
+		assert.Equal(t, 1.0, findings[0].After)
+	})
+
+	t.Run("zscore", func(t *testing.T) {
+		cfg := DetectMetricAnomaliesParams{Detectors: []string{"zscore"}}.config()
+		values := []float64{}
+		for i := 0; i < 20; i++ {
+			values = append(values, 10+float64(i%2))
+		}
+		values[12] = 100
+		findings := detectAnomalies(model.Matrix{sampleStream("a", values...)}, cfg)
+		require.Len(t, findings, 1)
+		f := findings[0]
+		assert.Equal(t, "zscore", f.Detector)
+		assert.Equal(t, f.Start, f.End)
+		assert.Equal(t, "1970-01-01T00:12:00Z", f.Start)
+		assert.Equal(t, 100.0, f.After)
+		assert.Greater(t, f.Score, 3.0)
+	})
+
+	t.Run("level shift", func(t *testing.T) {
+		cfg := DetectMetricAnomaliesParams{Detectors: []string{"level_shift"}}.config()
+		values := []float64{10, 11, 10, 11, 10, 11, 10, 11, 50, 51, 50, 51, 50, 51, 50, 51}
+		findings := detectAnomalies(model.Matrix{sampleStream("a", values...)}, cfg)
+		require.Len(t, findings, 1)
+		f := findings[0]
+		assert.Equal(t, "level_shift", f.Detector)
+		assert.Equal(t, "1970-01-01T00:07:00Z", f.Start)
+		assert.Equal(t, "1970-01-01T00:08:00Z", f.End)
+		assert.InDelta(t, 10.6, f.Before, 1e-9)
+		assert.InDelta(t, 50.4, f.After, 1e-9)
+	})
+
+	t.Run("non-finite samples are skipped", func(t *testing.T) {
+		cfg := DetectMetricAnomaliesParams{Detectors: []string{"spike"}}.config()
+		findings := detectAnomalies(model.Matrix{sampleStream("a", 10, math.NaN(), 10, math.Inf(1), 10)}, cfg)
+		assert.Empty(t, findings)
+	})
+
+	t.Run("findings are ordered by time across series", func(t *testing.T) {
+		cfg := DetectMetricAnomaliesParams{Detectors: []string{"spike"}}.config()
+		findings := detectAnomalies(model.Matrix{
+			sampleStream("late", 1, 1, 1, 5),
+			sampleStream("early", 1, 5, 5, 5),
+		}, cfg)
+		require.Len(t, findings, 2)
+		assert.Equal(t, "early", findings[0].Labels["instance"])
+		assert.Equal(t, "late", findings[1].Labels["instance"])
+	})
+}
+
+func TestDetectMetricAnomaliesParamsValidate(t *testing.T) {
+	assert.NoError(t, DetectMetricAnomaliesParams{}.validate())
+	assert.Error(t, DetectMetricAnomaliesParams{Detectors: []string{"unknown"}}.validate())
+	assert.Error(t, DetectMetricAnomaliesParams{Direction: "sideways"}.validate())
+	assert.Error(t, DetectMetricAnomaliesParams{ZScoreThreshold: -1}.validate())
+	assert.Error(t, DetectMetricAnomaliesParams{MaxFindings: -1}.validate())
+}
@@ -0,0 +1,278 @@
+package tools
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	mcpgrafana "mcp-grafana-local"
+)
+
+const (
+	// DefaultCardinalityLimit is the number of entries of each cardinality
+	// ranking returned by default.
+	DefaultCardinalityLimit = 10
+
+	// DefaultSeriesCountLimit is the number of series count_prometheus_series
+	// fetches by default before it stops counting.
+	DefaultSeriesCountLimit = 100000
+)
+
+type GetPrometheusCardinalityParams struct {
+	DatasourceUID string `json:"datasourceUid" jsonschema:"required,description=The UID of the Prometheus datasource"`
+	Limit         int    `json:"limit,omitempty" jsonschema:"description=Optionally\\, the number of entries of each ranking. Defaults to 10"`
+}
+
+// cardinalityStat is an entry of a cardinality ranking. Percent is the share
+// of all series, for series counts.
+type cardinalityStat struct {
+	Name    string  `json:"name"`
+	Value   uint64  `json:"value"`
+	Percent float64 `json:"percent,omitempty"`
+}
+
+type cardinalityHeadStats struct {
+	NumSeries     int    `json:"numSeries"`
+	NumLabelPairs int    `json:"numLabelPairs"`
+	ChunkCount    int    `json:"chunkCount"`
+	MinTime       string `json:"minTime,omitempty"`
+	MaxTime       string `json:"maxTime,omitempty"`
+}
+
+type prometheusCardinality struct {
+	HeadStats                   cardinalityHeadStats `json:"headStats"`
+	SeriesCountByMetricName     []cardinalityStat    `json:"seriesCountByMetricName"`
+	LabelValueCountByLabelName  []cardinalityStat    `json:"labelValueCountByLabelName"`
+	MemoryInBytesByLabelName    []cardinalityStat    `json:"memoryInBytesByLabelName"`
+	SeriesCountByLabelValuePair []cardinalityStat    `json:"seriesCountByLabelValuePair"`
+}
+
+func getPrometheusCardinality(ctx context.Context, args GetPrometheusCardinalityParams) (*prometheusCardinality, error) {
+	if args.Limit < 0 {
+		return nil, fmt.Errorf("invalid limit: %d, must not be negative", args.Limit)
+	}
+	limit := args.Limit
+	if limit == 0 {
+		limit = DefaultCardinalityLimit
+	}
+
+	promClient, err := promClientFromContext(ctx, args.DatasourceUID)
+	if err != nil {
+		return nil, fmt.Errorf("getting Prometheus client: %w", err)
+	}
+	result, err := promClient.TSDB(ctx, promv1.WithLimit(uint64(limit)))
+	if err != nil {
+		return nil, fmt.Errorf("getting Prometheus TSDB status: %w", err)
+	}
+	return summarizeTSDBStatus(result, limit), nil
+}
+
+var GetPrometheusCardinality = mcpgrafana.MustTool(
+	"get_prometheus_cardinality",
+	"Get the cardinality statistics of the head block of a Prometheus datasource, i.e. roughly the last two hours, from its TSDB status: the total number of series, label pairs and chunks, and the top entries by series count per metric name, by number of values per label name, by memory used per label name and by series count per label=value pair. Series counts include their percentage of all series. Use this to find the cause of a cardinality blowup, then count_prometheus_series to break down the series of a metric or label.",
+	getPrometheusCardinality,
+	mcp.WithTitleAnnotation("Get Prometheus cardinality"),
+	mcp.WithIdempotentHintAnnotation(true),
+	mcp.WithReadOnlyHintAnnotation(true),
+)
+
+// summarizeTSDBStatus converts the TSDB status to the cardinality rankings,
+// keeping at most limit entries of each. Older Prometheus versions ignore
+// the limit parameter, so it is applied here too.
+func summarizeTSDBStatus(result promv1.TSDBResult, limit int) *prometheusCardinality {
+	head := result.HeadStats
+	cardinality := &prometheusCardinality{
+		HeadStats: cardinalityHeadStats{
+			NumSeries:     head.NumSeries,
+			NumLabelPairs: head.NumLabelPairs,
+			ChunkCount:    head.ChunkCount,
+		},
+		SeriesCountByMetricName:     cardinalityStats(result.SeriesCountByMetricName, limit, head.NumSeries),
+		LabelValueCountByLabelName:  cardinalityStats(result.LabelValueCountByLabelName, limit, 0),
+		MemoryInBytesByLabelName:    cardinalityStats(result.MemoryInBytesByLabelName, limit, 0),
+		SeriesCountByLabelValuePair: cardinalityStats(result.SeriesCountByLabelValuePair, limit, head.NumSeries),
+	}
+	// The times are math.MaxInt64 and math.MinInt64 for an empty head.
+	if head.NumSeries > 0 {
+		cardinality.HeadStats.MinTime = time.UnixMilli(int64(head.MinTime)).UTC().Format(time.RFC3339)
+		cardinality.HeadStats.MaxTime = time.UnixMilli(int64(head.MaxTime)).UTC().Format(time.RFC3339)
+	}
+	return cardinality
+}
+
+// cardinalityStats returns the top entries of a ranking, with their
+// percentage of total if it is set.
+func cardinalityStats(stats []promv1.Stat, limit, total int) []cardinalityStat {
+	result := make([]cardinalityStat, 0, min(len(stats), limit))
+	for _, s := range stats {
+		stat := cardinalityStat{Name: s.Name, Value: s.Value}
+		if total > 0 {
+			stat.Percent = percentOf(int(s.Value), total)
+		}
+		result = append(result, stat)
+	}
+	sortCardinalityStats(result)
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+func sortCardinalityStats(stats []cardinalityStat) {
+	slices.SortStableFunc(stats, func(a, b cardinalityStat) int {
+		return cmp.Or(cmp.Compare(b.Value, a.Value), cmp.Compare(a.Name, b.Name))
+	})
+}
+
+// percentOf returns n as a percentage of total, rounded to two decimals.
+func percentOf(n, total int) float64 {
+	return math.Round(float64(n)/float64(total)*10000) / 100
+}
+
+type CountPrometheusSeriesParams struct {
+	DatasourceUID string   `json:"datasourceUid" jsonschema:"required,description=The UID of the Prometheus datasource"`
+	Selector      string   `json:"selector" jsonschema:"required,description=The series selector to count\\, e.g. 'http_requests_total{job=\"api\"}' or '{job=\"api\"}' for all metrics of a job"`
+	GroupBy       []string `json:"groupBy,omitempty" jsonschema:"description=Optionally\\, label names to break the count down by\\, e.g. ['instance'\\, 'path']"`
+	From          string   `json:"from,omitempty" jsonschema:"description=Optionally\\, the start time (RFC3339\\, epoch ms\\, or relative to now like 'now-1h'). Defaults to 'now-1h'"`
+	To            string   `json:"to,omitempty" jsonschema:"description=Optionally\\, the end time (RFC3339\\, epoch ms\\, or relative to now like 'now'). Defaults to 'now'"`
+	TopN          int      `json:"topN,omitempty" jsonschema:"description=Optionally\\, the number of entries of each breakdown. Defaults to 10"`
+	Limit         int      `json:"limit,omitempty" jsonschema:"description=Optionally\\, the maximum number of series to count. Counting stops there and the result is marked as truncated if there are more. Defaults to 100000"`
+}
+
+func (p CountPrometheusSeriesParams) validate() error {
+	matchers, err := parser.ParseMetricSelector(p.Selector)
+	if err != nil {
+		return fmt.Errorf("invalid selector %q: %w", p.Selector, err)
+	}
+	if !slices.ContainsFunc(matchers, func(m *labels.Matcher) bool { return !m.Matches("") }) {
+		return fmt.Errorf("invalid selector %q: it must contain a matcher that doesn't match empty values, such as a metric name", p.Selector)
+	}
+	if p.TopN < 0 {
+		return fmt.Errorf("invalid topN: %d, must not be negative", p.TopN)
+	}
+	if p.Limit < 0 {
+		return fmt.Errorf("invalid limit: %d, must not be negative", p.Limit)
+	}
+	return nil
+}
+
+type seriesCount struct {
+	Selector string `json:"selector"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Count    int    `json:"count"`
+	// Truncated is set if there are more series than the limit, which were
+	// not counted.
+	Truncated bool              `json:"truncated,omitempty"`
+	ByMetric  []cardinalityStat `json:"byMetric"`
+	// ByLabel breaks the count down by the values of each groupBy label.
+	// Series without the label are counted under an empty value.
+	ByLabel map[string][]cardinalityStat `json:"byLabel,omitempty"`
+}
+
+func countPrometheusSeries(ctx context.Context, args CountPrometheusSeriesParams) (*seriesCount, error) {
+	if err := args.validate(); err != nil {
+		return nil, err
+	}
+	from, to := args.From, args.To
+	if from == "" {
+		from = "now-1h"
+	}
+	if to == "" {
+		to = "now"
+	}
+	now := time.Now()
+	start, err := parseUserTime(from, now)
+	if err != nil {
+		return nil, fmt.Errorf("parsing from time: %w", err)
+	}
+	end, err := parseUserTime(to, now)
+	if err != nil {
+		return nil, fmt.Errorf("parsing to time: %w", err)
+	}
+	limit := args.Limit
+	if limit == 0 {
+		limit = DefaultSeriesCountLimit
+	}
+
+	promClient, err := promClientFromContext(ctx, args.DatasourceUID)
+	if err != nil {
+		return nil, fmt.Errorf("getting Prometheus client: %w", err)
+	}
+	// Fetch one more series than the limit, to tell whether there are more.
+	series, _, err := promClient.Series(ctx, []string{args.Selector}, start, end, promv1.WithLimit(uint64(limit)+1))
+	if err != nil {
+		return nil, fmt.Errorf("listing Prometheus series: %w", err)
+	}
+
+	result := countSeries(series, args.GroupBy, args.TopN, limit)
+	result.Selector = args.Selector
+	result.From = start.UTC().Format(time.RFC3339)
+	result.To = end.UTC().Format(time.RFC3339)
+	return result, nil
+}
+
+var CountPrometheusSeries = mcpgrafana.MustTool(
+	"count_prometheus_series",
+	"Count the series matching a selector in a Prometheus datasource over a time range (the last hour by default), using the series API rather than a count() query. Returns the number of series, the top metrics by series count and, for each label in groupBy, the top label values by series count with their percentage of the matched series. Use this after get_prometheus_cardinality to find which labels cause a metric's cardinality. Counting stops at limit series, and the result is marked as truncated if there are more.",
+	countPrometheusSeries,
+	mcp.WithTitleAnnotation("Count Prometheus series"),
+	mcp.WithIdempotentHintAnnotation(true),
+	mcp.WithReadOnlyHintAnnotation(true),
+)
+
+// countSeries counts series by metric name and by the values of the groupBy
+// labels, keeping the topN entries of each breakdown. Only the first limit
+// series are counted, and the result is truncated if there are more.
+func countSeries(series []model.LabelSet, groupBy []string, topN, limit int) *seriesCount {
+	if topN == 0 {
+		topN = DefaultCardinalityLimit
+	}
+	truncated := len(series) > limit
+	if truncated {
+		series = series[:limit]
+	}
+	result := &seriesCount{Count: len(series), Truncated: truncated}
+
+	byMetric := map[string]int{}
+	byLabel := map[string]map[string]int{}
+	for _, name := range groupBy {
+		byLabel[name] = map[string]int{}
+	}
+	for _, s := range series {
+		byMetric[string(s[labels.MetricName])]++
+		for _, name := range groupBy {
+			byLabel[name][string(s[model.LabelName(name)])]++
+		}
+	}
+
+	result.ByMetric = topCounts(byMetric, topN, len(series))
+	if len(groupBy) > 0 {
+		result.ByLabel = make(map[string][]cardinalityStat, len(groupBy))
+		for _, name := range groupBy {
+			result.ByLabel[name] = topCounts(byLabel[name], topN, len(series))
+		}
+	}
+	return result
+}
+
+func topCounts(counts map[string]int, topN, total int) []cardinalityStat {
+	stats := make([]cardinalityStat, 0, len(counts))
+	for name, n := range counts {
+		stats = append(stats, cardinalityStat{Name: name, Value: uint64(n), Percent: percentOf(n, total)})
+	}
+	sortCardinalityStats(stats)
+	if len(stats) > topN {
+		stats = stats[:topN]
+	}
+	return stats
+}
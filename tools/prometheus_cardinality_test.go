@@ -0,0 +1,100 @@
+//go:build unit
+// +build unit
+
+package tools
+
+import (
+	"testing"
+
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummarizeTSDBStatus(t *testing.T) {
+	result := summarizeTSDBStatus(promv1.TSDBResult{
+		HeadStats: promv1.TSDBHeadStats{NumSeries: 1000, NumLabelPairs: 300, ChunkCount: 2000, MinTime: 1704067200000, MaxTime: 1704074400000},
+		SeriesCountByMetricName: []promv1.Stat{
+			{Name: "up", Value: 100},
+			{Name: "http_requests_total", Value: 600},
+			{Name: "go_goroutines", Value: 100},
+		},
+		LabelValueCountByLabelName:  []promv1.Stat{{Name: "path", Value: 250}, {Name: "instance", Value: 20}},
+		MemoryInBytesByLabelName:    []promv1.Stat{{Name: "path", Value: 40000}},
+		SeriesCountByLabelValuePair: []promv1.Stat{{Name: "job=api", Value: 700}},
+	}, 2)
+
+	assert.Equal(t, cardinalityHeadStats{
+		NumSeries:     1000,
+		NumLabelPairs: 300,
+		ChunkCount:    2000,
+		MinTime:       "2024-01-01T00:00:00Z",
+		MaxTime:       "2024-01-01T02:00:00Z",
+	}, result.HeadStats)
+	assert.Equal(t, []cardinalityStat{
+		{Name: "http_requests_total", Value: 600, Percent: 60},
+		{Name: "go_goroutines", Value: 100, Percent: 10},
+	}, result.SeriesCountByMetricName)
+	assert.Equal(t, []cardinalityStat{{Name: "path", Value: 250}, {Name: "instance", Value: 20}}, result.LabelValueCountByLabelName)
+	assert.Equal(t, []cardinalityStat{{Name: "path", Value: 40000}}, result.MemoryInBytesByLabelName)
+	assert.Equal(t, []cardinalityStat{{Name: "job=api", Value: 700, Percent: 70}}, result.SeriesCountByLabelValuePair)
+}
+
+func TestSummarizeTSDBStatusEmptyHead(t *testing.T) {
+	result := summarizeTSDBStatus(promv1.TSDBResult{}, 10)
+	assert.Empty(t, result.HeadStats.MinTime)
+	assert.NotNil(t, result.SeriesCountByMetricName)
+}
+
+func TestCountSeries(t *testing.T) {
+	series := []model.LabelSet{
+		{"__name__": "http_requests_total", "path": "/a", "instance": "1"},
+		{"__name__": "http_requests_total", "path": "/b", "instance": "1"},
+		{"__name__": "http_requests_total", "path": "/a", "instance": "2"},
+		{"__name__": "up", "instance": "1"},
+	}
+
+	t.Run("breakdown", func(t *testing.T) {
+		result := countSeries(series, []string{"path"}, 0, 100)
+		assert.Equal(t, 4, result.Count)
+		assert.False(t, result.Truncated)
+		assert.Equal(t, []cardinalityStat{
+			{Name: "http_requests_total", Value: 3, Percent: 75},
+			{Name: "up", Value: 1, Percent: 25},
+		}, result.ByMetric)
+		assert.Equal(t, map[string][]cardinalityStat{
+			"path": {
+				{Name: "/a", Value: 2, Percent: 50},
+				{Name: "", Value: 1, Percent: 25},
+				{Name: "/b", Value: 1, Percent: 25},
+			},
+		}, result.ByLabel)
+	})
+
+	t.Run("top n", func(t *testing.T) {
+		result := countSeries(series, []string{"instance"}, 1, 100)
+		assert.Equal(t, []cardinalityStat{{Name: "1", Value: 3, Percent: 75}}, result.ByLabel["instance"])
+		assert.Len(t, result.ByMetric, 1)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		result := countSeries(series, nil, 0, 3)
+		assert.Equal(t, 3, result.Count)
+		assert.True(t, result.Truncated)
+		assert.Nil(t, result.ByLabel)
+	})
+
+	t.Run("exactly at the limit", func(t *testing.T) {
+		result := countSeries(series, nil, 0, 4)
+		assert.Equal(t, 4, result.Count)
+		assert.False(t, result.Truncated)
+	})
+}
+
+func TestCountPrometheusSeriesParamsValidate(t *testing.T) {
+	require.NoError(t, CountPrometheusSeriesParams{Selector: `{job="api"}`}.validate())
+	assert.Error(t, CountPrometheusSeriesParams{Selector: `sum(up)`}.validate())
+	assert.Error(t, CountPrometheusSeriesParams{Selector: `{job!="api"}`}.validate())
+	assert.Error(t, CountPrometheusSeriesParams{Selector: "up", TopN: -1}.validate())
+}
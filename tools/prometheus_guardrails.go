@@ -0,0 +1,230 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	mcpgrafana "mcp-grafana-local"
+)
+
+// The guardrails checked before Prometheus queries run.
+const (
+	guardrailMaxPoints         = "max-points"
+	guardrailMaxRange          = "max-range"
+	guardrailMaxSeries         = "max-series"
+	guardrailUnboundedSelector = "unbounded-selector"
+)
+
+// QueryGuardrailError is returned for Prometheus queries rejected by the
+// guardrails, before they are sent to Prometheus.
+type QueryGuardrailError struct {
+	// Guardrail is the guardrail rejecting the query, e.g. "max-range".
+	Guardrail string `json:"guardrail"`
+	Message   string `json:"message"`
+	// Suggestions are ways to narrow the query so that it is accepted.
+	Suggestions []string `json:"suggestions"`
+}
+
+func (e *QueryGuardrailError) Error() string {
+	return fmt.Sprintf("query rejected by the %s guardrail: %s. To narrow the query: %s", e.Guardrail, e.Message, strings.Join(e.Suggestions, "; "))
+}
+
+// ErrorDetails returns the error itself, so that tools return its fields as
+// JSON.
+func (e *QueryGuardrailError) ErrorDetails() any {
+	return e
+}
+
+// guardedPrometheusAPI checks queries against the guardrails before running
+// them. The other endpoints are passed through.
+type guardedPrometheusAPI struct {
+	promv1.API
+	guardrails mcpgrafana.PrometheusGuardrails
+}
+
+func (a guardedPrometheusAPI) Query(ctx context.Context, query string, ts time.Time, opts ...promv1.Option) (model.Value, promv1.Warnings, error) {
+	if err := a.check(ctx, query, promv1.Range{Start: ts, End: ts}); err != nil {
+		return nil, nil, err
+	}
+	return a.API.Query(ctx, query, ts, opts...)
+}
+
+func (a guardedPrometheusAPI) QueryRange(ctx context.Context, query string, r promv1.Range, opts ...promv1.Option) (model.Value, promv1.Warnings, error) {
+	if err := a.check(ctx, query, r); err != nil {
+		return nil, nil, err
+	}
+	return a.API.QueryRange(ctx, query, r, opts...)
+}
+
+// check returns a QueryGuardrailError if a query breaks a guardrail. Queries
+// which can't be parsed are left to Prometheus to report.
+func (a guardedPrometheusAPI) check(ctx context.Context, query string, r promv1.Range) error {
+	if err := checkQueryRange(a.guardrails, r); err != nil {
+		return err
+	}
+	expr, err := parser.ParseExpr(query)
+	if err != nil {
+		// The parser itself rejects selectors with only negative matchers.
+		if !a.guardrails.AllowUnboundedSelectors && strings.Contains(err.Error(), "at least one non-empty matcher") {
+			return unboundedSelectorError("")
+		}
+		return nil
+	}
+	if err := checkSelectors(a.guardrails, expr); err != nil {
+		return err
+	}
+	if a.guardrails.MaxSeries > 0 {
+		return a.checkSeriesCount(ctx, expr, r)
+	}
+	return nil
+}
+
+// checkQueryRange checks the time range and resolution of a range query.
+func checkQueryRange(g mcpgrafana.PrometheusGuardrails, r promv1.Range) error {
+	if r.Step <= 0 {
+		return nil
+	}
+	queryRange := r.End.Sub(r.Start)
+	if g.MaxRange > 0 && queryRange > g.MaxRange {
+		return &QueryGuardrailError{
+			Guardrail: guardrailMaxRange,
+			Message:   fmt.Sprintf("the time range of %s is longer than the limit of %s", model.Duration(queryRange), model.Duration(g.MaxRange)),
+			Suggestions: []string{
+				fmt.Sprintf("query at most %s at a time, e.g. from now-%s", model.Duration(g.MaxRange), model.Duration(g.MaxRange)),
+				"query the period of interest only, e.g. around an incident",
+			},
+		}
+	}
+	if points := int(queryRange/r.Step) + 1; g.MaxPointsPerSeries > 0 && points > g.MaxPointsPerSeries {
+		minStep := (queryRange/time.Duration(max(g.MaxPointsPerSeries-1, 1)) + time.Second - 1).Truncate(time.Second)
+		return &QueryGuardrailError{
+			Guardrail: guardrailMaxPoints,
+			Message:   fmt.Sprintf("a step of %s over %s returns %d points per series, more than the limit of %d", model.Duration(r.Step), model.Duration(queryRange), points, g.MaxPointsPerSeries),
+			Suggestions: []string{
+				fmt.Sprintf("use a step of at least %ds", int(minStep.Seconds())),
+				"omit stepSeconds to choose a step automatically",
+				"shorten the time range",
+			},
+		}
+	}
+	return nil
+}
+
+// checkSelectors checks the selectors and ranges of an expression.
+func checkSelectors(g mcpgrafana.PrometheusGuardrails, expr parser.Expr) error {
+	var guardrailErr *QueryGuardrailError
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		if guardrailErr != nil {
+			return nil
+		}
+		var selectorRange time.Duration
+		switch n := node.(type) {
+		case *parser.VectorSelector:
+			if !g.AllowUnboundedSelectors && !hasMetricName(n) {
+				guardrailErr = unboundedSelectorError(n.String())
+			}
+			return nil
+		case *parser.MatrixSelector:
+			selectorRange = n.Range
+		case *parser.SubqueryExpr:
+			selectorRange = n.Range
+		default:
+			return nil
+		}
+		if g.MaxRange > 0 && selectorRange > g.MaxRange {
+			guardrailErr = &QueryGuardrailError{
+				Guardrail: guardrailMaxRange,
+				Message:   fmt.Sprintf("the range [%s] in %s is longer than the limit of %s", model.Duration(selectorRange), node, model.Duration(g.MaxRange)),
+				Suggestions: []string{
+					fmt.Sprintf("use a range of at most %s", model.Duration(g.MaxRange)),
+					"run a range query over the period instead, and aggregate the result",
+				},
+			}
+		}
+		return nil
+	})
+	if guardrailErr != nil {
+		return guardrailErr
+	}
+	return nil
+}
+
+// selectorMetricName returns the metric name a selector matches, given
+// either before the braces or as a __name__ matcher.
+func selectorMetricName(vs *parser.VectorSelector) string {
+	if vs.Name != "" {
+		return vs.Name
+	}
+	for _, m := range vs.LabelMatchers {
+		if m.Name == labels.MetricName && m.Type == labels.MatchEqual && m.Value != "" {
+			return m.Value
+		}
+	}
+	return ""
+}
+
+// hasMetricName reports whether a selector selects a single metric.
+func hasMetricName(vs *parser.VectorSelector) bool {
+	return selectorMetricName(vs) != ""
+}
+
+// unboundedSelectorError returns the error for a selector without a metric
+// name. selector is empty for selectors with only negative matchers, which
+// the parser rejects before they can be shown.
+func unboundedSelectorError(selector string) *QueryGuardrailError {
+	message := "a selector has only negative matchers, so it would select every series of the instance"
+	if selector != "" {
+		message = fmt.Sprintf("the selector %s has no metric name, so it may select every series of the instance", selector)
+	}
+	return &QueryGuardrailError{
+		Guardrail: guardrailUnboundedSelector,
+		Message:   message,
+		Suggestions: []string{
+			"select a single metric by name, e.g. up{job=\"api\"}",
+			"use list_prometheus_metric_names to find metric names, optionally with a regex",
+		},
+	}
+}
+
+// checkSeriesCount counts the series selected by an expression with the
+// series API, stopping once there are more than the limit.
+func (a guardedPrometheusAPI) checkSeriesCount(ctx context.Context, expr parser.Expr, r promv1.Range) error {
+	var selectors []string
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		if vs, ok := node.(*parser.VectorSelector); ok {
+			selector := (&parser.VectorSelector{Name: vs.Name, LabelMatchers: vs.LabelMatchers}).String()
+			if !slices.Contains(selectors, selector) {
+				selectors = append(selectors, selector)
+			}
+		}
+		return nil
+	})
+
+	count := 0
+	for _, selector := range selectors {
+		series, _, err := a.API.Series(ctx, []string{selector}, r.Start, r.End, promv1.WithLimit(uint64(a.guardrails.MaxSeries+1)))
+		if err != nil {
+			return fmt.Errorf("counting series of %s: %w", selector, err)
+		}
+		count += len(series)
+		if count > a.guardrails.MaxSeries {
+			return &QueryGuardrailError{
+				Guardrail: guardrailMaxSeries,
+				Message:   fmt.Sprintf("the query selects more than %d series", a.guardrails.MaxSeries),
+				Suggestions: []string{
+					fmt.Sprintf("add label matchers to %s, e.g. for job or instance", selector),
+					"use list_prometheus_label_values to find the values of a label",
+				},
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+//go:build unit
+// +build unit
+
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	mcpgrafana "mcp-grafana-local"
+)
+
+// fakePrometheusAPI records the queries it runs and returns the given number
+// of series from the series API.
+type fakePrometheusAPI struct {
+	promv1.API
+	series  int
+	queries []string
+}
+
+func (f *fakePrometheusAPI) Query(ctx context.Context, query string, ts time.Time, opts ...promv1.Option) (model.Value, promv1.Warnings, error) {
+	f.queries = append(f.queries, query)
+	return model.Vector{}, nil, nil
+}
+
+func (f *fakePrometheusAPI) QueryRange(ctx context.Context, query string, r promv1.Range, opts ...promv1.Option) (model.Value, promv1.Warnings, error) {
+	f.queries = append(f.queries, query)
+	return model.Matrix{}, nil, nil
+}
+
+func (f *fakePrometheusAPI) Series(ctx context.Context, matches []string, startTime, endTime time.Time, opts ...promv1.Option) ([]model.LabelSet, promv1.Warnings, error) {
+	return make([]model.LabelSet, f.series), nil, nil
+}
+
+func TestGuardedPrometheusAPI(t *testing.T) {
+	ctx := context.Background()
+	end := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name       string
+		guardrails mcpgrafana.PrometheusGuardrails
+		series     int
+		query      string
+		r          promv1.Range
+		guardrail  string
+	}{
+		{
+			name:       "accepted range query",
+			guardrails: mcpgrafana.DefaultPrometheusGuardrails,
+			query:      `rate(http_requests_total{job="api"}[5m])`,
+			r:          promv1.Range{Start: end.Add(-time.Hour), End: end, Step: time.Minute},
+		},
+		{
+			name:       "accepted instant query",
+			guardrails: mcpgrafana.DefaultPrometheusGuardrails,
+			query:      `{__name__="up"}`,
+			r:          promv1.Range{Start: end},
+		},
+		{
+			name:       "all series",
+			guardrails: mcpgrafana.DefaultPrometheusGuardrails,
+			query:      `count({__name__=~".+"})`,
+			r:          promv1.Range{Start: end},
+			guardrail:  guardrailUnboundedSelector,
+		},
+		{
+			name:       "only negative matchers",
+			guardrails: mcpgrafana.DefaultPrometheusGuardrails,
+			query:      `{job!="api"}`,
+			r:          promv1.Range{Start: end},
+			guardrail:  guardrailUnboundedSelector,
+		},
+		{
+			name:       "unbounded selectors allowed",
+			guardrails: mcpgrafana.PrometheusGuardrails{AllowUnboundedSelectors: true},
+			query:      `{job="api"}`,
+			r:          promv1.Range{Start: end},
+		},
+		{
+			name:       "long time range",
+			guardrails: mcpgrafana.PrometheusGuardrails{MaxRange: 7 * 24 * time.Hour},
+			query:      "up",
+			r:          promv1.Range{Start: end.Add(-30 * 24 * time.Hour), End: end, Step: time.Hour},
+			guardrail:  guardrailMaxRange,
+		},
+		{
+			name:       "long range selector",
+			guardrails: mcpgrafana.PrometheusGuardrails{MaxRange: 7 * 24 * time.Hour},
+			query:      "increase(http_requests_total[30d])",
+			r:          promv1.Range{Start: end},
+			guardrail:  guardrailMaxRange,
+		},
+		{
+			name:       "long subquery",
+			guardrails: mcpgrafana.PrometheusGuardrails{MaxRange: 7 * 24 * time.Hour},
+			query:      "max_over_time(up[30d:1h])",
+			r:          promv1.Range{Start: end},
+			guardrail:  guardrailMaxRange,
+		},
+		{
+			name:       "too many points",
+			guardrails: mcpgrafana.PrometheusGuardrails{MaxPointsPerSeries: 1000},
+			query:      "up",
+			r:          promv1.Range{Start: end.Add(-24 * time.Hour), End: end, Step: time.Minute},
+			guardrail:  guardrailMaxPoints,
+		},
+		{
+			name:       "series within limit",
+			guardrails: mcpgrafana.PrometheusGuardrails{MaxSeries: 100},
+			series:     100,
+			query:      "up / up",
+			r:          promv1.Range{Start: end},
+		},
+		{
+			name:       "too many series",
+			guardrails: mcpgrafana.PrometheusGuardrails{MaxSeries: 100},
+			series:     60,
+			query:      "up / process_start_time_seconds",
+			r:          promv1.Range{Start: end},
+			guardrail:  guardrailMaxSeries,
+		},
+		{
+			name:       "parse errors are left to prometheus",
+			guardrails: mcpgrafana.DefaultPrometheusGuardrails,
+			query:      "sum(",
+			r:          promv1.Range{Start: end},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := &fakePrometheusAPI{series: tc.series}
+			api := guardedPrometheusAPI{API: fake, guardrails: tc.guardrails}
+
+			var err error
+			if tc.r.Step == 0 {
+				_, _, err = api.Query(ctx, tc.query, tc.r.Start)
+			} else {
+				_, _, err = api.QueryRange(ctx, tc.query, tc.r)
+			}
+
+			if tc.guardrail == "" {
+				require.NoError(t, err)
+				assert.Equal(t, []string{tc.query}, fake.queries)
+				return
+			}
+			var guardrailErr *QueryGuardrailError
+			require.True(t, errors.As(err, &guardrailErr), "expected a guardrail error, got %v", err)
+			assert.Equal(t, tc.guardrail, guardrailErr.Guardrail)
+			assert.NotEmpty(t, guardrailErr.Suggestions)
+			assert.Empty(t, fake.queries, "rejected queries must not run")
+		})
+	}
+}
+
+func TestQueryGuardrailErrorToolResult(t *testing.T) {
+	tool := mcpgrafana.MustTool("test_tool", "A test tool", func(ctx context.Context, args QueryPrometheusParams) (any, error) {
+		return nil, fmt.Errorf("query: %w", unboundedSelectorError(`{job="api"}`))
+	})
+	result, err := tool.Handler(context.Background(), mcp.CallToolRequest{})
+	require.NoError(t, err)
+	assert.True(t, result.IsError)
+
+	var details QueryGuardrailError
+	require.NoError(t, json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &details))
+	assert.Equal(t, guardrailUnboundedSelector, details.Guardrail)
+	assert.NotEmpty(t, details.Message)
+	assert.NotEmpty(t, details.Suggestions)
+}
+
+func TestQueryGuardrailErrorSuggestsStep(t *testing.T) {
+	err := checkQueryRange(mcpgrafana.PrometheusGuardrails{MaxPointsPerSeries: 1001}, promv1.Range{
+		Start: time.Unix(0, 0),
+		End:   time.Unix(0, 0).Add(24 * time.Hour),
+		Step:  time.Minute,
+	})
+	var guardrailErr *QueryGuardrailError
+	require.True(t, errors.As(err, &guardrailErr))
+	assert.Equal(t, "use a step of at least 87s", guardrailErr.Suggestions[0])
+	assert.Contains(t, err.Error(), "query rejected by the max-points guardrail")
+}
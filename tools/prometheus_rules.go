@@ -0,0 +1,351 @@
+package tools
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+
+	mcpgrafana "mcp-grafana-local"
+)
+
+const (
+	// DefaultListPrometheusRulesLimit is the number of rules returned by
+	// default.
+	DefaultListPrometheusRulesLimit = 100
+
+	// DefaultListPrometheusAlertsLimit is the number of alerts returned by
+	// default.
+	DefaultListPrometheusAlertsLimit = 100
+)
+
+type ListPrometheusRulesParams struct {
+	DatasourceUID  string     `json:"datasourceUid" jsonschema:"required,description=The UID of the Prometheus or Mimir datasource"`
+	Type           string     `json:"type,omitempty" jsonschema:"description=Optionally\\, only return the rules of this type: 'alerting' or 'recording'"`
+	Group          string     `json:"group,omitempty" jsonschema:"description=Optionally\\, only return the rules of the rule group with this name"`
+	State          string     `json:"state,omitempty" jsonschema:"description=Optionally\\, only return the alerting rules in this state: 'firing'\\, 'pending' or 'inactive'"`
+	LabelSelectors []Selector `json:"labelSelectors,omitempty" jsonschema:"description=Optionally\\, a list of matchers to filter the rules by their labels"`
+	Limit          int        `json:"limit,omitempty" jsonschema:"description=Optionally\\, the maximum number of rules to return. Defaults to 100"`
+}
+
+func (p ListPrometheusRulesParams) validate() error {
+	switch promv1.RuleType(p.Type) {
+	case "", promv1.RuleTypeAlerting, promv1.RuleTypeRecording:
+	default:
+		return fmt.Errorf("invalid type: %q, must be one of 'alerting' or 'recording'", p.Type)
+	}
+	if err := validateAlertState(p.State, true); err != nil {
+		return err
+	}
+	if p.State != "" && promv1.RuleType(p.Type) == promv1.RuleTypeRecording {
+		return fmt.Errorf("state can't be used with recording rules")
+	}
+	if p.Limit < 0 {
+		return fmt.Errorf("invalid limit: %d, must not be negative", p.Limit)
+	}
+	return nil
+}
+
+// validateAlertState checks an alert state filter. Rules can be inactive,
+// but active alerts can't.
+func validateAlertState(state string, allowInactive bool) error {
+	switch promv1.AlertState(state) {
+	case "", promv1.AlertStateFiring, promv1.AlertStatePending:
+		return nil
+	case promv1.AlertStateInactive:
+		if allowInactive {
+			return nil
+		}
+	}
+	if allowInactive {
+		return fmt.Errorf("invalid state: %q, must be one of 'firing', 'pending' or 'inactive'", state)
+	}
+	return fmt.Errorf("invalid state: %q, must be one of 'firing' or 'pending'", state)
+}
+
+type prometheusRule struct {
+	Group string `json:"group"`
+	File  string `json:"file,omitempty"`
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Query string `json:"query"`
+	// Duration is the "for" duration of alerting rules.
+	Duration    string            `json:"duration,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// State is the state of alerting rules: firing, pending or inactive.
+	State          string `json:"state,omitempty"`
+	ActiveAlerts   int    `json:"activeAlerts,omitempty"`
+	Health         string `json:"health"`
+	LastError      string `json:"lastError,omitempty"`
+	LastEvaluation string `json:"lastEvaluation,omitempty"`
+}
+
+type prometheusRules struct {
+	// Total is the number of matching rules, which may be more than the
+	// number returned.
+	Total int              `json:"total"`
+	Rules []prometheusRule `json:"rules"`
+}
+
+func listPrometheusRules(ctx context.Context, args ListPrometheusRulesParams) (*prometheusRules, error) {
+	if err := args.validate(); err != nil {
+		return nil, err
+	}
+	limit := args.Limit
+	if limit == 0 {
+		limit = DefaultListPrometheusRulesLimit
+	}
+
+	promClient, err := promClientFromContext(ctx, args.DatasourceUID)
+	if err != nil {
+		return nil, fmt.Errorf("getting Prometheus client: %w", err)
+	}
+	result, err := promClient.Rules(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing Prometheus rules: %w", err)
+	}
+
+	rules, err := filterPrometheusRules(result.Groups, args)
+	if err != nil {
+		return nil, err
+	}
+	total := len(rules)
+	if len(rules) > limit {
+		rules = rules[:limit]
+	}
+	return &prometheusRules{Total: total, Rules: rules}, nil
+}
+
+var ListPrometheusRules = mcpgrafana.MustTool(
+	"list_prometheus_rules",
+	"List the recording and alerting rules evaluated by a Prometheus or Mimir datasource, optionally filtered by type, rule group, state and labels. Each rule has its group, query, labels, annotations, health and last evaluation error, and alerting rules also have their 'for' duration, state and number of active alerts. Unlike list_alert_rules, which only returns Grafana-managed rules, this returns the rules managed by the datasource.",
+	listPrometheusRules,
+	mcp.WithTitleAnnotation("List Prometheus rules"),
+	mcp.WithIdempotentHintAnnotation(true),
+	mcp.WithReadOnlyHintAnnotation(true),
+)
+
+// filterPrometheusRules returns the rules of the groups matching the filters
+// of args, in the order returned by the API.
+func filterPrometheusRules(groups []promv1.RuleGroup, args ListPrometheusRulesParams) ([]prometheusRule, error) {
+	rules := []prometheusRule{}
+	for _, group := range groups {
+		if args.Group != "" && group.Name != args.Group {
+			continue
+		}
+		for _, r := range group.Rules {
+			rule, ok := summarizePrometheusRule(group, r)
+			if !ok {
+				continue
+			}
+			if args.Type != "" && rule.Type != args.Type {
+				continue
+			}
+			if args.State != "" && rule.State != args.State {
+				continue
+			}
+			match, err := matchesLabelSelectors(rule.Labels, args.LabelSelectors)
+			if err != nil {
+				return nil, fmt.Errorf("filtering rules: %w", err)
+			}
+			if match {
+				rules = append(rules, rule)
+			}
+		}
+	}
+	return rules, nil
+}
+
+// summarizePrometheusRule converts a rule of a group, reporting false for
+// rules of an unknown type.
+func summarizePrometheusRule(group promv1.RuleGroup, r any) (prometheusRule, bool) {
+	rule := prometheusRule{Group: group.Name, File: group.File}
+	var lastEvaluation time.Time
+	switch r := r.(type) {
+	case promv1.AlertingRule:
+		rule.Type = string(promv1.RuleTypeAlerting)
+		rule.Name, rule.Query = r.Name, r.Query
+		if r.Duration > 0 {
+			rule.Duration = model.Duration(time.Duration(r.Duration * float64(time.Second))).String()
+		}
+		rule.Labels, rule.Annotations = labelSetMap(r.Labels), labelSetMap(r.Annotations)
+		rule.State, rule.ActiveAlerts = r.State, len(r.Alerts)
+		rule.Health, rule.LastError, lastEvaluation = string(r.Health), r.LastError, r.LastEvaluation
+	case promv1.RecordingRule:
+		rule.Type = string(promv1.RuleTypeRecording)
+		rule.Name, rule.Query = r.Name, r.Query
+		rule.Labels = labelSetMap(r.Labels)
+		rule.Health, rule.LastError, lastEvaluation = string(r.Health), r.LastError, r.LastEvaluation
+	default:
+		return rule, false
+	}
+	if !lastEvaluation.IsZero() {
+		rule.LastEvaluation = lastEvaluation.UTC().Format(time.RFC3339)
+	}
+	return rule, true
+}
+
+// labelSetMap converts a label set to a map, which is nil for an empty set.
+func labelSetMap(ls model.LabelSet) map[string]string {
+	if len(ls) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(ls))
+	for name, value := range ls {
+		m[string(name)] = string(value)
+	}
+	return m
+}
+
+type ListPrometheusAlertsParams struct {
+	DatasourceUID  string     `json:"datasourceUid" jsonschema:"required,description=The UID of the Prometheus or Mimir datasource"`
+	Group          string     `json:"group,omitempty" jsonschema:"description=Optionally\\, only return the alerts of the rules of the rule group with this name"`
+	State          string     `json:"state,omitempty" jsonschema:"description=Optionally\\, only return the alerts in this state: 'firing' or 'pending'"`
+	LabelSelectors []Selector `json:"labelSelectors,omitempty" jsonschema:"description=Optionally\\, a list of matchers to filter the alerts by their labels\\, e.g. alertname or severity"`
+	Limit          int        `json:"limit,omitempty" jsonschema:"description=Optionally\\, the maximum number of alerts to return. Defaults to 100"`
+}
+
+func (p ListPrometheusAlertsParams) validate() error {
+	if err := validateAlertState(p.State, false); err != nil {
+		return err
+	}
+	if p.Limit < 0 {
+		return fmt.Errorf("invalid limit: %d, must not be negative", p.Limit)
+	}
+	return nil
+}
+
+type prometheusAlert struct {
+	AlertName   string            `json:"alertName"`
+	State       string            `json:"state"`
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	ActiveAt    string            `json:"activeAt,omitempty"`
+	ActiveFor   string            `json:"activeFor,omitempty"`
+	Value       string            `json:"value,omitempty"`
+}
+
+type prometheusAlerts struct {
+	// Total is the number of matching alerts, which may be more than the
+	// number returned.
+	Total  int               `json:"total"`
+	Alerts []prometheusAlert `json:"alerts"`
+}
+
+func listPrometheusAlerts(ctx context.Context, args ListPrometheusAlertsParams) (*prometheusAlerts, error) {
+	if err := args.validate(); err != nil {
+		return nil, err
+	}
+	limit := args.Limit
+	if limit == 0 {
+		limit = DefaultListPrometheusAlertsLimit
+	}
+
+	promClient, err := promClientFromContext(ctx, args.DatasourceUID)
+	if err != nil {
+		return nil, fmt.Errorf("getting Prometheus client: %w", err)
+	}
+
+	// The alerts endpoint doesn't return the groups of alerts, so the alerts
+	// of a group are read from its rules instead.
+	var active []promv1.Alert
+	if args.Group != "" {
+		result, err := promClient.Rules(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing Prometheus rules: %w", err)
+		}
+		active = groupAlerts(result.Groups, args.Group)
+	} else {
+		result, err := promClient.Alerts(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing Prometheus alerts: %w", err)
+		}
+		active = result.Alerts
+	}
+
+	alerts, err := filterPrometheusAlerts(active, args.State, args.LabelSelectors, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	total := len(alerts)
+	if len(alerts) > limit {
+		alerts = alerts[:limit]
+	}
+	return &prometheusAlerts{Total: total, Alerts: alerts}, nil
+}
+
+var ListPrometheusAlerts = mcpgrafana.MustTool(
+	"list_prometheus_alerts",
+	"List the active alerts of the alerting rules evaluated by a Prometheus or Mimir datasource, optionally filtered by rule group, state ('firing' or 'pending') and labels. Each alert has its name, state, labels, annotations, value and since when it is active. Firing alerts are listed first, oldest first. Unlike the Grafana alerting tools, this returns the alerts of the rules managed by the datasource.",
+	listPrometheusAlerts,
+	mcp.WithTitleAnnotation("List Prometheus alerts"),
+	mcp.WithIdempotentHintAnnotation(true),
+	mcp.WithReadOnlyHintAnnotation(true),
+)
+
+// groupAlerts returns the active alerts of the alerting rules of a group.
+func groupAlerts(groups []promv1.RuleGroup, name string) []promv1.Alert {
+	var alerts []promv1.Alert
+	for _, group := range groups {
+		if group.Name != name {
+			continue
+		}
+		for _, r := range group.Rules {
+			if rule, ok := r.(promv1.AlertingRule); ok {
+				for _, alert := range rule.Alerts {
+					alerts = append(alerts, *alert)
+				}
+			}
+		}
+	}
+	return alerts
+}
+
+// filterPrometheusAlerts returns the alerts matching the filters, firing
+// alerts first and then by how long they have been active.
+func filterPrometheusAlerts(active []promv1.Alert, state string, selectors []Selector, now time.Time) ([]prometheusAlert, error) {
+	slices.SortStableFunc(active, func(a, b promv1.Alert) int {
+		return cmp.Or(
+			cmp.Compare(alertStateOrder(a.State), alertStateOrder(b.State)),
+			a.ActiveAt.Compare(b.ActiveAt),
+		)
+	})
+	alerts := []prometheusAlert{}
+	for _, a := range active {
+		if state != "" && string(a.State) != state {
+			continue
+		}
+		alert := prometheusAlert{
+			AlertName:   string(a.Labels[model.AlertNameLabel]),
+			State:       string(a.State),
+			Labels:      labelSetMap(a.Labels),
+			Annotations: labelSetMap(a.Annotations),
+			Value:       a.Value,
+		}
+		if !a.ActiveAt.IsZero() {
+			alert.ActiveAt = a.ActiveAt.UTC().Format(time.RFC3339)
+			alert.ActiveFor = model.Duration(max(now.Sub(a.ActiveAt), 0).Truncate(time.Second)).String()
+		}
+		match, err := matchesLabelSelectors(alert.Labels, selectors)
+		if err != nil {
+			return nil, fmt.Errorf("filtering alerts: %w", err)
+		}
+		if match {
+			alerts = append(alerts, alert)
+		}
+	}
+	return alerts, nil
+}
+
+func alertStateOrder(state promv1.AlertState) int {
+	if state == promv1.AlertStateFiring {
+		return 0
+	}
+	return 1
+}
@@ -0,0 +1,183 @@
+//go:build unit
+// +build unit
+
+package tools
+
+import (
+	"testing"
+	"time"
+
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testRuleGroups(now time.Time) []promv1.RuleGroup {
+	firing := &promv1.Alert{
+		ActiveAt: now.Add(-time.Hour),
+		Labels:   model.LabelSet{"alertname": "HighErrorRate", "severity": "critical", "job": "api"},
+		State:    promv1.AlertStateFiring,
+		Value:    "0.2",
+	}
+	pending := &promv1.Alert{
+		ActiveAt: now.Add(-time.Minute),
+		Labels:   model.LabelSet{"alertname": "HighLatency", "severity": "warning", "job": "api"},
+		State:    promv1.AlertStatePending,
+		Value:    "1.5",
+	}
+	return []promv1.RuleGroup{
+		{
+			Name: "api",
+			File: "/etc/prometheus/rules/api.yml",
+			Rules: promv1.Rules{
+				promv1.RecordingRule{
+					Name:           "job:http_requests:rate5m",
+					Query:          "sum by (job) (rate(http_requests_total[5m]))",
+					Health:         promv1.RuleHealthGood,
+					LastEvaluation: now.Add(-10 * time.Second),
+				},
+				promv1.AlertingRule{
+					Name:        "HighErrorRate",
+					Query:       "job:http_errors:ratio5m > 0.1",
+					Duration:    300,
+					Labels:      model.LabelSet{"severity": "critical"},
+					Annotations: model.LabelSet{"summary": "High error rate"},
+					Alerts:      []*promv1.Alert{firing},
+					Health:      promv1.RuleHealthGood,
+					State:       "firing",
+				},
+				promv1.AlertingRule{
+					Name:   "HighLatency",
+					Query:  "job:http_latency:p99 > 1",
+					Labels: model.LabelSet{"severity": "warning"},
+					Alerts: []*promv1.Alert{pending},
+					Health: promv1.RuleHealthGood,
+					State:  "pending",
+				},
+			},
+		},
+		{
+			Name: "node",
+			Rules: promv1.Rules{
+				promv1.AlertingRule{
+					Name:      "NodeDown",
+					Query:     "up{job=\"node\"} == 0",
+					Labels:    model.LabelSet{"severity": "critical"},
+					Health:    promv1.RuleHealthBad,
+					LastError: "query timed out",
+					State:     "inactive",
+				},
+			},
+		},
+	}
+}
+
+func TestListPrometheusRulesParamsValidate(t *testing.T) {
+	assert.NoError(t, ListPrometheusRulesParams{Type: "alerting", State: "inactive"}.validate())
+	assert.Error(t, ListPrometheusRulesParams{Type: "record"}.validate())
+	assert.Error(t, ListPrometheusRulesParams{State: "resolved"}.validate())
+	assert.Error(t, ListPrometheusRulesParams{Type: "recording", State: "firing"}.validate())
+	assert.Error(t, ListPrometheusRulesParams{Limit: -1}.validate())
+
+	assert.NoError(t, ListPrometheusAlertsParams{State: "pending"}.validate())
+	assert.Error(t, ListPrometheusAlertsParams{State: "inactive"}.validate())
+}
+
+func TestFilterPrometheusRules(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	groups := testRuleGroups(now)
+
+	t.Run("no filters", func(t *testing.T) {
+		rules, err := filterPrometheusRules(groups, ListPrometheusRulesParams{})
+		require.NoError(t, err)
+		require.Len(t, rules, 4)
+		assert.Equal(t, prometheusRule{
+			Group:          "api",
+			File:           "/etc/prometheus/rules/api.yml",
+			Type:           "recording",
+			Name:           "job:http_requests:rate5m",
+			Query:          "sum by (job) (rate(http_requests_total[5m]))",
+			Health:         "ok",
+			LastEvaluation: "2024-01-01T11:59:50Z",
+		}, rules[0])
+		assert.Equal(t, prometheusRule{
+			Group:        "api",
+			File:         "/etc/prometheus/rules/api.yml",
+			Type:         "alerting",
+			Name:         "HighErrorRate",
+			Query:        "job:http_errors:ratio5m > 0.1",
+			Duration:     "5m",
+			Labels:       map[string]string{"severity": "critical"},
+			Annotations:  map[string]string{"summary": "High error rate"},
+			State:        "firing",
+			ActiveAlerts: 1,
+			Health:       "ok",
+		}, rules[1])
+		assert.Equal(t, "query timed out", rules[3].LastError)
+	})
+
+	for _, tc := range []struct {
+		name     string
+		args     ListPrometheusRulesParams
+		expected []string
+	}{
+		{name: "by type", args: ListPrometheusRulesParams{Type: "alerting"}, expected: []string{"HighErrorRate", "HighLatency", "NodeDown"}},
+		{name: "by group", args: ListPrometheusRulesParams{Group: "node"}, expected: []string{"NodeDown"}},
+		{name: "by state", args: ListPrometheusRulesParams{State: "pending"}, expected: []string{"HighLatency"}},
+		{
+			name: "by labels",
+			args: ListPrometheusRulesParams{
+				Group:          "api",
+				LabelSelectors: []Selector{{Filters: []LabelMatcher{{Name: "severity", Value: "critical", Type: "="}}}},
+			},
+			expected: []string{"HighErrorRate"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rules, err := filterPrometheusRules(groups, tc.args)
+			require.NoError(t, err)
+			names := []string{}
+			for _, r := range rules {
+				names = append(names, r.Name)
+			}
+			assert.Equal(t, tc.expected, names)
+		})
+	}
+}
+
+func TestFilterPrometheusAlerts(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	groups := testRuleGroups(now)
+
+	active := groupAlerts(groups, "api")
+	require.Len(t, active, 2)
+	assert.Empty(t, groupAlerts(groups, "node"))
+
+	// Pending alerts are listed after firing ones.
+	unsorted := []promv1.Alert{active[1], active[0]}
+	alerts, err := filterPrometheusAlerts(unsorted, "", nil, now)
+	require.NoError(t, err)
+	require.Len(t, alerts, 2)
+	assert.Equal(t, prometheusAlert{
+		AlertName: "HighErrorRate",
+		State:     "firing",
+		Labels:    map[string]string{"alertname": "HighErrorRate", "severity": "critical", "job": "api"},
+		ActiveAt:  "2024-01-01T11:00:00Z",
+		ActiveFor: "1h",
+		Value:     "0.2",
+	}, alerts[0])
+	assert.Equal(t, "HighLatency", alerts[1].AlertName)
+
+	alerts, err = filterPrometheusAlerts(active, "pending", nil, now)
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "HighLatency", alerts[0].AlertName)
+
+	alerts, err = filterPrometheusAlerts(active, "", []Selector{
+		{Filters: []LabelMatcher{{Name: "severity", Value: "crit.*", Type: "=~"}}},
+	}, now)
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "HighErrorRate", alerts[0].AlertName)
+}
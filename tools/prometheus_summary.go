@@ -0,0 +1,174 @@
+package tools
+
+import (
+	"math"
+	"sort"
+
+	"github.com/prometheus/common/model"
+)
+
+const (
+	// DefaultPrometheusSummaryTopN is the number of series included in a
+	// summarized query result if not specified.
+	DefaultPrometheusSummaryTopN = 10
+
+	// trendThreshold is the change over the whole range, relative to the
+	// average value, above which a series is considered rising or falling.
+	trendThreshold = 0.05
+)
+
+// seriesSummary holds the statistics of a single series. Non-finite samples
+// (NaN and ±Inf) are ignored.
+type seriesSummary struct {
+	Labels  map[string]string `json:"labels"`
+	Samples int               `json:"samples"`
+	Min     float64           `json:"min"`
+	Max     float64           `json:"max"`
+	Avg     float64           `json:"avg"`
+	Last    float64           `json:"last"`
+	P95     float64           `json:"p95"`
+	// Trend is one of "rising", "falling" or "flat", based on a linear fit
+	// over the samples of the series.
+	Trend string `json:"trend"`
+}
+
+// prometheusQuerySummary is a compact representation of a Prometheus query
+// result, returned by query_prometheus in summarize mode.
+type prometheusQuerySummary struct {
+	ResultType  string          `json:"resultType"`
+	SeriesCount int             `json:"seriesCount"`
+	TopSeries   []seriesSummary `json:"topSeries"`
+	// OmittedSeries is the number of series not included in TopSeries,
+	// either because they were outside the top N or had no finite samples.
+	OmittedSeries int `json:"omittedSeries"`
+	// Value holds the result of scalar and string queries, which are
+	// returned unchanged.
+	Value model.Value `json:"value,omitempty"`
+}
+
+// summarizePrometheusResult summarizes matrix and vector results, keeping the
+// topN series ranked by average value.
+func summarizePrometheusResult(result model.Value, topN int) *prometheusQuerySummary {
+	if topN <= 0 {
+		topN = DefaultPrometheusSummaryTopN
+	}
+
+	summary := &prometheusQuerySummary{}
+	if result == nil {
+		return summary
+	}
+	summary.ResultType = result.Type().String()
+
+	var summaries []seriesSummary
+	switch v := result.(type) {
+	case model.Matrix:
+		summary.SeriesCount = len(v)
+		for _, stream := range v {
+			values := make([]float64, 0, len(stream.Values))
+			for _, p := range stream.Values {
+				values = append(values, float64(p.Value))
+			}
+			if s, ok := summarizeSeries(stream.Metric, values); ok {
+				summaries = append(summaries, s)
+			}
+		}
+	case model.Vector:
+		summary.SeriesCount = len(v)
+		for _, sample := range v {
+			if s, ok := summarizeSeries(sample.Metric, []float64{float64(sample.Value)}); ok {
+				summaries = append(summaries, s)
+			}
+		}
+	default:
+		summary.Value = result
+		return summary
+	}
+
+	sort.SliceStable(summaries, func(i, j int) bool {
+		return summaries[i].Avg > summaries[j].Avg
+	})
+	if len(summaries) > topN {
+		summaries = summaries[:topN]
+	}
+	summary.TopSeries = summaries
+	summary.OmittedSeries = summary.SeriesCount - len(summaries)
+	return summary
+}
+
+// summarizeSeries computes the statistics for the given values, returning
+// false if there are no finite values.
+func summarizeSeries(metric model.Metric, values []float64) (seriesSummary, bool) {
+	finite := make([]float64, 0, len(values))
+	for _, v := range values {
+		if !math.IsNaN(v) && !math.IsInf(v, 0) {
+			finite = append(finite, v)
+		}
+	}
+	if len(finite) == 0 {
+		return seriesSummary{}, false
+	}
+
+	s := seriesSummary{
+		Labels:  make(map[string]string, len(metric)),
+		Samples: len(finite),
+		Min:     finite[0],
+		Max:     finite[0],
+		Last:    finite[len(finite)-1],
+	}
+	for k, v := range metric {
+		s.Labels[string(k)] = string(v)
+	}
+
+	sum := 0.0
+	for _, v := range finite {
+		sum += v
+		s.Min = math.Min(s.Min, v)
+		s.Max = math.Max(s.Max, v)
+	}
+	s.Avg = sum / float64(len(finite))
+	s.P95 = percentile(finite, 0.95)
+	s.Trend = trendDirection(finite, s.Avg)
+	return s, true
+}
+
+// percentile returns the q-quantile of values using the nearest-rank method.
+func percentile(values []float64, q float64) float64 {
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+	rank := int(math.Ceil(q*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+// trendDirection fits a least-squares line through the values and classifies
+// the change it predicts over the whole series relative to the average.
+func trendDirection(values []float64, avg float64) string {
+	n := float64(len(values))
+	if len(values) < 2 {
+		return "flat"
+	}
+
+	meanX := (n - 1) / 2
+	var num, den float64
+	for i, v := range values {
+		dx := float64(i) - meanX
+		num += dx * (v - avg)
+		den += dx * dx
+	}
+	change := num / den * (n - 1)
+
+	scale := math.Abs(avg)
+	if scale == 0 {
+		scale = math.Max(math.Abs(values[0]), math.Abs(values[len(values)-1]))
+	}
+	if scale == 0 || math.Abs(change)/scale < trendThreshold {
+		return "flat"
+	}
+	if change > 0 {
+		return "rising"
+	}
+	return "falling"
+}
@@ -0,0 +1,108 @@
+//go:build unit
+// +build unit
+
+package tools
+
+import (
+	"math"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sampleStream(name string, values ...float64) *model.SampleStream {
+	points := make([]model.SamplePair, 0, len(values))
+	for i, v := range values {
+		points = append(points, model.SamplePair{
+			Timestamp: model.Time(int64(i) * 60000),
+			Value:     model.SampleValue(v),
+		})
+	}
+	return &model.SampleStream{
+		Metric: model.Metric{"__name__": "test", "instance": model.LabelValue(name)},
+		Values: points,
+	}
+}
+
+func TestSummarizePrometheusResult(t *testing.T) {
+	t.Run("matrix statistics", func(t *testing.T) {
+		values := make([]float64, 0, 20)
+		for i := 1; i <= 20; i++ {
+			values = append(values, float64(i))
+		}
+		summary := summarizePrometheusResult(model.Matrix{sampleStream("a", values...)}, 0)
+
+		assert.Equal(t, "matrix", summary.ResultType)
+		assert.Equal(t, 1, summary.SeriesCount)
+		assert.Equal(t, 0, summary.OmittedSeries)
+		require.Len(t, summary.TopSeries, 1)
+
+		s := summary.TopSeries[0]
+		assert.Equal(t, map[string]string{"__name__": "test", "instance": "a"}, s.Labels)
+		assert.Equal(t, 20, s.Samples)
+		assert.Equal(t, 1.0, s.Min)
+		assert.Equal(t, 20.0, s.Max)
+		assert.Equal(t, 10.5, s.Avg)
+		assert.Equal(t, 20.0, s.Last)
+		assert.Equal(t, 19.0, s.P95)
+		assert.Equal(t, "rising", s.Trend)
+	})
+
+	t.Run("trend direction", func(t *testing.T) {
+		summary := summarizePrometheusResult(model.Matrix{
+			sampleStream("falling", 10, 8, 6, 4, 2),
+			sampleStream("flat", 5, 5.01, 4.99, 5, 5),
+		}, 0)
+		require.Len(t, summary.TopSeries, 2)
+		assert.Equal(t, "falling", summary.TopSeries[0].Trend)
+		assert.Equal(t, "flat", summary.TopSeries[1].Trend)
+	})
+
+	t.Run("top n by average", func(t *testing.T) {
+		summary := summarizePrometheusResult(model.Matrix{
+			sampleStream("low", 1, 1),
+			sampleStream("high", 100, 100),
+			sampleStream("mid", 10, 10),
+		}, 2)
+		assert.Equal(t, 3, summary.SeriesCount)
+		assert.Equal(t, 1, summary.OmittedSeries)
+		require.Len(t, summary.TopSeries, 2)
+		assert.Equal(t, "high", summary.TopSeries[0].Labels["instance"])
+		assert.Equal(t, "mid", summary.TopSeries[1].Labels["instance"])
+	})
+
+	t.Run("non-finite values are ignored", func(t *testing.T) {
+		summary := summarizePrometheusResult(model.Matrix{
+			sampleStream("mixed", 1, math.NaN(), 3, math.Inf(1)),
+			sampleStream("empty", math.NaN()),
+		}, 0)
+		assert.Equal(t, 2, summary.SeriesCount)
+		assert.Equal(t, 1, summary.OmittedSeries)
+		require.Len(t, summary.TopSeries, 1)
+		assert.Equal(t, 2, summary.TopSeries[0].Samples)
+		assert.Equal(t, 2.0, summary.TopSeries[0].Avg)
+		assert.Equal(t, 3.0, summary.TopSeries[0].Last)
+	})
+
+	t.Run("vector", func(t *testing.T) {
+		summary := summarizePrometheusResult(model.Vector{
+			{Metric: model.Metric{"instance": "a"}, Value: 2},
+			{Metric: model.Metric{"instance": "b"}, Value: 7},
+		}, 0)
+		assert.Equal(t, "vector", summary.ResultType)
+		require.Len(t, summary.TopSeries, 2)
+		assert.Equal(t, "b", summary.TopSeries[0].Labels["instance"])
+		assert.Equal(t, 7.0, summary.TopSeries[0].Last)
+		assert.Equal(t, "flat", summary.TopSeries[0].Trend)
+	})
+
+	t.Run("scalar is returned unchanged", func(t *testing.T) {
+		scalar := &model.Scalar{Value: 42}
+		summary := summarizePrometheusResult(scalar, 0)
+		assert.Equal(t, "scalar", summary.ResultType)
+		assert.Equal(t, scalar, summary.Value)
+		assert.Empty(t, summary.TopSeries)
+	})
+}
@@ -0,0 +1,321 @@
+package tools
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+
+	mcpgrafana "mcp-grafana-local"
+)
+
+const (
+	// DefaultListTargetsLimit is the number of targets returned by default.
+	DefaultListTargetsLimit = 100
+
+	// lastSuccessfulScrapeLookback is how far back the last successful
+	// scrape of an unhealthy target is looked up.
+	lastSuccessfulScrapeLookback = 24 * time.Hour
+)
+
+type ListPrometheusTargetsParams struct {
+	DatasourceUID  string     `json:"datasourceUid" jsonschema:"required,description=The UID of the Prometheus datasource"`
+	Job            string     `json:"job,omitempty" jsonschema:"description=Optionally\\, only return the targets of this job or scrape pool"`
+	Health         string     `json:"health,omitempty" jsonschema:"description=Optionally\\, only return the targets with this health: 'up'\\, 'down' or 'unknown'"`
+	LabelSelectors []Selector `json:"labelSelectors,omitempty" jsonschema:"description=Optionally\\, a list of matchers to filter the targets by their labels"`
+	Limit          int        `json:"limit,omitempty" jsonschema:"description=Optionally\\, the maximum number of targets to return. Defaults to 100"`
+}
+
+func (p ListPrometheusTargetsParams) validate() error {
+	switch promv1.HealthStatus(p.Health) {
+	case "", promv1.HealthGood, promv1.HealthBad, promv1.HealthUnknown:
+	default:
+		return fmt.Errorf("invalid health: %q, must be one of 'up', 'down' or 'unknown'", p.Health)
+	}
+	if p.Limit < 0 {
+		return fmt.Errorf("invalid limit: %d, must not be negative", p.Limit)
+	}
+	return nil
+}
+
+type prometheusTarget struct {
+	Job                       string            `json:"job"`
+	Instance                  string            `json:"instance"`
+	ScrapePool                string            `json:"scrapePool"`
+	ScrapeURL                 string            `json:"scrapeUrl"`
+	Health                    string            `json:"health"`
+	Labels                    map[string]string `json:"labels"`
+	LastError                 string            `json:"lastError,omitempty"`
+	LastScrape                string            `json:"lastScrape,omitempty"`
+	LastScrapeDurationSeconds float64           `json:"lastScrapeDurationSeconds"`
+	// LastSuccessfulScrape is the last scrape for healthy targets. For the
+	// others, it is looked up from the up metric, and empty if the target
+	// wasn't scraped successfully in the last 24 hours.
+	LastSuccessfulScrape      string `json:"lastSuccessfulScrape,omitempty"`
+	SinceLastSuccessfulScrape string `json:"sinceLastSuccessfulScrape,omitempty"`
+}
+
+type prometheusTargets struct {
+	// Total is the number of matching targets, which may be more than the
+	// number returned.
+	Total   int                `json:"total"`
+	Targets []prometheusTarget `json:"targets"`
+}
+
+func listPrometheusTargets(ctx context.Context, args ListPrometheusTargetsParams) (*prometheusTargets, error) {
+	if err := args.validate(); err != nil {
+		return nil, err
+	}
+	limit := args.Limit
+	if limit == 0 {
+		limit = DefaultListTargetsLimit
+	}
+
+	promClient, err := promClientFromContext(ctx, args.DatasourceUID)
+	if err != nil {
+		return nil, fmt.Errorf("getting Prometheus client: %w", err)
+	}
+	result, err := promClient.Targets(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing Prometheus targets: %w", err)
+	}
+
+	now := time.Now()
+	targets, err := filterTargets(result.Active, args.Job, "", args.Health, args.LabelSelectors, now)
+	if err != nil {
+		return nil, err
+	}
+	total := len(targets)
+	if len(targets) > limit {
+		targets = targets[:limit]
+	}
+	addLastSuccessfulScrapes(ctx, promClient, targets, now)
+	return &prometheusTargets{Total: total, Targets: targets}, nil
+}
+
+var ListPrometheusTargets = mcpgrafana.MustTool(
+	"list_prometheus_targets",
+	"List the scrape targets of a Prometheus datasource, optionally filtered by job, health ('up', 'down' or 'unknown') and labels. Each target has its job, instance, scrape URL, health, labels, last scrape error, last scrape duration and the time of and since its last successful scrape. Use this when a metric is missing or stale: the target exporting it is often down.",
+	listPrometheusTargets,
+	mcp.WithTitleAnnotation("List Prometheus targets"),
+	mcp.WithIdempotentHintAnnotation(true),
+	mcp.WithReadOnlyHintAnnotation(true),
+)
+
+type GetPrometheusTargetHealthParams struct {
+	DatasourceUID string `json:"datasourceUid" jsonschema:"required,description=The UID of the Prometheus datasource"`
+	Job           string `json:"job,omitempty" jsonschema:"description=Optionally\\, only check the targets of this job or scrape pool"`
+	Instance      string `json:"instance,omitempty" jsonschema:"description=Optionally\\, only check the targets with this instance label\\, e.g. 'host:9100'"`
+}
+
+type jobHealth struct {
+	Job     string `json:"job"`
+	Up      int    `json:"up"`
+	Down    int    `json:"down"`
+	Unknown int    `json:"unknown"`
+}
+
+type targetHealth struct {
+	Up      int         `json:"up"`
+	Down    int         `json:"down"`
+	Unknown int         `json:"unknown"`
+	Jobs    []jobHealth `json:"jobs"`
+	// Unhealthy are the targets which are down or not scraped yet, at most
+	// DefaultListTargetsLimit of them.
+	Unhealthy []prometheusTarget `json:"unhealthy"`
+}
+
+func getPrometheusTargetHealth(ctx context.Context, args GetPrometheusTargetHealthParams) (*targetHealth, error) {
+	promClient, err := promClientFromContext(ctx, args.DatasourceUID)
+	if err != nil {
+		return nil, fmt.Errorf("getting Prometheus client: %w", err)
+	}
+	result, err := promClient.Targets(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing Prometheus targets: %w", err)
+	}
+
+	now := time.Now()
+	targets, err := filterTargets(result.Active, args.Job, args.Instance, "", nil, now)
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no targets found for job %q and instance %q", args.Job, args.Instance)
+	}
+	health := summarizeTargetHealth(targets)
+	addLastSuccessfulScrapes(ctx, promClient, health.Unhealthy, now)
+	return health, nil
+}
+
+var GetPrometheusTargetHealth = mcpgrafana.MustTool(
+	"get_prometheus_target_health",
+	"Get the health of the scrape targets of a Prometheus datasource, optionally only of a job or instance: the number of targets up, down and unknown overall and per job, and the unhealthy targets with their last scrape error, last scrape duration and the time of and since their last successful scrape. Check this first when the metrics of a job or instance are missing.",
+	getPrometheusTargetHealth,
+	mcp.WithTitleAnnotation("Get Prometheus target health"),
+	mcp.WithIdempotentHintAnnotation(true),
+	mcp.WithReadOnlyHintAnnotation(true),
+)
+
+// filterTargets returns the targets matching all of the given filters,
+// sorted by job and instance. Empty filters match every target.
+func filterTargets(active []promv1.ActiveTarget, job, instance, health string, selectors []Selector, now time.Time) ([]prometheusTarget, error) {
+	targets := []prometheusTarget{}
+	for _, t := range active {
+		if job != "" && string(t.Labels[model.JobLabel]) != job && t.ScrapePool != job {
+			continue
+		}
+		if instance != "" && string(t.Labels[model.InstanceLabel]) != instance {
+			continue
+		}
+		if health != "" && string(t.Health) != health {
+			continue
+		}
+		target := summarizeTarget(t, now)
+		match, err := matchesLabelSelectors(target.Labels, selectors)
+		if err != nil {
+			return nil, fmt.Errorf("filtering targets: %w", err)
+		}
+		if match {
+			targets = append(targets, target)
+		}
+	}
+	slices.SortFunc(targets, func(a, b prometheusTarget) int {
+		return cmp.Or(cmp.Compare(a.Job, b.Job), cmp.Compare(a.Instance, b.Instance))
+	})
+	return targets, nil
+}
+
+// matchesLabelSelectors reports whether labels match all of the selectors.
+func matchesLabelSelectors(lbls map[string]string, selectors []Selector) (bool, error) {
+	for _, selector := range selectors {
+		match, err := selector.Matches(labels.FromMap(lbls))
+		if err != nil {
+			return false, err
+		}
+		if !match {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func summarizeTarget(t promv1.ActiveTarget, now time.Time) prometheusTarget {
+	lbls := make(map[string]string, len(t.Labels))
+	for name, value := range t.Labels {
+		lbls[string(name)] = string(value)
+	}
+	target := prometheusTarget{
+		Job:                       lbls[model.JobLabel],
+		Instance:                  lbls[model.InstanceLabel],
+		ScrapePool:                t.ScrapePool,
+		ScrapeURL:                 t.ScrapeURL,
+		Health:                    string(t.Health),
+		Labels:                    lbls,
+		LastError:                 t.LastError,
+		LastScrapeDurationSeconds: t.LastScrapeDuration,
+	}
+	if !t.LastScrape.IsZero() {
+		target.LastScrape = t.LastScrape.UTC().Format(time.RFC3339)
+		if t.Health == promv1.HealthGood {
+			setLastSuccessfulScrape(&target, t.LastScrape, now)
+		}
+	}
+	return target
+}
+
+func setLastSuccessfulScrape(target *prometheusTarget, ts, now time.Time) {
+	target.LastSuccessfulScrape = ts.UTC().Format(time.RFC3339)
+	target.SinceLastSuccessfulScrape = model.Duration(max(now.Sub(ts), 0).Truncate(time.Second)).String()
+}
+
+// summarizeTargetHealth counts the targets by health, overall and per job.
+func summarizeTargetHealth(targets []prometheusTarget) *targetHealth {
+	health := &targetHealth{Jobs: []jobHealth{}, Unhealthy: []prometheusTarget{}}
+	for _, t := range targets {
+		i := slices.IndexFunc(health.Jobs, func(j jobHealth) bool { return j.Job == t.Job })
+		if i < 0 {
+			health.Jobs = append(health.Jobs, jobHealth{Job: t.Job})
+			i = len(health.Jobs) - 1
+		}
+		switch promv1.HealthStatus(t.Health) {
+		case promv1.HealthGood:
+			health.Up++
+			health.Jobs[i].Up++
+			continue
+		case promv1.HealthBad:
+			health.Down++
+			health.Jobs[i].Down++
+		default:
+			health.Unknown++
+			health.Jobs[i].Unknown++
+		}
+		if len(health.Unhealthy) < DefaultListTargetsLimit {
+			health.Unhealthy = append(health.Unhealthy, t)
+		}
+	}
+	return health
+}
+
+// addLastSuccessfulScrapes looks up the last successful scrape of the
+// unhealthy targets from their up metric, which is 1 for successful scrapes.
+// The lookup is best effort: targets are left without it if it fails.
+func addLastSuccessfulScrapes(ctx context.Context, promClient promv1.API, targets []prometheusTarget, now time.Time) {
+	query := lastSuccessfulScrapeQuery(targets)
+	if query == "" {
+		return
+	}
+	value, _, err := promClient.Query(ctx, query, now)
+	if err != nil {
+		return
+	}
+	vector, ok := value.(model.Vector)
+	if !ok {
+		return
+	}
+	applyLastSuccessfulScrapes(targets, vector, now)
+}
+
+// lastSuccessfulScrapeQuery returns the query for the timestamp of the last
+// successful scrape of the jobs of the unhealthy targets, or an empty string
+// if all targets are healthy.
+func lastSuccessfulScrapeQuery(targets []prometheusTarget) string {
+	var jobs []string
+	for _, t := range targets {
+		if t.LastSuccessfulScrape != "" {
+			continue
+		}
+		if job := regexp.QuoteMeta(t.Job); !slices.Contains(jobs, job) {
+			jobs = append(jobs, job)
+		}
+	}
+	if len(jobs) == 0 {
+		return ""
+	}
+	selector := fmt.Sprintf("up{job=~%q}", strings.Join(jobs, "|"))
+	return fmt.Sprintf("max_over_time((timestamp(%s) and %s == 1)[%s:1m])", selector, selector, model.Duration(lastSuccessfulScrapeLookback))
+}
+
+// applyLastSuccessfulScrapes sets the last successful scrape of targets
+// from the result of lastSuccessfulScrapeQuery, by job and instance.
+func applyLastSuccessfulScrapes(targets []prometheusTarget, vector model.Vector, now time.Time) {
+	for i := range targets {
+		if targets[i].LastSuccessfulScrape != "" {
+			continue
+		}
+		for _, sample := range vector {
+			if string(sample.Metric[model.JobLabel]) == targets[i].Job && string(sample.Metric[model.InstanceLabel]) == targets[i].Instance {
+				setLastSuccessfulScrape(&targets[i], time.Unix(int64(sample.Value), 0), now)
+				break
+			}
+		}
+	}
+}
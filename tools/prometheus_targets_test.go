@@ -0,0 +1,144 @@
+//go:build unit
+// +build unit
+
+package tools
+
+import (
+	"testing"
+	"time"
+
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testActiveTargets(now time.Time) []promv1.ActiveTarget {
+	return []promv1.ActiveTarget{
+		{
+			Labels:             model.LabelSet{"job": "node", "instance": "host-b:9100", "env": "prod"},
+			ScrapePool:         "node",
+			ScrapeURL:          "http://host-b:9100/metrics",
+			LastError:          `Get "http://host-b:9100/metrics": dial tcp: connection refused`,
+			LastScrape:         now.Add(-10 * time.Second),
+			LastScrapeDuration: 0.002,
+			Health:             promv1.HealthBad,
+		},
+		{
+			Labels:             model.LabelSet{"job": "node", "instance": "host-a:9100", "env": "prod"},
+			ScrapePool:         "node",
+			ScrapeURL:          "http://host-a:9100/metrics",
+			LastScrape:         now.Add(-5 * time.Second),
+			LastScrapeDuration: 0.05,
+			Health:             promv1.HealthGood,
+		},
+		{
+			Labels:     model.LabelSet{"job": "api", "instance": "api:8080", "env": "dev"},
+			ScrapePool: "api",
+			ScrapeURL:  "http://api:8080/metrics",
+			Health:     promv1.HealthUnknown,
+		},
+	}
+}
+
+func TestFilterTargets(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	active := testActiveTargets(now)
+
+	t.Run("no filters", func(t *testing.T) {
+		targets, err := filterTargets(active, "", "", "", nil, now)
+		require.NoError(t, err)
+		require.Len(t, targets, 3)
+		assert.Equal(t, []string{"api:8080", "host-a:9100", "host-b:9100"}, []string{targets[0].Instance, targets[1].Instance, targets[2].Instance})
+
+		assert.Equal(t, prometheusTarget{
+			Job:                       "node",
+			Instance:                  "host-a:9100",
+			ScrapePool:                "node",
+			ScrapeURL:                 "http://host-a:9100/metrics",
+			Health:                    "up",
+			Labels:                    map[string]string{"job": "node", "instance": "host-a:9100", "env": "prod"},
+			LastScrape:                "2024-01-01T11:59:55Z",
+			LastScrapeDurationSeconds: 0.05,
+			LastSuccessfulScrape:      "2024-01-01T11:59:55Z",
+			SinceLastSuccessfulScrape: "5s",
+		}, targets[1])
+
+		// Down targets have a last scrape, but not a successful one.
+		assert.Equal(t, "2024-01-01T11:59:50Z", targets[2].LastScrape)
+		assert.Empty(t, targets[2].LastSuccessfulScrape)
+		assert.Contains(t, targets[2].LastError, "connection refused")
+		assert.Empty(t, targets[0].LastScrape)
+	})
+
+	t.Run("by job and health", func(t *testing.T) {
+		targets, err := filterTargets(active, "node", "", "down", nil, now)
+		require.NoError(t, err)
+		require.Len(t, targets, 1)
+		assert.Equal(t, "host-b:9100", targets[0].Instance)
+	})
+
+	t.Run("by instance", func(t *testing.T) {
+		targets, err := filterTargets(active, "", "api:8080", "", nil, now)
+		require.NoError(t, err)
+		require.Len(t, targets, 1)
+		assert.Equal(t, "api", targets[0].Job)
+	})
+
+	t.Run("by labels", func(t *testing.T) {
+		targets, err := filterTargets(active, "", "", "", []Selector{
+			{Filters: []LabelMatcher{{Name: "env", Value: "prod", Type: "="}}},
+			{Filters: []LabelMatcher{{Name: "instance", Value: "host-a.*", Type: "!~"}}},
+		}, now)
+		require.NoError(t, err)
+		require.Len(t, targets, 1)
+		assert.Equal(t, "host-b:9100", targets[0].Instance)
+	})
+
+	t.Run("invalid matcher", func(t *testing.T) {
+		_, err := filterTargets(active, "", "", "", []Selector{
+			{Filters: []LabelMatcher{{Name: "env", Value: "prod", Type: "=="}}},
+		}, now)
+		assert.Error(t, err)
+	})
+}
+
+func TestSummarizeTargetHealth(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	targets, err := filterTargets(testActiveTargets(now), "", "", "", nil, now)
+	require.NoError(t, err)
+
+	health := summarizeTargetHealth(targets)
+	assert.Equal(t, 1, health.Up)
+	assert.Equal(t, 1, health.Down)
+	assert.Equal(t, 1, health.Unknown)
+	assert.Equal(t, []jobHealth{
+		{Job: "api", Unknown: 1},
+		{Job: "node", Up: 1, Down: 1},
+	}, health.Jobs)
+	require.Len(t, health.Unhealthy, 2)
+	assert.Equal(t, "api:8080", health.Unhealthy[0].Instance)
+	assert.Equal(t, "host-b:9100", health.Unhealthy[1].Instance)
+}
+
+func TestLastSuccessfulScrapes(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	targets, err := filterTargets(testActiveTargets(now), "", "", "", nil, now)
+	require.NoError(t, err)
+
+	assert.Equal(t,
+		`max_over_time((timestamp(up{job=~"api|node"}) and up{job=~"api|node"} == 1)[1d:1m])`,
+		lastSuccessfulScrapeQuery(targets),
+	)
+	assert.Empty(t, lastSuccessfulScrapeQuery(targets[1:2]))
+
+	applyLastSuccessfulScrapes(targets, model.Vector{
+		{Metric: model.Metric{"job": "node", "instance": "host-b:9100"}, Value: model.SampleValue(now.Add(-90 * time.Minute).Unix())},
+		// The healthy target keeps its last scrape.
+		{Metric: model.Metric{"job": "node", "instance": "host-a:9100"}, Value: model.SampleValue(now.Add(-time.Hour).Unix())},
+	}, now)
+	assert.Empty(t, targets[0].LastSuccessfulScrape)
+	assert.Equal(t, "2024-01-01T11:59:55Z", targets[1].LastSuccessfulScrape)
+	assert.Equal(t, "2024-01-01T10:30:00Z", targets[2].LastSuccessfulScrape)
+	assert.Equal(t, "1h30m", targets[2].SinceLastSuccessfulScrape)
+}
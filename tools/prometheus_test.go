@@ -70,6 +70,111 @@ func TestPrometheusTools(t *testing.T) {
 		require.NoError(t, err)
 		assert.Len(t, result, 1)
 	})
+
+	t.Run("validate promql with metadata", func(t *testing.T) {
+		ctx := newTestContext()
+		result, err := validatePromQL(ctx, ValidatePromQLParams{
+			DatasourceUID: "prometheus",
+			Expr:          "rate(go_goroutines[5m])",
+		})
+		require.NoError(t, err)
+		assert.True(t, result.Valid)
+		assert.Equal(t, []string{"go_goroutines"}, result.Metrics)
+		require.Len(t, result.Warnings, 1)
+		assert.Contains(t, result.Warnings[0], "go_goroutines is a gauge")
+	})
+
+	t.Run("get prometheus cardinality", func(t *testing.T) {
+		ctx := newTestContext()
+		result, err := getPrometheusCardinality(ctx, GetPrometheusCardinalityParams{
+			DatasourceUID: "prometheus",
+			Limit:         5,
+		})
+		require.NoError(t, err)
+		assert.Greater(t, result.HeadStats.NumSeries, 0)
+		assert.NotEmpty(t, result.SeriesCountByMetricName)
+		assert.LessOrEqual(t, len(result.SeriesCountByMetricName), 5)
+	})
+
+	t.Run("count prometheus series", func(t *testing.T) {
+		ctx := newTestContext()
+		result, err := countPrometheusSeries(ctx, CountPrometheusSeriesParams{
+			DatasourceUID: "prometheus",
+			Selector:      "up",
+			GroupBy:       []string{"job"},
+		})
+		require.NoError(t, err)
+		assert.Greater(t, result.Count, 0)
+		require.Len(t, result.ByMetric, 1)
+		assert.Equal(t, "up", result.ByMetric[0].Name)
+		assert.NotEmpty(t, result.ByLabel["job"])
+	})
+
+	t.Run("list prometheus targets", func(t *testing.T) {
+		ctx := newTestContext()
+		result, err := listPrometheusTargets(ctx, ListPrometheusTargetsParams{
+			DatasourceUID: "prometheus",
+			Job:           "prometheus",
+		})
+		require.NoError(t, err)
+		require.Equal(t, 1, result.Total)
+		target := result.Targets[0]
+		assert.Equal(t, "prometheus", target.Job)
+		assert.Equal(t, "localhost:9090", target.Instance)
+		assert.Equal(t, "up", target.Health)
+		assert.NotEmpty(t, target.LastSuccessfulScrape)
+
+		result, err = listPrometheusTargets(ctx, ListPrometheusTargetsParams{
+			DatasourceUID: "prometheus",
+			Health:        "down",
+		})
+		require.NoError(t, err)
+		assert.Empty(t, result.Targets)
+	})
+
+	t.Run("get prometheus target health", func(t *testing.T) {
+		ctx := newTestContext()
+		result, err := getPrometheusTargetHealth(ctx, GetPrometheusTargetHealthParams{
+			DatasourceUID: "prometheus",
+			Instance:      "localhost:9090",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Up)
+		assert.Equal(t, []jobHealth{{Job: "prometheus", Up: 1}}, result.Jobs)
+		assert.Empty(t, result.Unhealthy)
+	})
+
+	t.Run("list prometheus rules", func(t *testing.T) {
+		ctx := newTestContext()
+		result, err := listPrometheusRules(ctx, ListPrometheusRulesParams{
+			DatasourceUID: "prometheus",
+			Group:         "seed",
+		})
+		require.NoError(t, err)
+		require.Equal(t, 1, result.Total)
+		rule := result.Rules[0]
+		assert.Equal(t, "seed", rule.Group)
+		assert.Equal(t, "recording", rule.Type)
+		assert.Equal(t, "test", rule.Name)
+		assert.Equal(t, "vector(1)", rule.Query)
+
+		result, err = listPrometheusRules(ctx, ListPrometheusRulesParams{
+			DatasourceUID: "prometheus",
+			Type:          "alerting",
+		})
+		require.NoError(t, err)
+		assert.Empty(t, result.Rules)
+	})
+
+	t.Run("list prometheus alerts", func(t *testing.T) {
+		ctx := newTestContext()
+		result, err := listPrometheusAlerts(ctx, ListPrometheusAlertsParams{
+			DatasourceUID: "prometheus",
+			State:         "firing",
+		})
+		require.NoError(t, err)
+		assert.Empty(t, result.Alerts)
+	})
 }
 
 func TestSelectorMatches(t *testing.T) {
@@ -241,8 +346,8 @@ func TestPrometheusQueries(t *testing.T) {
 				result, err := queryPrometheus(ctx, QueryPrometheusParams{
 					DatasourceUID: "prometheus",
 					Expr:          "test",
-					StartTime:     start.Format(time.RFC3339),
-					EndTime:       end.Format(time.RFC3339),
+					From:          start.Format(time.RFC3339),
+					To:            end.Format(time.RFC3339),
 					StepSeconds:   step,
 					QueryType:     "range",
 				})
@@ -262,7 +367,7 @@ func TestPrometheusQueries(t *testing.T) {
 		result, err := queryPrometheus(ctx, QueryPrometheusParams{
 			DatasourceUID: "prometheus",
 			Expr:          "up",
-			StartTime:     time.Now().Format(time.RFC3339),
+			From:          time.Now().Format(time.RFC3339),
 			QueryType:     "instant",
 		})
 		require.NoError(t, err)
@@ -278,7 +383,7 @@ func TestPrometheusQueries(t *testing.T) {
 		result, err := queryPrometheus(ctx, QueryPrometheusParams{
 			DatasourceUID: "prometheus",
 			Expr:          "up",
-			StartTime:     "now",
+			From:          "now",
 			QueryType:     "instant",
 		})
 		afterQuery := model.TimeFromUnix(time.Now().Unix())
@@ -302,8 +407,8 @@ func TestPrometheusQueries(t *testing.T) {
 		result, err := queryPrometheus(ctx, QueryPrometheusParams{
 			DatasourceUID: "prometheus",
 			Expr:          "test",
-			StartTime:     "now-1h",
-			EndTime:       "now",
+			From:          "now-1h",
+			To:            "now",
 			StepSeconds:   60,
 			QueryType:     "range",
 		})
@@ -1,9 +1,11 @@
 package tools
 
 import (
+	"context"
 	"testing"
 	"time"
 
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -115,3 +117,151 @@ func TestParseRelativeTime(t *testing.T) {
 		})
 	}
 }
+
+func TestComputeStep(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name          string
+		queryRange    time.Duration
+		stepSeconds   int
+		maxDataPoints int
+		expected      time.Duration
+		expectedError bool
+	}{
+		{
+			name:        "explicit step is honored",
+			queryRange:  time.Hour,
+			stepSeconds: 15,
+			expected:    15 * time.Second,
+		},
+		{
+			name:          "explicit step exceeding resolution",
+			queryRange:    30 * 24 * time.Hour,
+			stepSeconds:   1,
+			expectedError: true,
+		},
+		{
+			name:          "negative step",
+			queryRange:    time.Hour,
+			stepSeconds:   -1,
+			expectedError: true,
+		},
+		{
+			name:       "automatic step for one hour",
+			queryRange: time.Hour,
+			expected:   30 * time.Second,
+		},
+		{
+			name:       "automatic step for seven days",
+			queryRange: 7 * 24 * time.Hour,
+			expected:   time.Hour,
+		},
+		{
+			name:          "automatic step with custom max data points",
+			queryRange:    time.Hour,
+			maxDataPoints: 60,
+			expected:      time.Minute,
+		},
+		{
+			name:       "automatic step beyond a day",
+			queryRange: 365 * 24 * time.Hour,
+			expected:   2 * 24 * time.Hour,
+		},
+		{
+			name:       "empty range",
+			queryRange: 0,
+			expected:   time.Second,
+		},
+		{
+			name:          "end before start",
+			queryRange:    -time.Hour,
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			step, err := computeStep(start, start.Add(tc.queryRange), tc.stepSeconds, tc.maxDataPoints)
+			if tc.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, step)
+			if tc.stepSeconds == 0 {
+				maxDataPoints := tc.maxDataPoints
+				if maxDataPoints == 0 {
+					maxDataPoints = DefaultPrometheusMaxDataPoints
+				}
+				assert.LessOrEqual(t, int(tc.queryRange/step), maxDataPoints)
+			}
+		})
+	}
+}
+
+func TestResolvePrometheusQuery(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("instant query over a time range", func(t *testing.T) {
+		expr, r, err := resolvePrometheusQuery(QueryPrometheusParams{
+			Expr:      "rate(http_requests_total[$__range])",
+			From:      "now-1h",
+			To:        "now",
+			QueryType: "instant",
+		}, now)
+		require.NoError(t, err)
+		assert.Equal(t, "rate(http_requests_total[3600s])", expr)
+		assert.Equal(t, promv1.Range{Start: now}, r)
+	})
+
+	t.Run("instant query without end time", func(t *testing.T) {
+		expr, r, err := resolvePrometheusQuery(QueryPrometheusParams{
+			Expr:      "up",
+			From:      "now-1h",
+			QueryType: "instant",
+		}, now)
+		require.NoError(t, err)
+		assert.Equal(t, "up", expr)
+		assert.Equal(t, promv1.Range{Start: now.Add(-time.Hour)}, r)
+	})
+
+	t.Run("capture group references and unknown variables", func(t *testing.T) {
+		expr, _, err := resolvePrometheusQuery(QueryPrometheusParams{
+			Expr:      `label_replace(up{job="$job"}, "host", "$1", "instance", "(.*):.*") or on(host) $other`,
+			From:      "now-1h",
+			QueryType: "instant",
+			Variables: map[string]string{"job": "api"},
+		}, now)
+		require.NoError(t, err)
+		assert.Equal(t, `label_replace(up{job="api"}, "host", "$1", "instance", "(.*):.*") or on(host) $other`, expr)
+	})
+
+	t.Run("range query", func(t *testing.T) {
+		expr, r, err := resolvePrometheusQuery(QueryPrometheusParams{
+			Expr: "sum(rate(http_requests_total[$__rate_interval]))",
+			From: "now-1h",
+			To:   "now",
+		}, now)
+		require.NoError(t, err)
+		assert.Equal(t, "sum(rate(http_requests_total[1m]))", expr)
+		assert.Equal(t, promv1.Range{Start: now.Add(-time.Hour), End: now, Step: 30 * time.Second}, r)
+	})
+
+	t.Run("invalid query type", func(t *testing.T) {
+		_, _, err := resolvePrometheusQuery(QueryPrometheusParams{Expr: "up", From: "now", QueryType: "table"}, now)
+		assert.Error(t, err)
+	})
+}
+
+func TestQueryPrometheusValidation(t *testing.T) {
+	// Invalid parameters are rejected before the datasource is queried.
+	_, err := queryPrometheus(context.Background(), QueryPrometheusParams{
+		DatasourceUID:      "prometheus",
+		Expr:               "up",
+		From:               "now",
+		QueryType:          "instant",
+		IncludeAnnotations: true,
+	})
+	assert.EqualError(t, err, "includeAnnotations is only supported for range queries")
+}
@@ -0,0 +1,568 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	mcpgrafana "mcp-grafana-local"
+	"mcp-grafana-local/internal/interpolate"
+)
+
+var (
+	// counterFunctions are the functions meant for counters.
+	counterFunctions = []string{"rate", "irate", "increase", "resets"}
+
+	// gaugeFunctions are the functions meant for gauges, which give
+	// misleading results on counters.
+	gaugeFunctions = []string{"delta", "idelta", "deriv", "predict_linear"}
+
+	// counterSafeOperations are the functions and aggregations that may be
+	// applied to the raw value of a counter, as they don't depend on it.
+	counterSafeOperations = []string{"absent", "timestamp", "count", "group", "count_values", "topk", "bottomk"}
+
+	// histogramSeriesSuffixes are the suffixes of the counter series of
+	// classic histograms and summaries.
+	histogramSeriesSuffixes = []string{"_bucket", "_count", "_sum"}
+
+	// builtinDurationVariables and builtinNumberVariables are the built-in
+	// variables replaced before parsing, by their type.
+	builtinDurationVariables = []string{"__rate_interval", "__interval", "__range"}
+	builtinNumberVariables   = []string{"__interval_ms", "__range_ms", "__range_s", "__from", "__to"}
+)
+
+// placeholderBase is the first placeholder value used for template
+// variables, and placeholderNamePrefix starts the placeholders of names.
+// Placeholders must be valid names, durations and numbers which are unlikely
+// to be written by hand, so they can be replaced back.
+const (
+	placeholderBase       = 7_770_001
+	placeholderNamePrefix = "__placeholder_"
+)
+
+type ValidatePromQLParams struct {
+	Expr          string `json:"expr" jsonschema:"required,description=The PromQL expression to validate. Template variables such as $job and $__rate_interval are allowed"`
+	DatasourceUID string `json:"datasourceUid,omitempty" jsonschema:"description=Optionally\\, the UID of a Prometheus datasource. The types of the referenced metrics are then read from its metadata to check that functions suit them\\, e.g. that rate() isn't applied to gauges"`
+}
+
+type promQLError struct {
+	Message string `json:"message"`
+	// Start and End are byte offsets into the parsed expression, and Line and
+	// Column the 1-based position of Start.
+	Start  int `json:"start"`
+	End    int `json:"end"`
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+type promQLSelector struct {
+	Metric   string   `json:"metric,omitempty"`
+	Matchers []string `json:"matchers"`
+	Range    string   `json:"range,omitempty"`
+	Offset   string   `json:"offset,omitempty"`
+}
+
+type promQLAggregation struct {
+	Op       string   `json:"op"`
+	Grouping []string `json:"grouping,omitempty"`
+	Without  bool     `json:"without,omitempty"`
+	Param    string   `json:"param,omitempty"`
+	// Depth is the number of aggregations enclosing this one.
+	Depth int `json:"depth"`
+}
+
+type promQLValidation struct {
+	Valid bool `json:"valid"`
+	// ParsedExpr is the expression that was parsed, with template variables
+	// replaced by placeholders. It is only set if the expression has
+	// variables, and the error positions refer to it.
+	ParsedExpr   string              `json:"parsedExpr,omitempty"`
+	Errors       []promQLError       `json:"errors,omitempty"`
+	Formatted    string              `json:"formatted,omitempty"`
+	Type         string              `json:"type,omitempty"`
+	Metrics      []string            `json:"metrics,omitempty"`
+	Selectors    []promQLSelector    `json:"selectors,omitempty"`
+	Functions    []string            `json:"functions,omitempty"`
+	Aggregations []promQLAggregation `json:"aggregations,omitempty"`
+	Warnings     []string            `json:"warnings"`
+}
+
+func validatePromQL(ctx context.Context, args ValidatePromQLParams) (*promQLValidation, error) {
+	if strings.TrimSpace(args.Expr) == "" {
+		return nil, fmt.Errorf("expr is required")
+	}
+	query, restore := replaceWithPlaceholders(args.Expr)
+
+	result := &promQLValidation{Valid: true, Warnings: []string{}}
+	if query != args.Expr {
+		result.ParsedExpr = query
+	}
+	expr, err := parser.ParseExpr(query)
+	if err != nil {
+		result.Valid = false
+		result.Errors = promQLErrors(query, err)
+		return result, nil
+	}
+	result.Formatted = restore.Replace(parser.Prettify(expr))
+	result.Type = string(expr.Type())
+	describePromQL(expr, restore, result)
+
+	var types map[string]promv1.MetricType
+	if args.DatasourceUID != "" {
+		types, err = prometheusMetricTypes(ctx, args.DatasourceUID, result.Metrics)
+		if err != nil {
+			return nil, err
+		}
+	}
+	result.Warnings = promQLWarnings(expr, types)
+	return result, nil
+}
+
+var ValidatePromQL = mcpgrafana.MustTool(
+	"validate_promql",
+	"Parse a PromQL expression without running it, to catch mistakes before calling query_prometheus. Returns whether it is valid, syntax errors with their positions, a pretty-printed form, the result type, the referenced metrics, each selector with its label matchers, range and offset, the functions used and the aggregations with their grouping and nesting depth. Also warns about common mistakes: counters used without rate() or increase(), rate() and similar functions applied to gauges, delta() or deriv() applied to counters, and histogram_quantile() over an aggregation that drops the `le` label. Metric types are read from the metadata of the datasource if datasourceUid is given; otherwise only metrics ending in _total are known to be counters. Template variables are replaced with placeholders before parsing.",
+	validatePromQL,
+	mcp.WithTitleAnnotation("Validate PromQL expression"),
+	mcp.WithIdempotentHintAnnotation(true),
+	mcp.WithReadOnlyHintAnnotation(true),
+)
+
+// replaceWithPlaceholders replaces the template variables of a query with
+// unique placeholder values, so that it can be parsed. The placeholder of
+// each reference suits its position in the query: a name for metric and label
+// names, a duration in range selectors and offsets, and a number for scalar
+// arguments. The returned replacer turns the placeholders back into the
+// variables.
+func replaceWithPlaceholders(query string) (string, *strings.Replacer) {
+	type key struct {
+		name string
+		kind placeholderKind
+	}
+	var restorations []string
+	placeholders := map[key]string{}
+	next := placeholderBase
+	placeholder := func(name string, kind placeholderKind) string {
+		if value, ok := placeholders[key{name, kind}]; ok {
+			return value
+		}
+		var value string
+		switch kind {
+		case placeholderNumber:
+			value = strconv.Itoa(next)
+		case placeholderDuration:
+			value = model.Duration(time.Duration(next) * time.Millisecond).String()
+		default:
+			value = placeholderNamePrefix + strconv.Itoa(next)
+		}
+		next++
+		placeholders[key{name, kind}] = value
+		restorations = append(restorations, value, "$"+name)
+		return value
+	}
+
+	refs := interpolate.References(query)
+	kinds := placeholderKinds(query, refs)
+	var b strings.Builder
+	last := 0
+	for i, ref := range refs {
+		kind := kinds[i]
+		switch {
+		case slices.Contains(builtinNumberVariables, ref.Name):
+			kind = placeholderNumber
+		case slices.Contains(builtinDurationVariables, ref.Name):
+			kind = placeholderDuration
+		case strings.HasPrefix(ref.Name, "__"):
+			// Unknown built-in variables are left to the datasource.
+			continue
+		}
+		b.WriteString(query[last:ref.Start])
+		b.WriteString(placeholder(ref.Name, kind))
+		last = ref.End
+	}
+	b.WriteString(query[last:])
+	return b.String(), strings.NewReplacer(restorations...)
+}
+
+// placeholderKind is the kind of value a template variable is replaced with
+// before parsing.
+type placeholderKind int
+
+const (
+	// placeholderName is used for metric and label names, and wherever an
+	// expression is expected.
+	placeholderName placeholderKind = iota
+	// placeholderDuration is used in range selectors, subqueries and offsets.
+	placeholderDuration
+	// placeholderNumber is used for scalar arguments, such as the k of topk,
+	// and after @.
+	placeholderNumber
+)
+
+var (
+	// groupingKeywords are the keywords followed by a list of label names.
+	groupingKeywords = []string{"by", "without", "on", "ignoring", "group_left", "group_right"}
+
+	// scalarParamAggregations are the aggregations whose first argument is
+	// a scalar.
+	scalarParamAggregations = []string{"topk", "bottomk", "quantile", "limitk", "limit_ratio"}
+)
+
+// placeholderKinds returns the kind of placeholder for each variable
+// reference in query, from the brackets enclosing it and the keyword before
+// it. References in strings and comments can be replaced with any value.
+func placeholderKinds(query string, refs []interpolate.Reference) []placeholderKind {
+	type bracket struct {
+		char     byte
+		grouping bool
+		// call is the function or aggregation the parentheses hold the
+		// arguments of, and arg the index of the current argument.
+		call string
+		arg  int
+	}
+	var (
+		stack   []bracket
+		quote   byte
+		escaped bool
+		comment bool
+		kinds   = make([]placeholderKind, 0, len(refs))
+		// groupingEnd is the offset after the last grouping clause, and
+		// groupingOf its aggregation, whose arguments may follow it as in
+		// `topk by (job) (5, x)`.
+		groupingEnd int
+		groupingOf  string
+	)
+	kindAt := func(i int) placeholderKind {
+		if quote != 0 || comment {
+			return placeholderName
+		}
+		var top bracket
+		if len(stack) > 0 {
+			top = stack[len(stack)-1]
+		}
+		before := strings.TrimRightFunc(query[:i], unicode.IsSpace)
+		switch {
+		case top.char == '[', strings.EqualFold(previousWord(before), "offset"):
+			return placeholderDuration
+		case strings.HasSuffix(before, "@"):
+			return placeholderNumber
+		case top.char == '(' && !top.grouping && scalarArgument(top.call, top.arg):
+			return placeholderNumber
+		}
+		return placeholderName
+	}
+	for i := 0; i < len(query); i++ {
+		if len(kinds) < len(refs) && i == refs[len(kinds)].Start {
+			kinds = append(kinds, kindAt(i))
+			i = refs[len(kinds)-1].End - 1
+			escaped = false
+			continue
+		}
+		c := query[i]
+		switch {
+		case escaped:
+			escaped = false
+		case comment:
+			comment = c != '\n'
+		case quote != 0:
+			if c == '\\' && quote != '`' {
+				escaped = true
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '#':
+			comment = true
+		case c == '"', c == '\'', c == '`':
+			quote = c
+		case c == '(':
+			before := strings.TrimRightFunc(query[:i], unicode.IsSpace)
+			word := strings.ToLower(previousWord(before))
+			b := bracket{char: c, call: word}
+			switch {
+			case slices.Contains(groupingKeywords, word):
+				b.grouping = true
+				b.call = strings.ToLower(previousWord(strings.TrimRightFunc(before[:len(before)-len(word)], unicode.IsSpace)))
+			case word == "" && groupingOf != "" && strings.TrimSpace(query[groupingEnd:i]) == "":
+				b.call = groupingOf
+			}
+			stack = append(stack, b)
+		case c == '[', c == '{':
+			stack = append(stack, bracket{char: c})
+		case c == ')', c == ']', c == '}':
+			if len(stack) > 0 {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				if top.grouping {
+					groupingEnd, groupingOf = i+1, top.call
+				}
+			}
+		case c == ',':
+			if len(stack) > 0 {
+				stack[len(stack)-1].arg++
+			}
+		}
+	}
+	return kinds
+}
+
+// previousWord returns the identifier or keyword at the end of s.
+func previousWord(s string) string {
+	i := strings.LastIndexFunc(s, func(r rune) bool {
+		return r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return s[i+1:]
+}
+
+// scalarArgument reports whether an argument of a function or aggregation is
+// a scalar.
+func scalarArgument(call string, arg int) bool {
+	if slices.Contains(scalarParamAggregations, call) {
+		return arg == 0
+	}
+	f, ok := parser.Functions[call]
+	if !ok || len(f.ArgTypes) == 0 {
+		return false
+	}
+	return f.ArgTypes[min(arg, len(f.ArgTypes)-1)] == parser.ValueTypeScalar
+}
+
+// promQLErrors converts the errors of the parser, which reports positions as
+// byte offsets, to errors with line and column numbers.
+func promQLErrors(query string, err error) []promQLError {
+	var parseErrs parser.ParseErrors
+	if !errors.As(err, &parseErrs) {
+		return []promQLError{{Message: err.Error(), Line: 1, Column: 1}}
+	}
+	result := make([]promQLError, 0, len(parseErrs))
+	for _, e := range parseErrs {
+		start, end := int(e.PositionRange.Start), int(e.PositionRange.End)
+		start = min(max(start, 0), len(query))
+		before := query[:start]
+		line := strings.Count(before, "\n") + 1
+		column := start - strings.LastIndex(before, "\n")
+		message := e.Err.Error()
+		if strings.Contains(message, "expected type range vector") {
+			message += ". Add a range selector such as [5m] or [$__rate_interval] to the series"
+		}
+		result = append(result, promQLError{Message: message, Start: start, End: end, Line: line, Column: column})
+	}
+	return result
+}
+
+// describePromQL adds the metrics, selectors, functions and aggregations of
+// an expression to the result.
+func describePromQL(expr parser.Expr, restore *strings.Replacer, result *promQLValidation) {
+	parser.Inspect(expr, func(node parser.Node, ancestors []parser.Node) error {
+		switch n := node.(type) {
+		case *parser.VectorSelector:
+			metric := restore.Replace(n.Name)
+			selector := promQLSelector{Metric: metric, Matchers: []string{}}
+			for _, m := range n.LabelMatchers {
+				if m.Name == labels.MetricName && m.Type == labels.MatchEqual && m.Value == n.Name {
+					continue
+				}
+				selector.Matchers = append(selector.Matchers, restore.Replace(m.String()))
+			}
+			if len(ancestors) > 0 {
+				if ms, ok := ancestors[len(ancestors)-1].(*parser.MatrixSelector); ok {
+					selector.Range = restore.Replace(model.Duration(ms.Range).String())
+				}
+			}
+			if n.OriginalOffset != 0 {
+				selector.Offset = restore.Replace(model.Duration(n.OriginalOffset).String())
+			}
+			result.Selectors = append(result.Selectors, selector)
+			if metric != "" && !slices.Contains(result.Metrics, metric) {
+				result.Metrics = append(result.Metrics, metric)
+			}
+		case *parser.Call:
+			if !slices.Contains(result.Functions, n.Func.Name) {
+				result.Functions = append(result.Functions, n.Func.Name)
+			}
+		case *parser.AggregateExpr:
+			aggregation := promQLAggregation{Op: n.Op.String(), Without: n.Without}
+			for _, label := range n.Grouping {
+				aggregation.Grouping = append(aggregation.Grouping, restore.Replace(label))
+			}
+			if n.Param != nil {
+				aggregation.Param = restore.Replace(n.Param.String())
+			}
+			for _, a := range ancestors {
+				if _, ok := a.(*parser.AggregateExpr); ok {
+					aggregation.Depth++
+				}
+			}
+			result.Aggregations = append(result.Aggregations, aggregation)
+		}
+		return nil
+	})
+}
+
+// prometheusMetricTypes returns the types of the metrics in the metadata of
+// a datasource. The metadata of classic histograms and summaries is stored
+// under their base name, so it is looked up for their series too.
+func prometheusMetricTypes(ctx context.Context, datasourceUID string, metrics []string) (map[string]promv1.MetricType, error) {
+	types := map[string]promv1.MetricType{}
+	for _, metric := range metrics {
+		if strings.Contains(metric, "$") {
+			// Metric names given by variables can't be looked up.
+			continue
+		}
+		for _, name := range []string{metric, trimHistogramSuffix(metric)} {
+			if _, ok := types[name]; ok {
+				continue
+			}
+			metadata, err := listPrometheusMetricMetadata(ctx, ListPrometheusMetricMetadataParams{
+				DatasourceUID: datasourceUID,
+				Metric:        name,
+				Limit:         1,
+			})
+			if err != nil {
+				return nil, err
+			}
+			if md := metadata[name]; len(md) > 0 {
+				types[name] = md[0].Type
+			} else {
+				types[name] = promv1.MetricTypeUnknown
+			}
+		}
+	}
+	return types, nil
+}
+
+func trimHistogramSuffix(metric string) string {
+	for _, suffix := range histogramSeriesSuffixes {
+		if base, ok := strings.CutSuffix(metric, suffix); ok {
+			return base
+		}
+	}
+	return metric
+}
+
+// metricKind returns whether a metric is a counter or a gauge, or "" if it
+// isn't known. Without metadata, metrics ending in _total are taken to be
+// counters.
+func metricKind(metric string, types map[string]promv1.MetricType) promv1.MetricType {
+	switch types[metric] {
+	case promv1.MetricTypeCounter:
+		return promv1.MetricTypeCounter
+	case promv1.MetricTypeGauge:
+		return promv1.MetricTypeGauge
+	}
+	if base := trimHistogramSuffix(metric); base != metric {
+		switch types[base] {
+		case promv1.MetricTypeHistogram, promv1.MetricTypeSummary:
+			return promv1.MetricTypeCounter
+		case promv1.MetricTypeGaugeHistogram:
+			return promv1.MetricTypeGauge
+		}
+	}
+	if t := types[metric]; strings.HasSuffix(metric, "_total") && (t == "" || t == promv1.MetricTypeUnknown) {
+		return promv1.MetricTypeCounter
+	}
+	return ""
+}
+
+// promQLWarnings checks an expression for common mistakes. types holds the
+// metric types from metadata, and may be nil.
+func promQLWarnings(expr parser.Expr, types map[string]promv1.MetricType) []string {
+	warnings := []string{}
+	warn := func(format string, args ...any) {
+		if message := fmt.Sprintf(format, args...); !slices.Contains(warnings, message) {
+			warnings = append(warnings, message)
+		}
+	}
+
+	parser.Inspect(expr, func(node parser.Node, ancestors []parser.Node) error {
+		switch n := node.(type) {
+		case *parser.Call:
+			name := n.Func.Name
+			if name == "histogram_quantile" && len(n.Args) == 2 {
+				if agg, ok := unwrapParens(n.Args[1]).(*parser.AggregateExpr); ok && dropsLabel(agg, labels.BucketLabel) {
+					warn("histogram_quantile() needs the %q label, but the %s aggregation drops it. Add %q to its by clause.", labels.BucketLabel, agg.Op, labels.BucketLabel)
+				}
+			}
+			if !slices.Contains(counterFunctions, name) && !slices.Contains(gaugeFunctions, name) {
+				return nil
+			}
+			for _, metric := range callMetrics(n) {
+				switch kind := metricKind(metric, types); {
+				case kind == promv1.MetricTypeGauge && slices.Contains(counterFunctions, name):
+					warn("%s() is meant for counters, but %s is a gauge. Use delta(), deriv() or an *_over_time() function instead.", name, metric)
+				case kind == promv1.MetricTypeCounter && slices.Contains(gaugeFunctions, name):
+					warn("%s() is meant for gauges, but %s is a counter, whose resets it ignores. Use rate() or increase() instead.", name, metric)
+				}
+			}
+		case *parser.VectorSelector:
+			if n.Name == "" || metricKind(n.Name, types) != promv1.MetricTypeCounter || inRangeOrSafe(ancestors) {
+				return nil
+			}
+			warn("%s is a counter, whose raw value only ever grows. Use rate() or increase() to get its change over time.", n.Name)
+		}
+		return nil
+	})
+	return warnings
+}
+
+// callMetrics returns the metrics selected by the range vector argument of a
+// function call.
+func callMetrics(call *parser.Call) []string {
+	var metrics []string
+	for _, arg := range call.Args {
+		if ms, ok := unwrapParens(arg).(*parser.MatrixSelector); ok {
+			if vs, ok := ms.VectorSelector.(*parser.VectorSelector); ok && vs.Name != "" {
+				metrics = append(metrics, vs.Name)
+			}
+		}
+	}
+	return metrics
+}
+
+// inRangeOrSafe reports whether a selector is used as a range vector or
+// within an operation that doesn't depend on its value.
+func inRangeOrSafe(ancestors []parser.Node) bool {
+	for _, a := range ancestors {
+		switch a := a.(type) {
+		case *parser.MatrixSelector, *parser.SubqueryExpr:
+			return true
+		case *parser.Call:
+			if slices.Contains(counterSafeOperations, a.Func.Name) {
+				return true
+			}
+		case *parser.AggregateExpr:
+			if slices.Contains(counterSafeOperations, a.Op.String()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// dropsLabel reports whether an aggregation removes a label from its
+// result.
+func dropsLabel(agg *parser.AggregateExpr, label string) bool {
+	if agg.Without {
+		return slices.Contains(agg.Grouping, label)
+	}
+	return !slices.Contains(agg.Grouping, label)
+}
+
+func unwrapParens(expr parser.Expr) parser.Expr {
+	for {
+		paren, ok := expr.(*parser.ParenExpr)
+		if !ok {
+			return expr
+		}
+		expr = paren.Expr
+	}
+}
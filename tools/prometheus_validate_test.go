@@ -0,0 +1,218 @@
+//go:build unit
+// +build unit
+
+package tools
+
+import (
+	"context"
+	"testing"
+
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"mcp-grafana-local/internal/interpolate"
+)
+
+func TestValidatePromQL(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("valid expression", func(t *testing.T) {
+		result, err := validatePromQL(ctx, ValidatePromQLParams{
+			Expr: `sum by (job) (rate(http_requests_total{job="api", code=~"5.."}[5m] offset 1h)) / ignoring(code) sum by (job) (rate(http_requests_total{job="api"}[5m]))`,
+		})
+		require.NoError(t, err)
+		assert.True(t, result.Valid)
+		assert.Empty(t, result.Errors)
+		assert.Empty(t, result.ParsedExpr)
+		assert.Equal(t, "vector", result.Type)
+		assert.Equal(t, []string{"http_requests_total"}, result.Metrics)
+		assert.Equal(t, []string{"rate"}, result.Functions)
+		assert.Equal(t, []promQLSelector{
+			{Metric: "http_requests_total", Matchers: []string{`job="api"`, `code=~"5.."`}, Range: "5m", Offset: "1h"},
+			{Metric: "http_requests_total", Matchers: []string{`job="api"`}, Range: "5m"},
+		}, result.Selectors)
+		assert.Equal(t, []promQLAggregation{
+			{Op: "sum", Grouping: []string{"job"}},
+			{Op: "sum", Grouping: []string{"job"}},
+		}, result.Aggregations)
+		assert.Contains(t, result.Formatted, "sum by (job) (")
+		assert.Empty(t, result.Warnings)
+	})
+
+	t.Run("nested aggregations", func(t *testing.T) {
+		result, err := validatePromQL(ctx, ValidatePromQLParams{Expr: `topk(5, max without (instance) (up))`})
+		require.NoError(t, err)
+		assert.Equal(t, []promQLAggregation{
+			{Op: "topk", Param: "5"},
+			{Op: "max", Grouping: []string{"instance"}, Without: true, Depth: 1},
+		}, result.Aggregations)
+	})
+
+	t.Run("syntax error", func(t *testing.T) {
+		result, err := validatePromQL(ctx, ValidatePromQLParams{Expr: "sum(rate(up[5m])\n"})
+		require.NoError(t, err)
+		assert.False(t, result.Valid)
+		require.NotEmpty(t, result.Errors)
+		assert.Equal(t, 2, result.Errors[0].Line)
+		assert.Empty(t, result.Formatted)
+	})
+
+	t.Run("missing range selector", func(t *testing.T) {
+		result, err := validatePromQL(ctx, ValidatePromQLParams{Expr: "rate(http_requests_total)"})
+		require.NoError(t, err)
+		assert.False(t, result.Valid)
+		require.Len(t, result.Errors, 1)
+		assert.Contains(t, result.Errors[0].Message, "Add a range selector")
+		assert.Equal(t, 1, result.Errors[0].Line)
+		assert.Equal(t, 6, result.Errors[0].Column)
+	})
+
+	t.Run("template variables", func(t *testing.T) {
+		result, err := validatePromQL(ctx, ValidatePromQLParams{
+			Expr: `sum by (instance) (rate(node_cpu_seconds_total{job="$job", mode!="idle"}[$__rate_interval])) > $__interval_ms`,
+		})
+		require.NoError(t, err)
+		assert.True(t, result.Valid)
+		assert.NotEmpty(t, result.ParsedExpr)
+		assert.Contains(t, result.Formatted, `job="$job"`)
+		assert.Contains(t, result.Formatted, `[$__rate_interval]`)
+		assert.Contains(t, result.Formatted, `$__interval_ms`)
+		assert.Equal(t, "$__rate_interval", result.Selectors[0].Range)
+		assert.Equal(t, []string{`job="$job"`, `mode!="idle"`}, result.Selectors[0].Matchers)
+	})
+
+	t.Run("template variables by position", func(t *testing.T) {
+		result, err := validatePromQL(ctx, ValidatePromQLParams{Expr: `sum by ($label) (rate(http_requests_total{job="$job"}[$window]))`})
+		require.NoError(t, err)
+		require.True(t, result.Valid, result.Errors)
+		assert.Equal(t, []string{"$label"}, result.Aggregations[0].Grouping)
+		assert.Equal(t, "$window", result.Selectors[0].Range)
+		assert.Contains(t, result.Formatted, "sum by ($label)")
+
+		result, err = validatePromQL(ctx, ValidatePromQLParams{Expr: `${metric}{job="x"} offset $shift`})
+		require.NoError(t, err)
+		require.True(t, result.Valid, result.Errors)
+		assert.Equal(t, []string{"$metric"}, result.Metrics)
+		assert.Equal(t, []promQLSelector{{Metric: "$metric", Matchers: []string{`job="x"`}, Offset: "$shift"}}, result.Selectors)
+		assert.Equal(t, `$metric{job="x"} offset $shift`, result.Formatted)
+
+		result, err = validatePromQL(ctx, ValidatePromQLParams{Expr: `topk($n, round(rate(x_total[5m]), $precision))`})
+		require.NoError(t, err)
+		require.True(t, result.Valid, result.Errors)
+		assert.Equal(t, "$n", result.Aggregations[0].Param)
+		assert.Contains(t, result.Formatted, "$precision")
+
+		result, err = validatePromQL(ctx, ValidatePromQLParams{Expr: `topk by ($label) ($n, x)`})
+		require.NoError(t, err)
+		require.True(t, result.Valid, result.Errors)
+		assert.Equal(t, []promQLAggregation{{Op: "topk", Grouping: []string{"$label"}, Param: "$n"}}, result.Aggregations)
+	})
+
+	t.Run("empty expression", func(t *testing.T) {
+		_, err := validatePromQL(ctx, ValidatePromQLParams{Expr: " "})
+		assert.Error(t, err)
+	})
+}
+
+func TestPlaceholderKinds(t *testing.T) {
+	for _, tc := range []struct {
+		query string
+		kinds []placeholderKind
+	}{
+		{`sum by ($label) (x)`, []placeholderKind{placeholderName}},
+		{`${metric}{$label="$value"}`, []placeholderKind{placeholderName, placeholderName, placeholderName}},
+		{`topk($n, x)`, []placeholderKind{placeholderNumber}},
+		{`quantile without (i) ($q, x)`, []placeholderKind{placeholderNumber}},
+		{`rate(x[[[window]]] offset ${shift}) @ $at`, []placeholderKind{placeholderDuration, placeholderDuration, placeholderNumber}},
+		{`max_over_time(x[$range:$step])`, []placeholderKind{placeholderDuration, placeholderDuration}},
+		{`clamp_max(x, $max) > $threshold`, []placeholderKind{placeholderNumber, placeholderName}},
+		{"label_replace(x, \"dst\", \"$1\", \"src\", \"(.*)\") # $n\n/ $y", []placeholderKind{placeholderName, placeholderName}},
+	} {
+		query := tc.query
+		assert.Equal(t, tc.kinds, placeholderKinds(query, interpolate.References(query)), query)
+	}
+}
+
+func TestPromQLWarnings(t *testing.T) {
+	types := map[string]promv1.MetricType{
+		"node_memory_free_bytes": promv1.MetricTypeGauge,
+		"requests":               promv1.MetricTypeCounter,
+		"request_duration":       promv1.MetricTypeHistogram,
+		"odd_total":              promv1.MetricTypeGauge,
+	}
+
+	for _, tc := range []struct {
+		name     string
+		expr     string
+		types    map[string]promv1.MetricType
+		warnings []string
+	}{
+		{
+			name: "rate of gauge",
+			expr: "rate(node_memory_free_bytes[5m])",
+			warnings: []string{
+				"rate() is meant for counters, but node_memory_free_bytes is a gauge. Use delta(), deriv() or an *_over_time() function instead.",
+			},
+		},
+		{
+			name: "deriv of counter",
+			expr: "deriv(requests[5m])",
+			warnings: []string{
+				"deriv() is meant for gauges, but requests is a counter, whose resets it ignores. Use rate() or increase() instead.",
+			},
+		},
+		{
+			name: "raw counter",
+			expr: "sum(requests)",
+			warnings: []string{
+				"requests is a counter, whose raw value only ever grows. Use rate() or increase() to get its change over time.",
+			},
+		},
+		{
+			name:     "counter without metadata",
+			expr:     "http_requests_total",
+			types:    map[string]promv1.MetricType{},
+			warnings: []string{"http_requests_total is a counter, whose raw value only ever grows. Use rate() or increase() to get its change over time."},
+		},
+		{
+			name:     "gauge named like a counter",
+			expr:     "odd_total",
+			warnings: []string{},
+		},
+		{
+			name:     "counting counters",
+			expr:     "count(requests) + absent(requests)",
+			warnings: []string{},
+		},
+		{
+			name: "histogram quantile without le",
+			expr: "histogram_quantile(0.99, sum by (job) (rate(request_duration_bucket[5m])))",
+			warnings: []string{
+				`histogram_quantile() needs the "le" label, but the sum aggregation drops it. Add "le" to its by clause.`,
+			},
+		},
+		{
+			name:     "histogram quantile",
+			expr:     "histogram_quantile(0.99, sum by (job, le) (rate(request_duration_bucket[5m])))",
+			warnings: []string{},
+		},
+		{
+			name: "raw histogram buckets",
+			expr: "request_duration_bucket",
+			warnings: []string{
+				"request_duration_bucket is a counter, whose raw value only ever grows. Use rate() or increase() to get its change over time.",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			expr, err := parser.ParseExpr(tc.expr)
+			require.NoError(t, err)
+			if tc.types == nil {
+				tc.types = types
+			}
+			assert.Equal(t, tc.warnings, promQLWarnings(expr, tc.types))
+		})
+	}
+}
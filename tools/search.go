@@ -12,29 +12,125 @@ import (
 	mcpgrafana "mcp-grafana-local"
 )
 
-var dashboardTypeStr = "dash-db"
+const (
+	searchTypeDashboard = "dash-db"
+	searchTypeFolder    = "dash-folder"
+
+	// DefaultSearchLimit is the default number of results per page.
+	DefaultSearchLimit = 50
+	// maxSearchLimit is the largest page size Grafana accepts.
+	maxSearchLimit = 5000
+)
 
 type SearchDashboardsParams struct {
-	Query string `json:"query" jsonschema:"description=The query to search for"`
+	Query         string   `json:"query,omitempty" jsonschema:"description=The query to search for in titles"`
+	Tags          []string `json:"tags,omitempty" jsonschema:"description=Only return results with all of these tags"`
+	FolderUIDs    []string `json:"folderUids,omitempty" jsonschema:"description=Only return results in these folders. Use 'general' for the root folder"`
+	Type          string   `json:"type,omitempty" jsonschema:"description=Either 'dash-db' to search dashboards (default) or 'dash-folder' to search folders"`
+	Starred       bool     `json:"starred,omitempty" jsonschema:"description=Only return dashboards starred by the current user"`
+	DashboardUIDs []string `json:"dashboardUids,omitempty" jsonschema:"description=Only return the dashboards with these UIDs"`
+	Limit         int      `json:"limit,omitempty" jsonschema:"description=The maximum number of results per page (default 50\\, at most 5000)"`
+	Page          int      `json:"page,omitempty" jsonschema:"description=The page of results to return\\, starting at 1"`
+}
+
+func (p SearchDashboardsParams) validate() error {
+	if p.Type != "" && p.Type != searchTypeDashboard && p.Type != searchTypeFolder {
+		return fmt.Errorf("invalid type %q, must be %q or %q", p.Type, searchTypeDashboard, searchTypeFolder)
+	}
+	if p.Limit < 0 || p.Limit > maxSearchLimit {
+		return fmt.Errorf("limit must be between 0 and %d (0 for the default)", maxSearchLimit)
+	}
+	if p.Page < 0 {
+		return fmt.Errorf("page must be positive")
+	}
+	return nil
+}
+
+// searchHit is the compact form of a search result.
+type searchHit struct {
+	UID         string   `json:"uid"`
+	Title       string   `json:"title"`
+	Type        string   `json:"type"`
+	URL         string   `json:"url"`
+	FolderUID   string   `json:"folderUid,omitempty"`
+	FolderTitle string   `json:"folderTitle,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Starred     bool     `json:"starred,omitempty"`
 }
 
-func searchDashboards(ctx context.Context, args SearchDashboardsParams) (models.HitList, error) {
+type searchResult struct {
+	Hits  []searchHit `json:"hits"`
+	Page  int         `json:"page"`
+	Limit int         `json:"limit"`
+	// HasMore is set if the page is full, so the next page may have more
+	// results.
+	HasMore bool `json:"hasMore"`
+}
+
+func searchDashboards(ctx context.Context, args SearchDashboardsParams) (*searchResult, error) {
+	if err := args.validate(); err != nil {
+		return nil, err
+	}
+	searchType := args.Type
+	if searchType == "" {
+		searchType = searchTypeDashboard
+	}
+	limit := int64(args.Limit)
+	if limit == 0 {
+		limit = DefaultSearchLimit
+	}
+	page := int64(args.Page)
+	if page == 0 {
+		page = 1
+	}
+
 	c := mcpgrafana.GrafanaClientFromContext(ctx)
-	params := search.NewSearchParamsWithContext(ctx)
+	params := search.NewSearchParamsWithContext(ctx).
+		WithType(&searchType).
+		WithLimit(&limit).
+		WithPage(&page).
+		WithTag(args.Tags).
+		WithFolderUIDs(args.FolderUIDs).
+		WithDashboardUIDs(args.DashboardUIDs)
 	if args.Query != "" {
 		params.SetQuery(&args.Query)
-		params.SetType(&dashboardTypeStr)
 	}
-	search, err := c.Search.Search(params)
+	if args.Starred {
+		params.SetStarred(&args.Starred)
+	}
+	resp, err := c.Search.Search(params)
 	if err != nil {
-		return nil, fmt.Errorf("search dashboards for %+v: %w", c, err)
+		return nil, fmt.Errorf("search dashboards for %+v: %w", args, err)
+	}
+
+	result := &searchResult{
+		Hits:    make([]searchHit, 0, len(resp.Payload)),
+		Page:    int(page),
+		Limit:   int(limit),
+		HasMore: int64(len(resp.Payload)) >= limit,
+	}
+	for _, hit := range resp.Payload {
+		result.Hits = append(result.Hits, newSearchHit(hit))
+	}
+	return result, nil
+}
+
+func newSearchHit(hit *models.Hit) searchHit {
+	return searchHit{
+		UID:         hit.UID,
+		Title:       hit.Title,
+		Type:        string(hit.Type),
+		URL:         hit.URL,
+		FolderUID:   hit.FolderUID,
+		FolderTitle: hit.FolderTitle,
+		Tags:        hit.Tags,
+		Starred:     hit.IsStarred,
 	}
-	return search.Payload, nil
 }
 
 var SearchDashboards = mcpgrafana.MustTool(
 	"search_dashboards",
-	"Search for Grafana dashboards by a query string. Returns a list of matching dashboards with details like title, UID, folder, tags, and URL.",
+	"Search for Grafana dashboards, or folders with type 'dash-folder'. Results can be filtered by a query string matched against titles, tags (all of which must match), folder UIDs, dashboard UIDs and whether they are starred. Returns a page of results with the UID, title, type, URL, folder and tags of each, and hasMore if there may be another page. Results are paginated with limit (default 50) and page, starting at 1.",
 	searchDashboards,
 	mcp.WithTitleAnnotation("Search dashboards"),
 	mcp.WithIdempotentHintAnnotation(true),
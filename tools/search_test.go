@@ -8,7 +8,6 @@ package tools
 import (
 	"testing"
 
-	"github.com/grafana/grafana-openapi-client-go/models"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -20,7 +19,52 @@ func TestSearchTools(t *testing.T) {
 			Query: "Demo",
 		})
 		require.NoError(t, err)
-		assert.Len(t, result, 1)
-		assert.Equal(t, models.HitType("dash-db"), result[0].Type)
+		require.Len(t, result.Hits, 1)
+		assert.Equal(t, "dash-db", result.Hits[0].Type)
+		assert.NotEmpty(t, result.Hits[0].UID)
+		assert.False(t, result.HasMore)
+	})
+
+	t.Run("search dashboards by uid", func(t *testing.T) {
+		ctx := newTestContext()
+		demo, err := searchDashboards(ctx, SearchDashboardsParams{Query: "Demo"})
+		require.NoError(t, err)
+		require.NotEmpty(t, demo.Hits)
+
+		result, err := searchDashboards(ctx, SearchDashboardsParams{
+			DashboardUIDs: []string{demo.Hits[0].UID},
+		})
+		require.NoError(t, err)
+		require.Len(t, result.Hits, 1)
+		assert.Equal(t, demo.Hits[0].Title, result.Hits[0].Title)
+	})
+
+	t.Run("search dashboards with pagination", func(t *testing.T) {
+		ctx := newTestContext()
+		result, err := searchDashboards(ctx, SearchDashboardsParams{Limit: 1})
+		require.NoError(t, err)
+		require.Len(t, result.Hits, 1)
+		assert.True(t, result.HasMore)
+
+		next, err := searchDashboards(ctx, SearchDashboardsParams{Limit: 1, Page: 2})
+		require.NoError(t, err)
+		for _, hit := range next.Hits {
+			assert.NotEqual(t, result.Hits[0].UID, hit.UID)
+		}
+	})
+
+	t.Run("search folders", func(t *testing.T) {
+		ctx := newTestContext()
+		result, err := searchDashboards(ctx, SearchDashboardsParams{Type: "dash-folder"})
+		require.NoError(t, err)
+		for _, hit := range result.Hits {
+			assert.Equal(t, "dash-folder", hit.Type)
+		}
+	})
+
+	t.Run("search dashboards - invalid type", func(t *testing.T) {
+		ctx := newTestContext()
+		_, err := searchDashboards(ctx, SearchDashboardsParams{Type: "dashboard"})
+		require.Error(t, err)
 	})
 }
@@ -0,0 +1,46 @@
+package tools
+
+import (
+	"fmt"
+
+	"mcp-grafana-local/internal/interpolate"
+)
+
+type UnresolvedVariablesError struct {
+	Missing []string
+}
+
+func (e *UnresolvedVariablesError) Error() string {
+	return fmt.Sprintf("unresolved variables in query: %v, please prompt user to provide variable values and resolve them", e.Missing)
+}
+
+// interpolateQuery replaces the template variables in query. As in Grafana,
+// references to variables without a value are left in place for the
+// datasource to handle, since they may be part of the query language, like
+// the `$1` of label_replace.
+func interpolateQuery(query string, opts interpolate.Options) (string, error) {
+	result, _, err := interpolate.Interpolate(query, opts)
+	if err != nil {
+		return "", fmt.Errorf("interpolating variables: %w", err)
+	}
+	return result, nil
+}
+
+// interpolateValue replaces the template variables in a value that can't be
+// used with references left in it, such as a datasource UID or an interval.
+// It returns an UnresolvedVariablesError if any referenced variable has no
+// value.
+func interpolateValue(value string, opts interpolate.Options) (string, error) {
+	result, unresolved, err := interpolate.Interpolate(value, opts)
+	if err != nil {
+		return "", fmt.Errorf("interpolating variables: %w", err)
+	}
+	if len(unresolved) > 0 {
+		missing := make([]string, 0, len(unresolved))
+		for _, name := range unresolved {
+			missing = append(missing, "$"+name)
+		}
+		return "", &UnresolvedVariablesError{Missing: missing}
+	}
+	return result, nil
+}
@@ -6,6 +6,7 @@ package mcpgrafana
 import (
 	"context"
 	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/mark3labs/mcp-go/mcp"
@@ -536,6 +537,37 @@ func TestConvertTool(t *testing.T) {
 	})
 }
 
+type testStructuredError struct {
+	Reason string `json:"reason"`
+}
+
+func (e *testStructuredError) Error() string { return "rejected: " + e.Reason }
+
+func (e *testStructuredError) ErrorDetails() any { return e }
+
+func TestConvertToolStructuredError(t *testing.T) {
+	_, handler, err := ConvertTool("test_tool", "A test tool", func(ctx context.Context, params testToolParams) (string, error) {
+		if params.Name == "structured" {
+			return "", fmt.Errorf("run: %w", &testStructuredError{Reason: "too broad"})
+		}
+		return "", errors.New("test error")
+	})
+	require.NoError(t, err)
+
+	request := mcp.CallToolRequest{}
+	request.Params.Arguments = map[string]any{"name": "structured", "value": 1}
+	result, err := handler(context.Background(), request)
+	require.NoError(t, err)
+	assert.True(t, result.IsError)
+	require.Len(t, result.Content, 1)
+	assert.JSONEq(t, `{"reason": "too broad"}`, result.Content[0].(mcp.TextContent).Text)
+
+	// Other errors are still returned as errors.
+	request.Params.Arguments = map[string]any{"name": "other", "value": 1}
+	_, err = handler(context.Background(), request)
+	assert.EqualError(t, err, "test error")
+}
+
 func TestCreateJSONSchemaFromHandler(t *testing.T) {
 	schema := createJSONSchemaFromHandler(testToolHandler)
 